@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// benchStage is what a stage of the pipeline took, summed over the runs of
+// bench
+type benchStage struct {
+	Name    string        `json:"name"`
+	Wall    time.Duration `json:"wall_ns"`
+	MinWall time.Duration `json:"min_wall_ns"` // Of a single run
+	CPU     time.Duration `json:"cpu_ns"`      // Of the process and the tools it ran
+	Bytes   uint64        `json:"alloc_bytes"`
+	Allocs  uint64        `json:"allocs"`
+}
+
+// benchReport is what --report writes, per run on average
+type benchReport struct {
+	Runs   int          `json:"runs"`
+	Pages  int          `json:"pages"`
+	Jobs   int          `json:"jobs"`
+	Stages []benchStage `json:"stages"`
+}
+
+// benchRecorder measures the stages of the builds of bench
+type benchRecorder struct {
+	stages []benchStage
+	runs   int
+	pages  int
+
+	current       int // Index in stages of the stage running, -1 for none
+	start         time.Time
+	cpu           time.Duration
+	bytes, allocs uint64
+	runWall       []time.Duration // Wall time of each stage in this run
+}
+
+// stage ends the stage running, if any, and starts the one called name.
+// It does nothing on a nil recorder, outside bench.
+func (b *benchRecorder) stage(name string) {
+	if b == nil {
+		return
+	}
+	b.end()
+	b.current = slices.IndexFunc(b.stages, func(s benchStage) bool { return s.Name == name })
+	if b.current < 0 {
+		b.stages = append(b.stages, benchStage{Name: name})
+		b.current = len(b.stages) - 1
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	b.bytes, b.allocs = mem.TotalAlloc, mem.Mallocs
+	b.cpu = cpuTime()
+	b.start = time.Now()
+}
+
+// end adds what the stage running took, if any
+func (b *benchRecorder) end() {
+	if b.current < 0 {
+		return
+	}
+	wall := time.Since(b.start)
+	cpu := cpuTime() - b.cpu
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s := &b.stages[b.current]
+	s.Wall += wall
+	s.CPU += cpu
+	s.Bytes += mem.TotalAlloc - b.bytes
+	s.Allocs += mem.Mallocs - b.allocs
+	for len(b.runWall) <= b.current {
+		b.runWall = append(b.runWall, 0)
+	}
+	b.runWall[b.current] += wall
+	b.current = -1
+}
+
+// finish ends the last stage of a run
+func (b *benchRecorder) finish() {
+	b.end()
+	for i, wall := range b.runWall {
+		if b.runs == 0 || wall < b.stages[i].MinWall {
+			b.stages[i].MinWall = wall
+		}
+	}
+	b.runWall = b.runWall[:0]
+	b.runs++
+}
+
+// report returns the measurements per run on average
+func (b *benchRecorder) report(jobs int) benchReport {
+	r := benchReport{Runs: b.runs, Pages: b.pages, Jobs: jobs}
+	n := max(b.runs, 1)
+	for _, s := range b.stages {
+		s.Wall /= time.Duration(n)
+		s.CPU /= time.Duration(n)
+		s.Bytes /= uint64(n)
+		s.Allocs /= uint64(n)
+		r.Stages = append(r.Stages, s)
+	}
+	return r
+}
+
+// print writes r as a table
+func (r benchReport) print(w io.Writer) {
+	fmt.Fprintf(w, "%d pages, %d jobs, average of %d runs\n\n", r.Pages, r.Jobs, r.Runs)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "stage\twall\tmin wall\tcpu\tallocated\tallocs\t")
+	var total benchStage
+	for _, s := range r.Stages {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t\n", s.Name, round(s.Wall), round(s.MinWall), round(s.CPU), formatSize(int64(s.Bytes)), s.Allocs)
+		total.Wall += s.Wall
+		total.MinWall += s.MinWall
+		total.CPU += s.CPU
+		total.Bytes += s.Bytes
+		total.Allocs += s.Allocs
+	}
+	fmt.Fprintf(tw, "total\t%s\t%s\t%s\t%s\t%d\t\n", round(total.Wall), round(total.MinWall), round(total.CPU), formatSize(int64(total.Bytes)), total.Allocs)
+	tw.Flush()
+}
+
+// round rounds d for reading
+func round(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// runBench processes the pages of --input as build does, --runs times
+// without rendering them, and prints the wall time, CPU time and
+// allocations of each stage, so that changes to the pipeline can be
+// measured. The page cache is bypassed unless --cached.
+func runBench(o *options) error {
+	if o.benchRuns < 1 {
+		return fmt.Errorf("invalid --runs %d", o.benchRuns)
+	}
+	// Only the combined HTML is written, no engine is needed
+	o.format, o.watch, o.dryRun = "html", false, false
+	if !o.benchCached {
+		o.force = true
+	}
+	if o.cpuProfile != "" {
+		f, err := os.Create(o.cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return fmt.Errorf("error starting the CPU profile: %w", err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	b := &benchRecorder{current: -1}
+	o.bench = b
+	for run := 1; run <= o.benchRuns; run++ {
+		slog.Info("Benchmark run", "run", run, "of", o.benchRuns)
+		o.pageErrors = nil
+		if err := buildOnce(o); err != nil {
+			return err
+		}
+		b.finish()
+	}
+
+	if o.memProfile != "" {
+		runtime.GC()
+		err := writeFile(o.memProfile, pprof.WriteHeapProfile)
+		if err != nil {
+			return fmt.Errorf("error writing the heap profile: %w", err)
+		}
+	}
+	jobs := o.jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	report := b.report(jobs)
+	report.print(o.stdout)
+	if o.benchReport == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(o.benchReport, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing --report: %w", err)
+	}
+	slog.Info("Wrote benchmark report", "file", o.benchReport)
+	return nil
+}
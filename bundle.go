@@ -0,0 +1,255 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"i2pdoc2pdf/fetcher"
+	"i2pdoc2pdf/htmlproc"
+)
+
+// bundleManifest is the list of pages manifest.json gives in a --bundle
+type bundleManifest struct {
+	Title    string       `json:"title"`
+	Date     string       `json:"date"`
+	Revision string       `json:"revision,omitempty"`
+	Tool     string       `json:"tool"`
+	Files    []string     `json:"files"`
+	Pages    []bundlePage `json:"pages"`
+}
+
+// bundlePage is a page of the document in the manifest of a --bundle
+type bundlePage struct {
+	Path   string `json:"path"`
+	Title  string `json:"title"`
+	Number string `json:"number,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// bundleEntry is a file put in a --bundle, under name: the file at path, or
+// data if path is empty
+type bundleEntry struct {
+	name string
+	path string
+	data []byte
+}
+
+// open returns the content of e
+func (e bundleEntry) open() (io.ReadCloser, error) {
+	if e.path == "" {
+		return io.NopCloser(bytes.NewReader(e.data)), nil
+	}
+	return os.Open(e.path)
+}
+
+// licensePattern matches the license files of a repository
+var licensePattern = regexp.MustCompile(`(?i)^(licen[cs]e|copying|notice)([.-].*)?$`)
+
+// unsafeVersion matches what doesn't belong in the version of a file name
+var unsafeVersion = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// bundleFile returns where the --bundle archive is written: next to
+// --output, named after it and the version of the docs
+func (o *options) bundleFile() string {
+	ext := ".zip"
+	if o.bundle == "tar" {
+		ext = ".tar.gz"
+	}
+	return filepath.Join(filepath.Dir(o.outputFile), o.bundleName()+ext)
+}
+
+// bundleName returns the name of the archive and of the directory in it,
+// e.g. "i2p-documentation-1a2b3c4": --output followed by the pinned --ref,
+// or the commit of the docs, or the build date
+func (o *options) bundleName() string {
+	version := o.buildDate().UTC().Format("20060102")
+	if o.revision() != "" {
+		if o.repo.Ref != "" {
+			version = o.repo.Ref
+		} else if commit, err := fetcher.HeadCommit(o.repo.CloneDir); err == nil {
+			version = commit
+		}
+	}
+	version = strings.Trim(unsafeVersion.ReplaceAllString(version, "-"), "-")
+	return strings.TrimSuffix(filepath.Base(o.outputFile), filepath.Ext(o.outputFile)) + "-" + version
+}
+
+// writeBundle packages the outputs of the build, a manifest.json of the
+// pages, the license files of the docs and a SHA256SUMS of it all into a
+// single archive for distribution, see bundleFile. The files keep their
+// paths relative to the directory of --output, below a directory named
+// after the archive.
+func (o *options) writeBundle(stats buildStats, tree *htmlproc.Node) error {
+	var entries []bundleEntry
+	base := filepath.Dir(o.outputFile)
+	for _, file := range o.outputs() {
+		rel, err := filepath.Rel(base, file)
+		if err != nil || !filepath.IsLocal(rel) {
+			rel = filepath.Base(file)
+		}
+		entries = append(entries, bundleEntry{name: filepath.ToSlash(rel), path: file})
+	}
+
+	licenses, err := o.licenseFiles()
+	if err != nil {
+		return err
+	}
+	for _, file := range licenses {
+		entries = append(entries, bundleEntry{name: filepath.Base(file), path: file})
+	}
+
+	manifest := bundleManifest{
+		Title:    o.title,
+		Date:     stats.Date,
+		Revision: stats.Revision,
+		Tool:     "i2pdoc2pdf " + version,
+		Pages:    []bundlePage{},
+	}
+	for _, e := range entries {
+		manifest.Files = append(manifest.Files, e.name)
+	}
+	tree.Walk(func(n *htmlproc.Node) {
+		if n.File == "" {
+			return
+		}
+		title := n.Title
+		if title == "" {
+			title = n.Name
+		}
+		manifest.Pages = append(manifest.Pages, bundlePage{Path: n.Path, Title: title, Number: n.Number, URL: n.URL, Source: n.Source})
+	})
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	entries = append(entries, bundleEntry{name: "manifest.json", data: append(data, '\n')})
+
+	var sums strings.Builder
+	for _, e := range entries {
+		sum := sha256.Sum256(e.data)
+		hash := hex.EncodeToString(sum[:])
+		if e.path != "" {
+			if hash, err = sha256File(e.path); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", hash, e.name)
+	}
+	entries = append(entries, bundleEntry{name: "SHA256SUMS", data: []byte(sums.String())})
+
+	file, dir, date := o.bundleFile(), o.bundleName(), o.buildDate()
+	err = writeFile(file, func(w io.Writer) error {
+		if o.bundle == "tar" {
+			return writeTarGz(w, dir, entries, date)
+		}
+		return writeZipBundle(w, dir, entries, date)
+	})
+	if err != nil {
+		return fmt.Errorf("error writing bundle: %w", err)
+	}
+	slog.Info("Wrote bundle", "file", file, "files", len(entries))
+	return nil
+}
+
+// licenseFiles returns the license files at the top of the docs and of the
+// clone they come from, one of each name
+func (o *options) licenseFiles() ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	for _, dir := range []string{o.inputDir, o.repo.CloneDir} {
+		if dir == "" {
+			continue
+		}
+		list, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			if e.Type().IsRegular() && licensePattern.MatchString(e.Name()) && !seen[e.Name()] {
+				seen[e.Name()] = true
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	if len(files) == 0 {
+		slog.Warn("No license file found to bundle")
+	}
+	return files, nil
+}
+
+// writeZipBundle writes entries to w as a zip archive, below dir
+func writeZipBundle(w io.Writer, dir string, entries []bundleEntry, date time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: path.Join(dir, e.name), Method: zip.Deflate, Modified: date})
+		if err != nil {
+			return err
+		}
+		if err := copyEntry(fw, e); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeTarGz writes entries to w as a gzipped tar archive, below dir
+func writeTarGz(w io.Writer, dir string, entries []bundleEntry, date time.Time) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		size := int64(len(e.data))
+		if e.path != "" {
+			info, err := os.Stat(e.path)
+			if err != nil {
+				return err
+			}
+			size = info.Size()
+		}
+		header := &tar.Header{
+			Name:    path.Join(dir, e.name),
+			Mode:    0644,
+			Size:    size,
+			ModTime: date,
+			Format:  tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyEntry(tw, e); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// copyEntry writes the content of e to w
+func copyEntry(w io.Writer, e bundleEntry) error {
+	r, err := e.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"i2pdoc2pdf/fetcher"
+	"i2pdoc2pdf/htmlproc"
+)
+
+// changelogPath is the page path of the generated changelog chapter
+const changelogPath = "_changelog"
+
+// addChangelog appends a chapter listing the commits that touched the docs
+// in the --changelog days up to the checked out commit, with the pages they
+// changed, and when each section last changed
+func (o *options) addChangelog(tree *htmlproc.Node) error {
+	if o.revision() == "" {
+		slog.Warn("Leaving out the changelog, the docs don't come from the clone")
+		return nil
+	}
+	end, err := fetcher.HeadCommitTime(o.repo.CloneDir)
+	if err != nil {
+		return err
+	}
+	since := end.AddDate(0, 0, -int(o.changelogDays))
+	paths := []string{fetcher.DefaultDocsPath}
+	if o.specs {
+		paths = append(paths, fetcher.DefaultSpecsPath)
+	}
+	commits, err := fetcher.Log(o.repo, since, paths...)
+	if err != nil {
+		return err
+	}
+
+	pages := map[string]*htmlproc.Node{}
+	tree.Walk(func(n *htmlproc.Node) {
+		pages[n.Path] = n
+	})
+	link := func(p, name string) string {
+		if n, ok := pages[p]; ok {
+			return fmt.Sprintf(`<a href="#%s">%s</a>`, n.ID, html.EscapeString(name))
+		}
+		return html.EscapeString(name)
+	}
+
+	// Sections in the order they last changed, commits are newest first
+	type section struct {
+		path    string
+		last    time.Time
+		commits int
+	}
+	var sections []*section
+	bySection := map[string]*section{}
+	var rows strings.Builder
+	for _, c := range commits {
+		seen := map[string]bool{}
+		var changed []string
+		for _, file := range c.Files {
+			page, ok := changedPage(file)
+			if !ok || seen[page] {
+				continue
+			}
+			seen[page] = true
+			changed = append(changed, link(page, cmp.Or(page, "index")))
+
+			top, _, _ := strings.Cut(page, "/")
+			if seen["section:"+top] {
+				continue
+			}
+			seen["section:"+top] = true
+			s := bySection[top]
+			if s == nil {
+				s = &section{path: top, last: c.Time}
+				bySection[top] = s
+				sections = append(sections, s)
+			}
+			s.commits++
+		}
+		fmt.Fprintf(&rows, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>",
+			c.Time.Format("2006-01-02"), html.EscapeString(c.Author), html.EscapeString(c.Subject), strings.Join(changed, ", "))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<p>Commits to the documentation in the %d days up to %s, newest first.</p>", o.changelogDays, end.Format("2006-01-02"))
+	if len(commits) == 0 {
+		sb.WriteString("<p>The documentation did not change in this period.</p>")
+	} else {
+		sb.WriteString(`<h3>Last change by section</h3><table class="changelog"><tr><th>Section</th><th>Last changed</th><th>Commits</th></tr>`)
+		for _, s := range sections {
+			fmt.Fprintf(&sb, "<tr><td>%s</td><td>%s</td><td>%d</td></tr>", link(s.path, cmp.Or(s.path, "index")), s.last.Format("2006-01-02"), s.commits)
+		}
+		sb.WriteString(`</table><h3>Commits</h3><table class="changelog"><tr><th>Date</th><th>Author</th><th>Summary</th><th>Pages</th></tr>`)
+		sb.WriteString(rows.String())
+		sb.WriteString("</table>")
+	}
+
+	// The changelog has no file of its own, File only marks it as a page
+	tree.Children = append(tree.Children, &htmlproc.Node{
+		Name:     changelogPath,
+		ID:       tree.ID + "-" + changelogPath,
+		Path:     changelogPath,
+		Title:    "Changelog",
+		Content:  sb.String(),
+		File:     changelogPath,
+		Appendix: true,
+	})
+	slog.Info("Built changelog", "commits", len(commits), "since", since.Format("2006-01-02"))
+	return nil
+}
+
+// stampUpdated gives the pages of tree the date their source last changed,
+// printed below their headings
+func (o *options) stampUpdated(tree *htmlproc.Node) error {
+	if o.revision() == "" {
+		slog.Warn("Leaving out the last updated dates, the docs don't come from the clone")
+		return nil
+	}
+	paths := []string{fetcher.DefaultDocsPath}
+	if o.specs {
+		paths = append(paths, fetcher.DefaultSpecsPath)
+	}
+	changed, err := fetcher.LastChanged(o.repo, paths...)
+	if err != nil {
+		return err
+	}
+	updated := map[string]time.Time{}
+	for file, t := range changed {
+		// A page may exist both as HTML and reStructuredText
+		if page, ok := changedPage(file); ok && t.After(updated[page]) {
+			updated[page] = t
+		}
+	}
+	stamped, missing := 0, 0
+	tree.Walk(func(n *htmlproc.Node) {
+		if n.File == "" {
+			return
+		}
+		if t, ok := updated[n.Path]; ok {
+			n.Updated = t
+			stamped++
+		} else {
+			missing++
+		}
+	})
+	if missing > 0 && o.repo.Depth > 0 {
+		slog.Warn("Some pages didn't change within the history of the shallow clone, fetch with --depth 0 to date them all", "pages", missing)
+	}
+	slog.Info("Dated pages", "count", stamped)
+	return nil
+}
+
+// sourceLinks says where the i2p.www docs in docsDir are published and kept,
+// for --source-notes
+func (o *options) sourceLinks() htmlproc.SourceLinks {
+	var links htmlproc.SourceLinks
+	if o.siteURL != "" {
+		lang := "en"
+		if o.lang != "" {
+			lang = o.lang
+		}
+		site := strings.TrimSuffix(o.siteURL, "/")
+		links.BaseURL = site + path.Join("/", lang, o.sitePath)
+		links.SpecsURL = site + "/" + htmlproc.SpecsPath
+	}
+	// Docs brought with --input are given relative to it
+	if o.revision() != "" {
+		links.RepoPath, links.SpecsRepoPath = fetcher.DefaultDocsPath, fetcher.DefaultSpecsPath
+	}
+	return links
+}
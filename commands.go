@@ -0,0 +1,1300 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"i2pdoc2pdf/fetcher"
+	"i2pdoc2pdf/htmlproc"
+	"i2pdoc2pdf/progress"
+	"i2pdoc2pdf/renderer"
+)
+
+// docsSource describes where fetching gets the docs from. update pulls the
+// latest commit into an existing clone.
+func (o *options) docsSource(update bool) (fetcher.Source, error) {
+	switch o.source {
+	case "git":
+	case "web":
+		return &fetcher.WebSource{
+			BaseURL:  o.baseURL,
+			DestDir:  o.inputDir,
+			MaxDepth: o.crawlDepth,
+			Delay:    o.crawlDelay,
+			Proxy:    o.repo.Proxy,
+			Progress: progress.New("Crawling pages").Set,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown --source %q, expected git or web", o.source)
+	}
+
+	source := &fetcher.GitSource{
+		Update:   update,
+		Repo:     o.repo,
+		Sparse:   o.sparse,
+		DocsPath: fetcher.DefaultDocsPath,
+		DestDir:  o.inputDir,
+		Copy:     o.copyOpts,
+		// The navigation template gives the reading order
+		ExtraPaths: []string{"i2p2www/pages/global"},
+	}
+	if o.lang != "" || o.withLangs != "" {
+		source.ExtraPaths = append(source.ExtraPaths, "i2p2www/translations")
+	}
+	if o.specs {
+		source.SpecsPath = fetcher.DefaultSpecsPath
+		source.ExtraPaths = append(source.ExtraPaths, fetcher.DefaultSpecsPath)
+	}
+	return source, nil
+}
+
+// intermediateFile returns where the combined HTML is written before
+// rendering, with the other intermediate files next to it: next to the PDF
+// with --keep-intermediate, in --workdir if set, else in a new temporary
+// directory, so concurrent builds don't clash. cleanup removes the
+// temporary directory.
+func (o *options) intermediateFile() (file string, cleanup func(), err error) {
+	if o.keepIntermediate {
+		return strings.TrimSuffix(o.outputFile, filepath.Ext(o.outputFile)) + ".html", func() {}, nil
+	}
+	if o.workDir != "" {
+		if err := os.MkdirAll(o.workDir, 0755); err != nil {
+			return "", nil, fmt.Errorf("error creating work directory: %w", err)
+		}
+		return filepath.Join(o.workDir, "combined.html"), func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", "i2pdoc2pdf-")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	return filepath.Join(dir, "combined.html"), func() { os.RemoveAll(dir) }, nil
+}
+
+// keepFiles reports whether the intermediate files are kept after the build
+func (o *options) keepFiles() bool {
+	return o.keepIntermediate || o.workDir != ""
+}
+
+// assetDir returns the directory, next to the combined HTML file, that the
+// images of the pages are copied to
+func assetDir(combined string) string {
+	return strings.TrimSuffix(combined, filepath.Ext(combined)) + "_assets"
+}
+
+// coverFile returns where the cover page for the combined HTML file is written
+func coverFile(combined string) string {
+	return strings.TrimSuffix(combined, filepath.Ext(combined)) + "-cover.html"
+}
+
+// revision describes the commit of the clone the docs were copied from, and
+// the pinned --ref if any, for the title page
+func (o *options) revision() string {
+	// Docs brought with --input need not come from the clone. build has no
+	// --source, its docs come from an earlier fetch.
+	if o.source == "web" || (o.set["input"] && o.repo.Ref == "") {
+		return ""
+	}
+	commit, err := fetcher.HeadCommit(o.repo.CloneDir)
+	if err != nil {
+		if o.repo.Ref == "" {
+			return ""
+		}
+		slog.Warn("Cannot stamp the commit on the title page", "err", err)
+		return o.repo.Ref
+	}
+	if o.repo.Ref == "" {
+		return "commit " + commit
+	}
+	if strings.HasPrefix(o.repo.Ref, commit) {
+		return o.repo.Ref
+	}
+	return o.repo.Ref + " (commit " + commit + ")"
+}
+
+// running returns the header and footer printed on every page, with the
+// title, date and commit of the title page
+func (o *options) running(opts htmlproc.DocumentOptions) renderer.Running {
+	r := renderer.Running{Header: o.header, Footer: o.footer, Title: opts.Title, Date: opts.Date}
+	if opts.Revision != "" {
+		r.Commit, _ = fetcher.HeadCommit(o.repo.CloneDir)
+	}
+	if htmlproc.IsRTL(o.lang) {
+		return r.Mirrored()
+	}
+	return r
+}
+
+// documentOptions returns the settings of the title page and colophon.
+// assets is where the logo is copied from, nil to leave it out.
+func (o *options) documentOptions(assets *htmlproc.AssetResolver) htmlproc.DocumentOptions {
+	opts := htmlproc.DocumentOptions{
+		Lang:      o.lang,
+		Title:     o.title,
+		Subtitle:  o.subtitle,
+		Revision:  o.revision(),
+		Date:      o.buildDate().Format("2006-01-02"),
+		Generator: "i2pdoc2pdf " + version,
+		Theme:     o.theme,
+		Grayscale: o.grayscale,
+		FontSize:  o.fontSize,
+		TOCDepth:  int(o.tocDepth),
+	}
+	switch {
+	case o.set["input"]:
+	case o.source == "web":
+		opts.Source = o.baseURL
+	case o.repo.URL != "":
+		opts.Source = o.repo.URL
+	default:
+		opts.Source, _ = fetcher.OriginURL(o.repo.CloneDir)
+	}
+
+	logo := o.logo
+	if logo == "" && assets != nil {
+		for _, dir := range assets.StaticDirs {
+			if candidate := filepath.Join(dir, "images", "i2plogo.png"); fileExists(candidate) {
+				logo = candidate
+				break
+			}
+		}
+	}
+	if logo != "" && logo != "none" && assets != nil {
+		opts.Logo = assets.Add(logo)
+	}
+	if assets != nil {
+		for _, css := range splitList(o.css) {
+			opts.Stylesheet = append(opts.Stylesheet, assets.Add(css))
+		}
+		o.embedFonts(&opts, assets)
+	}
+	opts.CSS = o.mathCSS
+	return opts
+}
+
+// formulaCSS returns the stylesheet of the formulas math typeset in tree,
+// empty if there are none
+func (o *options) formulaCSS(tree *htmlproc.Node, math *htmlproc.MathRenderer) (string, error) {
+	typeset := false
+	tree.Walk(func(n *htmlproc.Node) {
+		typeset = typeset || strings.Contains(n.Content, `class="katex`)
+	})
+	if !typeset {
+		return "", nil
+	}
+	css, err := math.CSS()
+	if err != nil {
+		return "", fmt.Errorf("error loading the stylesheet of formulas: %w", err)
+	}
+	return css, nil
+}
+
+// pageSetup returns the page geometry given by --page-size, --orientation,
+// --margins and --dpi
+func (o *options) pageSetup() (renderer.PageSetup, error) {
+	setup := renderer.PageSetup{Size: o.pageSize, DPI: o.dpi}
+	switch o.orientation {
+	case "portrait":
+	case "landscape":
+		setup.Landscape = true
+	default:
+		return setup, fmt.Errorf("unknown --orientation %q, expected portrait or landscape", o.orientation)
+	}
+	if _, _, err := setup.Dimensions(); err != nil {
+		return setup, fmt.Errorf("invalid --page-size: %w", err)
+	}
+	margins, err := renderer.ParseMargins(o.margins)
+	if err != nil {
+		return setup, fmt.Errorf("invalid --margins: %w", err)
+	}
+	setup.Margins = margins
+	// Pages written right to left are bound at the right
+	if htmlproc.IsRTL(o.lang) {
+		setup.Margins.Left, setup.Margins.Right = margins.Right, margins.Left
+	}
+	if o.dpi == 0 {
+		return setup, fmt.Errorf("--dpi must be positive")
+	}
+	return setup, nil
+}
+
+// Sizes of the stylesheet of htmlproc.BuildDocument, in millimeters at 96 DPI
+const (
+	bodyMaxWidth = 800 * 25.4 / 96      // Width of the text at most
+	bodyPadding  = 2 * 20 * 25.4 / 96   // Padding at both sides of the text
+	codeChar     = 0.6 * 13 * 25.4 / 96 // A character of a code block
+	codePadding  = 2 * 10 * 25.4 / 96   // Padding at both sides of code blocks
+)
+
+// fitOptions returns how code blocks and tables wider than the page are laid
+// out, estimating how many characters fit on a line
+func (o *options) fitOptions(setup renderer.PageSetup) htmlproc.FitOptions {
+	width, _, _ := setup.Dimensions()
+	text := min(width-setup.Margins.Left-setup.Margins.Right, bodyMaxWidth) - bodyPadding - codePadding
+	// wkhtmltopdf lays pages out at --dpi, so more fits at higher values
+	columns := int(text / codeChar * float64(setup.DPI) / 96)
+	return htmlproc.FitOptions{Mode: o.fitWide, Columns: columns}
+}
+
+// sanitizeRules returns the --sanitize profile with the rules given by the
+// other --sanitize flags
+func (o *options) sanitizeRules() (*htmlproc.SanitizeRules, error) {
+	rules, err := htmlproc.SanitizeProfile(o.sanitize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --sanitize: %w", err)
+	}
+	if o.set["sanitize-remove"] {
+		rules.Remove = o.sanitizeRemove
+	}
+	if o.sanitizeKeep != "" {
+		rules.Keep = o.sanitizeKeep
+	}
+	if o.set["sanitize-attrs"] {
+		rules.Attributes = splitList(o.sanitizeAttrs)
+	}
+	if err := rules.Check(); err != nil {
+		return nil, fmt.Errorf("invalid sanitization rules: %w", err)
+	}
+	return &rules, nil
+}
+
+// siteVersion returns the I2P release for the ver() template helper: that of
+// --i2p-version, or else the one the i2p.www checkout sets, if it can be read
+func (o *options) siteVersion() (string, error) {
+	if o.i2pVersion != "" {
+		return o.i2pVersion, nil
+	}
+	v, err := htmlproc.ReadSiteVersion(filepath.Join(o.repo.CloneDir, "i2p2www", "__init__.py"))
+	if err != nil {
+		slog.Debug("No I2P release for ver()", "err", err)
+		return "", nil
+	}
+	return v, nil
+}
+
+// endpoints returns the URLs of the url_for() endpoints: the i2p2www ones
+// with those of --url-map
+func (o *options) endpoints() (map[string]string, error) {
+	if o.urlMap == "" {
+		return nil, nil
+	}
+	endpoints := maps.Clone(htmlproc.DefaultEndpoints)
+	for _, pair := range splitList(o.urlMap) {
+		name, target, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --url-map entry %q, expected endpoint=URL", pair)
+		}
+		endpoints[strings.TrimSpace(name)] = strings.TrimSpace(target)
+	}
+	return endpoints, nil
+}
+
+// encryption returns the encryption asked for with the flags
+func (o *options) encryption() renderer.Encryption {
+	return renderer.Encryption{
+		UserPassword:  o.userPassword,
+		OwnerPassword: o.ownerPassword,
+		NoPrint:       o.noPrint,
+		NoCopy:        o.noCopy,
+	}
+}
+
+// metadata returns the document information written into the PDF
+func (o *options) metadata() renderer.Metadata {
+	lang := "en"
+	if o.lang != "" {
+		lang = strings.ReplaceAll(o.lang, "_", "-")
+	}
+	return renderer.Metadata{
+		Title:    o.title,
+		Author:   o.author,
+		Subject:  o.subject,
+		Keywords: o.keywords,
+		Creator:  "i2pdoc2pdf " + version,
+		Language: lang,
+		Date:     o.sourceDate,
+	}
+}
+
+// buildDate returns the date the document is dated, today unless fixed by
+// SOURCE_DATE_EPOCH or --reproducible
+func (o *options) buildDate() time.Time {
+	if o.sourceDate.IsZero() {
+		return time.Now()
+	}
+	return o.sourceDate
+}
+
+// fixSourceDate sets the date a reproducible build is dated: the time in
+// SOURCE_DATE_EPOCH if set, otherwise with --reproducible the time of the
+// commit the docs were taken from
+func (o *options) fixSourceDate() error {
+	o.sourceDate = time.Time{}
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid SOURCE_DATE_EPOCH %q, expected seconds since 1970", epoch)
+		}
+		o.sourceDate = time.Unix(seconds, 0).UTC()
+		return nil
+	}
+	if !o.reproducible {
+		return nil
+	}
+	if o.revision() == "" {
+		return fmt.Errorf("--reproducible needs SOURCE_DATE_EPOCH when the docs don't come from the clone")
+	}
+	date, err := fetcher.HeadCommitTime(o.repo.CloneDir)
+	if err != nil {
+		return fmt.Errorf("--reproducible needs SOURCE_DATE_EPOCH or the commit time: %w", err)
+	}
+	o.sourceDate = date
+	return nil
+}
+
+// writeFile creates file and writes it with write, atomically
+func writeFile(file string, write func(w io.Writer) error) error {
+	return replaceFile(file, func(tmp string) error {
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		if err := write(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// replaceFile creates file by having create write a temporary file next to
+// it, which then replaces file in one rename, so a failed or interrupted
+// build never leaves a truncated file for others to pick up
+func replaceFile(file string, create func(tmp string) error) error {
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*"+filepath.Ext(file))
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	err = create(tmp)
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// runFetch clones i2p.www, or pulls the latest commit into an existing clone,
+// and copies the docs to --input. With --source web it crawls the site into
+// --input instead.
+func runFetch(o *options) error {
+	source, err := o.docsSource(true)
+	if err != nil {
+		return err
+	}
+	if _, err := source.Fetch(); err != nil {
+		return failed(exitFetch, fmt.Errorf("failed to fetch documentation: %w", err))
+	}
+	return failed(exitFetch, o.fetchSources(true))
+}
+
+// runAll fetches the docs unless --input or --dry-run was given, then builds
+// them
+func runAll(o *options) error {
+	// An explicit --input means the user brings their own HTML tree
+	if !o.set["input"] && !o.dryRun {
+		source, err := o.docsSource(false)
+		if err != nil {
+			return err
+		}
+		if _, err := source.Fetch(); err != nil {
+			return failed(exitFetch, fmt.Errorf("failed to fetch documentation: %w", err))
+		}
+	}
+	if err := o.fetchSources(false); err != nil {
+		return failed(exitFetch, err)
+	}
+	return runBuild(o)
+}
+
+// runUpdate pulls the latest commit of i2p.www and rebuilds --output only if
+// the docs changed since the commit it was last built from, listing the
+// changed files. It is meant to be run from cron.
+func runUpdate(o *options) error {
+	if o.source != "git" {
+		return fmt.Errorf("update needs --source git, the website has no commits to compare")
+	}
+	if o.dryRun {
+		return runBuild(o)
+	}
+	source, err := o.docsSource(true)
+	if err != nil {
+		return err
+	}
+	if _, err := source.Fetch(); err != nil {
+		return failed(exitFetch, fmt.Errorf("failed to fetch documentation: %w", err))
+	}
+	head, err := fetcher.FullHeadCommit(o.repo.CloneDir)
+	if err != nil {
+		return failed(exitFetch, err)
+	}
+
+	last := o.lastBuiltCommit()
+	switch {
+	case o.force:
+	case last == "":
+		slog.Info("No earlier build recorded, building", "commit", head)
+	case last == head:
+		slog.Info("Docs unchanged since the last build", "commit", head)
+		return nil
+	default:
+		paths := []string{fetcher.DefaultDocsPath, "i2p2www/pages/global"}
+		if o.lang != "" || o.withLangs != "" {
+			paths = append(paths, "i2p2www/translations")
+		}
+		changes, err := fetcher.ChangedPaths(o.repo, last, paths...)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			slog.Info("No docs changes since the last build", "from", last, "to", head)
+			return o.writeBuiltCommit(head)
+		}
+		fmt.Fprintf(o.stdout, "Docs changed between %.10s and %.10s:\n", last, head)
+		for _, change := range changes {
+			fmt.Fprintf(o.stdout, "  %s\n", change)
+		}
+	}
+
+	if err := runBuild(o); err != nil {
+		return err
+	}
+	return o.writeBuiltCommit(head)
+}
+
+// runBuild processes the pages in --input and writes the requested outputs,
+// again after every change with --watch
+func runBuild(o *options) error {
+	if o.targets != "" {
+		return runTargets(o)
+	}
+	if o.watch && !o.dryRun {
+		return watchBuild(o)
+	}
+	return o.reportPageErrors(buildOnce(o))
+}
+
+// buildOnce processes the pages in --input and writes the requested outputs
+func buildOnce(o *options) (err error) {
+	stage, start := exitFailure, time.Now()
+	defer func() {
+		metrics.recordBuild(start, err)
+		err = failed(stage, err)
+	}()
+	// Targets process their pages one at a time, so those after the first
+	// find them in the page cache, and render together
+	release := func() {}
+	if o.processing != nil {
+		o.processing.Lock()
+		release = sync.OnceFunc(o.processing.Unlock)
+		defer release()
+	}
+	switch o.tocStyle {
+	case "pages", "links", "none":
+	default:
+		return fmt.Errorf("unknown --toc style %q, expected pages, links or none", o.tocStyle)
+	}
+	if err := htmlproc.CheckNumbering(o.numbering); err != nil {
+		return fmt.Errorf("invalid --numbering: %w", err)
+	}
+	switch o.format {
+	case "pdf", "html", "both", "epub":
+	default:
+		return fmt.Errorf("unknown --format %q, expected pdf, html, both or epub", o.format)
+	}
+	if o.format != "epub" && strings.EqualFold(filepath.Ext(o.outputFile), ".epub") {
+		return fmt.Errorf("--output %s names an EPUB, add --format epub", o.outputFile)
+	}
+	switch o.onError {
+	case "continue", "fail":
+	default:
+		return fmt.Errorf("unknown --on-error %q, expected continue or fail", o.onError)
+	}
+	switch o.bundle {
+	case "", "zip", "tar":
+	default:
+		return fmt.Errorf("unknown --bundle %q, expected zip or tar", o.bundle)
+	}
+	switch o.attachSources {
+	case "none", "pages", "zip":
+	default:
+		return fmt.Errorf("unknown --attach-sources %q, expected pages, zip or none", o.attachSources)
+	}
+	if o.attachSources != "none" && o.pdfa {
+		return fmt.Errorf("--attach-sources cannot be combined with --pdfa, PDF/A-2 forbids attachments")
+	}
+	o.pageErrors = nil
+	if o.preflight {
+		renderer.PrintPreflight(o.stdout, o.chromePath)
+		return nil
+	}
+	switch o.svgTool {
+	case "go", "rsvg-convert", "none":
+	default:
+		return fmt.Errorf("unknown --svg %q, expected go, rsvg-convert or none", o.svgTool)
+	}
+	if err := htmlproc.CheckRST(o.rstTool); err != nil {
+		return fmt.Errorf("invalid --rst: %w", err)
+	}
+	if o.rstTool == "rst2html" || o.rstTool == "pandoc" {
+		if _, err := exec.LookPath(o.rstTool); err != nil {
+			return fmt.Errorf("--rst %s needs %s, which was not found in PATH", o.rstTool, o.rstTool)
+		}
+	}
+	if err := htmlproc.CheckMath(o.mathTool); err != nil {
+		return fmt.Errorf("invalid --math: %w", err)
+	}
+	switch o.mathTool {
+	case "auto":
+		o.mathTool = htmlproc.DetectMath()
+		slog.Debug("Selected math renderer", "tool", o.mathTool)
+	case "katex", "tex2svg":
+		if _, err := exec.LookPath(o.mathTool); err != nil {
+			return fmt.Errorf("--math %s needs %s, which was not found in PATH", o.mathTool, o.mathTool)
+		}
+	}
+	switch o.engine {
+	case "auto", "wkhtmltopdf", "chrome", "native":
+	default:
+		return fmt.Errorf("unknown --engine %q, expected auto, wkhtmltopdf, chrome or native", o.engine)
+	}
+	setup, err := o.pageSetup()
+	if err != nil {
+		return err
+	}
+	if err := htmlproc.CheckFitMode(o.fitWide); err != nil {
+		return fmt.Errorf("invalid --fit-wide: %w", err)
+	}
+	if err := htmlproc.CheckSplitBy(o.splitBy); err != nil {
+		return fmt.Errorf("invalid --split-by: %w", err)
+	}
+	if o.continuousPages && o.splitBy == "none" {
+		slog.Warn("--continuous-numbering only applies with --split-by")
+	}
+	if o.continuousPages && o.splitBy != "none" {
+		// {pages} counts the pages of each volume, "6/5" would look wrong
+		if !o.set["header"] {
+			o.header = "||{page}"
+		} else if strings.Contains(o.header+o.footer, "{pages}") {
+			slog.Warn("With --continuous-numbering, {pages} counts the pages of each volume, not of the whole document")
+		}
+	}
+	if err := htmlproc.CheckPrintLinks(o.printLinks); err != nil {
+		return fmt.Errorf("invalid --print-links: %w", err)
+	}
+	switch o.linkReportFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown --link-report-format %q, expected text or json", o.linkReportFormat)
+	}
+	if o.keepBuilds < 0 {
+		return fmt.Errorf("invalid --keep-builds %d", o.keepBuilds)
+	}
+	if strings.HasPrefix(o.sign, "age:") {
+		// age keys only encrypt; an SSH key serves both age and --sign ssh:
+		return fmt.Errorf("invalid --sign: age keys cannot sign, use a GPG key ID or ssh:<key file>")
+	}
+	if o.jpegQuality < 1 || o.jpegQuality > 100 {
+		return fmt.Errorf("invalid --jpeg-quality %d, expected 1 to 100", o.jpegQuality)
+	}
+	if o.booklet != "" {
+		if err := renderer.CheckSheet(o.booklet); err != nil {
+			return fmt.Errorf("invalid --booklet: %w", err)
+		}
+	}
+	if o.zoom <= 0 {
+		return fmt.Errorf("invalid --zoom %g, expected a factor such as 1.2", o.zoom)
+	}
+	if o.fontSize < 0 {
+		return fmt.Errorf("invalid --font-size %g", o.fontSize)
+	}
+	if o.maxImageWidth < 0 {
+		return fmt.Errorf("invalid --max-image-width %d", o.maxImageWidth)
+	}
+	if o.renderMemory != "" {
+		if _, err := parseSize(o.renderMemory); err != nil {
+			return fmt.Errorf("invalid --render-memory: %w", err)
+		}
+		if runtime.GOOS != "linux" {
+			slog.Warn("--render-memory only applies on Linux")
+		}
+	}
+	if o.targetSize != "" {
+		if _, err := parseSize(o.targetSize); err != nil {
+			return fmt.Errorf("invalid --target-size: %w", err)
+		}
+		if !o.optimize {
+			slog.Warn("--target-size only applies with --optimize")
+		}
+	}
+	if enc := o.encryption(); enc.Enabled() {
+		if err := enc.Check(); err != nil {
+			return fmt.Errorf("invalid encryption flags: %w", err)
+		}
+		if o.pdfa {
+			return fmt.Errorf("--pdfa cannot be combined with encryption, PDF/A forbids it")
+		}
+		if o.reproducible {
+			slog.Warn("Encrypted PDFs are not reproducible, encryption is salted at random")
+		}
+	}
+	if err := o.fixSourceDate(); err != nil {
+		return err
+	}
+	if err := o.expandOutputs(); err != nil {
+		return err
+	}
+	if err := htmlproc.CheckTheme(o.theme); err != nil {
+		return fmt.Errorf("invalid --theme: %w", err)
+	}
+	sanitize, err := o.sanitizeRules()
+	if err != nil {
+		return err
+	}
+	for _, css := range splitList(o.css) {
+		if !fileExists(css) {
+			return fmt.Errorf("--css stylesheet %s not found", css)
+		}
+	}
+	if err := o.checkFonts(); err != nil {
+		return err
+	}
+	if o.makesPDF() {
+		resolved, info, err := renderer.SelectEngine(o.engine, o.chromePath)
+		if err != nil {
+			return fmt.Errorf("no usable rendering engine: %w", err)
+		}
+		o.engine = resolved
+		if o.engine == "chrome" && (o.zoom < 0.1 || o.zoom > 2) {
+			return fmt.Errorf("--zoom %g is beyond what Chrome can print, 0.1 to 2", o.zoom)
+		}
+		if o.linearize && renderer.DetectQpdf() == "" {
+			slog.Warn("--linearize needs qpdf, which was not found in PATH; the PDF will not be linearized")
+			o.linearize = false
+		}
+		if o.pdfa && renderer.DetectGhostscript() == "" {
+			return fmt.Errorf("--pdfa needs Ghostscript (gs), which was not found in PATH")
+		}
+		if o.engine == "native" && (o.theme != htmlproc.DefaultTheme || o.css != "" || o.fonts != "" || o.fontFamily != "") {
+			slog.Warn("The native engine ignores stylesheets, --theme, --css, --font and --font-family only apply to HTML output")
+		}
+		if o.engine == "native" && htmlproc.IsRTL(o.lang) {
+			slog.Warn("The native engine lays out text left to right, use wkhtmltopdf or chrome for right-to-left languages", "lang", o.lang)
+		}
+		if o.continuousPages && o.engine == "chrome" && !o.splitRender {
+			slog.Warn("Chrome cannot number pages on from the previous volume, use --split-render for --continuous-numbering")
+		}
+		if o.pageRefs && o.splitRender {
+			slog.Warn("Chapters rendered separately cannot refer to the pages of others, leaving out --page-refs")
+			o.pageRefs = false
+		}
+		// Only Chrome supports pages of another orientation
+		if o.fitWide == "rotate" && o.engine != "chrome" {
+			slog.Warn("The engine cannot rotate pages, scaling wide tables instead", "engine", o.engine)
+			o.fitWide = "scale"
+		}
+
+		// Only a patched-qt wkhtmltopdf can generate a TOC with page numbers,
+		// unless the chapters are rendered separately and numbered after merging
+		if o.tocStyle == "pages" && !o.splitRender && (info == nil || !info.PatchedQt) {
+			slog.Warn("The engine cannot number TOC pages, using --toc links", "engine", o.engine)
+			o.tocStyle = "links"
+		}
+	}
+
+	docsDir, err := fetcher.LocalSource{Dir: o.inputDir}.Fetch()
+	if err != nil {
+		return failed(exitFetch, fmt.Errorf("failed to open documentation: %w", err))
+	}
+
+	stage = exitProcess
+	o.bench.stage("setup")
+	bar := progress.New("Processing pages")
+	pipeline := &htmlproc.Pipeline{
+		InputDir:    docsDir,
+		SitePath:    o.sitePath,
+		SiteURL:     o.siteURL,
+		NavFile:     o.navFile,
+		Boilerplate: o.boilerplate,
+		Sanitize:    sanitize,
+		Fit:         o.fitOptions(setup),
+		Proposals:   o.withProposals,
+		PrintLinks:  o.printLinks,
+		Cache:       &htmlproc.PageCache{Dir: o.cacheDir, Refresh: o.force},
+		Jobs:        o.jobs,
+		Progress:    bar.Set,
+	}
+	pipeline.MinWords, pipeline.SkipRedirects = o.minWords, o.skipRedirects
+	pipeline.FailOnError = o.onError == "fail"
+	if pipeline.NavFile == "" {
+		pipeline.NavFile = filepath.Join(o.repo.CloneDir, "i2p2www", "pages", "global", "nav.html")
+	}
+	tempFile, cleanup, err := o.intermediateFile()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	pipeline.Assets = &htmlproc.AssetResolver{
+		BaseDir:    docsDir,
+		StaticDirs: splitList(o.staticDirs),
+		Dir:        filepath.Base(assetDir(tempFile)),
+	}
+	if o.svgTool != "none" {
+		pipeline.Assets.SVG = &htmlproc.SVGRasterizer{DPI: o.svgDPI, Tool: o.svgTool}
+	}
+	if o.maxImageWidth > 0 || o.jpegImages {
+		pipeline.Assets.Images = &htmlproc.ImageOptimizer{MaxWidth: o.maxImageWidth}
+		if o.jpegImages {
+			pipeline.Assets.Images.JPEGQuality = o.jpegQuality
+		}
+	}
+	if o.rstTool != "none" {
+		pipeline.RST = &htmlproc.RSTConverter{Tool: o.rstTool}
+	}
+	if o.mathTool != "none" {
+		pipeline.Math = &htmlproc.MathRenderer{Tool: o.mathTool}
+	}
+	if o.diagrams {
+		// Text in SVG is beyond the built-in rasterizer, draw bitmaps instead
+		pipeline.Diagrams = &htmlproc.DiagramRenderer{PNG: o.svgTool != "none", DPI: o.svgDPI}
+	}
+	if len(pipeline.Assets.StaticDirs) == 0 {
+		pipeline.Assets.StaticDirs = []string{filepath.Join(o.repo.CloneDir, "i2p2www", "static")}
+	}
+	if o.include != "" || o.exclude != "" {
+		pipeline.Filter, err = htmlproc.NewPathFilter(splitList(o.include), splitList(o.exclude))
+		if err != nil {
+			return err
+		}
+	}
+	if o.changes != nil && !o.changes.Appendix {
+		if pipeline.Filter == nil {
+			pipeline.Filter = &htmlproc.PathFilter{}
+		}
+		pipeline.Filter.Only = o.changes.filter()
+	}
+	if o.orderFile != "" {
+		switch strings.ToLower(filepath.Ext(o.orderFile)) {
+		case ".yaml", ".yml", ".json":
+			pipeline.Manifest, err = htmlproc.ReadManifest(o.orderFile)
+		default:
+			pipeline.Order, err = htmlproc.ReadOrderManifest(o.orderFile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read --order: %w", err)
+		}
+	}
+	if pipeline.Version, err = o.siteVersion(); err != nil {
+		return err
+	}
+	if pipeline.Endpoints, err = o.endpoints(); err != nil {
+		return err
+	}
+	if o.translationsDir == "" {
+		o.translationsDir = filepath.Join(o.repo.CloneDir, "i2p2www", "translations")
+	}
+	if o.lang != "" {
+		cat, err := htmlproc.LoadCatalogs(o.translationsDir, o.lang)
+		if err != nil {
+			return fmt.Errorf("failed to load translations: %w", err)
+		}
+		slog.Info("Loaded translations", "messages", len(cat), "lang", o.lang)
+		pipeline.Catalog = cat
+	}
+	if o.bench != nil {
+		pipeline.Stage = o.bench.stage
+	}
+	tree, err := pipeline.Build()
+	bar.Finish()
+	o.pageErrors = append(o.pageErrors, pipeline.Errors()...)
+	if err != nil {
+		return err
+	}
+	o.bench.stage("post-process")
+	translations, err := o.buildTranslations(pipeline)
+	if err != nil {
+		return err
+	}
+	if pipeline.Math != nil {
+		if o.mathCSS, err = o.formulaCSS(tree, pipeline.Math); err != nil {
+			return err
+		}
+	}
+	if o.sourceNotes {
+		htmlproc.NoteSources(tree, docsDir, o.sourceLinks())
+	}
+	var sourceAssets []*htmlproc.AssetResolver
+	if len(o.sources) > 0 {
+		if tree, sourceAssets, err = o.joinSources(tree, pipeline); err != nil {
+			return err
+		}
+	}
+	if o.dryRun {
+		printDryRun(o.stdout, tree, append([]*htmlproc.AssetResolver{pipeline.Assets}, sourceAssets...))
+		return nil
+	}
+	if o.lastUpdated {
+		if err := o.stampUpdated(tree); err != nil {
+			return fmt.Errorf("error dating pages: %w", err)
+		}
+	}
+	if o.headings {
+		for _, t := range append([]*htmlproc.Node{tree}, translations...) {
+			if err := htmlproc.NormalizeHeadings(t); err != nil {
+				return fmt.Errorf("error normalizing headings: %w", err)
+			}
+		}
+	}
+	for i, lang := range splitList(o.withLangs) {
+		done, missing := htmlproc.AddTranslations(tree, translations[i], lang)
+		slog.Info("Added translations", "lang", lang, "pages", done, "untranslated", missing)
+	}
+	if o.glossary {
+		count, err := htmlproc.Glossary(tree)
+		if err != nil {
+			return fmt.Errorf("error building the glossary: %w", err)
+		}
+		slog.Info("Built glossary", "terms", count)
+	}
+	if o.changelogDays > 0 {
+		if err := o.addChangelog(tree); err != nil {
+			return fmt.Errorf("error building the changelog: %w", err)
+		}
+	}
+	if o.changes != nil {
+		o.changes.addChapter(tree)
+	}
+	htmlproc.NumberChapters(tree, o.numbering)
+	var figures []htmlproc.Figure
+	if o.listFigures {
+		if figures, err = htmlproc.NumberFigures(tree); err != nil {
+			return fmt.Errorf("error numbering figures: %w", err)
+		}
+		slog.Info("Numbered figures", "count", len(figures))
+	}
+	if o.checkLinks {
+		if err := o.runLinkCheck(tree); err != nil {
+			return err
+		}
+	}
+
+	// Create combined HTML document
+	o.bench.stage("write")
+	docOpts := o.documentOptions(pipeline.Assets)
+	docOpts.Figures = figures
+	stats := buildStats{Date: docOpts.Date, Revision: docOpts.Revision, Stats: pipeline.Stats(tree)}
+	metrics.recordPages(stats.Pages, len(o.pageErrors))
+	combinedOpts := docOpts
+	combinedOpts.TOC = o.tocStyle
+	combinedOpts.Cover = o.tocStyle != "pages"
+
+	// Write combined HTML to file, with the images it refers to
+	err = writeFile(tempFile, func(w io.Writer) error {
+		return htmlproc.WriteDocument(w, tree, combinedOpts)
+	})
+	if err != nil {
+		return fmt.Errorf("error writing combined HTML: %w", err)
+	}
+	if o.keepFiles() {
+		slog.Info("Keeping intermediate HTML", "file", tempFile)
+	} else {
+		defer os.Remove(tempFile)
+	}
+	for _, assets := range append([]*htmlproc.AssetResolver{pipeline.Assets}, sourceAssets...) {
+		if err := assets.CopyTo(filepath.Dir(tempFile)); err != nil {
+			return fmt.Errorf("error copying images: %w", err)
+		}
+	}
+	if pipeline.Assets.Images != nil {
+		pipeline.Assets.Images.Report()
+	}
+	if !o.keepFiles() {
+		defer os.RemoveAll(assetDir(tempFile))
+	}
+	if o.bench != nil {
+		o.bench.pages = stats.Pages
+		return nil
+	}
+
+	// Write the cover page separately when wkhtmltopdf generates the TOC
+	cover := ""
+	if o.tocStyle == "pages" && !o.splitRender {
+		cover = coverFile(tempFile)
+		err = os.WriteFile(cover, []byte(htmlproc.BuildCover(docOpts)), 0644)
+		if err != nil {
+			return fmt.Errorf("error writing cover page: %w", err)
+		}
+		if !o.keepFiles() {
+			defer os.Remove(cover)
+		}
+	}
+
+	stage = exitRender
+	release()
+	if o.format == "epub" {
+		slog.Info("Writing EPUB", "file", o.epubFile())
+		err := writeFile(o.epubFile(), func(w io.Writer) error {
+			return htmlproc.WriteEPUB(w, tree, docOpts, filepath.Dir(tempFile), o.buildDate())
+		})
+		if err != nil {
+			return fmt.Errorf("error writing EPUB: %w", err)
+		}
+		return o.finishBuild(stats, tree)
+	}
+	if o.format == "html" || o.format == "both" {
+		if o.htmlOutput == "" {
+			o.htmlOutput = strings.TrimSuffix(o.outputFile, filepath.Ext(o.outputFile)) + ".standalone.html"
+		}
+		// There is no generated TOC to fall back on in HTML, use links instead
+		standaloneTOC := "links"
+		if o.tocStyle == "none" {
+			standaloneTOC = "none"
+		}
+		standaloneOpts := docOpts
+		standaloneOpts.TOC = standaloneTOC
+		standaloneOpts.Cover = true
+		slog.Info("Writing standalone HTML", "file", o.htmlOutput)
+		err := writeFile(o.htmlOutput, func(w io.Writer) error {
+			return htmlproc.WriteStandalone(w, tree, standaloneOpts, filepath.Dir(tempFile))
+		})
+		if err != nil {
+			return fmt.Errorf("error writing standalone HTML: %w", err)
+		}
+		if o.format == "html" {
+			return o.finishBuild(stats, tree)
+		}
+	}
+
+	// Skip rendering when none of its inputs changed
+	key, err := o.renderKey(tempFile, cover, assetDir(tempFile))
+	if err != nil {
+		return fmt.Errorf("error hashing render inputs: %w", err)
+	}
+	if o.upToDate(key) {
+		slog.Info("PDF is up to date (use --force to render it anyway)", "file", o.outputFile)
+		o.splitVolumes(tree)
+		o.splitPages(tree)
+		return o.finishBuild(stats, tree)
+	}
+
+	// Generate PDF
+	slog.Info("Generating PDF", "engine", o.engine)
+	running := o.running(docOpts)
+	if o.splitBy != "none" {
+		if err := o.renderVolumes(tree, tempFile, docOpts, setup, running); err != nil {
+			return err
+		}
+	} else {
+		err := replaceFile(o.outputFile, func(pdf string) error {
+			if err := o.renderOne(tree, tempFile, cover, pdf, docOpts, setup, running); err != nil {
+				return fmt.Errorf("error creating PDF: %w", err)
+			}
+			return o.finishPDF(pdf, o.metadata())
+		})
+		if err != nil {
+			return err
+		}
+		if err := o.writeBooklet(o.outputFile); err != nil {
+			return err
+		}
+	}
+	if o.pagePDFs != "" {
+		if err := o.renderPages(tree, tempFile, docOpts, setup, running); err != nil {
+			return err
+		}
+	}
+	if err := o.writeStamp(key); err != nil {
+		slog.Warn("Cannot record the build for incremental rebuilds", "err", err)
+	}
+
+	slog.Info("PDF generation complete!")
+	return o.finishBuild(stats, tree)
+}
+
+// chapterFile returns where chapter i of the combined HTML file is written
+// for --split-render. Chapters sit next to it so they share its images.
+func chapterFile(combined string, i int) string {
+	return fmt.Sprintf("%s-chapter-%03d.html", strings.TrimSuffix(combined, filepath.Ext(combined)), i)
+}
+
+// frontFile returns where the title page and TOC are written for --split-render
+func frontFile(combined string) string {
+	return strings.TrimSuffix(combined, filepath.Ext(combined)) + "-front.html"
+}
+
+// renderChapters writes each top-level section of tree to a document of its
+// own next to the combined HTML file and renders them separately into output,
+// jobs at a time, all CPUs for 0
+func (o *options) renderChapters(r renderer.Renderer, tree *htmlproc.Node, combined, output string, opts htmlproc.DocumentOptions, setup renderer.PageSetup, running renderer.Running, jobs int) error {
+	chapters := htmlproc.SplitChapters(tree)
+	files := make([]string, len(chapters))
+	titles := make([]string, len(chapters))
+	for i, c := range chapters {
+		files[i] = chapterFile(combined, i)
+		titles[i] = c.Title
+		err := writeFile(files[i], func(w io.Writer) error {
+			return htmlproc.WriteChapter(w, c, opts)
+		})
+		if err != nil {
+			return fmt.Errorf("error writing chapter: %w", err)
+		}
+		if !o.keepFiles() {
+			defer os.Remove(files[i])
+		}
+	}
+
+	front := frontFile(combined)
+	if !o.keepFiles() {
+		defer os.Remove(front)
+	}
+	writeFront := func(starts []int) (string, error) {
+		if o.tocStyle == "none" {
+			starts = nil
+		}
+		err := os.WriteFile(front, []byte(htmlproc.BuildFrontMatter(chapters, starts, opts)), 0644)
+		if err != nil {
+			return "", fmt.Errorf("error writing title page: %w", err)
+		}
+		return front, nil
+	}
+
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	bar := progress.New("Rendering chapters")
+	defer bar.Finish()
+	return renderer.RenderChapters(r, files, writeFront, output, renderer.SplitOptions{
+		Jobs:     jobs,
+		Page:     setup,
+		Running:  running,
+		Titles:   titles,
+		Progress: bar.Set,
+	})
+}
+
+// runClean removes the clone, the copied docs, the cache and any intermediate
+// HTML left behind by an interrupted or --keep-intermediate build. Generated PDFs and
+// standalone HTML files are kept.
+func runClean(o *options) error {
+	var paths []string
+	if o.cleanClone {
+		paths = append(paths, o.repo.CloneDir)
+	}
+	if o.cleanDocs && !o.set["input"] {
+		// An --input of one's own holds the only copy of the docs
+		paths = append(paths, o.inputDir)
+	}
+	if o.cleanCache {
+		paths = append(paths, o.cacheDir)
+	} else {
+		paths = append(paths, filepath.Join(o.cacheDir, "pages"), filepath.Join(o.cacheDir, "renders"))
+	}
+	// The intermediate files kept by --keep-intermediate and --workdir,
+	// where targets keep theirs in a directory each
+	combinedFiles := []string{strings.TrimSuffix(o.outputFile, filepath.Ext(o.outputFile)) + ".html"}
+	if o.workDir != "" {
+		combinedFiles = append(combinedFiles, filepath.Join(o.workDir, "combined.html"))
+		targets, _ := filepath.Glob(filepath.Join(o.workDir, "*", "combined.html"))
+		combinedFiles = append(combinedFiles, targets...)
+	}
+	for _, combined := range combinedFiles {
+		paths = append(paths, combined, coverFile(combined), frontFile(combined), assetDir(combined))
+		chapters, _ := filepath.Glob(strings.TrimSuffix(combined, filepath.Ext(combined)) + "-chapter-[0-9][0-9][0-9].html")
+		paths = append(paths, chapters...)
+		volumes, _ := filepath.Glob(strings.TrimSuffix(combined, filepath.Ext(combined)) + "-volume-*.html")
+		paths = append(paths, volumes...)
+		pages, _ := filepath.Glob(strings.TrimSuffix(combined, filepath.Ext(combined)) + "-page-[0-9][0-9][0-9][0-9].html")
+		paths = append(paths, pages...)
+	}
+
+	for _, path := range paths {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+		slog.Info("Removing", "path", path)
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// finishPDF post-processes a rendered PDF as the flags ask: it writes meta
+// into it, optimizes, converts and encrypts it
+func (o *options) finishPDF(file string, meta renderer.Metadata) error {
+	if err := renderer.SetMetadata(file, meta); err != nil {
+		return fmt.Errorf("error setting PDF metadata: %w", err)
+	}
+	if o.optimize || o.linearize {
+		if err := o.optimizePDF(file); err != nil {
+			return err
+		}
+	}
+	if o.pdfa {
+		if err := o.convertPDFA(file); err != nil {
+			return err
+		}
+	}
+	if enc := o.encryption(); enc.Enabled() {
+		if err := renderer.Encrypt(file, enc); err != nil {
+			return fmt.Errorf("error encrypting PDF: %w", err)
+		}
+	}
+	return nil
+}
+
+// optimizePDF optimizes and/or linearizes file and reports the savings
+func (o *options) optimizePDF(file string) error {
+	opts := renderer.OptimizeOptions{
+		Recompress: o.optimize,
+		Quality:    o.jpegQuality,
+		Linearize:  o.linearize,
+		Canonical:  !o.sourceDate.IsZero(),
+	}
+	if o.targetSize != "" && o.optimize {
+		opts.TargetSize, _ = parseSize(o.targetSize)
+	}
+	before, after, err := renderer.Optimize(file, opts)
+	if err != nil {
+		return fmt.Errorf("error optimizing PDF: %w", err)
+	}
+	slog.Info("Optimized PDF", "before", before, "after", after,
+		"saved", fmt.Sprintf("%.0f%%", 100-100*float64(after)/float64(max(before, 1))))
+	return nil
+}
+
+// embedSources embeds the source files of the pages of tree in the PDF
+// file as --attach-sources asks, named by their page paths
+func (o *options) embedSources(file string, tree *htmlproc.Node) error {
+	if o.attachSources == "none" {
+		return nil
+	}
+	var files []renderer.Attachment
+	tree.Walk(func(n *htmlproc.Node) {
+		if n.File == "" {
+			return
+		}
+		name := n.Path
+		if base := filepath.Base(n.File); strings.HasPrefix(base, "index.") || name == "" {
+			name = path.Join(name, "index")
+		}
+		files = append(files, renderer.Attachment{Name: name + filepath.Ext(n.File), File: n.File})
+	})
+	if o.attachSources == "zip" {
+		archive := strings.TrimSuffix(file, filepath.Ext(file)) + "-sources.zip"
+		if err := writeZip(archive, files, o.sourceDate); err != nil {
+			return fmt.Errorf("error archiving sources: %w", err)
+		}
+		defer os.Remove(archive)
+		files = []renderer.Attachment{{Name: "sources.zip", File: archive}}
+	}
+	slog.Info("Attaching sources", "files", len(files))
+	if err := renderer.Attach(file, files, o.sourceDate); err != nil {
+		return fmt.Errorf("error attaching sources: %w", err)
+	}
+	return nil
+}
+
+// writeZip writes files to the zip archive file under their names, dated
+// date if it isn't zero
+func writeZip(file string, files []renderer.Attachment, date time.Time) error {
+	return writeFile(file, func(w io.Writer) error {
+		zw := zip.NewWriter(w)
+		for _, a := range files {
+			info, err := os.Stat(a.File)
+			if err != nil {
+				return err
+			}
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name, header.Method = a.Name, zip.Deflate
+			if !date.IsZero() {
+				header.Modified = date
+			}
+			fw, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(a.File)
+			if err != nil {
+				return err
+			}
+			if _, err := fw.Write(data); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	})
+}
+
+// writeBooklet imposes the finished PDF file for saddle-stitch binding as
+// --booklet asks, into a -booklet.pdf next to it, protected like file
+func (o *options) writeBooklet(file string) error {
+	if o.booklet == "" {
+		return nil
+	}
+	out := strings.TrimSuffix(file, filepath.Ext(file)) + "-booklet.pdf"
+	slog.Info("Imposing booklet", "file", out, "sheet", o.booklet)
+	enc := o.encryption()
+	password := enc.OwnerPassword
+	if password == "" {
+		password = enc.UserPassword
+	}
+	if err := renderer.Booklet(file, out, o.booklet, password); err != nil {
+		return fmt.Errorf("error imposing booklet: %w", err)
+	}
+	return nil
+}
+
+// convertPDFA converts file to PDF/A-2b and reports whether it conforms
+func (o *options) convertPDFA(file string) error {
+	if err := renderer.ConvertPDFA(file, o.iccProfile, o.sourceDate); err != nil {
+		return fmt.Errorf("error converting to PDF/A: %w", err)
+	}
+	problems, err := renderer.CheckPDFA(file)
+	if err != nil {
+		return fmt.Errorf("error checking PDF/A conformance: %w", err)
+	}
+	for _, p := range problems {
+		slog.Warn("Not PDF/A-2b conformant", "problem", p)
+	}
+	if len(problems) == 0 {
+		slog.Info("PDF/A-2b conformance checked", "file", file)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig reads a YAML config file. Its keys are flag names and its values
+// are what would be passed to the flag; lists are joined with commas.
+func loadConfig(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return flagValues(path, raw, "sources", "targets")
+}
+
+// flagValues turns the settings of a config file into flag values, leaving
+// out the keys in skip, which aren't flags
+func flagValues(path string, raw map[string]interface{}, skip ...string) (map[string]string, error) {
+	values := map[string]string{}
+	for key, value := range raw {
+		if slices.Contains(skip, key) {
+			// Not a flag, see loadSources and loadTargets
+			continue
+		}
+		switch v := value.(type) {
+		case nil:
+			values[key] = ""
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s: %s must be a value or a list", path, key)
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// applyConfig sets the flags of fs from the config file at path, except those
+// given on the command line. Keys that are flags of other subcommands are
+// ignored so that one file can serve all of them.
+func applyConfig(fs *flag.FlagSet, path string) error {
+	values, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	known := flag.NewFlagSet("config", flag.ContinueOnError)
+	all := &options{}
+	all.commonFlags(known)
+	all.fetchFlags(known)
+	all.buildFlags(known)
+	all.cleanFlags(known)
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if known.Lookup(key) == nil || key == "config" {
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		if set[key] || fs.Lookup(key) == nil {
+			continue
+		}
+		if err := fs.Set(key, values[key]); err != nil {
+			return fmt.Errorf("%s: invalid %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package main
+
+import "time"
+
+// cpuTime returns 0, the CPU time used is not known on this system
+func cpuTime() time.Duration {
+	return 0
+}
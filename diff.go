@@ -0,0 +1,178 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"log/slog"
+	"path"
+	"strings"
+
+	"i2pdoc2pdf/fetcher"
+	"i2pdoc2pdf/htmlproc"
+)
+
+// changesPath is the page path of the generated "What changed" chapter
+const changesPath = "_changes"
+
+// docChanges are the pages that changed between two refs of i2p.www
+type docChanges struct {
+	From, To string
+	Added    []string // Page paths
+	Modified []string
+	Removed  []string
+	Appendix bool // Whether the chapter goes at the end of a full build
+}
+
+// runDiff checks out --to, lists the pages added, modified and removed
+// since --from and builds a PDF of the added and modified pages that opens
+// with a "What changed" chapter listing them all. With --full every page is
+// built and the chapter is an appendix instead.
+func runDiff(o *options) error {
+	if o.diffFrom == "" {
+		return fmt.Errorf("diff needs --from, the commit, tag or branch to compare with")
+	}
+	if o.source != "git" {
+		return fmt.Errorf("diff needs --source git, the website has no commits to compare")
+	}
+	source, err := o.docsSource(true)
+	if err != nil {
+		return err
+	}
+	if _, err := source.Fetch(); err != nil {
+		return failed(exitFetch, fmt.Errorf("failed to fetch documentation: %w", err))
+	}
+	paths := []string{fetcher.DefaultDocsPath}
+	if o.specs {
+		paths = append(paths, fetcher.DefaultSpecsPath)
+	}
+	lines, err := fetcher.ChangedPaths(o.repo, o.diffFrom, paths...)
+	if err != nil {
+		return failed(exitFetch, err)
+	}
+
+	changes := parseChanges(lines)
+	changes.From, changes.To = o.diffFrom, cmp.Or(o.repo.Ref, o.repo.Branch)
+	changes.Appendix = o.diffFull
+	slog.Info("Docs changed", "from", changes.From, "to", changes.To,
+		"added", len(changes.Added), "modified", len(changes.Modified), "removed", len(changes.Removed))
+	if len(changes.Added)+len(changes.Modified) == 0 && !o.diffFull {
+		if len(changes.Removed) > 0 {
+			return fmt.Errorf("no pages were added or modified, %d were removed: %s", len(changes.Removed), strings.Join(changes.Removed, ", "))
+		}
+		slog.Info("No docs changes to build")
+		return nil
+	}
+	o.changes = changes
+	if !o.set["output"] {
+		o.outputFile = "i2p-documentation-changes.pdf"
+	}
+	if !o.set["subtitle"] {
+		o.subtitle = fmt.Sprintf("Changes from %s to %s", changes.From, changes.To)
+	}
+	return runBuild(o)
+}
+
+// parseChanges sorts the lines of fetcher.ChangedPaths into pages added,
+// modified and removed
+func parseChanges(lines []string) *docChanges {
+	changes := &docChanges{}
+	for _, line := range lines {
+		status, file, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		page, ok := changedPage(file)
+		if !ok {
+			continue
+		}
+		switch status[0] {
+		case 'A':
+			changes.Added = append(changes.Added, page)
+		case 'D':
+			changes.Removed = append(changes.Removed, page)
+		default:
+			changes.Modified = append(changes.Modified, page)
+		}
+	}
+	return changes
+}
+
+// changedPage returns the page path of a file of i2p.www, if it is a page of
+// the docs or the specifications
+func changedPage(file string) (string, bool) {
+	var page string
+	if rel, ok := strings.CutPrefix(file, fetcher.DefaultDocsPath+"/"); ok {
+		page = rel
+	} else if rel, ok := strings.CutPrefix(file, fetcher.DefaultSpecsPath+"/"); ok {
+		page = path.Join(htmlproc.SpecsPath, rel)
+	} else {
+		return "", false
+	}
+	switch path.Ext(page) {
+	case ".html", ".rst", ".md", ".markdown":
+	default:
+		return "", false
+	}
+	page = strings.TrimSuffix(page, path.Ext(page))
+	if path.Base(page) == "index" {
+		page = path.Dir(page)
+	}
+	return strings.Trim(path.Clean("/"+page), "/"), true
+}
+
+// filter returns the pages the build includes: the added and modified ones
+func (c *docChanges) filter() map[string]bool {
+	pages := map[string]bool{}
+	for _, p := range append(append([]string{}, c.Added...), c.Modified...) {
+		pages[p] = true
+	}
+	return pages
+}
+
+// addChapter adds the "What changed" chapter to tree, first or as an
+// appendix, linking the pages of tree that changed
+func (c *docChanges) addChapter(tree *htmlproc.Node) {
+	pages := map[string]*htmlproc.Node{}
+	tree.Walk(func(n *htmlproc.Node) {
+		if n.File != "" {
+			pages[n.Path] = n
+		}
+	})
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<p>Pages of the documentation that changed between <code>%s</code> and <code>%s</code>.</p>",
+		html.EscapeString(c.From), html.EscapeString(c.To))
+	list := func(title string, paths []string) {
+		if len(paths) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "<h3>%s (%d)</h3><ul>", title, len(paths))
+		for _, p := range paths {
+			if n, ok := pages[p]; ok {
+				fmt.Fprintf(&sb, `<li><a href="#%s">%s</a> <code>%s</code></li>`, n.ID, html.EscapeString(n.DisplayName()), html.EscapeString(p))
+			} else {
+				fmt.Fprintf(&sb, "<li><code>%s</code></li>", html.EscapeString(p))
+			}
+		}
+		sb.WriteString("</ul>")
+	}
+	list("Added pages", c.Added)
+	list("Modified pages", c.Modified)
+	list("Removed pages", c.Removed)
+
+	// The chapter has no file of its own, File only marks it as a page
+	chapter := &htmlproc.Node{
+		Name:    changesPath,
+		ID:      tree.ID + "-" + changesPath,
+		Path:    changesPath,
+		Title:   "What changed",
+		Content: sb.String(),
+		File:    changesPath,
+	}
+	if c.Appendix {
+		chapter.Appendix = true
+		tree.Children = append(tree.Children, chapter)
+	} else {
+		tree.Children = append([]*htmlproc.Node{chapter}, tree.Children...)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"i2pdoc2pdf/htmlproc"
+)
+
+// printDryRun prints to out what a build of tree would include for --dry-run: the
+// pages in reading order, the images they use and a rough size of the
+// document, the text of the pages and the images taken together
+func printDryRun(out io.Writer, tree *htmlproc.Node, assets []*htmlproc.AssetResolver) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	var text, images int64
+	pages := 0
+	tree.Walk(func(n *htmlproc.Node) {
+		if n.File != "" {
+			pages++
+			text += int64(len(n.Content))
+		}
+	})
+	fmt.Fprintf(w, "Pages (%d, in reading order):\n", pages)
+	tree.Walk(func(n *htmlproc.Node) {
+		if n.File == "" {
+			return
+		}
+		path := n.Path
+		if path == "" {
+			path = "index"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", path, n.DisplayName(), n.File)
+	})
+
+	var files, missing []string
+	for _, a := range assets {
+		files = append(files, a.Files()...)
+		missing = append(missing, a.Missing()...)
+	}
+	fmt.Fprintf(w, "\nImages (%d):\n", len(files))
+	for _, file := range files {
+		size := int64(0)
+		if info, err := os.Stat(file); err == nil {
+			size = info.Size()
+		}
+		images += size
+		fmt.Fprintf(w, "  %s\t%s\n", file, formatSize(size))
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(w, "\nMissing images (%d):\n", len(missing))
+		for _, ref := range missing {
+			fmt.Fprintf(w, "  %s\n", ref)
+		}
+	}
+	fmt.Fprintf(w, "\nEstimated size: %s (%s of text, %s of images)\n", formatSize(text+images), formatSize(text), formatSize(images))
+	w.Flush()
+}
+
+// formatSize formats a size in bytes the way parseSize reads it
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fk", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"i2pdoc2pdf/htmlproc"
+)
+
+// reportPageErrors sums up the pages that failed to process in the build,
+// which ended with err, at the end of the output and in --error-report. The
+// run fails if any page did, even if the document was written without them.
+func (o *options) reportPageErrors(err error) error {
+	if o.errorReport != "" {
+		report := struct {
+			Errors []htmlproc.PageError `json:"errors"`
+		}{Errors: append([]htmlproc.PageError{}, o.pageErrors...)}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if writeErr := os.WriteFile(o.errorReport, append(data, '\n'), 0644); writeErr != nil {
+			slog.Error("Cannot write --error-report", "err", writeErr)
+			if err == nil {
+				err = fmt.Errorf("error writing --error-report: %w", writeErr)
+			}
+		} else {
+			slog.Info("Wrote error report", "file", o.errorReport, "errors", len(o.pageErrors))
+		}
+	}
+	if len(o.pageErrors) == 0 {
+		return err
+	}
+
+	slog.Error("Some pages failed to process", "count", len(o.pageErrors))
+	for _, e := range o.pageErrors {
+		slog.Error("Failed page", "page", e.Page, "file", e.File, "err", e.Err)
+	}
+	if err != nil {
+		return err
+	}
+	return failed(exitPartial, fmt.Errorf("%d pages failed to process and were left out", len(o.pageErrors)))
+}
@@ -0,0 +1,143 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// CopyOptions controls how CopyDir handles the tree it copies
+type CopyOptions struct {
+	FollowSymlinks bool // Copy the files symlinks point to instead of recreating the links
+	DryRun         bool // Only log what would be copied
+}
+
+// CopyDir recursively copies the contents of source into destination,
+// preserving permission bits and modification times. Existing files in
+// destination are overwritten; the source is never modified.
+func CopyDir(source, destination string, opts CopyOptions) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", source)
+	}
+
+	return filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return copySymlink(path, target, opts)
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && path != source {
+				// Docs taken from the top of a repository leave its history behind
+				return filepath.SkipDir
+			}
+			if opts.DryRun {
+				slog.Info("[dry-run] mkdir", "dir", target)
+				return nil
+			}
+			if err := os.MkdirAll(target, info.Mode().Perm()|0700); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm()|0700)
+		}
+		if !info.Mode().IsRegular() {
+			slog.Warn("Skipping special file", "path", path)
+			return nil
+		}
+		if opts.DryRun {
+			slog.Info("[dry-run] copy", "from", path, "to", target)
+			return nil
+		}
+		return copyFile(path, target, info)
+	})
+}
+
+// copySymlink recreates the link at path as target, or copies what it points
+// to when following symlinks or when the platform refuses to create the link
+func copySymlink(path, target string, opts CopyOptions) error {
+	if !opts.FollowSymlinks {
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			slog.Info("[dry-run] symlink", "link", target, "target", link)
+			return nil
+		}
+		os.Remove(target)
+		err = os.Symlink(link, target)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("Could not create symlink, copying its target instead", "link", target, "err", err)
+	}
+
+	resolved, err := os.Stat(path)
+	if err != nil {
+		slog.Warn("Skipping dangling symlink", "path", path, "err", err)
+		return nil
+	}
+	if resolved.IsDir() {
+		return CopyDir(path, target, opts)
+	}
+	if opts.DryRun {
+		slog.Info("[dry-run] copy", "from", path, "to", target)
+		return nil
+	}
+	return copyFile(path, target, resolved)
+}
+
+// copyFile copies a single regular file, keeping its mode and modification time
+func copyFile(source, destination string, info os.FileInfo) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if errors.Is(err, fs.ErrPermission) {
+		// A read-only file copied by an earlier run is replaced rather than
+		// failing every run after the first
+		if os.Remove(destination) == nil {
+			out, err = os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", source, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(destination, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(destination, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,474 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IGNORE THIS (notes): wget http://archive.ubuntu.com/ubuntu/pool/main/o/openssl/libssl1.1_1.1.1f-1ubuntu2.23_amd64.deb
+// cleanupDownloadDir removes incomplete or failed downloads
+func cleanupDownloadDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Remove temporary wget files
+		if strings.HasSuffix(path, ".tmp") || strings.HasSuffix(path, ".wget") {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove temporary file %s: %w", path, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RepositoryInfo holds information about the Git repository
+type RepositoryInfo struct {
+	URL         string   // e.g., "https://github.com/username/i2p.www.git"
+	Branch      string   // e.g., "main"
+	CloneDir    string   // Local directory to clone into
+	SparsePaths []string // Subtrees to check out in sparse mode, e.g. "i2p2www/pages/site/docs"
+	Depth       int      // History depth to fetch in sparse mode, 0 for full history
+	Proxy       string   // HTTP or SOCKS proxy for talking to the remote, e.g. "http://127.0.0.1:4444"
+	Ref         string   // Commit, tag or branch to check out instead of the tip of Branch, e.g. "2.5.0"
+
+	// Timeout stops a git command that runs longer, 0 for no limit. The
+	// commands talking to the remote are tried Retries more times when they
+	// fail, waiting twice as long before each retry.
+	Timeout time.Duration
+	Retries int
+	// Mirrors are other URLs of the repository, tried in order when URL
+	// cannot be reached. Eepsite mirrors are reached through I2PProxy unless
+	// Proxy is set.
+	Mirrors []string
+	// Output is where git writes its messages and progress, nil to log them
+	// at debug level instead
+	Output io.Writer
+}
+
+// I2PProxy is the default HTTP proxy of an I2P router
+const I2PProxy = "http://127.0.0.1:4444"
+
+// I2PRepoURL is the i2p.www repository on the I2P-hosted git server, reachable
+// through I2PProxy without any clearnet access
+const I2PRepoURL = "http://git.idk.i2p/i2p-hackers/i2p.www.git"
+
+// I2PSiteURL is the website's eepsite, for crawling it over I2P
+const I2PSiteURL = "http://i2p-projekt.i2p"
+
+// ExecuteCommand runs a shell command and returns an error with its output
+// if it fails. Its output is logged at debug level.
+func ExecuteCommand(dir string, name string, args ...string) error {
+	return ExecuteCommandTimeout(0, dir, name, args...)
+}
+
+// ExecuteCommandTimeout is ExecuteCommand, stopping the command if it runs
+// longer than timeout unless that is 0
+func ExecuteCommandTimeout(timeout time.Duration, dir string, name string, args ...string) error {
+	return runCommand(timeout, dir, nil, name, args...)
+}
+
+// runCommand runs a command in dir, stopping it if it runs longer than
+// timeout unless that is 0. Its output goes to out, or if out is nil to the
+// log at debug level and to the error if it fails.
+func runCommand(timeout time.Duration, dir string, out io.Writer, name string, args ...string) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	var output bytes.Buffer
+	if out == nil {
+		out = &output
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// Don't wait forever for the children of a killed command either
+	cmd.WaitDelay = 10 * time.Second
+
+	// Run the command and capture any errors
+	err := cmd.Run()
+	msg := strings.TrimSpace(output.String())
+	if msg != "" {
+		slog.Debug("Command output", "command", name, "output", msg)
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("command timed out after %s: %s %v", timeout, name, args)
+		}
+		if msg != "" {
+			return fmt.Errorf("command failed: %s %v, error: %v\n%s", name, args, err, msg)
+		}
+		return fmt.Errorf("command failed: %s %v, error: %v", name, args, err)
+	}
+	return nil
+}
+
+// git runs a local git command in repo.CloneDir
+func git(repo RepositoryInfo, args ...string) error {
+	if runtime.GOOS == "windows" {
+		// Paths in the docs may be longer than the 260 characters Windows
+		// allows unless asked, failing checkouts on later runs
+		args = append([]string{"-c", "core.longpaths=true"}, args...)
+	}
+	return runCommand(repo.Timeout, repo.CloneDir, repo.Output, "git", args...)
+}
+
+// remoteGit runs a git command that talks to the remote, through repo.Proxy
+// if one is set. It is retried repo.Retries times, then tried against each
+// of repo.Mirrors in turn, leaving origin at the URL that worked.
+func remoteGit(repo RepositoryInfo, args ...string) error {
+	var err error
+	for i, remote := range append([]string{repo.URL}, repo.Mirrors...) {
+		if i > 0 {
+			slog.Warn("Trying mirror", "url", remote, "err", err)
+		}
+		if len(repo.Mirrors) > 0 {
+			if err := git(repo, "remote", "set-url", "origin", remote); err != nil {
+				return err
+			}
+		}
+		if err = retryGit(repo, proxyFor(repo, remote), args...); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// retryGit runs a git command through proxy, unless it is empty, retrying it
+// repo.Retries times
+func retryGit(repo RepositoryInfo, proxy string, args ...string) error {
+	if proxy != "" {
+		args = append([]string{"-c", "http.proxy=" + proxy}, args...)
+	}
+	wait := 5 * time.Second
+	for retry := 0; ; retry++ {
+		err := git(repo, args...)
+		if err == nil || retry >= repo.Retries {
+			return err
+		}
+		slog.Warn("Retrying git", "in", wait, "retry", retry+1, "of", repo.Retries, "err", err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// proxyFor returns the proxy to reach the repository at rawURL through:
+// repo.Proxy, or else I2PProxy for eepsites
+func proxyFor(repo RepositoryInfo, rawURL string) string {
+	if repo.Proxy != "" {
+		return repo.Proxy
+	}
+	if u, err := url.Parse(rawURL); err == nil && strings.HasSuffix(u.Hostname(), ".i2p") {
+		return I2PProxy
+	}
+	return ""
+}
+
+// CloneRepo fetches the whole history of the branch into repo.CloneDir
+func CloneRepo(repo RepositoryInfo) error {
+	// Ensure the clone directory exists
+	if _, err := os.Stat(repo.CloneDir); os.IsNotExist(err) {
+		err := os.MkdirAll(repo.CloneDir, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", repo.CloneDir, err)
+		}
+	}
+
+	// Step 1: Initialize the Git repository
+	slog.Info("Initializing Git repository", "dir", repo.CloneDir)
+	if err := git(repo, "init"); err != nil {
+		return err
+	}
+
+	// Step 2: Add remote origin
+	slog.Info("Adding remote origin", "url", repo.URL)
+	if err := git(repo, "remote", "add", "origin", repo.URL); err != nil {
+		return err
+	}
+
+	if repo.Ref != "" {
+		// Depth only applies to sparse clones, don't make a full one shallow
+		repo.Depth = 0
+		if err := fetchAndCheckout(repo); err != nil {
+			return err
+		}
+		slog.Info("Clone completed")
+		return nil
+	}
+
+	// Step 5: Pull the specified branch
+	slog.Info("Pulling branch", "branch", repo.Branch)
+	if err := remoteGit(repo, "pull", "origin", repo.Branch); err != nil {
+		return err
+	}
+
+	slog.Info("Sparse clone completed")
+	return nil
+}
+
+// UpdateRepo fetches the latest commit of the branch, or repo.Ref, into an
+// existing clone and checks it out, keeping the clone's sparse paths and
+// history depth
+func UpdateRepo(repo RepositoryInfo) error {
+	// --repo or --i2p may point somewhere else than the original clone
+	if err := git(repo, "remote", "set-url", "origin", repo.URL); err != nil {
+		return err
+	}
+	return fetchAndCheckout(repo)
+}
+
+// fetchAndCheckout fetches repo.Ref, or else the branch, with at most
+// repo.Depth commits of history and checks it out. A ref is checked out as a
+// detached HEAD, the branch is reset to the fetched commit.
+func fetchAndCheckout(repo RepositoryInfo) error {
+	target := repo.Branch
+	if repo.Ref != "" {
+		target = repo.Ref
+	}
+	slog.Info("Fetching", "ref", target)
+	args := []string{"fetch", "--no-tags"}
+	if repo.Depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", repo.Depth))
+	}
+	args = append(args, "origin", target)
+	if err := remoteGit(repo, args...); err != nil {
+		return err
+	}
+
+	slog.Info("Checking out", "ref", target)
+	if repo.Ref != "" {
+		return git(repo, "checkout", "--detach", "FETCH_HEAD")
+	}
+	return git(repo, "checkout", "-B", repo.Branch, "FETCH_HEAD")
+}
+
+// gitOutput runs a git command in dir and returns its trimmed output
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s in %s: %w", strings.Join(args, " "), dir, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// HeadCommit returns the abbreviated hash of the commit checked out in dir
+func HeadCommit(dir string) (string, error) {
+	return gitOutput(dir, "rev-parse", "--short", "HEAD")
+}
+
+// OriginURL returns the URL of the remote the clone in dir was fetched from
+func OriginURL(dir string) (string, error) {
+	return gitOutput(dir, "remote", "get-url", "origin")
+}
+
+// FullHeadCommit returns the full hash of the commit checked out in dir
+func FullHeadCommit(dir string) (string, error) {
+	return gitOutput(dir, "rev-parse", "HEAD")
+}
+
+// HeadCommitTime returns when the commit checked out in dir was made
+func HeadCommitTime(dir string) (time.Time, error) {
+	out, err := gitOutput(dir, "log", "-1", "--format=%ct", "HEAD")
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected commit time %q: %w", out, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// ChangedPaths lists the files below paths that differ between since, a
+// commit or another ref, and the checked out commit, as "<status>\t<path>"
+// lines of git diff --name-status, renames as a deletion and an addition. A
+// commit missing from a shallow clone is fetched first.
+func ChangedPaths(repo RepositoryInfo, since string, paths ...string) ([]string, error) {
+	from := since
+	if _, err := gitOutput(repo.CloneDir, "cat-file", "-e", since+"^{commit}"); err != nil {
+		if err := remoteGit(repo, "fetch", "--no-tags", "--depth=1", "origin", since); err != nil {
+			return nil, fmt.Errorf("cannot fetch commit %s: %w", since, err)
+		}
+		// A tag or branch fetched by name doesn't become a local ref
+		from = "FETCH_HEAD"
+	}
+	args := append([]string{"diff", "--name-status", "--no-renames", from, "HEAD", "--"}, paths...)
+	out, err := gitOutput(repo.CloneDir, args...)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// Commit is a commit of the repository as Log lists it
+type Commit struct {
+	Hash    string
+	Time    time.Time
+	Author  string
+	Subject string
+	Files   []string // Files below the paths given to Log that it changed
+}
+
+// Log lists the commits made since since that touch paths, newest first,
+// up to the checked out commit. A shallow clone is deepened to since first;
+// when that fails the commits it has are listed.
+func Log(repo RepositoryInfo, since time.Time, paths ...string) ([]Commit, error) {
+	if shallow, _ := gitOutput(repo.CloneDir, "rev-parse", "--is-shallow-repository"); shallow == "true" {
+		target := repo.Branch
+		if repo.Ref != "" {
+			target = repo.Ref
+		}
+		if err := remoteGit(repo, "fetch", "--no-tags", "--shallow-since="+since.Format(time.RFC3339), "origin", target); err != nil {
+			slog.Warn("Cannot fetch the history of the docs, listing the commits of the clone", "err", err)
+		}
+	}
+	// Records are separated by \x1e and their fields by \x1f, the files
+	// follow the fields one per line
+	args := append([]string{"log", "--since=" + since.Format(time.RFC3339), "--no-renames", "--name-only",
+		"--format=%x1e%H%x1f%ct%x1f%an%x1f%s", "HEAD", "--"}, paths...)
+	out, err := gitOutput(repo.CloneDir, args...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, record := range strings.Split(out, "\x1e") {
+		header, files, _ := strings.Cut(record, "\n")
+		fields := strings.Split(header, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected commit time %q: %w", fields[1], err)
+		}
+		c := Commit{Hash: fields[0], Time: time.Unix(seconds, 0).UTC(), Author: fields[2], Subject: fields[3]}
+		for _, file := range strings.Split(files, "\n") {
+			if file = strings.TrimSpace(file); file != "" {
+				c.Files = append(c.Files, file)
+			}
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// LastChanged returns when each file below paths was last changed, by the
+// date of the newest commit touching it up to the checked out commit. A
+// shallow clone is unshallowed first, fetching the history without file
+// contents; when that fails the files that didn't change within its history
+// are left out, the oldest commit it has would only tell when they were
+// fetched.
+func LastChanged(repo RepositoryInfo, paths ...string) (map[string]time.Time, error) {
+	shallowFile, err := gitOutput(repo.CloneDir, "rev-parse", "--git-path", "shallow")
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(shallowFile) {
+		shallowFile = filepath.Join(repo.CloneDir, shallowFile)
+	}
+	if _, err := os.Stat(shallowFile); err == nil {
+		target := repo.Branch
+		if repo.Ref != "" {
+			target = repo.Ref
+		}
+		if err := remoteGit(repo, "fetch", "--no-tags", "--unshallow", "--filter=blob:none", "origin", target); err != nil {
+			slog.Warn("Cannot fetch the history of the docs, dating the pages from the commits of the clone", "err", err)
+		}
+	}
+	shallow := map[string]bool{}
+	if data, err := os.ReadFile(shallowFile); err == nil {
+		for _, hash := range strings.Fields(string(data)) {
+			shallow[hash] = true
+		}
+	}
+	args := append([]string{"log", "--no-renames", "--name-only", "--format=%x1e%H %ct", "HEAD", "--"}, paths...)
+	out, err := gitOutput(repo.CloneDir, args...)
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]time.Time{}
+	for _, record := range strings.Split(out, "\x1e") {
+		header, files, _ := strings.Cut(record, "\n")
+		hash, ct, ok := strings.Cut(strings.TrimSpace(header), " ")
+		if !ok || shallow[hash] {
+			continue
+		}
+		seconds, err := strconv.ParseInt(ct, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected commit time %q: %w", ct, err)
+		}
+		for _, file := range strings.Split(files, "\n") {
+			file = strings.TrimSpace(file)
+			if _, seen := changed[file]; file != "" && !seen {
+				changed[file] = time.Unix(seconds, 0).UTC()
+			}
+		}
+	}
+	return changed, nil
+}
+
+// EnsureSparsePath adds path to the sparse checkout of an existing clone if it
+// isn't checked out yet
+func EnsureSparsePath(repo RepositoryInfo, path string) error {
+	if _, err := os.Stat(filepath.Join(repo.CloneDir, filepath.FromSlash(path))); err == nil {
+		return nil
+	}
+	slog.Info("Adding to the sparse checkout", "path", path)
+	return git(repo, "sparse-checkout", "add", path)
+}
+
+// CloneSparseRepo fetches only repo.SparsePaths of the branch, with at most
+// repo.Depth commits of history, instead of the whole repository
+func CloneSparseRepo(repo RepositoryInfo) error {
+	// Ensure the clone directory exists
+	if _, err := os.Stat(repo.CloneDir); os.IsNotExist(err) {
+		err := os.MkdirAll(repo.CloneDir, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", repo.CloneDir, err)
+		}
+	}
+
+	// Step 1: Initialize the Git repository
+	slog.Info("Initializing Git repository", "dir", repo.CloneDir)
+	if err := git(repo, "init"); err != nil {
+		return err
+	}
+
+	// Step 2: Add remote origin
+	slog.Info("Adding remote origin", "url", repo.URL)
+	if err := git(repo, "remote", "add", "origin", repo.URL); err != nil {
+		return err
+	}
+
+	// Step 3: Restrict the working tree to the requested subtrees
+	slog.Info("Configuring sparse checkout", "paths", repo.SparsePaths)
+	args := append([]string{"sparse-checkout", "set", "--cone"}, repo.SparsePaths...)
+	if err := git(repo, args...); err != nil {
+		return err
+	}
+
+	// Step 4: Fetch the branch or ref, shallow if a depth was given, and
+	// check it out
+	if err := fetchAndCheckout(repo); err != nil {
+		return err
+	}
+
+	slog.Info("Sparse clone completed")
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package fetcher makes documentation sources available as a local
+// directory of pages, cloning the i2p.www repository when needed.
+package fetcher
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Source provides a local directory of documentation pages
+type Source interface {
+	// Fetch makes the pages available locally and returns their directory
+	Fetch() (string, error)
+}
+
+// LocalSource is a directory of pages that already exists on disk
+type LocalSource struct {
+	Dir string
+}
+
+// Fetch returns the directory, after checking that it exists
+func (s LocalSource) Fetch() (string, error) {
+	info, err := os.Stat(s.Dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", s.Dir)
+	}
+	return s.Dir, nil
+}
+
+// GitSource clones a documentation repository (unless it was cloned before)
+// and copies its docs subtree to a working directory
+type GitSource struct {
+	Repo     RepositoryInfo
+	Sparse   bool        // Clone with CloneSparseRepo instead of CloneRepo
+	Update   bool        // Pull the latest commit into an existing clone (always done for Repo.Ref)
+	DocsPath string      // Slash-separated path of the docs inside the repository
+	DestDir  string      // Directory the docs are copied to
+	Copy     CopyOptions // How the docs are copied
+	// SpecsPath is the slash-separated path of the specifications inside the
+	// repository, copied to a directory of the same base name in DestDir;
+	// empty to leave them out
+	SpecsPath string
+	// ExtraPaths are widened into an existing sparse clone that predates them,
+	// e.g. translations needed only for some builds
+	ExtraPaths []string
+}
+
+// DefaultMirrors are other places the i2p.www repository is published: on
+// the I2P project's GitLab and on its eepsite
+var DefaultMirrors = []string{"https://i2pgit.org/i2p-hackers/i2p.www.git", I2PRepoURL}
+
+// DefaultDocsPath is where the documentation lives in the i2p.www repository
+const DefaultDocsPath = "i2p2www/pages/site/docs"
+
+// DefaultSpecsPath is where the specifications and proposals live in the
+// i2p.www repository, mostly as reStructuredText
+const DefaultSpecsPath = "i2p2www/spec"
+
+// Fetch clones the repository if needed and copies the docs to DestDir
+func (s *GitSource) Fetch() (string, error) {
+	// Get absolute path for CloneDir
+	absPath, err := filepath.Abs(s.Repo.CloneDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	s.Repo.CloneDir = absPath
+
+	// Check if the clone directory already exists
+	if _, err := os.Stat(s.Repo.CloneDir); os.IsNotExist(err) {
+		// Directory does not exist, proceed to clone
+		slog.Info("Cloning the repository", "dir", s.Repo.CloneDir)
+		clone := CloneRepo
+		if s.Sparse {
+			clone = CloneSparseRepo
+		}
+		if err := clone(s.Repo); err != nil {
+			return "", fmt.Errorf("failed to clone repository: %w", err)
+		}
+	} else if s.Update || s.Repo.Ref != "" {
+		// An existing clone may be at another commit than the pinned ref
+		repo := s.Repo
+		if !s.Sparse {
+			// Depth only applies to sparse clones, don't make a full one shallow
+			repo.Depth = 0
+		}
+		if err := UpdateRepo(repo); err != nil {
+			return "", fmt.Errorf("failed to update repository: %w", err)
+		}
+	} else {
+		// Directory exists, skip cloning
+		slog.Info("Repository already cloned, skipping clone", "dir", s.Repo.CloneDir)
+	}
+
+	// An existing sparse clone may predate some paths, widen it if needed
+	if s.Sparse {
+		for _, path := range s.ExtraPaths {
+			if err := EnsureSparsePath(s.Repo, path); err != nil {
+				return "", fmt.Errorf("failed to add %s to the sparse checkout: %w", path, err)
+			}
+		}
+	}
+
+	docsDir := filepath.Join(s.Repo.CloneDir, filepath.FromSlash(s.DocsPath))
+	if err := CopyDir(docsDir, s.DestDir, s.Copy); err != nil {
+		return "", fmt.Errorf("failed to copy %s to %s: %w", docsDir, s.DestDir, err)
+	}
+	if s.SpecsPath != "" {
+		specsDir := filepath.Join(s.Repo.CloneDir, filepath.FromSlash(s.SpecsPath))
+		dest := filepath.Join(s.DestDir, path.Base(s.SpecsPath))
+		if err := CopyDir(specsDir, dest, s.Copy); err != nil {
+			return "", fmt.Errorf("failed to copy %s to %s: %w", specsDir, dest, err)
+		}
+	}
+	return s.DestDir, nil
+}
@@ -0,0 +1,233 @@
+package fetcher
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// WebSource crawls the rendered documentation on a live website, so the pages
+// are already templated and translated. Pages are saved below DestDir
+// mirroring their URL paths relative to BaseURL; their images are saved below
+// DestDir/_assets and referenced relatively.
+type WebSource struct {
+	BaseURL  string        // Only pages below this URL are crawled, e.g. "https://geti2p.net/en/docs"
+	DestDir  string        // Directory the pages are saved to
+	MaxDepth int           // Number of links followed from BaseURL, 0 for no limit
+	Delay    time.Duration // Pause between requests, to go easy on the server
+	Proxy    string        // HTTP or SOCKS proxy, e.g. I2PProxy for an eepsite
+	// Progress, if not nil, is called after each page with the number of
+	// pages crawled and the number known so far
+	Progress func(done, total int)
+}
+
+// assetDir is where a crawl saves images, relative to DestDir
+const assetDir = "_assets"
+
+// Fetch crawls BaseURL breadth first and returns DestDir
+func (s *WebSource) Fetch() (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(s.BaseURL, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL: %w", err)
+	}
+	client := &http.Client{Timeout: time.Minute}
+	if s.Proxy != "" {
+		proxy, err := url.Parse(s.Proxy)
+		if err != nil {
+			return "", fmt.Errorf("invalid proxy: %w", err)
+		}
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(proxy)}
+	}
+	c := &crawler{source: s, base: base, client: client, seen: map[string]bool{}}
+
+	type queued struct {
+		u     *url.URL
+		depth int
+	}
+	queue := []queued{{base, 0}}
+	c.seen[base.String()] = true
+	done := 0
+	for ; len(queue) > 0; done++ {
+		if s.Progress != nil {
+			s.Progress(done, done+len(queue))
+		}
+		q := queue[0]
+		queue = queue[1:]
+		links, err := c.savePage(q.u)
+		if err != nil {
+			if q.depth == 0 {
+				return "", err
+			}
+			slog.Warn("Skipping page", "url", q.u, "err", err)
+			continue
+		}
+		if s.MaxDepth > 0 && q.depth >= s.MaxDepth {
+			continue
+		}
+		for _, link := range links {
+			queue = append(queue, queued{link, q.depth + 1})
+		}
+	}
+	if s.Progress != nil {
+		s.Progress(done, done)
+	}
+	slog.Info("Crawled pages", "count", c.pages, "url", s.BaseURL)
+	return s.DestDir, nil
+}
+
+// crawler holds the state of one crawl
+type crawler struct {
+	source *WebSource
+	base   *url.URL
+	client *http.Client
+	seen   map[string]bool // URLs already queued or downloaded
+	last   time.Time       // Time of the last request, for rate limiting
+	pages  int
+}
+
+// get downloads u, waiting for the crawl delay first
+func (c *crawler) get(u *url.URL) (*http.Response, error) {
+	if wait := c.source.Delay - time.Since(c.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	c.last = time.Now()
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return resp, nil
+}
+
+// inScope reports whether u is a page below the base URL
+func (c *crawler) inScope(u *url.URL) bool {
+	if u.Scheme != c.base.Scheme || !strings.EqualFold(u.Host, c.base.Host) {
+		return false
+	}
+	p := strings.TrimSuffix(u.Path, "/")
+	return p == c.base.Path || strings.HasPrefix(p, c.base.Path+"/")
+}
+
+// localPath returns where the page at u is saved, relative to DestDir
+func (c *crawler) localPath(u *url.URL) string {
+	rel := strings.Trim(strings.TrimPrefix(u.Path, c.base.Path), "/")
+	if rel == "" {
+		return "index.html"
+	}
+	if path.Ext(rel) != ".html" {
+		rel += ".html"
+	}
+	return rel
+}
+
+// savePage downloads the page at u, saves it with its images and returns the
+// in-scope links it contains that haven't been seen yet
+func (c *crawler) savePage(u *url.URL) ([]*url.URL, error) {
+	resp, err := c.get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return nil, fmt.Errorf("not an HTML page (%s)", mediaType)
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// Redirects may have moved the page
+	u = resp.Request.URL
+	if !c.inScope(u) {
+		return nil, fmt.Errorf("redirected outside of %s to %s", c.base, u)
+	}
+	local := c.localPath(u)
+
+	var links []*url.URL
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		link, err := u.Parse(href)
+		if err != nil {
+			return
+		}
+		// Saved pages live at other paths than their URLs, make links absolute
+		s.SetAttr("href", link.String())
+		link.Fragment, link.RawQuery = "", ""
+		if !c.inScope(link) || c.seen[link.String()] {
+			return
+		}
+		c.seen[link.String()] = true
+		links = append(links, link)
+	})
+
+	doc.Find("img[src]").Each(func(i int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		img, err := u.Parse(src)
+		if err != nil || (img.Scheme != "http" && img.Scheme != "https") {
+			return
+		}
+		name := path.Join(assetDir, img.Hostname(), img.Path)
+		if err := c.saveAsset(img, name); err != nil {
+			slog.Warn("Cannot download image", "url", img, "err", err)
+			return
+		}
+		rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(local)), filepath.FromSlash(name))
+		if err == nil {
+			s.SetAttr("src", (&url.URL{Path: filepath.ToSlash(rel)}).String())
+		}
+	})
+
+	html, err := doc.Html()
+	if err != nil {
+		return nil, err
+	}
+	dest := filepath.Join(c.source.DestDir, filepath.FromSlash(local))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(dest, []byte(html), 0644); err != nil {
+		return nil, err
+	}
+	c.pages++
+	slog.Debug("Saved page", "url", u, "file", local)
+	return links, nil
+}
+
+// saveAsset downloads u to name below DestDir, unless it was already saved
+func (c *crawler) saveAsset(u *url.URL, name string) error {
+	if c.seen[u.String()] {
+		return nil
+	}
+	c.seen[u.String()] = true
+	resp, err := c.get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dest := filepath.Join(c.source.DestDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"i2pdoc2pdf/htmlproc"
+)
+
+// fontFile is a font file of --font to embed, under the family name given
+// before "=" or else its file name
+type fontFile struct {
+	family string
+	file   string
+}
+
+// fontFiles parses --font
+func (o *options) fontFiles() ([]fontFile, error) {
+	var fonts []fontFile
+	for _, spec := range splitList(o.fonts) {
+		family, file, ok := strings.Cut(spec, "=")
+		if !ok {
+			file = spec
+			family = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		family, file = strings.TrimSpace(family), strings.TrimSpace(file)
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".ttf", ".otf", ".ttc", ".woff", ".woff2":
+		default:
+			return nil, fmt.Errorf("--font %s is not a TrueType, OpenType or WOFF font", file)
+		}
+		if !fileExists(file) {
+			return nil, fmt.Errorf("--font %s not found", file)
+		}
+		fonts = append(fonts, fontFile{family: family, file: file})
+	}
+	return fonts, nil
+}
+
+// embedFonts adds the fonts of --font to opts, copied along with the images
+// by assets
+func (o *options) embedFonts(opts *htmlproc.DocumentOptions, assets *htmlproc.AssetResolver) {
+	fonts, _ := o.fontFiles() // Checked by checkFonts
+	for _, f := range fonts {
+		opts.Fonts = append(opts.Fonts, htmlproc.Font{Family: f.family, Href: assets.Add(f.file)})
+	}
+	opts.FontFamily = o.fontFamily
+}
+
+// checkFonts checks --font and warns when no installed font covers the
+// languages of the document, whose text would then render as boxes.
+// fc-list only knows the fonts of fontconfig, which wkhtmltopdf and Chrome
+// use on Linux and BSD.
+func (o *options) checkFonts() error {
+	fonts, err := o.fontFiles()
+	if err != nil {
+		return err
+	}
+	if len(fonts) > 0 || o.fontFamily != "" {
+		return nil
+	}
+	if _, err := exec.LookPath("fc-list"); err != nil {
+		return nil
+	}
+	for _, lang := range append([]string{o.lang}, splitList(o.withLangs)...) {
+		if lang == "" || !htmlproc.NeedsFonts(lang) {
+			continue
+		}
+		code := strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+		out, err := exec.Command("fc-list", ":lang="+code, "family").Output()
+		if err == nil && strings.TrimSpace(string(out)) == "" {
+			slog.Warn("No installed font covers the language, its text may render as boxes; install e.g. the Noto fonts for it or pass --font", "lang", lang)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package htmlproc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/unicode/norm"
+)
+
+// AssetResolver locates the images pages refer to, in the page's directory or
+// in the site's static directories, and points the references at copies
+// placed under Dir next to the combined document
+type AssetResolver struct {
+	BaseDir    string   // Input directory of the pages
+	StaticDirs []string // Directories searched for url_for('static') and /static/ references
+	Dir        string   // Directory of the copies, relative to the combined document
+	// SVG converts SVG images to PNG while copying them, nil to copy them as
+	// they are
+	SVG *SVGRasterizer
+	// Images shrinks PNG and JPEG images while copying them, nil to copy
+	// them as they are
+	Images *ImageOptimizer
+
+	mu      sync.Mutex          // Guards files and missing, pages may be processed concurrently
+	files   map[string]string   // Reference below Dir → source file
+	missing map[string][]string // Unresolved reference → pages using it
+}
+
+// Rewrite resolves the img sources of a page. Remote and data URIs are left
+// alone; sources that can't be found are recorded for Report. It returns the
+// assets the page uses (copy name → source file) and the missing sources.
+func (r *AssetResolver) Rewrite(doc *goquery.Document, htmlFile string) (used map[string]string, missing []string) {
+	used = map[string]string{}
+	doc.Find("img[src]").Each(func(i int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		u, err := url.Parse(src)
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+			return
+		}
+		name, file := r.locate(u.Path, htmlFile)
+		if file == "" {
+			missing = append(missing, src)
+			return
+		}
+		if r.SVG != nil && strings.EqualFold(filepath.Ext(file), ".svg") {
+			name += ".png"
+			// Keep the diagram at its own size rather than the raster's
+			if _, ok := s.Attr("width"); !ok {
+				if w, _, err := svgSize(file); err == nil {
+					s.SetAttr("width", fmt.Sprint(int(w+0.5)))
+				}
+			}
+		}
+		if r.Images != nil {
+			p := r.Images.plan(file)
+			if p.jpeg {
+				name += ".jpg"
+			}
+			// Keep the image at its own size rather than the scaled one's
+			if _, ok := s.Attr("width"); !ok && r.Images.MaxWidth > 0 && p.width > r.Images.MaxWidth {
+				s.SetAttr("width", fmt.Sprint(p.width))
+			}
+		}
+		used[name] = file
+		s.SetAttr("src", fileRef(path.Join(filepath.ToSlash(r.Dir), name)))
+	})
+	r.record(htmlFile, used, missing)
+	return used, missing
+}
+
+// record adds the assets used by a page to those CopyTo copies and Report
+// reports
+func (r *AssetResolver) record(htmlFile string, used map[string]string, missing []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.files == nil {
+		r.files = map[string]string{}
+		r.missing = map[string][]string{}
+	}
+	for name, file := range used {
+		r.files[name] = file
+	}
+	for _, src := range missing {
+		r.missing[src] = append(r.missing[src], htmlFile)
+	}
+}
+
+// Add has CopyTo copy file along with the pages' images, e.g. a logo for the
+// title page, and returns its reference relative to the combined document
+func (r *AssetResolver) Add(file string) string {
+	name := copyName("extra", filepath.Base(file))
+	if r.SVG != nil && strings.EqualFold(filepath.Ext(file), ".svg") {
+		name += ".png"
+	}
+	r.record("", map[string]string{name: file}, nil)
+	return fileRef(path.Join(filepath.ToSlash(r.Dir), name))
+}
+
+// locate finds the file a reference points to and the name of its copy
+func (r *AssetResolver) locate(ref, htmlFile string) (name, file string) {
+	ref = path.Clean(ref)
+	if !strings.HasPrefix(ref, "/") {
+		candidate := findFile(filepath.Join(filepath.Dir(htmlFile), filepath.FromSlash(ref)))
+		if rel, err := filepath.Rel(r.BaseDir, candidate); err == nil && !strings.HasPrefix(rel, "..") && candidate != "" {
+			return copyName("pages", filepath.ToSlash(rel)), candidate
+		}
+	}
+
+	// url_for('static', filename=...) renders to the path inside the static
+	// directory, other references may include the /static/ prefix
+	static := strings.TrimPrefix(strings.TrimPrefix(ref, "/"), "static/")
+	if strings.HasPrefix(static, "..") {
+		return "", ""
+	}
+	for _, dir := range r.StaticDirs {
+		if candidate := findFile(filepath.Join(dir, filepath.FromSlash(static))); candidate != "" {
+			return copyName("static", static), candidate
+		}
+	}
+	return "", ""
+}
+
+// isFile reports whether path is an existing regular file
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// findFile returns file if it exists, or else the same name with its
+// accented letters composed or decomposed, as macOS may have saved it while
+// the page refers to it the other way, or "" if there is none
+func findFile(file string) string {
+	for _, candidate := range []string{file, norm.NFC.String(file), norm.NFD.String(file)} {
+		if isFile(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// maxCopyName is the longest name below a directory of AssetResolver.Dir an
+// asset's copy keeps. Longer names and non-ASCII ones are replaced by a hash,
+// so the paths the engines open stay short and plain, as wkhtmltopdf and
+// Chrome need on Windows.
+const maxCopyName = 100
+
+// copyName returns the name of the copy of the asset at rel in the directory
+// dir of AssetResolver.Dir
+func copyName(dir, rel string) string {
+	plain := len(rel) <= maxCopyName
+	for _, c := range rel {
+		plain = plain && c > ' ' && c < utf8.RuneSelf
+	}
+	if plain {
+		return path.Join(dir, rel)
+	}
+	sum := sha256.Sum256([]byte(rel))
+	ext := strings.ToLower(path.Ext(rel))
+	if !copyExt.MatchString(ext) {
+		ext = ""
+	}
+	return path.Join(dir, "long", hex.EncodeToString(sum[:8])+ext)
+}
+
+// copyExt matches the extensions kept by copyName
+var copyExt = regexp.MustCompile(`^\.[a-z0-9]{1,8}$`)
+
+// fileRef returns a slash-separated relative path as the value of an src or
+// href, percent-encoded so that names with spaces, # or ? keep pointing at
+// their file
+func fileRef(p string) string {
+	return (&url.URL{Path: p}).String()
+}
+
+// CopyTo copies every resolved asset below dir/Dir, where dir is the
+// directory of the combined document
+func (r *AssetResolver) CopyTo(dir string) error {
+	for name, file := range r.files {
+		dest := filepath.Join(dir, r.Dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if r.SVG != nil && strings.EqualFold(filepath.Ext(file), ".svg") {
+			if err := r.SVG.Rasterize(file, dest); err != nil {
+				return fmt.Errorf("failed to rasterize %s: %w", file, err)
+			}
+			continue
+		}
+		if r.Images != nil {
+			done, err := r.Images.copy(file, dest)
+			if err != nil {
+				return fmt.Errorf("failed to shrink %s: %w", file, err)
+			}
+			if done {
+				continue
+			}
+		}
+		if err := copyAsset(file, dest); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func copyAsset(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Files returns the source files of the resolved assets, sorted
+func (r *AssetResolver) Files() []string {
+	files := make([]string, 0, len(r.files))
+	for _, file := range r.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return slices.Compact(files)
+}
+
+// Missing returns the image references that weren't found, sorted
+func (r *AssetResolver) Missing() []string {
+	refs := make([]string, 0, len(r.missing))
+	for ref := range r.missing {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// Report logs how many assets were resolved and every reference that wasn't
+func (r *AssetResolver) Report() {
+	slog.Info("Resolved referenced images", "count", len(r.files))
+	for _, ref := range r.Missing() {
+		slog.Warn("Missing image", "src", ref, "pages", strings.Join(r.missing[ref], ", "))
+	}
+}
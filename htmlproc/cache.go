@@ -0,0 +1,156 @@
+package htmlproc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cacheVersion changes whenever processing changes in a way that makes pages
+// cached by earlier versions stale
+const cacheVersion = "5"
+
+// PageCache keeps processed pages on disk, so pages whose source and
+// processing settings haven't changed aren't processed again. Pages are
+// also kept as they are after cleaning, before their links are rewritten,
+// so that when only the set of pages changed, which changes the links of
+// all pages, they aren't rendered and cleaned again either.
+type PageCache struct {
+	Dir     string
+	Refresh bool // Process every page again, only updating the cache
+}
+
+// Kinds of cached pages
+const (
+	processedPages = ""        // Finished pages, see Pipeline.settingsKey
+	cleanedPages   = "cleaned" // Cleaned pages, see Pipeline.cleanSettingsKey
+)
+
+// cachedPage is a processed page together with the images it refers to, or
+// a cleaned page, whose Content is its body
+type cachedPage struct {
+	Title   string
+	Content string
+	Assets  map[string]string // Copy name → source file, see AssetResolver
+	Missing []string          // Image references that weren't found
+}
+
+// key returns the cache key of a page source processed with the given settings
+func (c *PageCache) key(settings string, source []byte) string {
+	h := sha256.New()
+	h.Write([]byte(settings))
+	h.Write([]byte{0})
+	h.Write(source)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *PageCache) path(kind, key string) string {
+	return filepath.Join(c.Dir, "pages", kind, key[:2], key+".json")
+}
+
+// get returns the cached page of kind for key, if any
+func (c *PageCache) get(kind, key string) (*cachedPage, bool) {
+	if c.Refresh {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(kind, key))
+	if err != nil {
+		return nil, false
+	}
+	page := &cachedPage{}
+	if err := json.Unmarshal(data, page); err != nil {
+		return nil, false
+	}
+	// Images may have disappeared since, their references must be reported
+	for _, file := range page.Assets {
+		if !isFile(file) {
+			return nil, false
+		}
+	}
+	return page, true
+}
+
+// put stores page of kind under key
+func (c *PageCache) put(kind, key string, page *cachedPage) error {
+	data, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	file := c.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// settingsKey describes everything besides the page source that the
+// processed pages depend on
+func (p *Pipeline) settingsKey(tree *Node) string {
+	var sb strings.Builder
+	sb.WriteString(p.cleanSettingsKey())
+	fmt.Fprintf(&sb, "input=%s\nsite-path=%s\n", p.InputDir, p.SitePath)
+	fmt.Fprintf(&sb, "fit=%s %d\nlinks=%s\n", p.Fit.Mode, p.Fit.Columns, p.PrintLinks)
+	if p.Assets != nil {
+		fmt.Fprintf(&sb, "assets=%s %q\n", p.Assets.Dir, p.Assets.StaticDirs)
+		if p.Assets.SVG != nil {
+			fmt.Fprintf(&sb, "svg=%s %g\n", p.Assets.SVG.Tool, p.Assets.SVG.DPI)
+		}
+		if p.Assets.Images != nil {
+			fmt.Fprintf(&sb, "images=%d %d\n", p.Assets.Images.MaxWidth, p.Assets.Images.JPEGQuality)
+		}
+	}
+
+	// Links are rewritten according to which pages are included
+	tree.Walk(func(n *Node) {
+		if n.File != "" {
+			fmt.Fprintf(&sb, "page=%s %s\n", n.Path, n.ID)
+		}
+	})
+	return sb.String()
+}
+
+// cleanSettingsKey describes everything besides the page source that the
+// cleaned pages depend on: how templates are rendered and what is stripped,
+// but not which other pages there are
+func (p *Pipeline) cleanSettingsKey() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "version=%s\nsite=%s\nboilerplate=%s\n", cacheVersion, p.SiteURL, p.Boilerplate)
+	fmt.Fprintf(&sb, "i2p-version=%s\n", p.Version)
+	if p.Endpoints != nil {
+		endpoints := make([]string, 0, len(p.Endpoints))
+		for e := range p.Endpoints {
+			endpoints = append(endpoints, e)
+		}
+		sort.Strings(endpoints)
+		for _, e := range endpoints {
+			fmt.Fprintf(&sb, "endpoint=%s %s\n", e, p.Endpoints[e])
+		}
+	}
+	if p.Sanitize != nil {
+		fmt.Fprintf(&sb, "sanitize=%s\n", p.Sanitize)
+	}
+	if p.RST != nil {
+		fmt.Fprintf(&sb, "rst=%s\n", p.RST.Tool)
+	}
+	if p.Math != nil {
+		fmt.Fprintf(&sb, "math=%s\n", p.Math.Tool)
+	}
+	if p.Diagrams != nil {
+		fmt.Fprintf(&sb, "diagrams=%t %g\n", p.Diagrams.PNG, p.Diagrams.DPI)
+	}
+
+	msgids := make([]string, 0, len(p.Catalog))
+	for msgid := range p.Catalog {
+		msgids = append(msgids, msgid)
+	}
+	sort.Strings(msgids)
+	for _, msgid := range msgids {
+		fmt.Fprintf(&sb, "msg=%q %q\n", msgid, p.Catalog[msgid])
+	}
+	return sb.String()
+}
@@ -0,0 +1,151 @@
+package htmlproc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// diagramLanguages maps the languages of code blocks, and the extensions of
+// diagram source files, to the command drawing them
+var diagramLanguages = map[string]string{
+	"mermaid":  "mmdc",
+	".mmd":     "mmdc",
+	"dot":      "dot",
+	"graphviz": "dot",
+	".dot":     "dot",
+	".gv":      "dot",
+}
+
+// DiagramRenderer draws the Mermaid and Graphviz diagrams of pages, so state
+// machines and message flows can be kept as text: code blocks of language
+// mermaid, dot or graphviz, <div class="mermaid"> blocks, and images whose
+// source is a .mmd, .dot or .gv file. Mermaid needs mmdc (mermaid-cli) and
+// Graphviz needs dot; diagrams whose command is missing are left as code.
+type DiagramRenderer struct {
+	// PNG draws bitmaps rather than SVG, for renderers that draw SVG badly
+	PNG bool
+	DPI float64 // Resolution of PNG diagrams
+
+	warned sync.Map // Commands found missing
+}
+
+// render replaces the diagrams of doc with images embedded as data URIs, so
+// they are kept with the page in the cache
+func (d *DiagramRenderer) render(doc *goquery.Document, file string) {
+	doc.Find("pre > code[class], div.mermaid").Each(func(_ int, s *goquery.Selection) {
+		lang := "mermaid"
+		if goquery.NodeName(s) == "code" {
+			lang = codeLanguage(s)
+		}
+		if diagramLanguages[lang] == "" {
+			return
+		}
+		img, ok := d.draw(diagramLanguages[lang], []byte(s.Text()), file)
+		if !ok {
+			return
+		}
+		block := s
+		if goquery.NodeName(s) == "code" {
+			block = s.Parent()
+		}
+		block.ReplaceWithHtml(fmt.Sprintf(`<div class="diagram"><img src="%s" alt="%s diagram"></div>`, img, lang))
+	})
+
+	doc.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		command := diagramLanguages[strings.ToLower(filepath.Ext(src))]
+		if command == "" || strings.Contains(src, ":") {
+			return
+		}
+		source, err := os.ReadFile(filepath.Join(filepath.Dir(file), filepath.FromSlash(src)))
+		if err != nil {
+			slog.Warn("Cannot read diagram", "file", file, "src", src, "err", err)
+			return
+		}
+		if img, ok := d.draw(command, source, file); ok {
+			s.SetAttr("src", img)
+			s.AddClass("diagram")
+		}
+	})
+}
+
+// codeLanguage returns the language of a code block, from its class
+// language-<lang> or <lang>
+func codeLanguage(s *goquery.Selection) string {
+	class, _ := s.Attr("class")
+	for _, c := range strings.Fields(class) {
+		lang := strings.TrimPrefix(c, "language-")
+		if diagramLanguages[lang] != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// draw runs command on the diagram source and returns the image as a data
+// URI, and whether it could be drawn
+func (d *DiagramRenderer) draw(command string, source []byte, file string) (string, bool) {
+	if _, err := exec.LookPath(command); err != nil {
+		if _, warned := d.warned.LoadOrStore(command, true); !warned {
+			slog.Warn("Cannot draw diagrams, leaving them as code", "command", command, "err", err)
+		}
+		return "", false
+	}
+	format, mediaType := "svg", "image/svg+xml"
+	if d.PNG {
+		format, mediaType = "png", "image/png"
+	}
+
+	var out []byte
+	var err error
+	switch command {
+	case "dot":
+		cmd := exec.Command("dot", "-T"+format)
+		if d.PNG {
+			cmd.Args = append(cmd.Args, fmt.Sprintf("-Gdpi=%g", d.DPI))
+		}
+		cmd.Stdin = bytes.NewReader(source)
+		out, err = cmd.Output()
+	case "mmdc":
+		out, err = d.mermaid(source, format)
+	}
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exit.Stderr)))
+		}
+		slog.Warn("Cannot draw diagram, leaving it as code", "file", file, "command", command, "err", err)
+		return "", false
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(out), true
+}
+
+// mermaid draws a Mermaid diagram with mmdc, which only works on files
+func (d *DiagramRenderer) mermaid(source []byte, format string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "i2pdoc2pdf-mermaid-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "diagram.mmd"), filepath.Join(dir, "diagram."+format)
+	if err := os.WriteFile(input, source, 0644); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("mmdc", "--quiet", "--input", input, "--output", output, "--backgroundColor", "white")
+	if d.PNG {
+		cmd.Args = append(cmd.Args, "--scale", fmt.Sprint(max(1, int(d.DPI/cssDPI))))
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, html.UnescapeString(strings.TrimSpace(string(out))))
+	}
+	return os.ReadFile(output)
+}
@@ -0,0 +1,82 @@
+package htmlproc
+
+import (
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SourcePage is a page found in the input directory
+type SourcePage struct {
+	File string // Source file, below the input directory
+	Path string // Page path of the file, as Node.Path, e.g. "transport/ntcp2"
+}
+
+// FindPages returns the pages of baseDir whose files have one of the
+// extensions exts, e.g. ".html". Every file makes one page, however it is
+// reached, and every page has one file: of a/index.html and a.html, which
+// are both page a, the first found is kept.
+func FindPages(baseDir string, exts ...string) ([]SourcePage, error) {
+	var pages []SourcePage
+	seen := map[string]bool{}    // Resolved paths of the files found
+	files := map[string]string{} // Page path → file
+	err := filepath.Walk(baseDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			slog.Warn("Error accessing path", "path", file, "err", err)
+			return nil
+		}
+		if info.IsDir() || !slices.Contains(exts, strings.ToLower(filepath.Ext(file))) {
+			return nil
+		}
+		real, err := filepath.EvalSymlinks(file)
+		if err != nil {
+			real = file
+		}
+		if real, err = filepath.Abs(real); err == nil {
+			if seen[real] {
+				slog.Debug("Skipping file found twice", "file", file)
+				return nil
+			}
+			seen[real] = true
+		}
+		rel, err := filepath.Rel(baseDir, file)
+		if err != nil {
+			slog.Warn("Skipping page", "file", file, "err", err)
+			return nil
+		}
+		page := sourcePagePath(rel)
+		if other, ok := files[page]; ok {
+			slog.Warn("Skipping second file of page", "page", page, "file", file, "kept", other)
+			return nil
+		}
+		files[page] = file
+		slog.Debug("Found page", "file", file)
+		pages = append(pages, SourcePage{File: file, Path: page})
+		return nil
+	})
+	return pages, err
+}
+
+// sourcePagePath returns the page path of a file at rel in the input
+// directory, the way BuildTree places it: index files stand for their
+// directory
+func sourcePagePath(rel string) string {
+	rel = filepath.ToSlash(rel)
+	dir, name := path.Split(strings.TrimSuffix(rel, path.Ext(rel)))
+	if strings.EqualFold(name, "index") {
+		name = ""
+	}
+	return strings.Trim(dir+name, "/")
+}
+
+// pageFiles returns the files of pages
+func pageFiles(pages []SourcePage) []string {
+	files := make([]string, len(pages))
+	for i, page := range pages {
+		files[i] = page.File
+	}
+	return files
+}
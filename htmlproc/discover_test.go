@@ -0,0 +1,103 @@
+package htmlproc
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string          // Created with some content
+		symlinks map[string]string // Link → target, relative to the link's directory
+		want     []string          // Files found, in order
+	}{
+		{
+			name:  "index next to page file",
+			files: []string{"a.html", "a/index.html"},
+			want:  []string{"a/index.html"},
+		},
+		{
+			name:  "nested index files",
+			files: []string{"index.html", "a/index.html", "a/b/index.html", "a/b/c.html"},
+			want:  []string{"a/b/c.html", "a/b/index.html", "a/index.html", "index.html"},
+		},
+		{
+			name:  "page file next to nested index",
+			files: []string{"a/b.html", "a/b/index.html", "a/index.html"},
+			want:  []string{"a/b/index.html", "a/index.html"},
+		},
+		{
+			name:     "symlinked duplicate",
+			files:    []string{"a.html", "b/index.html"},
+			symlinks: map[string]string{"c.html": "a.html", "d.html": "b/index.html"},
+			want:     []string{"a.html", "b/index.html"},
+		},
+		{
+			name:     "symlink sorted first",
+			files:    []string{"b.html"},
+			symlinks: map[string]string{"a.html": "b.html"},
+			want:     []string{"a.html"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tt.files {
+				file := filepath.Join(dir, filepath.FromSlash(f))
+				if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(file, []byte("<p>"+f+"</p>"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for link, target := range tt.symlinks {
+				if err := os.Symlink(filepath.FromSlash(target), filepath.Join(dir, filepath.FromSlash(link))); err != nil {
+					t.Skip("cannot create symlinks:", err)
+				}
+			}
+
+			pages, err := FindPages(dir, ".html")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			paths := map[string]bool{}
+			for _, p := range pages {
+				rel, err := filepath.Rel(dir, p.File)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+				if paths[p.Path] {
+					t.Errorf("page %q found more than once", p.Path)
+				}
+				paths[p.Path] = true
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindPages() found %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourcePagePath(t *testing.T) {
+	tests := []struct {
+		rel, want string
+	}{
+		{"index.html", ""},
+		{"a.html", "a"},
+		{"a/index.html", "a"},
+		{"a/INDEX.html", "a"},
+		{"a/b/index.html", "a/b"},
+		{"a/b/c.rst", "a/b/c"},
+	}
+	for _, tt := range tests {
+		if got := sourcePagePath(filepath.FromSlash(tt.rel)); got != tt.want {
+			t.Errorf("sourcePagePath(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package htmlproc
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultTitle is the document title unless another one is configured
+const DefaultTitle = "I2P Documentation"
+
+// coverHTML returns the title page. With --toc=pages it is rendered as a
+// separate cover so that it comes before the table of contents wkhtmltopdf
+// generates.
+func coverHTML(opts DocumentOptions) string {
+	var sb strings.Builder
+	sb.WriteString(`<div class="title-page">`)
+	if opts.Logo != "" {
+		sb.WriteString(`<img class="logo" src="` + html.EscapeString(opts.Logo) + `" alt="">`)
+	}
+	sb.WriteString("<h1>" + html.EscapeString(opts.title()) + "</h1>")
+	if opts.Subtitle != "" {
+		sb.WriteString(`<p class="subtitle">` + html.EscapeString(opts.Subtitle) + "</p>")
+	}
+	if opts.Revision != "" {
+		sb.WriteString("<p>Documentation as of " + html.EscapeString(opts.Revision) + "</p>")
+	}
+	if opts.Date != "" {
+		sb.WriteString("<p>" + html.EscapeString(opts.Date) + "</p>")
+	}
+	sb.WriteString(`</div><div class="page-break"></div>`)
+	return sb.String()
+}
+
+// colophonHTML returns the closing page saying how the document was made,
+// empty without a Generator
+func colophonHTML(opts DocumentOptions) string {
+	if opts.Generator == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(`<div class="page-break"></div><div class="colophon"><h2>Colophon</h2><dl>`)
+	item := func(term, value string) {
+		if value != "" {
+			sb.WriteString("<dt>" + term + "</dt><dd>" + html.EscapeString(value) + "</dd>")
+		}
+	}
+	item("Source", opts.Source)
+	item("Revision", opts.Revision)
+	item("Built", opts.Date)
+	item("Generated by", opts.Generator)
+	sb.WriteString("</dl><p>The I2P documentation is written by the I2P project and its contributors.</p></div>")
+	return sb.String()
+}
+
+// DocumentOptions controls how the combined document is assembled
+type DocumentOptions struct {
+	Lang string // Language of the document, empty for English
+	TOC  string // Table of contents style: "pages", "links" or "none"
+	// TOCDepth is the number of levels of the "links" table of contents, 0
+	// for all of them
+	TOCDepth int
+	Cover    bool // Include the title page in the document itself
+
+	// The title page and colophon describe the document; empty fields are
+	// left out
+	Title    string // DefaultTitle if empty
+	Subtitle string
+	Logo     string // Image shown on the title page, relative to the document
+	// Revision names the version of the docs, e.g. a release tag and commit
+	Revision  string
+	Date      string // Build date
+	Source    string // Repository or website the docs were taken from
+	Generator string // Tool and version that made the document, for the colophon
+
+	Figures []Figure // Listed after the table of contents, see NumberFigures
+
+	Theme      string   // Built-in theme, DefaultTheme if empty
+	Stylesheet []string // Stylesheets linked after the theme, relative to the document
+	// FontFamily is the CSS font-family of the text, the fonts of Fonts and
+	// those suited to Lang if empty
+	FontFamily string
+	Fonts      []Font // Font files embedded in the document
+	CSS        string // Rules added after the stylesheets, e.g. MathRenderer.CSS
+	// Grayscale prints images in gray and marks links without color, for
+	// monochrome printers; Chrome has no grayscale mode of its own
+	Grayscale bool
+	FontSize  float64 // Of the text in points, 0 for that of the theme
+}
+
+// Font is a font file embedded in a document with @font-face
+type Font struct {
+	Family string // Name the stylesheets use for it
+	Href   string // Font file, relative to the document
+}
+
+// fontFamily returns the CSS font-family of the text of the document
+func (opts DocumentOptions) fontFamily() string {
+	if opts.FontFamily != "" {
+		return opts.FontFamily
+	}
+	var families []string
+	for _, f := range opts.Fonts {
+		if family := strconv.Quote(f.Family); !slices.Contains(families, family) {
+			families = append(families, family)
+		}
+	}
+	return strings.Join(append(families, fontFamilyFor(opts.Lang)), ", ")
+}
+
+// fontFaces returns the @font-face rules of the embedded fonts
+func (opts DocumentOptions) fontFaces() string {
+	var sb strings.Builder
+	for _, f := range opts.Fonts {
+		fmt.Fprintf(&sb, "\t\t\t@font-face {\n\t\t\t\tfont-family: %s;\n\t\t\t\tsrc: url(%s);\n\t\t\t}\n", strconv.Quote(f.Family), strconv.Quote(f.Href))
+	}
+	return sb.String()
+}
+
+func (opts DocumentOptions) title() string {
+	if opts.Title == "" {
+		return DefaultTitle
+	}
+	return opts.Title
+}
+
+// BuildCover returns the title page as a document of its own, for renderers
+// that take the cover separately
+func BuildCover(opts DocumentOptions) string {
+	var sb strings.Builder
+	documentHead(&sb, opts)
+	sb.WriteString(coverHTML(opts))
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+// htmlLang converts a gettext language code like pt_BR to an HTML one
+func htmlLang(lang string) string {
+	if lang == "" {
+		return "en"
+	}
+	return strings.ReplaceAll(lang, "_", "-")
+}
+
+// htmlDir returns the dir attribute of a document in lang, empty for
+// languages written left to right. Code stays left to right, see
+// documentHead.
+func htmlDir(lang string) string {
+	if !IsRTL(lang) {
+		return ""
+	}
+	return ` dir="rtl"`
+}
+
+// htmlWriter is what documents are written to: a strings.Builder for small
+// ones, a bufio.Writer for those that are streamed to a file
+type htmlWriter interface {
+	io.Writer
+	io.StringWriter
+}
+
+// documentHead writes the start of a document up to and including <body>
+func documentHead(sb htmlWriter, opts DocumentOptions) {
+	sb.WriteString(`
+	<!DOCTYPE html>
+	<html lang="` + htmlLang(opts.Lang) + `"` + htmlDir(opts.Lang) + `>
+	<head>
+		<meta charset="UTF-8">
+		<title>` + html.EscapeString(opts.title()) + `</title>
+		<style>
+` + opts.fontFaces() + `			body { 
+				font-family: ` + opts.fontFamily() + `;
+				max-width: 800px;
+				margin: 0 auto;
+				padding: 20px;
+			}
+			.page-break { 
+				page-break-after: always;
+				height: 1px;
+			}
+			.chapter { 
+				margin-top: 30px;
+			}
+			.title-page {
+				text-align: center;
+				padding-top: 200px;
+			}
+			.part-divider {
+				text-align: center;
+				padding-top: 150px;
+			}
+			.part-divider .part {
+				font-size: 2em;
+			}
+			.part-divider ul {
+				display: inline-block;
+				text-align: left;
+			}
+			.title-page .logo {
+				max-width: 200px;
+			}
+			.title-page .subtitle {
+				font-size: 1.4em;
+			}
+			.colophon dt {
+				font-weight: bold;
+			}
+			figcaption {
+				text-align: center;
+				font-size: 0.9em;
+			}
+			.glossary dt {
+				font-weight: bold;
+			}
+			.translation .lang, .untranslated {
+				color: #555;
+			}
+			.last-updated {
+				font-size: 0.85em;
+				color: #555;
+			}
+			.glossary-refs {
+				font-size: 0.9em;
+				color: #555;
+			}
+			pre {
+				background-color: #f5f5f5;
+				padding: 10px;
+				border-radius: 5px;
+				overflow-x: auto;
+			}
+			code {
+				font-family: monospace;
+			}
+			pre, table, figure, img {
+				page-break-inside: avoid;
+			}
+			tr {
+				page-break-inside: avoid;
+			}
+			thead {
+				display: table-header-group;
+			}
+			h1, h2, h3, h4 {
+				page-break-after: avoid;
+			}
+			.source-note {
+				font-size: 0.8em;
+				color: #555;
+				border-top: 1px solid #ddd;
+				padding-top: 4px;
+				word-break: break-all;
+			}
+			.page-ref {
+				font-size: 0.85em;
+				color: #555;
+			}
+			.link-note {
+				font-size: 0.7em;
+			}
+			.link-notes {
+				font-size: 0.85em;
+				word-break: break-all;
+			}
+			.broken-link {
+				color: #c00;
+				text-decoration: line-through;
+			}
+			.broken-link-note {
+				color: #c00;
+				font-size: 0.7em;
+			}
+			[dir="rtl"] pre, [dir="rtl"] code, [dir="rtl"] .link-notes {
+				direction: ltr;
+				text-align: left;
+				unicode-bidi: embed;
+			}
+			.landscape {
+				page: landscape;
+			}
+			@page landscape {
+				size: landscape;
+			}
+` + themes[opts.Theme] + grayscaleCSS(opts.Grayscale) + fontSizeCSS(opts.FontSize) + `
+		</style>
+`)
+	for _, href := range opts.Stylesheet {
+		sb.WriteString(`		<link rel="stylesheet" href="` + html.EscapeString(href) + `">
+`)
+	}
+	if opts.CSS != "" {
+		sb.WriteString("\t\t<style>" + opts.CSS + "</style>\n")
+	}
+	sb.WriteString(`	</head>
+	<body>
+`)
+}
+
+// WriteDocument writes the processed pages of tree to w as a single HTML
+// document. It is written page by page, so the document as a whole, which
+// may be hundreds of megabytes, is never held in memory.
+func WriteDocument(w io.Writer, tree *Node, opts DocumentOptions) error {
+	bw := bufio.NewWriter(w)
+	documentHead(bw, opts)
+	if opts.Cover {
+		bw.WriteString(coverHTML(opts))
+	}
+
+	// Add table of contents. With "pages" wkhtmltopdf generates it from the
+	// outline instead, so it can include page numbers.
+	if opts.TOC == "links" {
+		bw.WriteString("<h2>Table of Contents</h2>")
+		if tree.File != "" {
+			fmt.Fprintf(bw, `<ul><li><a href="#%s">%s</a></li></ul>`, tree.ID, html.EscapeString(tree.DisplayName()))
+		}
+		writeTOC(bw, tree, opts.TOCDepth)
+		bw.WriteString("<div class=\"page-break\"></div>")
+	}
+	writeFigureList(bw, opts.Figures, true)
+
+	// Add the chapters, in tree order
+	writeChapters(bw, tree, 0)
+	bw.WriteString(colophonHTML(opts))
+
+	bw.WriteString("</body></html>")
+	return bw.Flush()
+}
+
+// Chapter is a top-level section of the documentation as a document of its own
+type Chapter struct {
+	Title string
+	node  *Node // Section, or a copy of the docs index page without children
+	depth int
+	last  bool // The colophon follows it
+}
+
+// SplitChapters splits the document into its top-level sections, so they
+// can be rendered separately. The docs index page, if any, is the first
+// chapter. Links between chapters don't survive separate rendering.
+func SplitChapters(tree *Node) []Chapter {
+	var chapters []Chapter
+	if tree.File != "" {
+		index := *tree
+		index.Children = nil
+		chapters = append(chapters, Chapter{Title: tree.DisplayName(), node: &index})
+	}
+	for _, c := range tree.Children {
+		chapters = append(chapters, Chapter{Title: c.Heading(), node: c, depth: 1})
+	}
+	if len(chapters) > 0 {
+		chapters[len(chapters)-1].last = true
+	}
+	return chapters
+}
+
+// WriteChapter writes chapter c to w as a document of its own
+func WriteChapter(w io.Writer, c Chapter, opts DocumentOptions) error {
+	bw := bufio.NewWriter(w)
+	documentHead(bw, opts)
+	writeChapters(bw, c.node, c.depth)
+	if c.last {
+		bw.WriteString(colophonHTML(opts))
+	}
+	bw.WriteString("</body></html>")
+	return bw.Flush()
+}
+
+// BuildFrontMatter returns the title page followed by a table of contents
+// listing each chapter with the page it starts on, for documents assembled
+// from separately rendered chapters. starts may be nil to leave out the table
+// of contents.
+func BuildFrontMatter(chapters []Chapter, starts []int, opts DocumentOptions) string {
+	var sb strings.Builder
+	documentHead(&sb, opts)
+	sb.WriteString(coverHTML(opts))
+	if starts != nil {
+		sb.WriteString(`<h2>Table of Contents</h2><table style="width: 100%">`)
+		for i, c := range chapters {
+			sb.WriteString(fmt.Sprintf(`<tr><td>%s</td><td style="text-align: right">%d</td></tr>`, html.EscapeString(c.Title), starts[i]))
+		}
+		sb.WriteString("</table>")
+	}
+	// The figures are in other documents, links to them would be dead
+	writeFigureList(&sb, opts.Figures, false)
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
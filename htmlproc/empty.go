@@ -0,0 +1,150 @@
+package htmlproc
+
+import (
+	"html"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// metaRefresh matches the meta element of pages that only send the browser on
+// to another page, and the URL they send it to
+var (
+	metaRefresh    = regexp.MustCompile(`(?i)<meta\s[^>]*http-equiv\s*=\s*["']?refresh[^>]*>`)
+	metaRefreshURL = regexp.MustCompile(`(?i)url\s*=\s*['"]?([^'">\s]+)`)
+)
+
+// EmptyPage is a page left out of the document for having nothing to show
+type EmptyPage struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"` // "redirect" or "empty"
+}
+
+// dropEmptyPages leaves out the pages of tree that only redirect to another
+// page, if redirects, and those with fewer than minWords words and no
+// images, tables or code, so they don't end up as blank chapters. Sections
+// left without pages are removed too. Links to a redirect are pointed at
+// the page it redirects to if links resolves it, other links to the pages
+// left out become plain text. It returns the pages left out.
+func dropEmptyPages(tree *Node, minWords int, redirects bool, links *LinkMap) ([]EmptyPage, error) {
+	var dropped []EmptyPage
+	targets := map[string]string{} // Anchor of a page left out → anchor to link instead, "" for none
+	tree.Walk(func(n *Node) {
+		if n.File == "" {
+			return
+		}
+		reason := ""
+		target, redirect := "", false
+		if redirects {
+			target, redirect = redirectOf(n.File)
+		}
+		if redirect {
+			reason = "redirect"
+			targets[n.ID], _ = links.Resolve(n.File, target)
+		} else if minWords > 0 && isEmptyPage(n.Content, minWords) {
+			reason = "empty"
+			targets[n.ID] = ""
+		}
+		if reason == "" {
+			return
+		}
+		slog.Info("Leaving out page", "page", pageName(n), "reason", reason)
+		dropped = append(dropped, EmptyPage{Path: pageName(n), Reason: reason})
+		n.File, n.Content = "", ""
+	})
+	if len(dropped) == 0 {
+		return nil, nil
+	}
+	pruneTree(tree)
+
+	var err error
+	tree.Walk(func(n *Node) {
+		if n.File == "" || err != nil {
+			return
+		}
+		var doc *goquery.Document
+		doc, err = goquery.NewDocumentFromReader(strings.NewReader(n.Content))
+		if err != nil {
+			return
+		}
+		changed := false
+		doc.Find(`a[href^="#"]`).Each(func(_ int, s *goquery.Selection) {
+			// Links to an element of the page go to what replaces the page
+			target, ok := targets[pageAnchor(strings.TrimPrefix(s.AttrOr("href", ""), "#"))]
+			if !ok {
+				return
+			}
+			// Follow redirects to pages left out as well, giving up on loops
+			for range len(targets) {
+				next, ok := targets[target]
+				if !ok {
+					break
+				}
+				target = next
+			}
+			if _, ok := targets[target]; ok {
+				target = ""
+			}
+			if target != "" {
+				s.SetAttr("href", "#"+target)
+			} else {
+				s.ReplaceWithSelection(s.Contents())
+			}
+			changed = true
+		})
+		if changed {
+			n.Content, err = doc.Find("body").Html()
+		}
+	})
+	return dropped, err
+}
+
+// redirectOf returns the URL the source file of a page redirects to with a
+// meta refresh, if it does
+func redirectOf(file string) (string, bool) {
+	if filepath.Ext(file) != ".html" {
+		return "", false
+	}
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+	meta := metaRefresh.Find(src)
+	if meta == nil {
+		return "", false
+	}
+	if m := metaRefreshURL.FindSubmatch(meta); m != nil {
+		return html.UnescapeString(string(m[1])), true
+	}
+	return "", true
+}
+
+// isEmptyPage reports whether content has fewer than minWords words and
+// nothing else to show
+func isEmptyPage(content string, minWords int) bool {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return false
+	}
+	if doc.Find("img, svg, table, pre, object").Length() > 0 {
+		return false
+	}
+	return len(strings.Fields(doc.Text())) < minWords
+}
+
+// pruneTree removes the sections of n that have neither a page nor
+// subsections
+func pruneTree(n *Node) {
+	kept := n.Children[:0]
+	for _, c := range n.Children {
+		pruneTree(c)
+		if c.File != "" || len(c.Children) > 0 {
+			kept = append(kept, c)
+		}
+	}
+	n.Children = kept
+}
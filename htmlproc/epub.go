@@ -0,0 +1,297 @@
+package htmlproc
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// epubTypes are the media types of the files books commonly hold, which the
+// MIME table of the system may lack
+var epubTypes = map[string]string{
+	".css":   "text/css",
+	".gif":   "image/gif",
+	".jpeg":  "image/jpeg",
+	".jpg":   "image/jpeg",
+	".png":   "image/png",
+	".svg":   "image/svg+xml",
+	".webp":  "image/webp",
+	".otf":   "font/otf",
+	".ttf":   "font/ttf",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// epubDoc is a content document of the book
+type epubDoc struct {
+	name  string
+	write func(w io.Writer) error
+}
+
+// parse writes the document and parses it
+func (d epubDoc) parse() (*goquery.Document, error) {
+	var buf bytes.Buffer
+	if err := d.write(&buf); err != nil {
+		return nil, err
+	}
+	return goquery.NewDocumentFromReader(&buf)
+}
+
+// WriteEPUB writes the processed pages of tree to w as an EPUB 3 book: the
+// title page and each chapter as SplitChapters makes them as XHTML
+// documents, a navigation document listing the tree like the table of
+// contents, and the local images, stylesheets and fonts they use, relative
+// to baseDir. Links between chapters are pointed at the document of their
+// target. Chapters are written twice, once to find their anchors, rather
+// than all held in memory.
+func WriteEPUB(w io.Writer, tree *Node, opts DocumentOptions, baseDir string, modified time.Time) error {
+	docs := []epubDoc{{name: "cover.xhtml", write: func(w io.Writer) error {
+		_, err := io.WriteString(w, BuildCover(opts))
+		return err
+	}}}
+	for i, c := range SplitChapters(tree) {
+		docs = append(docs, epubDoc{name: fmt.Sprintf("chapter-%03d.xhtml", i), write: func(w io.Writer) error {
+			return WriteChapter(w, c, opts)
+		}})
+	}
+
+	// The document of each anchor, for links and the navigation document
+	anchors := map[string]string{}
+	for _, d := range docs {
+		doc, err := d.parse()
+		if err != nil {
+			return err
+		}
+		doc.Find("[id]").Each(func(_ int, s *goquery.Selection) {
+			if id := s.AttrOr("id", ""); anchors[id] == "" {
+				anchors[id] = d.name
+			}
+		})
+	}
+
+	zw := zip.NewWriter(w)
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	}
+	// The media type comes first and uncompressed, so the format can be told
+	// from the start of the file
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	io.WriteString(fw, "application/epub+zip")
+	if fw, err = create("META-INF/container.xml"); err != nil {
+		return err
+	}
+	io.WriteString(fw, `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+	<rootfiles>
+		<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+	</rootfiles>
+</container>
+`)
+
+	assets := &epubAssets{baseDir: baseDir, seen: map[string]bool{}}
+	var items strings.Builder
+	for _, d := range docs {
+		doc, err := d.parse()
+		if err != nil {
+			return err
+		}
+		properties := epubRewrite(doc, d.name, anchors, assets)
+		if fw, err = create("OEBPS/" + d.name); err != nil {
+			return err
+		}
+		if err := html.Render(fw, doc.Nodes[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(&items, "\t\t<item id=\"%s\" href=\"%s\" media-type=\"application/xhtml+xml\"%s/>\n", strings.TrimSuffix(d.name, ".xhtml"), d.name, properties)
+	}
+	if fw, err = create("OEBPS/nav.xhtml"); err != nil {
+		return err
+	}
+	writeNav(fw, tree, opts, anchors)
+
+	// Stylesheets may add files of their own, so the list grows on
+	for i := 0; i < len(assets.files); i++ {
+		file := assets.files[i]
+		data, err := os.ReadFile(filepath.Join(baseDir, filepath.FromSlash(file)))
+		if err != nil {
+			slog.Warn("Cannot add file to the EPUB", "file", file, "err", err)
+			continue
+		}
+		if fw, err = create("OEBPS/" + file); err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+		if path.Ext(file) == ".css" {
+			for _, m := range cssURL.FindAllSubmatch(data, -1) {
+				assets.add(path.Dir(file), string(m[1])+string(m[2])+string(m[3]))
+			}
+		}
+		fmt.Fprintf(&items, "\t\t<item id=\"asset-%d\" href=\"%s\" media-type=\"%s\"/>\n", i, html.EscapeString((&url.URL{Path: file}).EscapedPath()), epubType(file))
+	}
+
+	if fw, err = create("OEBPS/content.opf"); err != nil {
+		return err
+	}
+	writePackage(fw, docs, items.String(), opts, modified)
+	return zw.Close()
+}
+
+// epubAssets collects the local files the documents of a book refer to
+type epubAssets struct {
+	baseDir string
+	seen    map[string]bool
+	files   []string // Slash-separated, relative to baseDir
+}
+
+// add records the file ref refers to from dir, a slash-separated directory
+// relative to baseDir, if it is a local file below baseDir
+func (a *epubAssets) add(dir, ref string) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || path.IsAbs(u.Path) {
+		return
+	}
+	file := path.Join(dir, u.Path)
+	if !filepath.IsLocal(filepath.FromSlash(file)) {
+		slog.Warn("Leaving a file outside the document out of the EPUB", "ref", ref)
+		return
+	}
+	if !a.seen[file] {
+		a.seen[file] = true
+		a.files = append(a.files, file)
+	}
+}
+
+// epubRewrite turns the parsed document name into XHTML: it points the links
+// to anchors of other documents at them, records the files it uses in
+// assets, and returns the manifest properties it needs
+func epubRewrite(doc *goquery.Document, name string, anchors map[string]string, assets *epubAssets) string {
+	doc.Find("html").SetAttr("xmlns", "http://www.w3.org/1999/xhtml")
+	doc.Find(`a[href^="#"]`).Each(func(_ int, s *goquery.Selection) {
+		href := s.AttrOr("href", "")
+		if target := anchors[strings.TrimPrefix(href, "#")]; target != "" && target != name {
+			s.SetAttr("href", target+href)
+		}
+	})
+	doc.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		assets.add(".", s.AttrOr("src", ""))
+	})
+	doc.Find(`link[rel="stylesheet"][href]`).Each(func(_ int, s *goquery.Selection) {
+		assets.add(".", s.AttrOr("href", ""))
+	})
+	doc.Find("style").Each(func(_ int, s *goquery.Selection) {
+		for _, m := range cssURL.FindAllStringSubmatch(s.Text(), -1) {
+			assets.add(".", m[1]+m[2]+m[3])
+		}
+	})
+	var properties []string
+	if doc.Find("svg").Length() > 0 {
+		properties = append(properties, "svg")
+	}
+	if doc.Find("math").Length() > 0 {
+		properties = append(properties, "mathml")
+	}
+	if len(properties) == 0 {
+		return ""
+	}
+	return ` properties="` + strings.Join(properties, " ") + `"`
+}
+
+// epubType returns the media type of file
+func epubType(file string) string {
+	ext := strings.ToLower(path.Ext(file))
+	if t, ok := epubTypes[ext]; ok {
+		return t
+	}
+	if t, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// writeNav writes the navigation document of the book, listing the entries
+// of tree like the table of contents of the combined document
+func writeNav(w io.Writer, tree *Node, opts DocumentOptions, anchors map[string]string) {
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="%s"%s>
+<head><meta charset="UTF-8"/><title>%s</title></head>
+<body><nav epub:type="toc" id="toc"><h1>Table of Contents</h1><ol>`, htmlLang(opts.Lang), htmlDir(opts.Lang), html.EscapeString(opts.title()))
+	if tree.File != "" {
+		writeNavEntry(w, tree, anchors)
+		io.WriteString(w, "</li>")
+	}
+	writeNavChildren(w, tree, opts.TOCDepth, anchors)
+	io.WriteString(w, "</ol></nav></body></html>\n")
+}
+
+// writeNavChildren writes the entries of the children of n, and theirs down
+// to depth levels, all for 0
+func writeNavChildren(w io.Writer, n *Node, depth int, anchors map[string]string) {
+	for _, c := range n.Children {
+		writeNavEntry(w, c, anchors)
+		if depth != 1 && len(c.Children) > 0 {
+			io.WriteString(w, "<ol>")
+			writeNavChildren(w, c, depth-1, anchors)
+			io.WriteString(w, "</ol>")
+		}
+		io.WriteString(w, "</li>")
+	}
+}
+
+// writeNavEntry opens the list item of n, linked to its heading
+func writeNavEntry(w io.Writer, n *Node, anchors map[string]string) {
+	title := html.EscapeString(n.Heading())
+	if doc := anchors[n.ID]; doc != "" {
+		fmt.Fprintf(w, `<li><a href="%s#%s">%s</a>`, doc, html.EscapeString(n.ID), title)
+	} else {
+		fmt.Fprintf(w, `<li><span>%s</span>`, title)
+	}
+}
+
+// writePackage writes the package document of the book, listing its
+// metadata, the items of its manifest and the order of its documents
+func writePackage(w io.Writer, docs []epubDoc, items string, opts DocumentOptions, modified time.Time) {
+	// The same edition of the docs keeps its identifier across builds
+	h := sha1.Sum([]byte(opts.title() + "\x00" + opts.Lang + "\x00" + opts.Source + "\x00" + opts.Revision))
+	h[6] = h[6]&0x0f | 0x50
+	h[8] = h[8]&0x3f | 0x80
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id" xml:lang="%s">
+	<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+		<dc:identifier id="id">urn:uuid:%x-%x-%x-%x-%x</dc:identifier>
+		<dc:title>%s</dc:title>
+		<dc:language>%s</dc:language>
+		<meta property="dcterms:modified">%s</meta>
+	</metadata>
+	<manifest>
+		<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+%s	</manifest>
+	<spine>
+`, htmlLang(opts.Lang), h[0:4], h[4:6], h[6:8], h[8:10], h[10:16], html.EscapeString(opts.title()), htmlLang(opts.Lang), modified.UTC().Format("2006-01-02T15:04:05Z"), items)
+	for i, d := range docs {
+		fmt.Fprintf(w, "\t\t<itemref idref=\"%s\"/>\n", strings.TrimSuffix(d.name, ".xhtml"))
+		// The table of contents follows the title page, as in the PDF
+		if i == 0 && opts.TOC != "none" {
+			io.WriteString(w, "\t\t<itemref idref=\"nav\"/>\n")
+		}
+	}
+	io.WriteString(w, "\t</spine>\n</package>\n")
+}
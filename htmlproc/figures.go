@@ -0,0 +1,148 @@
+package htmlproc
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Figure is a numbered image of the document
+type Figure struct {
+	ID      string // Anchor of the figure
+	Number  string // Chapter and number within it, e.g. "3.2"
+	Caption string
+}
+
+// NumberFigures turns the images of tree that have a caption or alt text
+// into figures numbered per chapter, with their caption underneath, and
+// returns them in document order. The docs index page, if any, is the
+// first chapter, then come the top-level sections. Images without any
+// description, such as icons, are left alone.
+func NumberFigures(tree *Node) ([]Figure, error) {
+	chapters := tree.Children
+	if tree.File != "" {
+		index := *tree
+		index.Children = nil
+		chapters = append([]*Node{&index}, chapters...)
+	}
+	var figures []Figure
+	for i, chapter := range chapters {
+		count := 0
+		var err error
+		chapter.Walk(func(n *Node) {
+			if n.File == "" || err != nil {
+				return
+			}
+			var doc *goquery.Document
+			doc, err = goquery.NewDocumentFromReader(strings.NewReader(n.Content))
+			if err != nil {
+				return
+			}
+			changed := false
+			doc.Find("img").Each(func(_ int, img *goquery.Selection) {
+				if f, ok := numberFigure(img, i+1, count+1); ok {
+					figures = append(figures, f)
+					count++
+					changed = true
+				}
+			})
+			if changed {
+				n.Content, err = doc.Find("body").Html()
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if tree.File != "" && i == 0 {
+			tree.Content = chapter.Content
+		}
+	}
+	return figures, nil
+}
+
+// numberFigure makes img figure number of the chapter if it has a caption,
+// an alt text or a title
+func numberFigure(img *goquery.Selection, chapter, number int) (Figure, bool) {
+	figure := img.Closest("figure")
+	caption := ""
+	if figure.Length() > 0 {
+		if figure.Find("img").First().Get(0) != img.Get(0) {
+			return Figure{}, false // One number per figure
+		}
+		caption = strings.TrimSpace(figure.Find("figcaption").First().Text())
+	}
+	if caption == "" {
+		// reStructuredText figures have their caption in the next element
+		caption = strings.TrimSpace(img.NextFiltered(".caption").Text())
+	}
+	if caption == "" {
+		caption = strings.TrimSpace(img.AttrOr("alt", img.AttrOr("title", "")))
+	}
+	if caption == "" {
+		return Figure{}, false
+	}
+
+	// Images in running text are icons or symbols, not figures. A paragraph or
+	// link holding nothing but the image is replaced by the figure instead, so
+	// it doesn't end up inside a paragraph.
+	inner, target := img, img
+	if figure.Length() == 0 {
+		if parent := img.Parent(); goquery.NodeName(parent) == "a" && alone(img) {
+			inner, target = parent, parent
+		}
+		if parent := target.Parent(); goquery.NodeName(parent) == "p" {
+			if !alone(target) {
+				return Figure{}, false
+			}
+			target = parent
+		}
+	}
+
+	f := Figure{
+		ID:      fmt.Sprintf("figure-%d-%d", chapter, number),
+		Number:  fmt.Sprintf("%d.%d", chapter, number),
+		Caption: caption,
+	}
+	label := `<span class="figure-number">Figure ` + f.Number + ":</span> "
+	if figure.Length() > 0 {
+		figure.SetAttr("id", f.ID)
+		if figcaption := figure.Find("figcaption").First(); figcaption.Length() > 0 {
+			figcaption.PrependHtml(label)
+			return f, true
+		}
+		figure.AppendHtml("<figcaption>" + label + html.EscapeString(caption) + "</figcaption>")
+		return f, true
+	}
+
+	next := img.NextFiltered(".caption")
+	content, _ := goquery.OuterHtml(inner)
+	target.ReplaceWithHtml(fmt.Sprintf(`<figure class="figure" id="%s">%s<figcaption>%s%s</figcaption></figure>`,
+		f.ID, content, label, html.EscapeString(caption)))
+	next.Remove()
+	return f, true
+}
+
+// alone reports whether s is the only content of its parent
+func alone(s *goquery.Selection) bool {
+	parent := s.Parent()
+	return parent.Children().Length() == 1 && strings.TrimSpace(parent.Text()) == strings.TrimSpace(s.Text())
+}
+
+// writeFigureList writes the list of figures, linking to them if links
+func writeFigureList(sb htmlWriter, figures []Figure, links bool) {
+	if len(figures) == 0 {
+		return
+	}
+	sb.WriteString(`<h2>List of Figures</h2><ul class="figure-list">`)
+	for _, f := range figures {
+		text := "Figure " + f.Number + ": " + html.EscapeString(f.Caption)
+		if links {
+			fmt.Fprintf(sb, `<li><a href="#%s">%s</a></li>`, f.ID, text)
+		} else {
+			fmt.Fprintf(sb, "<li>%s</li>", text)
+		}
+	}
+	sb.WriteString(`</ul><div class="page-break"></div>`)
+}
@@ -0,0 +1,117 @@
+package htmlproc
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// PathFilter selects pages by their path relative to the docs root, e.g.
+// "spec/ntcp2". A pattern that matches a section also matches every page in
+// it. The zero value selects every page.
+type PathFilter struct {
+	Include []*regexp.Regexp // If any, only pages matching one of these are kept
+	Exclude []*regexp.Regexp // Pages matching any of these are dropped
+	// Only, if not nil, keeps just the pages at these paths, without the
+	// pages in their sections
+	Only map[string]bool
+}
+
+// NewPathFilter compiles include and exclude patterns, see CompilePattern
+func NewPathFilter(include, exclude []string) (*PathFilter, error) {
+	f := &PathFilter{}
+	for _, p := range include {
+		re, err := CompilePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.Include = append(f.Include, re)
+	}
+	for _, p := range exclude {
+		re, err := CompilePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.Exclude = append(f.Exclude, re)
+	}
+	return f, nil
+}
+
+// CompilePattern turns a page pattern into a regular expression. Patterns
+// starting with "re:" are regular expressions searched for in the path; any
+// other pattern is a glob matching the whole path, where * and ? don't cross
+// slashes and ** does.
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		return re, nil
+	}
+
+	glob := strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), ".html")
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			// "spec/**" also matches the spec section itself
+			sb.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			sb.WriteString("[^/]*")
+		case glob[i] == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// Match reports whether the page at p should be included. Paths are tried
+// both as they are and prefixed with sitePath, so "docs/spec/**" works as
+// well as "spec/**".
+func (f *PathFilter) Match(p, sitePath string) bool {
+	if f.Only != nil && !f.Only[onlyPath(p)] {
+		return false
+	}
+	if len(f.Include) > 0 && !f.matchAny(f.Include, p, sitePath) {
+		return false
+	}
+	return !f.matchAny(f.Exclude, p, sitePath)
+}
+
+// onlyPath returns the page path of p for Only, which also names the
+// reStructuredText and Markdown pages without their extension
+func onlyPath(p string) string {
+	switch path.Ext(p) {
+	case ".rst", ".md", ".markdown":
+		p = strings.TrimSuffix(p, path.Ext(p))
+		if path.Base(p) == "index" {
+			p = path.Dir(p)
+		}
+	}
+	return p
+}
+
+// matchAny reports whether any of patterns matches p or one of its sections
+func (f *PathFilter) matchAny(patterns []*regexp.Regexp, p, sitePath string) bool {
+	for ; p != "" && p != "."; p = path.Dir(p) {
+		for _, re := range patterns {
+			if re.MatchString(p) || (sitePath != "" && re.MatchString(path.Join(sitePath, p))) {
+				return true
+			}
+		}
+	}
+	return false
+}
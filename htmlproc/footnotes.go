@@ -0,0 +1,79 @@
+package htmlproc
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// CheckPrintLinks returns an error unless mode is a Processor.PrintLinks mode
+func CheckPrintLinks(mode string) error {
+	switch mode {
+	case "none", "footnotes", "list":
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q, expected none, footnotes or list", mode)
+}
+
+// printLinks spells out the URLs of the external links in body, so they
+// survive printing. With "footnotes" each link is followed by a number
+// referring to a numbered list of URLs at the end of the page; with "list"
+// the page just ends in a list of its links. A URL linked several times is
+// listed once.
+func printLinks(body *goquery.Selection, mode string) {
+	if mode == "" || mode == "none" {
+		return
+	}
+	var urls []string
+	numbers := map[string]int{}
+	texts := map[string]string{}
+	body.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if !externalLink(href) {
+			return
+		}
+		n, ok := numbers[href]
+		if !ok {
+			urls = append(urls, href)
+			n = len(urls)
+			numbers[href] = n
+			texts[href] = strings.Join(strings.Fields(s.Text()), " ")
+		}
+		if mode == "footnotes" {
+			s.AfterHtml(fmt.Sprintf(`<sup class="link-note">[%d]</sup>`, n))
+		}
+	})
+	if len(urls) == 0 {
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<div class="link-notes"><h4>Links</h4><ol>`)
+	for _, href := range urls {
+		sb.WriteString("<li>")
+		// The text is worth repeating without markers to refer to it
+		if text := texts[href]; mode == "list" && text != "" && text != href {
+			sb.WriteString(html.EscapeString(text) + ": ")
+		}
+		sb.WriteString(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(href) + "</a></li>")
+	}
+	sb.WriteString("</ol></div>")
+	body.AppendHtml(sb.String())
+}
+
+// externalLink reports whether href points at another website, rather than
+// within the document
+func externalLink(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ftp":
+		return u.Host != ""
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package htmlproc
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// GlossaryPath is the page path of the generated glossary chapter, which
+// won't clash with the pages of the docs
+const GlossaryPath = "_glossary"
+
+// glossaryRefs is how many pages using a term the glossary links at most
+const glossaryRefs = 12
+
+// glossaryTerm is a term defined in a definition list of the docs
+type glossaryTerm struct {
+	Term       string
+	Definition string // HTML of the definition
+	Page       *Node  // Page defining the term
+	match      *regexp.Regexp
+	uses       []*Node // Other pages using the term
+}
+
+// Glossary collects the terms of the definition lists of every page of tree,
+// such as those of the naming and glossary pages, into a chapter of its own
+// at the end of the book. The terms are sorted alphabetically, each with its
+// definition, a link to the page defining it and links to the pages using
+// it. Terms defined more than once keep their first definition. It returns
+// the number of terms, adding no chapter without any.
+func Glossary(tree *Node) (int, error) {
+	var pages []*Node
+	texts := map[*Node]string{}
+	terms := map[string]*glossaryTerm{}
+	var err error
+	tree.Walk(func(n *Node) {
+		if n.File == "" || err != nil {
+			return
+		}
+		var doc *goquery.Document
+		doc, err = goquery.NewDocumentFromReader(strings.NewReader(n.Content))
+		if err != nil {
+			err = fmt.Errorf("error parsing %s: %w", n.Path, err)
+			return
+		}
+		pages = append(pages, n)
+		texts[n] = strings.Join(strings.Fields(doc.Text()), " ")
+		doc.Find("dl > dt").Each(func(_ int, dt *goquery.Selection) {
+			term := strings.Join(strings.Fields(dt.Text()), " ")
+			// Long terms are options, fields or sentences rather than terms
+			if term == "" || len(term) > 60 || terms[strings.ToLower(term)] != nil {
+				return
+			}
+			var definition strings.Builder
+			dt.NextUntil("dt").Filter("dd").Each(func(_ int, dd *goquery.Selection) {
+				dd.Find("[id]").RemoveAttr("id") // The anchors stay with the page
+				content, _ := dd.Html()
+				definition.WriteString("<dd>" + content + "</dd>")
+			})
+			if definition.Len() == 0 {
+				return
+			}
+			terms[strings.ToLower(term)] = &glossaryTerm{
+				Term:       term,
+				Definition: definition.String(),
+				Page:       n,
+				match:      regexp.MustCompile(`(?i)(?:^|[^\pL\pN_])` + regexp.QuoteMeta(term) + `(?:$|[^\pL\pN_])`),
+			}
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(terms) == 0 {
+		return 0, nil
+	}
+
+	sorted := make([]*glossaryTerm, 0, len(terms))
+	for _, t := range terms {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := strings.ToLower(sorted[i].Term), strings.ToLower(sorted[j].Term)
+		if a != b {
+			return a < b
+		}
+		return sorted[i].Term < sorted[j].Term
+	})
+	for _, n := range pages {
+		lower := strings.ToLower(texts[n])
+		for _, t := range sorted {
+			if t.Page != n && strings.Contains(lower, strings.ToLower(t.Term)) && t.match.MatchString(texts[n]) {
+				t.uses = append(t.uses, n)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<dl class="glossary">`)
+	for _, t := range sorted {
+		fmt.Fprintf(&sb, "<dt>%s</dt>%s", html.EscapeString(t.Term), t.Definition)
+		fmt.Fprintf(&sb, `<dd class="glossary-refs">Defined in %s.`, glossaryLink(t.Page))
+		if len(t.uses) > 0 {
+			sb.WriteString(" Used in ")
+			for i, n := range t.uses {
+				if i == glossaryRefs {
+					fmt.Fprintf(&sb, " and %d more", len(t.uses)-glossaryRefs)
+					break
+				}
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				sb.WriteString(glossaryLink(n))
+			}
+			sb.WriteString(".")
+		}
+		sb.WriteString("</dd>")
+	}
+	sb.WriteString("</dl>")
+
+	// The glossary has no file of its own, File only marks it as a page
+	tree.Children = append(tree.Children, &Node{
+		Name:     GlossaryPath,
+		ID:       tree.ID + "-" + GlossaryPath,
+		Path:     GlossaryPath,
+		Title:    "Glossary",
+		Content:  sb.String(),
+		File:     GlossaryPath,
+		Appendix: true,
+	})
+	return len(sorted), nil
+}
+
+// glossaryLink links to the heading of page n
+func glossaryLink(n *Node) string {
+	return fmt.Sprintf(`<a href="#%s">%s</a>`, n.ID, html.EscapeString(n.DisplayName()))
+}
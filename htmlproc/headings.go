@@ -0,0 +1,90 @@
+package htmlproc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html/atom"
+)
+
+// NormalizeHeadings fixes the heading levels of the pages of tree, which
+// start at whatever level their authors liked, so they nest below the heading
+// of their page: the top-level headings of a chapter page, whose heading is
+// h2, become h3, and so on. Skipped levels are closed up and anything deeper
+// than h6 is flattened into h6. A first heading repeating the page's title
+// is dropped.
+func NormalizeHeadings(tree *Node) error {
+	var err error
+	var walk func(n *Node, depth int)
+	walk = func(n *Node, depth int) {
+		if n.File != "" && err == nil {
+			if n.Content, err = normalizeHeadings(n.Content, n.DisplayName(), headingLevel(depth)+1); err != nil {
+				err = fmt.Errorf("error parsing %s: %w", n.Path, err)
+			}
+		}
+		for _, c := range n.Children {
+			walk(c, depth+1)
+		}
+	}
+	walk(tree, 0)
+	return err
+}
+
+// normalizeHeadings moves the headings of content so the outermost ones are
+// at level base
+func normalizeHeadings(content, title string, base int) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	headings := doc.Find("h1, h2, h3, h4, h5, h6")
+	removed := false
+	if first := headings.First(); first.Length() > 0 && strings.EqualFold(strings.Join(strings.Fields(first.Text()), " "), title) {
+		first.Remove()
+		headings = headings.Slice(1, headings.Length())
+		removed = true
+	}
+	if headings.Length() == 0 {
+		if removed {
+			return doc.Find("body").Html()
+		}
+		return content, nil
+	}
+
+	top := 6
+	headings.Each(func(_ int, h *goquery.Selection) {
+		top = min(top, headingTagLevel(h))
+	})
+	// levels[i] is the new level of the headings of old level i in the
+	// current section, so a skipped level doesn't leave a gap
+	var levels [7]int
+	last := base - 1
+	headings.Each(func(_ int, h *goquery.Selection) {
+		old := headingTagLevel(h)
+		level := min(base+old-top, last+1)
+		for i := old - 1; i >= top; i-- {
+			if levels[i] != 0 {
+				level = min(level, levels[i]+1)
+				break
+			}
+		}
+		level = min(level, 6)
+		levels[old] = level
+		for i := old + 1; i < len(levels); i++ {
+			levels[i] = 0
+		}
+		last = level
+		node := h.Get(0)
+		node.Data = "h" + strconv.Itoa(level)
+		node.DataAtom = atom.Lookup([]byte(node.Data))
+	})
+	return doc.Find("body").Html()
+}
+
+// headingTagLevel returns n of the hn element h
+func headingTagLevel(h *goquery.Selection) int {
+	level, _ := strconv.Atoi(goquery.NodeName(h)[1:])
+	return level
+}
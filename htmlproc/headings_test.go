@@ -0,0 +1,51 @@
+package htmlproc
+
+import "testing"
+
+func TestNormalizeHeadings(t *testing.T) {
+	tests := []struct {
+		name, content, title string
+		base                 int
+		want                 string
+	}{
+		{
+			name:    "title only",
+			content: "<h1>Docs</h1><p>Welcome</p>",
+			title:   "docs",
+			base:    3,
+			want:    "<p>Welcome</p>",
+		},
+		{
+			name:    "title then sections",
+			content: "<h1>Docs</h1><h2>One</h2><h3>Two</h3>",
+			title:   "Docs",
+			base:    3,
+			want:    "<h3>One</h3><h4>Two</h4>",
+		},
+		{
+			name:    "no title",
+			content: "<h1>One</h1><h3>Two</h3>",
+			title:   "Docs",
+			base:    3,
+			want:    "<h3>One</h3><h4>Two</h4>",
+		},
+		{
+			name:    "no headings",
+			content: "<p>Text</p>",
+			title:   "Docs",
+			base:    3,
+			want:    "<p>Text</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeHeadings(tt.content, tt.title, tt.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeHeadings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
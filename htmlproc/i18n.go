@@ -0,0 +1,199 @@
+package htmlproc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Catalog maps whitespace-normalized msgids to their translations
+type Catalog map[string]string
+
+// LoadCatalogs reads every .po file of lang from an i2p.www translations
+// directory (<dir>/<lang>/LC_MESSAGES/*.po) into a single catalog
+func LoadCatalogs(dir, lang string) (Catalog, error) {
+	files, err := filepath.Glob(filepath.Join(dir, lang, "LC_MESSAGES", "*.po"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .po files for language %q in %s", lang, dir)
+	}
+
+	cat := Catalog{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		err = cat.parsePO(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+	}
+	return cat, nil
+}
+
+// parsePO adds the translated, non-fuzzy entries of a gettext .po file.
+// Message contexts and plural forms other than the first are ignored.
+func (c Catalog) parsePO(r io.Reader) error {
+	var (
+		msgid, msgstr, discard strings.Builder
+		current                *strings.Builder
+		seenStr, fuzzy         bool
+	)
+	commit := func() {
+		if seenStr && !fuzzy && msgid.Len() > 0 && msgstr.Len() > 0 {
+			c[normalizeMsgid(msgid.String())] = msgstr.String()
+		}
+		msgid.Reset()
+		msgstr.Reset()
+		current, seenStr, fuzzy = nil, false, false
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if seenStr && (text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "msgctxt ") || strings.HasPrefix(text, "msgid ")) {
+			commit()
+		}
+
+		keyword, rest, _ := strings.Cut(text, " ")
+		switch {
+		case text == "":
+			continue
+		case strings.HasPrefix(text, "#"):
+			if strings.HasPrefix(text, "#,") && strings.Contains(text, "fuzzy") {
+				fuzzy = true
+			}
+			continue
+		case keyword == "msgid":
+			current = &msgid
+		case keyword == "msgstr" || keyword == "msgstr[0]":
+			current = &msgstr
+			seenStr = true
+		case keyword == "msgctxt" || keyword == "msgid_plural" || strings.HasPrefix(keyword, "msgstr["):
+			discard.Reset()
+			current = &discard
+		case strings.HasPrefix(text, `"`):
+			rest = text
+		default:
+			return fmt.Errorf("line %d: unexpected %q", line, keyword)
+		}
+
+		if current == nil {
+			return fmt.Errorf("line %d: string outside of an entry", line)
+		}
+		s, err := strconv.Unquote(rest)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		current.WriteString(s)
+	}
+	commit()
+	return scanner.Err()
+}
+
+// normalizeMsgid collapses whitespace so that msgids extracted from templates
+// match regardless of how the {% trans %} block was indented
+func normalizeMsgid(s string) string {
+	return strings.TrimSpace(whitespaceRun.ReplaceAllString(s, " "))
+}
+
+// Translate returns the translation of msgid, or msgid itself
+func (c Catalog) Translate(msgid string) string {
+	if t, ok := c[normalizeMsgid(msgid)]; ok {
+		return t
+	}
+	return msgid
+}
+
+// AddTranslations follows each page of tree with the page of translated, the
+// same docs processed with the catalog of lang, at the same heading level.
+// Pages the catalog leaves as they are get a note instead, so translators
+// can see what is missing. It returns the number of pages translated and of
+// pages without a translation.
+func AddTranslations(tree, translated *Node, lang string) (done, missing int) {
+	pages := map[string]*Node{}
+	translated.Walk(func(n *Node) {
+		if n.File != "" {
+			pages[n.Path] = n
+		}
+	})
+	tree.Walk(func(n *Node) {
+		if n.File == "" || n.Lang != "" {
+			return
+		}
+		t := &Node{Name: n.Name, ID: n.ID + "-" + lang, Path: n.Path, Title: n.Title, File: n.File, Lang: lang}
+		p := pages[n.Path]
+		if p != nil {
+			// The anchors stay those of the translated tree, which the links
+			// of translated pages point to
+			t.ID = p.ID
+		}
+		if p != nil && p.Content != n.Content {
+			t.Title, t.Content = p.Title, p.Content
+			done++
+		} else {
+			t.Content = fmt.Sprintf(`<p class="untranslated">This page has no translation into %s yet.</p>`, lang)
+			missing++
+		}
+		n.Translations = append(n.Translations, t)
+	})
+	return done, missing
+}
+
+// langFonts lists font families able to render scripts the default Arial
+// can't, keyed by language code, or language and region where the region
+// writes differently
+var langFonts = map[string]string{
+	"zh":    `"Noto Sans CJK SC", "Noto Sans SC", "Source Han Sans SC", "WenQuanYi Micro Hei", "Microsoft YaHei", "PingFang SC", sans-serif`,
+	"zh_TW": `"Noto Sans CJK TC", "Noto Sans TC", "Source Han Sans TC", "Microsoft JhengHei", "PingFang TC", sans-serif`,
+	"zh_HK": `"Noto Sans CJK HK", "Noto Sans HK", "Noto Sans CJK TC", "Microsoft JhengHei", "PingFang HK", sans-serif`,
+	"ja":    `"Noto Sans CJK JP", "Noto Sans JP", "Source Han Sans JP", "IPAGothic", "Yu Gothic", "Hiragino Sans", sans-serif`,
+	"ko":    `"Noto Sans CJK KR", "Noto Sans KR", "Source Han Sans KR", "NanumGothic", "Malgun Gothic", sans-serif`,
+	"th":    `"Noto Sans Thai", "Tahoma", sans-serif`,
+	"hi":    `"Noto Sans Devanagari", "Mangal", sans-serif`,
+	"ar":    `"Noto Naskh Arabic", "Amiri", "DejaVu Sans", sans-serif`,
+	"fa":    `"Vazirmatn", "Noto Naskh Arabic", "DejaVu Sans", sans-serif`,
+	"ur":    `"Noto Nastaliq Urdu", "Noto Naskh Arabic", "DejaVu Sans", sans-serif`,
+	"he":    `"Noto Sans Hebrew", "Culmus", "DejaVu Sans", sans-serif`,
+	"el":    `"DejaVu Sans", Arial, sans-serif`,
+	"ru":    `"DejaVu Sans", Arial, sans-serif`,
+	"uk":    `"DejaVu Sans", Arial, sans-serif`,
+}
+
+// rtlLangs are the languages written right to left, keyed by language code
+var rtlLangs = map[string]bool{"ar": true, "fa": true, "he": true, "ur": true, "ps": true, "yi": true}
+
+// IsRTL reports whether lang is written right to left
+func IsRTL(lang string) bool {
+	base, _, _ := strings.Cut(lang, "_")
+	return rtlLangs[base]
+}
+
+// NeedsFonts reports whether lang is written in a script the default Arial
+// can't render, so fonts for it must be installed or embedded
+func NeedsFonts(lang string) bool {
+	base, _, _ := strings.Cut(lang, "_")
+	_, ok := langFonts[base]
+	return ok
+}
+
+// fontFamilyFor returns the CSS font-family to use for lang
+func fontFamilyFor(lang string) string {
+	if f, ok := langFonts[lang]; ok {
+		return f
+	}
+	base, _, _ := strings.Cut(lang, "_")
+	if f, ok := langFonts[base]; ok {
+		return f
+	}
+	return "Arial, sans-serif"
+}
@@ -0,0 +1,162 @@
+package htmlproc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// photoColors is the number of distinct colors from which an opaque PNG is
+// taken for a photo or rendering, which JPEG stores in far less space.
+// Diagrams and screenshots have fewer and lose legibility as JPEG.
+const photoColors = 4096
+
+// ImageOptimizer shrinks the PNG and JPEG images copied along with the pages,
+// which are often far larger than print needs: it scales those wider than
+// MaxWidth down, converts photo-like PNGs to JPEG and recompresses JPEGs.
+// Images keep the size they are shown at.
+type ImageOptimizer struct {
+	MaxWidth int // Pixels, 0 to keep the width
+	// JPEGQuality converts photo-like PNGs to JPEGs of this quality (1-100)
+	// and recompresses JPEGs with it, 0 to only rescale
+	JPEGQuality int
+
+	plans sync.Map // Source file → imagePlan, images are shared by pages
+
+	mu            sync.Mutex // Guards the savings, copies may run concurrently
+	shrunk        int
+	before, after int64
+}
+
+// imagePlan is how an image is copied
+type imagePlan struct {
+	width int  // Width of the source, 0 if it isn't an image to optimize
+	jpeg  bool // Whether a PNG is converted to JPEG
+}
+
+// plan decodes file to decide how to copy it
+func (o *ImageOptimizer) plan(file string) imagePlan {
+	if p, ok := o.plans.Load(file); ok {
+		return p.(imagePlan)
+	}
+	var p imagePlan
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".png":
+		img, err := decodeImage(file)
+		if err != nil {
+			slog.Debug("Cannot decode image, copying it as it is", "file", file, "err", err)
+			break
+		}
+		p.width = img.Bounds().Dx()
+		p.jpeg = o.JPEGQuality > 0 && photoLike(img)
+	case ".jpg", ".jpeg":
+		f, err := os.Open(file)
+		if err != nil {
+			break
+		}
+		if config, _, err := image.DecodeConfig(f); err == nil {
+			p.width = config.Width
+		}
+		f.Close()
+	}
+	o.plans.Store(file, p)
+	return p
+}
+
+// photoLike reports whether img is opaque and has at least photoColors
+// colors
+func photoLike(img image.Image) bool {
+	colors := map[uint64]bool{}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a != 0xffff {
+				return false
+			}
+			colors[uint64(r>>8)<<16|uint64(g>>8)<<8|uint64(bl>>8)] = true
+		}
+	}
+	return len(colors) >= photoColors
+}
+
+func decodeImage(file string) (image.Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// copy writes the optimized file to dest, and reports whether it did; when
+// it didn't, the file is to be copied as it is
+func (o *ImageOptimizer) copy(file, dest string) (bool, error) {
+	p := o.plan(file)
+	isJPEG := p.jpeg || !strings.EqualFold(filepath.Ext(file), ".png")
+	resize := o.MaxWidth > 0 && p.width > o.MaxWidth
+	if p.width == 0 || !resize && !p.jpeg && !(isJPEG && o.JPEGQuality > 0) {
+		return false, nil
+	}
+	img, err := decodeImage(file)
+	if err != nil {
+		return false, err
+	}
+	if resize {
+		b := img.Bounds()
+		h := max(1, b.Dy()*o.MaxWidth/b.Dx())
+		scaled := image.NewRGBA(image.Rect(0, 0, o.MaxWidth, h))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, b, draw.Src, nil)
+		img = scaled
+	}
+	var buf bytes.Buffer
+	if isJPEG {
+		quality := o.JPEGQuality
+		if quality == 0 {
+			quality = 90
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	}
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return false, err
+	}
+	// Recompressing alone may not pay off, a converted PNG has to be written
+	if !resize && !p.jpeg && int64(buf.Len()) >= info.Size() {
+		return false, nil
+	}
+	if err := os.WriteFile(dest, buf.Bytes(), 0644); err != nil {
+		return false, err
+	}
+	o.mu.Lock()
+	o.shrunk++
+	o.before += info.Size()
+	o.after += int64(buf.Len())
+	o.mu.Unlock()
+	return true, nil
+}
+
+// Report logs how much the optimized images were shrunk
+func (o *ImageOptimizer) Report() {
+	if o.shrunk == 0 {
+		slog.Info("No images to shrink")
+		return
+	}
+	slog.Info("Shrank images", "count", o.shrunk, "before", o.before, "after", o.after,
+		"saved", fmt.Sprintf("%.0f%%", 100-100*float64(o.after)/float64(max(o.before, 1))))
+}
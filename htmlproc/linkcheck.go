@@ -0,0 +1,248 @@
+package htmlproc
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// LinkChecker finds the links of processed pages that lead nowhere: links
+// within the document to anchors that don't exist, relative links to pages
+// that weren't included or don't exist, and links to other websites that
+// fail.
+type LinkChecker struct {
+	Offline bool          // Don't request external links, only check the document
+	Timeout time.Duration // Time allowed per external link, 0 for 30 seconds
+	Jobs    int           // External links checked concurrently, 0 for 8
+	// Progress, if not nil, is called as external links are checked
+	Progress func(done, total int)
+}
+
+// BrokenLink is a link the LinkChecker found to lead nowhere
+type BrokenLink struct {
+	Page   string `json:"page"` // Path of the page the link is on, "index" for the docs index
+	Href   string `json:"href"`
+	Reason string `json:"reason"`
+}
+
+// LinkReport is the result of checking the links of a document
+type LinkReport struct {
+	Checked int          `json:"checked"` // Links checked
+	Skipped int          `json:"skipped"` // External links not requested, offline or on I2P
+	Broken  []BrokenLink `json:"broken"`
+}
+
+// Check checks the links of every page in tree
+func (c *LinkChecker) Check(tree *Node) (*LinkReport, error) {
+	report := &LinkReport{Broken: []BrokenLink{}}
+	pages := map[string]*goquery.Document{}
+	anchors := map[string]bool{}
+	var parseErr error
+	tree.Walk(func(n *Node) {
+		anchors[n.ID] = true
+		if n.File == "" || parseErr != nil {
+			return
+		}
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(n.Content))
+		if err != nil {
+			parseErr = fmt.Errorf("error parsing %s: %w", n.Path, err)
+			return
+		}
+		pages[pageName(n)] = doc
+		doc.Find("[id], a[name]").Each(func(i int, s *goquery.Selection) {
+			anchors[s.AttrOr("id", s.AttrOr("name", ""))] = true
+		})
+	})
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	external := map[string][]string{} // URL to the pages linking to it
+	for page, doc := range pages {
+		doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+			href := strings.TrimSpace(s.AttrOr("href", ""))
+			u, err := url.Parse(href)
+			switch {
+			case err != nil:
+				report.Checked++
+				report.add(page, href, "invalid URL")
+			case strings.HasPrefix(href, "#"):
+				report.Checked++
+				if !anchors[u.Fragment] && u.Fragment != "" {
+					report.add(page, href, "no such anchor in the document")
+				}
+			case externalLink(href):
+				if !contains(external[href], page) {
+					external[href] = append(external[href], page)
+				}
+			case u.Scheme == "" && u.Host == "" && u.Path != "" && !strings.HasPrefix(u.Path, "/"):
+				// Links to included pages were rewritten to anchors.
+				// Site-absolute ones are left for the website.
+				report.Checked++
+				report.add(page, href, "page is not in the document")
+			}
+		})
+	}
+
+	var urls []string
+	for href := range external {
+		host := strings.ToLower(strings.TrimSuffix(hostOf(href), "."))
+		if c.Offline || strings.HasSuffix(host, ".i2p") {
+			report.Skipped++
+			continue
+		}
+		urls = append(urls, href)
+	}
+	sort.Strings(urls)
+	for href, reason := range c.checkExternal(urls) {
+		for _, page := range external[href] {
+			report.add(page, href, reason)
+		}
+	}
+	report.Checked += len(urls)
+
+	sort.Slice(report.Broken, func(i, j int) bool {
+		a, b := report.Broken[i], report.Broken[j]
+		if a.Page != b.Page {
+			return a.Page < b.Page
+		}
+		return a.Href < b.Href
+	})
+	return report, nil
+}
+
+// pageName names the page of n in reports
+func pageName(n *Node) string {
+	if n.Path == "" {
+		return "index"
+	}
+	return n.Path
+}
+
+// add records a broken link
+func (r *LinkReport) add(page, href, reason string) {
+	r.Broken = append(r.Broken, BrokenLink{Page: page, Href: href, Reason: reason})
+}
+
+// contains reports whether list has s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hostOf returns the host name of an absolute URL
+func hostOf(href string) string {
+	u, _ := url.Parse(href)
+	return u.Hostname()
+}
+
+// checkExternal requests urls, several at a time, and returns why the failed
+// ones failed
+func (c *LinkChecker) checkExternal(urls []string) map[string]string {
+	timeout, jobs := c.Timeout, c.Jobs
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	if jobs <= 0 {
+		jobs = 8
+	}
+	client := &http.Client{Timeout: timeout}
+
+	var (
+		mu     sync.Mutex
+		failed = map[string]string{}
+		done   atomic.Int64
+		wg     sync.WaitGroup
+	)
+	sem := make(chan struct{}, jobs)
+	for _, href := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if reason := checkURL(client, href); reason != "" {
+				slog.Debug("Broken link", "url", href, "reason", reason)
+				mu.Lock()
+				failed[href] = reason
+				mu.Unlock()
+			}
+			if c.Progress != nil {
+				c.Progress(int(done.Add(1)), len(urls))
+			}
+		}()
+	}
+	wg.Wait()
+	return failed
+}
+
+// checkURL requests href and returns why it failed, or "" if it works. Some
+// servers refuse HEAD requests, those are retried with GET.
+func checkURL(client *http.Client, href string) string {
+	var status int
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, href, nil)
+		if err != nil {
+			return err.Error()
+		}
+		req.Header.Set("User-Agent", "i2pdoc2pdf link checker")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err.Error()
+		}
+		resp.Body.Close()
+		status = resp.StatusCode
+		switch status {
+		case http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusForbidden:
+			continue
+		}
+		break
+	}
+	if status >= 400 {
+		return fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
+	return ""
+}
+
+// MarkBrokenLinks highlights the broken links of the report in the pages of
+// tree, so they stand out in the document
+func MarkBrokenLinks(tree *Node, broken []BrokenLink) error {
+	byPage := map[string]map[string]bool{}
+	for _, b := range broken {
+		if byPage[b.Page] == nil {
+			byPage[b.Page] = map[string]bool{}
+		}
+		byPage[b.Page][b.Href] = true
+	}
+	var err error
+	tree.Walk(func(n *Node) {
+		hrefs := byPage[pageName(n)]
+		if n.File == "" || hrefs == nil || err != nil {
+			return
+		}
+		var doc *goquery.Document
+		doc, err = goquery.NewDocumentFromReader(strings.NewReader(n.Content))
+		if err != nil {
+			return
+		}
+		doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+			if hrefs[strings.TrimSpace(s.AttrOr("href", ""))] {
+				s.AddClass("broken-link")
+				s.AfterHtml(`<sup class="broken-link-note">[broken link]</sup>`)
+			}
+		})
+		n.Content, err = doc.Find("body").Html()
+	})
+	return err
+}
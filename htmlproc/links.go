@@ -0,0 +1,202 @@
+package htmlproc
+
+import (
+	"log/slog"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SpecsPath is the URL path of the specifications on the website. They live
+// beside the docs there; builds that include them keep them in a directory of
+// that name in the input directory.
+const SpecsPath = "spec"
+
+// langPrefix matches the language segment of i2p.www URLs, e.g. "en/" or "pt_BR/"
+var langPrefix = regexp.MustCompile(`^[a-z]{2}(_[A-Z]{2})?/`)
+
+// LinkMap resolves hrefs between included pages to anchors in the combined document
+type LinkMap struct {
+	baseDir  string            // Input directory the pages were found in
+	sitePath string            // URL path of baseDir on the website, e.g. "docs"
+	siteHost string            // Host of the website, e.g. "geti2p.net"
+	anchors  map[string]string // Page path relative to baseDir → heading ID
+}
+
+// NewLinkMap indexes every page of the tree. sitePath and siteURL describe
+// where the input directory lives on the website, so that absolute links like
+// https://geti2p.net/en/docs/transport/ntcp2 are recognized as internal too.
+func NewLinkMap(baseDir string, tree *Node, sitePath, siteURL string) *LinkMap {
+	lm := &LinkMap{
+		baseDir:  baseDir,
+		sitePath: strings.Trim(sitePath, "/"),
+		anchors:  make(map[string]string),
+	}
+	if u, err := url.Parse(siteURL); err == nil {
+		lm.siteHost = u.Host
+	}
+	tree.Walk(func(n *Node) {
+		if n.File != "" {
+			lm.anchors[n.Path] = n.ID
+		}
+	})
+	return lm
+}
+
+// Resolve returns the anchor for href as seen from the page in htmlFile, or
+// false if href does not point at an included page
+func (lm *LinkMap) Resolve(htmlFile, href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil || u.Opaque != "" {
+		return "", false
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if !strings.EqualFold(u.Host, lm.siteHost) || lm.siteHost == "" {
+			return "", false
+		}
+	}
+	if u.Path == "" {
+		// Same-page fragment, nothing to rewrite
+		return "", false
+	}
+
+	var target string
+	if strings.HasPrefix(u.Path, "/") || u.Host != "" {
+		// Site-absolute: strip the language and the path of the docs root
+		target = strings.TrimPrefix(u.Path, "/")
+		target = langPrefix.ReplaceAllString(target, "")
+		if lm.sitePath != "" {
+			if target == lm.sitePath || strings.HasPrefix(target, lm.sitePath+"/") {
+				target = strings.TrimPrefix(strings.TrimPrefix(target, lm.sitePath), "/")
+			} else if target != SpecsPath && !strings.HasPrefix(target, SpecsPath+"/") {
+				return "", false
+			}
+		}
+	} else {
+		rel, err := filepath.Rel(lm.baseDir, htmlFile)
+		if err != nil {
+			return "", false
+		}
+		target = path.Join(path.Dir(filepath.ToSlash(rel)), u.Path)
+	}
+
+	target = strings.TrimSuffix(path.Clean("/"+target), "/")
+	// Pages are named without the extension of their source
+	switch path.Ext(target) {
+	case ".html", ".rst", ".md", ".markdown":
+		target = strings.TrimSuffix(target, path.Ext(target))
+	}
+	target = strings.TrimSuffix(target, "/index")
+	target = norm.NFC.String(strings.TrimPrefix(target, "/"))
+
+	id, ok := lm.anchors[target]
+	return id, ok
+}
+
+// idSeparator joins the anchor of a page and an ID of the page, see
+// NamespaceIDs
+const idSeparator = "--"
+
+// namespacedID returns the ID in the combined document of the element id of
+// the page anchored at page
+func namespacedID(page, id string) string {
+	return page + idSeparator + id
+}
+
+// pageAnchor returns the anchor of the page an ID of the combined document
+// belongs to
+func pageAnchor(id string) string {
+	page, _, _ := strings.Cut(id, idSeparator)
+	return page
+}
+
+// NamespaceIDs prefixes the IDs of the page in htmlFile with the anchor of its
+// chapter, so "overview" on spec/ntcp2 becomes "doc-spec-ntcp2--overview"
+// and pages may use the same IDs, and points the links to them within the
+// page at the new IDs. The IDs within SVG images are left alone, the images
+// refer to them.
+func (lm *LinkMap) NamespaceIDs(doc *goquery.Document, htmlFile string) {
+	rel, err := filepath.Rel(lm.baseDir, htmlFile)
+	if err != nil {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+	page, ok := lm.anchors[pagePath(strings.TrimSuffix(rel, path.Ext(rel)))]
+	if !ok {
+		return
+	}
+	ids := map[string]bool{}
+	doc.Find("body [id], body a[name]").Not("svg, svg *").Each(func(_ int, s *goquery.Selection) {
+		for _, attr := range []string{"id", "name"} {
+			if id, ok := s.Attr(attr); ok && id != "" && (attr == "id" || goquery.NodeName(s) == "a") {
+				ids[id] = true
+				s.SetAttr(attr, namespacedID(page, id))
+			}
+		}
+	})
+	doc.Find(`a[href^="#"]`).Each(func(_ int, s *goquery.Selection) {
+		if id := strings.TrimPrefix(s.AttrOr("href", ""), "#"); ids[id] {
+			s.SetAttr("href", "#"+namespacedID(page, id))
+		}
+	})
+}
+
+// pageFragment matches links to an element of a page in the combined
+// document
+var pageFragment = regexp.MustCompile(`href="#([^"]*` + idSeparator + `[^"]*)"`)
+
+// anchorAttr matches the IDs of elements and the names of anchors
+var anchorAttr = regexp.MustCompile(`\s(?:id|name)="([^"]*)"`)
+
+// fixFragments points links to elements of other pages that don't exist, by
+// an outdated fragment for instance, at the page instead
+func fixFragments(tree *Node) {
+	anchors := map[string]bool{}
+	tree.Walk(func(n *Node) {
+		anchors[n.ID] = true
+		for _, t := range n.Translations {
+			anchors[t.ID] = true
+		}
+		for _, m := range anchorAttr.FindAllStringSubmatch(n.Content, -1) {
+			anchors[m[1]] = true
+		}
+	})
+	tree.Walk(func(n *Node) {
+		if !strings.Contains(n.Content, idSeparator) {
+			return
+		}
+		n.Content = pageFragment.ReplaceAllStringFunc(n.Content, func(m string) string {
+			id := pageFragment.FindStringSubmatch(m)[1]
+			if anchors[id] || !anchors[pageAnchor(id)] {
+				return m
+			}
+			slog.Debug("No such anchor, linking to the page", "page", pageName(n), "anchor", id)
+			return `href="#` + pageAnchor(id) + `"`
+		})
+	})
+}
+
+// RewriteLinks points hrefs to other included pages at their chapter anchors,
+// so cross-references jump within the PDF instead of to dead relative URLs.
+// Links to an element of a page point at its namespaced ID, see
+// NamespaceIDs.
+func (lm *LinkMap) RewriteLinks(doc *goquery.Document, htmlFile string) {
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if id, ok := lm.Resolve(htmlFile, href); ok {
+			if u, _ := url.Parse(href); u.Fragment != "" {
+				id = namespacedID(id, u.Fragment)
+			}
+			s.SetAttr("href", "#"+id)
+			return
+		}
+		if u, err := url.Parse(href); err == nil && u.Scheme == "" && u.Host == "" && u.Path != "" && !strings.HasPrefix(u.Path, "{{") {
+			slog.Warn("Unresolved internal link", "page", htmlFile, "href", href)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package htmlproc
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is a chapter manifest: the chapters of the document in reading
+// order, with titles of their own if given, optionally grouped into parts.
+// It is YAML or JSON:
+//
+//	parts:
+//	  - title: "Part I: Concepts"
+//	    chapters:
+//	      - how/intro
+//	      - page: how/tech-intro
+//	        title: Technical introduction
+//	  - title: "Part II: Protocols"
+//	    chapters: [protocols]
+//
+// or a list of chapters without parts. A chapter is a page or a section with
+// all its pages, relative to the docs root.
+type Manifest struct {
+	Parts    []ManifestPart    `yaml:"parts"`
+	Chapters []ManifestChapter `yaml:"chapters"`
+}
+
+// ManifestPart is a group of chapters under a heading
+type ManifestPart struct {
+	Title    string            `yaml:"title"`
+	Chapters []ManifestChapter `yaml:"chapters"`
+}
+
+// ManifestChapter is a chapter of a Manifest, written as its page path alone
+// unless it has a title
+type ManifestChapter struct {
+	Page  string `yaml:"page"`
+	Title string `yaml:"title"`
+}
+
+// UnmarshalYAML reads a chapter given as a path or as a mapping
+func (c *ManifestChapter) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.Page = value.Value
+		return nil
+	}
+	type plain ManifestChapter
+	return value.Decode((*plain)(c))
+}
+
+// ReadManifest reads and checks a chapter manifest. JSON is read as the YAML
+// it is a subset of.
+func ReadManifest(file string) (*Manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(m.Parts) > 0 && len(m.Chapters) > 0 {
+		return nil, fmt.Errorf("%s: list chapters within parts or without, not both", file)
+	}
+	seen := map[string]bool{}
+	for i, part := range m.parts() {
+		if part.Title == "" && len(m.Parts) > 0 {
+			return nil, fmt.Errorf("%s: part %d has no title", file, i+1)
+		}
+		for j, c := range part.Chapters {
+			if strings.TrimSpace(c.Page) == "" {
+				return nil, fmt.Errorf("%s: chapter %d of part %d has no page", file, j+1, i+1)
+			}
+			p := pagePath(c.Page)
+			if seen[p] {
+				return nil, fmt.Errorf("%s: %s is listed twice", file, c.Page)
+			}
+			seen[p] = true
+			part.Chapters[j].Page = p
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("%s lists no chapters", file)
+	}
+	return &m, nil
+}
+
+// parts returns the parts of m, a single untitled one if it has none
+func (m *Manifest) parts() []ManifestPart {
+	if len(m.Parts) > 0 {
+		return m.Parts
+	}
+	return []ManifestPart{{Chapters: m.Chapters}}
+}
+
+// Order returns the chapters of m in reading order, for SortTree
+func (m *Manifest) Order() []string {
+	var order []string
+	for _, part := range m.parts() {
+		for _, c := range part.Chapters {
+			order = append(order, c.Page)
+		}
+	}
+	return order
+}
+
+// apply arranges tree as m lists: the chapters in order at the top level, or
+// in their parts, with their titles. Chapters found in known, the paths of
+// all the pages and sections of the docs, but not in tree were left out on
+// purpose, by a filter for instance; the others are returned as missing.
+// Pages in no chapter stay after the listed ones and are returned as
+// unlisted.
+func (m *Manifest) apply(tree *Node, known map[string]bool) (missing, unlisted []string) {
+	nodes := map[string]*Node{}
+	parents := map[*Node]*Node{}
+	tree.Walk(func(n *Node) {
+		nodes[n.Path] = n
+		for _, c := range n.Children {
+			parents[c] = n
+		}
+	})
+	listed := map[*Node]bool{}
+	detach := func(n *Node) {
+		parent := parents[n]
+		parent.Children = slices.DeleteFunc(parent.Children, func(c *Node) bool { return c == n })
+		// Sections left without pages go
+		for parent != tree && !listed[parent] && parent.File == "" && len(parent.Children) == 0 {
+			n, parent = parent, parents[parent]
+			parent.Children = slices.DeleteFunc(parent.Children, func(c *Node) bool { return c == n })
+		}
+	}
+
+	var top []*Node
+	for i, part := range m.parts() {
+		var chapters []*Node
+		for _, c := range part.Chapters {
+			n, ok := nodes[c.Page]
+			if n == tree {
+				continue // The docs index page comes first anyway
+			}
+			if !ok {
+				if !known[c.Page] {
+					missing = append(missing, c.Page)
+				} else {
+					slog.Debug("Leaving out chapter of the manifest", "page", c.Page)
+				}
+				continue
+			}
+			if c.Title != "" {
+				n.Title = c.Title
+			}
+			detach(n)
+			listed[n] = true
+			chapters = append(chapters, n)
+		}
+		if len(m.Parts) == 0 {
+			top = chapters
+			continue
+		}
+		if len(chapters) == 0 {
+			slog.Warn("Leaving out empty part of the manifest", "part", part.Title)
+			continue
+		}
+		name := fmt.Sprintf("_part%d", i+1)
+		top = append(top, &Node{
+			Name:     name,
+			ID:       tree.ID + "-part-" + fmt.Sprint(i+1),
+			Path:     name,
+			Title:    part.Title,
+			Children: chapters,
+			Part:     true,
+		})
+	}
+
+	for _, c := range tree.Children {
+		c.Walk(func(n *Node) {
+			if n.File != "" {
+				unlisted = append(unlisted, n.Path)
+			}
+		})
+	}
+	tree.Children = append(top, tree.Children...)
+	return missing, unlisted
+}
@@ -0,0 +1,88 @@
+package htmlproc
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v3"
+)
+
+// markdown converts GitHub Flavored Markdown: tables, fenced code blocks,
+// strikethrough, task lists and autolinks, with IDs on the headings. Raw
+// HTML is kept, the pages are cleaned up like HTML pages afterwards.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, extension.Footnote, extension.DefinitionList),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// frontMatter matches the YAML metadata block opening a Markdown page
+var frontMatter = regexp.MustCompile(`(?s)\A---\r?\n(.*?)\r?\n(?:---|\.\.\.)\r?\n`)
+
+// ConvertMarkdown converts a Markdown page, such as those of mkdocs sites,
+// to HTML and returns its title and the HTML of its body, without the
+// title. The title is the title of the front matter, else the first
+// top-level heading, which is then left out of the body.
+func ConvertMarkdown(src []byte) (title, body string, err error) {
+	if m := frontMatter.FindSubmatch(src); m != nil {
+		var meta struct {
+			Title string `yaml:"title"`
+		}
+		if err := yaml.Unmarshal(m[1], &meta); err == nil {
+			title = meta.Title
+		}
+		src = src[len(m[0]):]
+	}
+
+	doc := markdown.Parser().Parse(text.NewReader(src))
+	if title == "" {
+		for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+			if h, ok := n.(*ast.Heading); ok && h.Level == 1 {
+				title = strings.TrimSpace(string(headingText(h, src)))
+				doc.RemoveChild(doc, h)
+				break
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, src, doc); err != nil {
+		return "", "", fmt.Errorf("error rendering Markdown: %w", err)
+	}
+	return title, buf.String(), nil
+}
+
+// headingText returns the plain text of a heading, without its markup
+func headingText(n ast.Node, src []byte) []byte {
+	var buf bytes.Buffer
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := c.(type) {
+		case *ast.Text:
+			buf.Write(t.Segment.Value(src))
+			if t.SoftLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(t.Value)
+		case *ast.CodeSpan:
+			for s := t.FirstChild(); s != nil; s = s.NextSibling() {
+				if st, ok := s.(*ast.Text); ok {
+					buf.Write(st.Segment.Value(src))
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.Bytes()
+}
@@ -0,0 +1,181 @@
+package htmlproc
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	xhtml "golang.org/x/net/html"
+)
+
+// CheckMath returns an error unless tool is a way to typeset formulas
+func CheckMath(tool string) error {
+	switch tool {
+	case "auto", "katex", "tex2svg", "none":
+		return nil
+	}
+	return fmt.Errorf("unknown math renderer %q, expected auto, katex, tex2svg or none", tool)
+}
+
+// DetectMath returns the math renderer "auto" stands for: katex if it is in
+// PATH, else tex2svg, else "none"
+func DetectMath() string {
+	for _, tool := range []string{"katex", "tex2svg"} {
+		if _, err := exec.LookPath(tool); err == nil {
+			return tool
+		}
+	}
+	return "none"
+}
+
+// MathRenderer typesets the LaTeX formulas of pages, such as the equations of
+// the cryptography specifications, ahead of rendering. Tool is "katex" for
+// the KaTeX command line, whose HTML needs the stylesheet of CSS, or
+// "tex2svg" (MathJax) for self-contained SVG that every engine draws.
+//
+// Formulas are the elements of class "math", as reStructuredText converters
+// write them, and text between \( and \) (inline) or \[ and \] (display).
+type MathRenderer struct {
+	Tool string
+
+	rendered sync.Map // Formula → HTML, pages repeat formulas
+}
+
+// mathDelimited matches the formulas in text, inline or display
+var mathDelimited = regexp.MustCompile(`(?s)\\\((.+?)\\\)|\\\[(.+?)\\\]`)
+
+// typeset replaces the formulas of doc with their typeset form, leaving those
+// that fail to render as their source
+func (m *MathRenderer) typeset(doc *goquery.Document, file string) {
+	doc.Find(".math").Each(func(_ int, s *goquery.Selection) {
+		tex := strings.TrimSpace(s.Text())
+		display := goquery.NodeName(s) == "div" || s.HasClass("display")
+		if inner := mathDelimited.FindStringSubmatch(tex); inner != nil && inner[0] == tex {
+			tex, display = inner[1]+inner[2], inner[2] != ""
+		}
+		if out, ok := m.render(tex, display, file); ok {
+			s.SetHtml(out)
+		}
+	})
+
+	var texts []*xhtml.Node
+	doc.Find("body").Each(func(_ int, s *goquery.Selection) {
+		var walk func(n *xhtml.Node)
+		walk = func(n *xhtml.Node) {
+			if n.Type == xhtml.ElementNode && (n.Data == "pre" || n.Data == "code" || hasClass(n, "math")) {
+				return
+			}
+			if n.Type == xhtml.TextNode && mathDelimited.MatchString(n.Data) {
+				texts = append(texts, n)
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(s.Get(0))
+	})
+	for _, n := range texts {
+		var sb strings.Builder
+		last := 0
+		for _, loc := range mathDelimited.FindAllStringSubmatchIndex(n.Data, -1) {
+			sb.WriteString(html.EscapeString(n.Data[last:loc[0]]))
+			last = loc[1]
+			display := loc[4] >= 0
+			var tex string
+			if display {
+				tex = n.Data[loc[4]:loc[5]]
+			} else {
+				tex = n.Data[loc[2]:loc[3]]
+			}
+			if out, ok := m.render(tex, display, file); ok {
+				tag := "span"
+				if display {
+					tag = "div"
+				}
+				fmt.Fprintf(&sb, `<%s class="math">%s</%s>`, tag, out, tag)
+			} else {
+				sb.WriteString(html.EscapeString(n.Data[loc[0]:loc[1]]))
+			}
+		}
+		sb.WriteString(html.EscapeString(n.Data[last:]))
+		goquery.NewDocumentFromNode(n).ReplaceWithHtml(sb.String())
+	}
+}
+
+// hasClass reports whether the element n has class
+func hasClass(n *xhtml.Node, class string) bool {
+	for _, a := range n.Attr {
+		if a.Key == "class" && strings.Contains(" "+a.Val+" ", " "+class+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the HTML of formula tex, and whether it could be rendered
+func (m *MathRenderer) render(tex string, display bool, file string) (string, bool) {
+	key := fmt.Sprintf("%t %s", display, tex)
+	if out, ok := m.rendered.Load(key); ok {
+		return out.(string), true
+	}
+	var cmd *exec.Cmd
+	switch m.Tool {
+	case "katex":
+		cmd = exec.Command("katex", "--format", "html")
+		if display {
+			cmd.Args = append(cmd.Args, "--display-mode")
+		}
+		cmd.Stdin = strings.NewReader(tex)
+	case "tex2svg":
+		cmd = exec.Command("tex2svg", tex)
+		if !display {
+			cmd.Args = append(cmd.Args, "--inline")
+		}
+	default:
+		return "", false
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exit.Stderr)))
+		}
+		slog.Warn("Cannot typeset formula, keeping its source", "file", file, "formula", tex, "tool", m.Tool, "err", err)
+		return "", false
+	}
+	m.rendered.Store(key, string(out))
+	return string(out), true
+}
+
+// katexFontFormats matches the WOFF sources of the @font-face rules of the
+// KaTeX stylesheet, which older engines cannot load
+var katexFontFormats = regexp.MustCompile(`url\([^)]*\.woff2?\) format\("woff2?"\),?`)
+
+// CSS returns the stylesheet the typeset formulas need, with the fonts it
+// refers to embedded: that of KaTeX, found in the dist directory of its npm
+// package next to the katex command. tex2svg needs none.
+func (m *MathRenderer) CSS() (string, error) {
+	if m.Tool != "katex" {
+		return "", nil
+	}
+	bin, err := exec.LookPath("katex")
+	if err != nil {
+		return "", err
+	}
+	if bin, err = filepath.EvalSymlinks(bin); err != nil {
+		return "", err
+	}
+	// The command is cli.js at the root of the package
+	dist := filepath.Join(filepath.Dir(bin), "dist")
+	css, err := os.ReadFile(filepath.Join(dist, "katex.min.css"))
+	if err != nil {
+		return "", fmt.Errorf("cannot find the KaTeX stylesheet: %w", err)
+	}
+	return string(inlineCSSURLs(katexFontFormats.ReplaceAll(css, nil), dist)), nil
+}
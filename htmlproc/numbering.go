@@ -0,0 +1,67 @@
+package htmlproc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckNumbering returns an error unless scheme is a way to number chapters
+func CheckNumbering(scheme string) error {
+	switch scheme {
+	case "none", "decimal", "appendix":
+		return nil
+	}
+	return fmt.Errorf("unknown numbering %q, expected none, decimal or appendix", scheme)
+}
+
+// NumberChapters numbers the sections and pages of tree by their place in
+// it, e.g. 3.2.1 for the first page of the second subsection of the third
+// section. With scheme "appendix" the appendices at the end (proposals,
+// glossary, changelog...) are lettered A, B... instead, their pages A.1,
+// A.2... The docs index page, the root, is not numbered, nor are parts,
+// whose chapters are numbered on through the book. Translations take the
+// number of their page.
+func NumberChapters(tree *Node, scheme string) {
+	if scheme == "none" {
+		return
+	}
+	number, letter := 0, 0
+	var numberTop func(chapters []*Node)
+	numberTop = func(chapters []*Node) {
+		for _, c := range chapters {
+			switch {
+			case c.Part:
+				numberTop(c.Children)
+			case c.Appendix && scheme == "appendix":
+				letter++
+				numberChapter(c, string(rune('A'+(letter-1)%26)))
+			default:
+				number++
+				numberChapter(c, fmt.Sprint(number))
+			}
+		}
+	}
+	numberTop(tree.Children)
+}
+
+func numberChapter(n *Node, number string) {
+	n.Number = number
+	for _, t := range n.Translations {
+		t.Number = number
+	}
+	for i, c := range n.Children {
+		numberChapter(c, fmt.Sprintf("%s.%d", number, i+1))
+	}
+}
+
+// Heading returns the text of the heading of n: its name after its number,
+// if any. A lettered appendix is called "Appendix A: name".
+func (n *Node) Heading() string {
+	switch {
+	case n.Number == "":
+		return n.DisplayName()
+	case n.Appendix && !strings.ContainsAny(n.Number, "0123456789."):
+		return "Appendix " + n.Number + ": " + strings.TrimPrefix(n.DisplayName(), "Appendix: ")
+	}
+	return n.Number + " " + n.DisplayName()
+}
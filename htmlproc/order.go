@@ -0,0 +1,110 @@
+package htmlproc
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ReadOrderManifest reads a chapter order file: one page path per line,
+// relative to the docs root (e.g. "how/intro" or "spec/ntcp2.html"), with
+// blank lines and lines starting with # ignored
+func ReadOrderManifest(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var order []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		order = append(order, pagePath(line))
+	}
+	return order, scanner.Err()
+}
+
+// pagePath normalizes a page reference to the form of Node.Path
+func pagePath(p string) string {
+	p = strings.TrimSuffix(path.Clean("/"+p), "/")
+	p = strings.TrimSuffix(p, ".html")
+	p = strings.TrimSuffix(p, "/index")
+	return strings.TrimPrefix(p, "/")
+}
+
+// linkOrder returns the paths of the included pages that the links in content
+// point at, in the order they appear. resolve maps an href to the ID of the
+// page's heading.
+func linkOrder(tree *Node, content string, resolve func(href string) (string, bool)) []string {
+	paths := map[string]string{}
+	tree.Walk(func(n *Node) {
+		paths[n.ID] = n.Path
+	})
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+	var order []string
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if id, ok := resolve(href); ok {
+			if p, ok := paths[id]; ok {
+				order = append(order, p)
+			}
+		}
+	})
+	return order
+}
+
+// anchorHref resolves links already rewritten to anchors by RewriteLinks
+func anchorHref(href string) (string, bool) {
+	if !strings.HasPrefix(href, "#") {
+		return "", false
+	}
+	return href[1:], true
+}
+
+// SortTree reorders the tree so that pages come in the order of the given
+// paths. A section moves to the position of the first of its pages that is
+// listed; entries that aren't listed at all keep their discovery order after
+// the listed ones.
+func SortTree(tree *Node, order []string) {
+	pos := map[string]int{}
+	for i, p := range order {
+		if _, ok := pos[p]; !ok {
+			pos[p] = i
+		}
+	}
+
+	ranks := map[*Node]int{}
+	var rank func(n *Node) int
+	rank = func(n *Node) int {
+		r, ok := pos[n.Path]
+		if !ok || n.Path == "" {
+			r = math.MaxInt
+		}
+		for _, c := range n.Children {
+			if cr := rank(c); cr < r {
+				r = cr
+			}
+		}
+		ranks[n] = r
+		return r
+	}
+	rank(tree)
+
+	tree.Walk(func(n *Node) {
+		sort.SliceStable(n.Children, func(i, j int) bool {
+			return ranks[n.Children[i]] < ranks[n.Children[j]]
+		})
+	})
+}
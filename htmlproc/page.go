@@ -0,0 +1,193 @@
+package htmlproc
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultBoilerplate selects the parts of i2p.www pages that repeat on every
+// page: navigation menus, headers and footers, language selectors and the
+// "Get involved" boxes
+const DefaultBoilerplate = "nav, header, footer, #header, #footer, #navigation, #cssswitcher, .menu, .lang-selector, #languages, .getinvolved"
+
+// Processor turns source pages into cleaned HTML fragments
+type Processor struct {
+	Links    *LinkMap          // Rewrites links between included pages
+	Template *TemplateRenderer // Renders the Jinja syntax of i2p.www pages
+	// Boilerplate is a CSS selector group of elements to drop from every
+	// page, e.g. DefaultBoilerplate; empty keeps everything
+	Boilerplate string
+	// Sanitize says which elements and attributes to strip, the
+	// DefaultSanitize profile if nil
+	Sanitize *SanitizeRules
+	Assets   *AssetResolver   // Locates referenced images, nil to leave them alone
+	Fit      FitOptions       // What to do with code blocks and tables too wide for the page
+	RST      *RSTConverter    // Converts reStructuredText pages to HTML first
+	Math     *MathRenderer    // Typesets formulas, nil to leave them as LaTeX
+	Diagrams *DiagramRenderer // Draws diagrams, nil to leave them as code
+	// PrintLinks spells out external URLs: "none", "footnotes" or "list"
+	PrintLinks string
+	// Cache reuses pages processed by earlier runs with the same
+	// CacheSettings, or cleaned with the same CleanSettings, nil to process
+	// every page
+	Cache         *PageCache
+	CacheSettings string
+	CleanSettings string
+
+	cached  atomic.Int64 // Pages taken from Cache
+	cleaned atomic.Int64 // Cleaned pages taken from Cache
+}
+
+// Process reads, renders and cleans up a single HTML, reStructuredText or
+// Markdown file and returns its title and body content
+func (p *Processor) Process(htmlFile string) (string, string, error) {
+	content, err := os.ReadFile(htmlFile)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading file: %w", err)
+	}
+
+	var key, cleanKey string
+	if p.Cache != nil {
+		key = p.Cache.key(p.CacheSettings, content)
+		if page, ok := p.Cache.get(processedPages, key); ok {
+			if p.Assets != nil {
+				p.Assets.record(htmlFile, page.Assets, page.Missing)
+			}
+			p.cached.Add(1)
+			return page.Title, page.Content, nil
+		}
+		// Markdown pages are read otherwise than the same text in HTML
+		cleanKey = p.Cache.key(p.CleanSettings+"ext="+strings.ToLower(filepath.Ext(htmlFile))+"\n", content)
+	}
+
+	var title string
+	var doc *goquery.Document
+	if page, ok := p.cachedClean(cleanKey); ok {
+		title = page.Title
+		if doc, err = goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + page.Content + "</body></html>")); err != nil {
+			return "", "", fmt.Errorf("error parsing HTML: %w", err)
+		}
+		p.cleaned.Add(1)
+	} else {
+		if title, doc, err = p.clean(htmlFile, content); err != nil {
+			return "", "", err
+		}
+		if p.Cache != nil {
+			body, err := doc.Find("body").First().Html()
+			if err == nil {
+				err = p.Cache.put(cleanedPages, cleanKey, &cachedPage{Title: title, Content: body})
+			}
+			if err != nil {
+				slog.Warn("Cannot cache page", "file", htmlFile, "err", err)
+			}
+		}
+	}
+
+	// Point links to other included pages at their chapters, and make the
+	// IDs of the page unique in the document
+	p.Links.NamespaceIDs(doc, htmlFile)
+	p.Links.RewriteLinks(doc, htmlFile)
+	fitWide(doc, p.Fit)
+	var assets map[string]string
+	var missing []string
+	if p.Assets != nil {
+		assets, missing = p.Assets.Rewrite(doc, htmlFile)
+	}
+
+	// Extract the body content
+	bodyContent := doc.Find("body").First()
+	if bodyContent.Length() == 0 {
+		return "", "", fmt.Errorf("no body found")
+	}
+	printLinks(bodyContent, p.PrintLinks)
+
+	// Get HTML content and handle potential error
+	htmlContent, err := bodyContent.Html()
+	if err != nil {
+		return "", "", fmt.Errorf("error getting HTML content: %w", err)
+	}
+
+	if p.Cache != nil {
+		page := &cachedPage{Title: title, Content: htmlContent, Assets: assets, Missing: missing}
+		if err := p.Cache.put(processedPages, key, page); err != nil {
+			slog.Warn("Cannot cache page", "file", htmlFile, "err", err)
+		}
+	}
+	return title, htmlContent, nil
+}
+
+// cachedClean returns the cleaned page cached under key, if any
+func (p *Processor) cachedClean(key string) (*cachedPage, bool) {
+	if p.Cache == nil {
+		return nil, false
+	}
+	return p.Cache.get(cleanedPages, key)
+}
+
+// clean renders the template syntax of the page in htmlFile, or converts it
+// from reStructuredText or Markdown, and strips, typesets and draws it as
+// configured. It returns the title and the document, whose links are left
+// as they are.
+func (p *Processor) clean(htmlFile string, content []byte) (string, *goquery.Document, error) {
+	slog.Debug("Processing page", "file", htmlFile)
+
+	source := string(content)
+	var title, rendered string
+	var err error
+	templated := true
+	switch strings.ToLower(filepath.Ext(htmlFile)) {
+	case ".rst":
+		if p.RST == nil {
+			return "", nil, fmt.Errorf("no converter for reStructuredText")
+		}
+		if title, source, err = p.RST.Convert(htmlFile, content); err != nil {
+			return "", nil, fmt.Errorf("error converting reStructuredText: %w", err)
+		}
+		source = "<html><body>" + source + "</body></html>"
+	case ".md", ".markdown":
+		// Markdown has no template syntax, code samples may look like it
+		templated = false
+		if title, rendered, err = ConvertMarkdown(content); err != nil {
+			return "", nil, err
+		}
+		rendered = "<html><body>" + rendered + "</body></html>"
+	}
+
+	// Render template syntax before parsing, it isn't valid HTML
+	if templated {
+		var templateTitle string
+		templateTitle, rendered = p.Template.Render(source)
+		if templateTitle != "" {
+			title = templateTitle
+		}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rendered))
+	if err != nil {
+		return "", nil, fmt.Errorf("error parsing HTML: %w", err)
+	}
+
+	// Clean up HTML
+	rules := p.Sanitize
+	if rules == nil {
+		defaults := sanitizeProfiles[DefaultSanitize]
+		rules = &defaults
+	}
+	rules.clean(doc, p.Boilerplate)
+	if p.Math != nil {
+		p.Math.typeset(doc, htmlFile)
+	}
+	if p.Diagrams != nil {
+		p.Diagrams.render(doc, htmlFile)
+	}
+
+	// Resolve helper calls left in links, images and text, e.g. by Markdown
+	p.Template.resolveHelpers(doc)
+	return title, doc, nil
+}
@@ -0,0 +1,100 @@
+package htmlproc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Bookmark is a heading of the rendered document and the page it is on, as
+// the PDF outline gives them
+type Bookmark struct {
+	Title string
+	Page  int
+}
+
+// headingSelector matches the headings that make up the PDF outline
+const headingSelector = "h1, h2, h3, h4, h5, h6"
+
+// AnchorPages returns the page every ID of the combined HTML document in
+// file ended up on, or rather the page of the heading leading the section
+// it is in: the headings are matched to outline, the bookmarks of the PDF
+// rendered from the document, by their text and order. IDs before the first
+// matched heading, or in sections deeper than the outline, are left out or
+// take the page of their parent section.
+func AnchorPages(file string, outline []Bookmark) (map[string]int, error) {
+	doc, err := readDocument(file)
+	if err != nil {
+		return nil, err
+	}
+	pages := map[string]int{}
+	page, next := 0, 0
+	doc.Find("body [id], body a[name]").Each(func(_ int, s *goquery.Selection) {
+		if s.Is(headingSelector) {
+			text := strings.Join(strings.Fields(s.Text()), " ")
+			// Bookmarks the document has no heading for, such as that of a
+			// generated table of contents, are passed over
+			for i := next; i < len(outline); i++ {
+				if strings.Join(strings.Fields(outline[i].Title), " ") == text {
+					page, next = outline[i].Page, i+1
+					break
+				}
+			}
+		}
+		if page > 0 {
+			pages[s.AttrOr("id", s.AttrOr("name", ""))] = page
+		}
+	})
+	return pages, nil
+}
+
+// AddPageRefs writes the combined HTML document in file to out with the
+// internal links followed by the section number, if numbered, and the page
+// of their target, e.g. "(§3.2, p. 147)", so they can be followed on paper.
+// pages is what AnchorPages returned for the document rendered before. It
+// returns the number of links given a page.
+func AddPageRefs(file, out string, tree *Node, pages map[string]int) (int, error) {
+	doc, err := readDocument(file)
+	if err != nil {
+		return 0, err
+	}
+	numbers := map[string]string{}
+	tree.Walk(func(n *Node) {
+		numbers[n.ID] = n.Number
+		for _, t := range n.Translations {
+			numbers[t.ID] = t.Number
+		}
+	})
+
+	count := 0
+	doc.Find(`body a[href^="#"]`).Each(func(_ int, s *goquery.Selection) {
+		id := strings.TrimPrefix(s.AttrOr("href", ""), "#")
+		page, ok := pages[id]
+		if !ok {
+			return
+		}
+		ref := fmt.Sprintf("p. %d", page)
+		// Table of contents entries start with the number already
+		if number := numbers[pageAnchor(id)]; number != "" && !strings.HasPrefix(strings.TrimSpace(s.Text()), number+" ") {
+			ref = "§" + number + ", " + ref
+		}
+		s.AfterHtml(` <span class="page-ref">(` + ref + `)</span>`)
+		count++
+	})
+	html, err := goquery.OuterHtml(doc.Selection)
+	if err != nil {
+		return 0, err
+	}
+	return count, os.WriteFile(out, []byte(html), 0644)
+}
+
+func readDocument(file string) (*goquery.Document, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return goquery.NewDocumentFromReader(f)
+}
@@ -0,0 +1,38 @@
+package htmlproc
+
+// Page is a page of the documentation published as a document of its own
+type Page struct {
+	Path  string // Path of the page relative to the docs root, "" for the docs index
+	Title string
+	Tree  *Node // Docs tree holding only this page
+}
+
+// SplitPages makes a document of each page of tree. The pages are copies,
+// so linking them leaves tree as it is.
+func SplitPages(tree *Node) []Page {
+	var pages []Page
+	tree.Walk(func(n *Node) {
+		if n.File == "" {
+			return
+		}
+		page := *n
+		page.Children = nil
+		root := &page
+		if n != tree {
+			root = &Node{Name: tree.Name, ID: tree.ID, Children: []*Node{&page}}
+		}
+		pages = append(pages, Page{Path: n.Path, Title: n.DisplayName(), Tree: root})
+	})
+	return pages
+}
+
+// LinkPages points links to other pages, which were rewritten to anchors in
+// the combined document, at the files of those pages instead. file(i, j)
+// returns the file of page j relative to page i.
+func LinkPages(pages []Page, file func(from, to int) string) error {
+	trees := make([]*Node, len(pages))
+	for i, p := range pages {
+		trees[i] = p.Tree
+	}
+	return linkDocuments(trees, file)
+}
@@ -0,0 +1,28 @@
+package htmlproc
+
+import "path"
+
+// Part is the tree of one documentation source of a book made of several
+type Part struct {
+	Name  string // Short name, e.g. "i2pd", prefixed to the page paths
+	Title string // Heading of the part, e.g. "i2pd"
+	Tree  *Node
+}
+
+// JoinParts makes a book of the trees of several documentation sources,
+// each a top-level part under its title. The trees must have been built with
+// different IDs. Page paths get the name of their part as prefix, so they
+// stay unique.
+func JoinParts(parts []Part) *Node {
+	book := &Node{Name: "book", ID: "book"}
+	for _, p := range parts {
+		p.Tree.Walk(func(n *Node) {
+			n.Path = path.Join(p.Name, n.Path)
+		})
+		p.Tree.Name = p.Name
+		p.Tree.Title = p.Title
+		p.Tree.Part = true
+		book.Children = append(book.Children, p.Tree)
+	}
+	return book
+}
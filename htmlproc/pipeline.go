@@ -0,0 +1,340 @@
+// Package htmlproc turns a directory of i2p.www pages into a single combined
+// HTML document: it discovers the pages, renders their template syntax,
+// cleans them up, rewrites links between them and assembles the result.
+package htmlproc
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// Pipeline discovers and processes the pages of a documentation directory.
+// The zero value processes InputDir without translations; the site settings
+// only matter for recognizing absolute links between pages.
+type Pipeline struct {
+	InputDir string  // Directory containing the source pages
+	SitePath string  // URL path of InputDir on the website, e.g. "docs"
+	SiteURL  string  // Base URL of the website, e.g. "https://geti2p.net"
+	Catalog  Catalog // Translations for {% trans %} blocks, nil for none
+	// Version is the current I2P release for the ver() helper, Endpoints the
+	// URLs of the url_for() endpoints, DefaultEndpoints if nil
+	Version   string
+	Endpoints map[string]string
+	// Format is the kind of pages to look for: "html" (the default, with
+	// reStructuredText pages too if RST is set), "rst" or "markdown"
+	Format string
+	// ID is the anchor of the root of the tree, "doc" if empty. The trees
+	// joined by JoinParts need different ones.
+	ID string
+	// Order lists page paths relative to InputDir in reading order, see
+	// ReadOrderManifest. When nil, the order is taken from the links in
+	// NavFile (the site's navigation template, if it exists) followed by the
+	// links on the docs index page.
+	Order   []string
+	NavFile string
+	// Manifest, if not nil, gives the chapters and parts of the tree instead
+	// of Order, see ReadManifest
+	Manifest *Manifest
+	Filter   *PathFilter // Pages to include, nil for all of them
+	// Boilerplate is a CSS selector group of site chrome to remove from each
+	// page, usually DefaultBoilerplate
+	Boilerplate string
+	// Sanitize says which elements and attributes to strip from each page,
+	// the DefaultSanitize profile if nil
+	Sanitize *SanitizeRules
+	// Assets locates the images the pages refer to; call its CopyTo after
+	// Build. Nil leaves image references as they are.
+	Assets *AssetResolver
+	Fit    FitOptions // Handling of code blocks and tables wider than the page
+	// RST converts reStructuredText pages, nil to leave them out
+	RST *RSTConverter
+	// Math typesets the formulas of pages, nil to leave them as LaTeX
+	Math *MathRenderer
+	// Diagrams draws the Mermaid and Graphviz diagrams of pages, nil to leave
+	// them as code
+	Diagrams *DiagramRenderer
+	// Proposals includes the proposals under ProposalsPath as an appendix,
+	// ordered by number; when false they are left out
+	Proposals bool
+	// PrintLinks lists the URLs of external links on each page, see Processor
+	PrintLinks string
+	// MinWords leaves out pages with fewer words of text and no images,
+	// tables or code, 0 to keep them. SkipRedirects leaves out the pages that
+	// only redirect to another one.
+	MinWords      int
+	SkipRedirects bool
+	// FailOnError makes Build fail if any page fails to process, instead of
+	// leaving it out; see Errors
+	FailOnError bool
+	// Cache keeps processed pages between runs, nil to process all pages
+	Cache *PageCache
+	Jobs  int // Pages processed concurrently, 0 for one per CPU
+	// Progress, if not nil, is called as pages are processed
+	Progress func(done, total int)
+	// Stage, if not nil, is called as Build enters each of its stages:
+	// "discover", "process", "empty-pages" and "order"
+	Stage func(name string)
+
+	skipped int         // Pages left out by Filter in the last Build
+	empty   []EmptyPage // Pages left out as empty in the last Build
+	errors  []PageError // Pages that failed to process in the last Build
+}
+
+// Build finds and processes all pages and returns them as a tree, ready to
+// be passed to WriteDocument
+func (p *Pipeline) Build() (*Node, error) {
+	if p.Boilerplate != "" {
+		if _, err := cascadia.ParseGroup(p.Boilerplate); err != nil {
+			return nil, fmt.Errorf("invalid boilerplate selector %q: %w", p.Boilerplate, err)
+		}
+	}
+	if p.Sanitize != nil {
+		if err := p.Sanitize.Check(); err != nil {
+			return nil, err
+		}
+	}
+	p.stage("discover")
+	htmlFiles, exts, err := p.findPages()
+	if err != nil {
+		return nil, err
+	}
+	found := htmlFiles
+	if !p.Proposals {
+		htmlFiles = slices.DeleteFunc(htmlFiles, func(file string) bool { return inProposals(p.InputDir, file) })
+	}
+	if p.Filter != nil {
+		htmlFiles = p.filter(htmlFiles)
+	}
+	if len(htmlFiles) == 0 {
+		return nil, fmt.Errorf("no %s files found in %s", orList(exts), p.InputDir)
+	}
+	slog.Info("Found HTML files to process", "count", len(htmlFiles))
+
+	tree := BuildTree(p.InputDir, htmlFiles)
+	if p.ID != "" {
+		tree.setID(p.ID)
+	}
+
+	// Process each HTML file up front, so page titles are known for the TOC
+	processor := &Processor{
+		Links:       NewLinkMap(p.InputDir, tree, p.SitePath, p.SiteURL),
+		Template:    NewTemplateRenderer(),
+		Boilerplate: p.Boilerplate,
+		Sanitize:    p.Sanitize,
+		Assets:      p.Assets,
+		Fit:         p.Fit,
+		RST:         p.RST,
+		Math:        p.Math,
+		Diagrams:    p.Diagrams,
+		PrintLinks:  p.PrintLinks,
+		Cache:       p.Cache,
+	}
+	if p.Cache != nil {
+		processor.CacheSettings = p.settingsKey(tree)
+		processor.CleanSettings = p.cleanSettingsKey()
+	}
+	if p.Catalog != nil {
+		processor.Template.Translate = p.Catalog.Translate
+	}
+	processor.Template.Version, processor.Template.SiteURL = p.Version, p.SiteURL
+	if p.Endpoints != nil {
+		processor.Template.Endpoints = p.Endpoints
+	}
+	jobs := p.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	process := processor.Process
+	if p.Progress != nil {
+		total := 0
+		tree.Walk(func(n *Node) {
+			if n.File != "" {
+				total++
+			}
+		})
+		var done atomic.Int64
+		process = func(file string) (string, string, error) {
+			defer func() { p.Progress(int(done.Add(1)), total) }()
+			return processor.Process(file)
+		}
+	}
+	p.stage("process")
+	p.errors = ProcessTree(tree, jobs, process)
+	if p.FailOnError && len(p.errors) > 0 {
+		return nil, fmt.Errorf("%d pages failed to process, the first %s: %s", len(p.errors), p.errors[0].File, p.errors[0].Err)
+	}
+	if p.Cache != nil {
+		slog.Info("Reused unchanged pages from the cache", "count", processor.cached.Load(), "cleaned", processor.cleaned.Load())
+	}
+	if p.Assets != nil {
+		p.Assets.Report()
+	}
+
+	p.stage("empty-pages")
+	if p.empty, err = dropEmptyPages(tree, p.MinWords, p.SkipRedirects, processor.Links); err != nil {
+		return nil, fmt.Errorf("error leaving out empty pages: %w", err)
+	}
+	if len(p.empty) > 0 {
+		slog.Warn("Left out empty and redirect pages", "count", len(p.empty))
+	}
+	fixFragments(tree)
+
+	p.stage("order")
+	order := p.Order
+	if p.Manifest != nil {
+		order = p.Manifest.Order()
+	} else if order == nil {
+		order = p.navOrder(tree, processor)
+	}
+	SortTree(tree, order)
+	if p.Manifest != nil {
+		if err := p.applyManifest(tree, found); err != nil {
+			return nil, err
+		}
+	}
+	if p.Proposals {
+		proposalsAppendix(tree)
+	}
+	return tree, nil
+}
+
+// stage reports the stage Build enters to Stage
+func (p *Pipeline) stage(name string) {
+	if p.Stage != nil {
+		p.Stage(name)
+	}
+}
+
+// applyManifest arranges tree as Manifest lists, failing if it lists pages
+// that aren't among the found pages, and reports the pages it doesn't list
+func (p *Pipeline) applyManifest(tree *Node, found []string) error {
+	known := map[string]bool{}
+	BuildTree(p.InputDir, found).Walk(func(n *Node) {
+		known[n.Path] = true
+	})
+	missing, unlisted := p.Manifest.apply(tree, known)
+	if len(missing) > 0 {
+		return fmt.Errorf("the chapter manifest lists pages that don't exist: %s", strings.Join(missing, ", "))
+	}
+	if len(unlisted) > 0 {
+		slog.Warn("Pages missing from the chapter manifest, placed after the listed chapters", "count", len(unlisted))
+		for _, page := range unlisted {
+			slog.Info("Not in the chapter manifest", "page", page)
+		}
+	}
+	return nil
+}
+
+// Errors returns the pages that failed to process in the last Build
+func (p *Pipeline) Errors() []PageError {
+	return p.errors
+}
+
+// findPages returns the source pages of InputDir in Format, and the
+// extensions it searched for
+func (p *Pipeline) findPages() ([]string, []string, error) {
+	var exts []string
+	switch p.Format {
+	case "", "html":
+		exts = []string{".html"}
+	case "rst":
+		if p.RST == nil {
+			return nil, nil, fmt.Errorf("no converter for reStructuredText")
+		}
+		exts = []string{".rst"}
+	case "markdown":
+		exts = []string{".md", ".markdown"}
+	default:
+		return nil, nil, fmt.Errorf("unknown page format %q, expected html, rst or markdown", p.Format)
+	}
+
+	pages, err := FindPages(p.InputDir, exts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding pages: %w", err)
+	}
+	if p.RST != nil && exts[0] == ".html" {
+		if pages, err = p.addRST(pages); err != nil {
+			return nil, nil, err
+		}
+		exts = append(exts, ".rst")
+	}
+	return pageFiles(pages), exts, nil
+}
+
+// orList joins items as "a, b or c"
+func orList(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
+
+// addRST adds the reStructuredText pages of InputDir to pages. Where a page
+// exists in both forms the reStructuredText one is kept: the HTML pages
+// left beside the specifications only redirect to them.
+func (p *Pipeline) addRST(pages []SourcePage) ([]SourcePage, error) {
+	rstPages, err := FindPages(p.InputDir, ".rst")
+	if err != nil {
+		return nil, fmt.Errorf("error finding reStructuredText files: %w", err)
+	}
+	if len(rstPages) == 0 {
+		return pages, nil
+	}
+	rst := map[string]bool{}
+	for _, page := range rstPages {
+		rst[page.Path] = true
+	}
+	pages = slices.DeleteFunc(pages, func(page SourcePage) bool {
+		if rst[page.Path] {
+			slog.Debug("Using the reStructuredText version of page", "file", page.File)
+		}
+		return rst[page.Path]
+	})
+	slog.Info("Found reStructuredText files to process", "count", len(rstPages))
+	return append(pages, rstPages...), nil
+}
+
+// filter drops the files whose page path is not selected by Filter
+func (p *Pipeline) filter(files []string) []string {
+	var kept []string
+	for _, file := range files {
+		rel, err := filepath.Rel(p.InputDir, file)
+		if err != nil {
+			continue
+		}
+		if p.Filter.Match(pagePath(filepath.ToSlash(rel)), strings.Trim(p.SitePath, "/")) {
+			kept = append(kept, file)
+		}
+	}
+	p.skipped = len(files) - len(kept)
+	slog.Info("Selected HTML files", "count", len(kept), "of", len(files))
+	return kept
+}
+
+// navOrder collects the pages linked from NavFile and from the docs index page,
+// in the order the site presents them
+func (p *Pipeline) navOrder(tree *Node, processor *Processor) []string {
+	var order []string
+	if p.NavFile != "" {
+		if src, err := os.ReadFile(p.NavFile); err == nil {
+			_, nav := processor.Template.Render(string(src))
+			order = linkOrder(tree, nav, func(href string) (string, bool) {
+				return processor.Links.Resolve(p.NavFile, href)
+			})
+		} else if !os.IsNotExist(err) {
+			slog.Warn("Ignoring navigation template", "err", err)
+		}
+	}
+	if tree.File != "" {
+		order = append(order, linkOrder(tree, tree.Content, anchorHref)...)
+	}
+	return order
+}
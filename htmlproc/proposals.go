@@ -0,0 +1,93 @@
+package htmlproc
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProposalsPath is the page path of the I2P proposals, which come with the
+// specifications, see SpecsPath
+const ProposalsPath = SpecsPath + "/proposals"
+
+var (
+	proposalNumber = regexp.MustCompile(`^(\d+)-`)
+	proposalStatus = regexp.MustCompile(`(?m)^\s+:status:\s*(.+?)\s*$`)
+)
+
+// inProposals reports whether file, found in baseDir, is a proposal
+func inProposals(baseDir, file string) bool {
+	rel, err := filepath.Rel(baseDir, file)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	return rel == ProposalsPath || strings.HasPrefix(rel, ProposalsPath+"/")
+}
+
+// proposalsAppendix moves the proposals section of tree behind all other
+// sections as an appendix. The proposals are ordered by number and titled
+// with their number and status (draft, accepted, rejected...), so the TOC
+// shows it.
+func proposalsAppendix(tree *Node) {
+	var section, parent *Node
+	tree.Walk(func(n *Node) {
+		for _, c := range n.Children {
+			if c.Path == ProposalsPath {
+				section, parent = c, n
+			}
+		}
+	})
+	if section == nil {
+		return
+	}
+	for i, c := range parent.Children {
+		if c == section {
+			parent.Children = append(parent.Children[:i:i], parent.Children[i+1:]...)
+			break
+		}
+	}
+	tree.Children = append(tree.Children, section)
+	section.Title = "Appendix: Proposals"
+	section.Appendix = true
+
+	numbers := map[*Node]int{}
+	for _, n := range section.Children {
+		numbers[n] = -1
+		m := proposalNumber.FindStringSubmatch(path.Base(n.Path))
+		if m == nil {
+			continue
+		}
+		numbers[n], _ = strconv.Atoi(m[1])
+		title := fmt.Sprintf("Proposal %s: %s", m[1], n.DisplayName())
+		if status := proposalStatusOf(n.File); status != "" {
+			title += " (" + status + ")"
+		}
+		n.Title = title
+	}
+	// Proposals without a number, such as an index, come first
+	sort.SliceStable(section.Children, func(i, j int) bool {
+		return numbers[section.Children[i]] < numbers[section.Children[j]]
+	})
+}
+
+// proposalStatusOf returns the status declared in the metadata of a
+// proposal's source, or "" if it declares none
+func proposalStatusOf(file string) string {
+	if file == "" {
+		return ""
+	}
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	if m := proposalStatus.FindSubmatch(src); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+	return ""
+}
@@ -0,0 +1,749 @@
+package htmlproc
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// CheckRST returns an error unless tool is a way to convert
+// reStructuredText pages
+func CheckRST(tool string) error {
+	switch tool {
+	case "go", "rst2html", "pandoc", "none":
+		return nil
+	}
+	return fmt.Errorf("unknown converter %q, expected go, rst2html, pandoc or none", tool)
+}
+
+// RSTConverter turns reStructuredText pages, which most of the I2P
+// specifications and proposals are written in, into HTML. Tool is "go" for
+// the built-in converter, which handles the parts of reStructuredText the
+// specifications use, or "rst2html" (docutils) or "pandoc" for complete
+// support.
+type RSTConverter struct {
+	Tool string
+}
+
+// Convert converts the reStructuredText source of file and returns the
+// document title and the HTML of its body, without the title. The HTML may
+// still hold template syntax from raw HTML blocks.
+func (c *RSTConverter) Convert(file string, src []byte) (title, body string, err error) {
+	switch c.Tool {
+	case "rst2html":
+		return externalRST(exec.Command("rst2html", "--no-generator", "--no-datestamp", "--no-source-link",
+			"--report=4", "--halt=5", "--math-output=MathJax", file))
+	case "pandoc":
+		return externalRST(exec.Command("pandoc", "--from", "rst", "--to", "html5", "--standalone", file))
+	}
+	p := newRSTParser(string(src))
+	return p.title, p.body(p.lines, true), nil
+}
+
+// externalRST runs a converter writing a standalone HTML document and
+// separates its title from its body
+func externalRST(cmd *exec.Cmd) (title, body string, err error) {
+	out, err := cmd.Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return "", "", fmt.Errorf("%s failed: %v: %s", cmd.Args[0], err, strings.TrimSpace(string(exit.Stderr)))
+		}
+		return "", "", fmt.Errorf("%s failed: %w", cmd.Args[0], err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(out)))
+	if err != nil {
+		return "", "", err
+	}
+	title = strings.TrimSpace(doc.Find("h1.title").First().Text())
+	if title == "" {
+		title = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	doc.Find("h1.title, header#title-block-header").Remove()
+	body, err = doc.Find("body").Html()
+	return title, body, err
+}
+
+var (
+	rstDirective = regexp.MustCompile(`^\.\.\s+([\w:-]+)::\s*(.*)$`)
+	rstTarget    = regexp.MustCompile(`^\.\.\s+_([^:]+|` + "`[^`]+`" + `):\s*(.*)$`)
+	rstCitation  = regexp.MustCompile(`^\.\.\s+\[([^\]]+)\]\s*(.*)$`)
+	rstBullet    = regexp.MustCompile(`^([-*+•])(\s+|$)`)
+	rstEnum      = regexp.MustCompile(`^\(?([0-9]+|[a-zA-Z]|#)[.)](\s+|$)`)
+	rstField     = regexp.MustCompile(`^:([^:` + "`" + `]+):(\s+|$)`)
+	rstSimple    = regexp.MustCompile(`^=+( +=+)+\s*$`)
+	rstInline    = regexp.MustCompile(`{{.*?}}|{%.*?%}` + // Template syntax, kept as it is
+		"|``(.+?)``" + // Literal
+		"|:[\\w-]+:`([^`]+)`" + // Role
+		"|`([^`<]*?)\\s*<([^>]+)>`__?" + // Link with an embedded URL
+		"|`([^`]+)`__?" + // Reference to a named target
+		"|`([^`]+)`" + // Interpreted text
+		`|\*\*(.+?)\*\*` + // Strong
+		`|\*([^*\s](?:[^*]*[^*\s])?)\*` + // Emphasis
+		`|\[([\w#*.-]+)\]_` + // Citation or footnote reference
+		`|\b([A-Za-z0-9][\w.-]*?)_\b` + // Reference to a target named by one word
+		`|https?://[^\s<>"]*[^\s<>".,;:!?)'\]]`) // Standalone URL
+	rstNonWord = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// rstParser converts a reStructuredText document to HTML
+type rstParser struct {
+	lines   []string
+	title   string
+	titleAt int               // Line of the document title, -1 for none
+	styles  []string          // Section adornments, by level
+	targets map[string]string // URLs of named targets by normalized name
+	ids     map[string]bool   // Element IDs in use
+	headers map[int]string    // Element IDs of the section titles by line
+}
+
+// newRSTParser prepares src for parsing: it expands tabs and collects the
+// link targets, section titles and the document title
+func newRSTParser(src string) *rstParser {
+	src = strings.ReplaceAll(strings.ReplaceAll(src, "\r\n", "\n"), "\t", "        ")
+	p := &rstParser{
+		lines:   strings.Split(src, "\n"),
+		titleAt: -1,
+		targets: map[string]string{},
+		ids:     map[string]bool{},
+		headers: map[int]string{},
+	}
+	for i := range p.lines {
+		p.lines[i] = strings.TrimRight(p.lines[i], " ")
+	}
+
+	// docutils makes a title that opens the document and whose adornment
+	// appears nowhere else the document title
+	uses := map[string]int{}
+	first, firstAt := "", -1
+	for i := 0; i < len(p.lines); i++ {
+		if m := rstTarget.FindStringSubmatch(p.lines[i]); m != nil {
+			url := m[2]
+			if url == "" && i+1 < len(p.lines) && indentOf(p.lines[i+1]) > 0 {
+				url = strings.TrimSpace(p.lines[i+1])
+			}
+			p.targets[rstName(strings.Trim(m[1], "`"))] = url
+			continue
+		}
+		text, style, n := p.sectionTitle(i)
+		if n == 0 {
+			continue
+		}
+		if firstAt < 0 && len(uses) == 0 && p.onlyBlankBefore(i) {
+			first, firstAt = style, i
+		}
+		uses[style]++
+		p.headers[i] = p.id(text)
+		if _, ok := p.targets[rstName(text)]; !ok {
+			p.targets[rstName(text)] = "#" + p.headers[i]
+		}
+		i += n - 1
+	}
+	if firstAt >= 0 && uses[first] == 1 {
+		text, _, _ := p.sectionTitle(firstAt)
+		p.title, p.titleAt = text, firstAt
+	}
+	return p
+}
+
+// onlyBlankBefore reports whether the lines before i are blank, comments or
+// directives such as the metadata
+func (p *rstParser) onlyBlankBefore(i int) bool {
+	for _, line := range p.lines[:i] {
+		if line != "" && indentOf(line) == 0 && !strings.HasPrefix(line, "..") {
+			return false
+		}
+	}
+	return true
+}
+
+// id returns a unique element ID made from name
+func (p *rstParser) id(name string) string {
+	base := strings.Trim(rstNonWord.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "section"
+	}
+	id := base
+	for n := 2; p.ids[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	p.ids[id] = true
+	return id
+}
+
+// rstName normalizes the name of a target the way references spell it
+func rstName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// indentOf returns the number of leading spaces of line
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// adornment returns the character a section title is underlined or
+// overlined with, if line is such an adornment
+func adornment(line string) (byte, bool) {
+	if len(line) < 2 || indentOf(line) > 0 {
+		return 0, false
+	}
+	c := line[0]
+	if !strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", rune(c)) {
+		return 0, false
+	}
+	return c, strings.Count(line, string(c)) == len(line)
+}
+
+// sectionTitle returns the title of the section starting at line i, its
+// adornment style and the number of lines it takes, 0 if there is none
+func (p *rstParser) sectionTitle(i int) (title, style string, n int) {
+	lines := p.lines
+	if i+2 < len(lines) {
+		if over, ok := adornment(lines[i]); ok && lines[i+1] != "" {
+			if under, ok := adornment(lines[i+2]); ok && under == over {
+				return strings.TrimSpace(lines[i+1]), "over" + string(over), 3
+			}
+		}
+	}
+	if i+1 < len(lines) && lines[i] != "" && indentOf(lines[i]) == 0 && (i == 0 || lines[i-1] == "") {
+		title := strings.TrimSpace(lines[i])
+		if under, ok := adornment(lines[i+1]); ok && (len(lines[i+1]) >= len(title) || len(lines[i+1]) >= 4) {
+			if _, over := adornment(title); !over {
+				return title, string(under), 2
+			}
+		}
+	}
+	return "", "", 0
+}
+
+// level returns the heading level of a section adornment style
+func (p *rstParser) level(style string) int {
+	for i, s := range p.styles {
+		if s == style {
+			return min(i+2, 6)
+		}
+	}
+	p.styles = append(p.styles, style)
+	return min(len(p.styles)+1, 6)
+}
+
+// block returns the lines from i on that are blank or indented by at
+// least indent, without trailing blank lines, and the line after them
+func block(lines []string, i, indent int) ([]string, int) {
+	j := i
+	for j < len(lines) && (lines[j] == "" || indentOf(lines[j]) >= indent) {
+		j++
+	}
+	end := j
+	for end > i && lines[end-1] == "" {
+		end--
+	}
+	return lines[i:end], end
+}
+
+// dedent removes the indentation common to the non-blank lines
+func dedent(lines []string) []string {
+	indent := -1
+	for _, line := range lines {
+		if line != "" && (indent < 0 || indentOf(line) < indent) {
+			indent = indentOf(line)
+		}
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			out[i] = line[indent:]
+		} else {
+			out[i] = line
+		}
+	}
+	return out
+}
+
+// blocks converts a sequence of body elements nested in another element,
+// whose first line is not indented
+func (p *rstParser) blocks(lines []string) string {
+	return p.body(lines, false)
+}
+
+// body converts a sequence of body elements, and section titles if they are
+// the lines of the document
+func (p *rstParser) body(lines []string, document bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if line == "" {
+			i++
+			continue
+		}
+		if document {
+			if title, style, n := p.sectionTitle(i); n > 0 {
+				if i != p.titleAt {
+					level := p.level(style)
+					fmt.Fprintf(&sb, "<h%d id=\"%s\">%s</h%d>\n", level, p.headers[i], p.inline(title), level)
+				}
+				i += n
+				continue
+			}
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case indentOf(line) > 0:
+			quote, next := block(lines, i, 1)
+			fmt.Fprintf(&sb, "<blockquote>\n%s</blockquote>\n", p.blocks(dedent(quote)))
+			i = next
+		case len(trimmed) >= 4 && isTransition(lines, i):
+			sb.WriteString("<hr>\n")
+			i++
+		case strings.HasPrefix(line, ".. ") || line == ".." || strings.HasPrefix(line, "__ "):
+			i = p.explicit(&sb, lines, i)
+		case strings.HasPrefix(line, "+-") || strings.HasPrefix(line, "+="):
+			i = p.gridTable(&sb, lines, i)
+		case rstSimple.MatchString(line):
+			i = p.simpleTable(&sb, lines, i)
+		case rstBullet.MatchString(line):
+			i = p.list(&sb, lines, i, rstBullet, "ul")
+		case rstEnum.MatchString(line) && (i+1 == len(lines) || lines[i+1] == "" || indentOf(lines[i+1]) > 0 || rstEnum.MatchString(lines[i+1])):
+			i = p.list(&sb, lines, i, rstEnum, "ol")
+		case rstField.MatchString(line):
+			i = p.fieldList(&sb, lines, i)
+		case i+1 < len(lines) && lines[i+1] != "" && indentOf(lines[i+1]) > 0:
+			i = p.definitionList(&sb, lines, i)
+		default:
+			i = p.paragraph(&sb, lines, i)
+		}
+	}
+	return sb.String()
+}
+
+// isTransition reports whether line i is a transition between sections
+func isTransition(lines []string, i int) bool {
+	if _, ok := adornment(lines[i]); !ok {
+		return false
+	}
+	return (i == 0 || lines[i-1] == "") && (i+1 == len(lines) || lines[i+1] == "")
+}
+
+// paragraph converts the paragraph at line i and the literal block
+// following it if it ends with "::"
+func (p *rstParser) paragraph(sb *strings.Builder, lines []string, i int) int {
+	j := i
+	for j < len(lines) && lines[j] != "" && indentOf(lines[j]) == 0 {
+		j++
+	}
+	text := strings.Join(lines[i:j], "\n")
+	literal := strings.HasSuffix(text, "::")
+	if literal {
+		switch {
+		case text == "::":
+			text = ""
+		case strings.HasSuffix(text, " ::"):
+			text = strings.TrimSuffix(text, " ::")
+		default:
+			text = strings.TrimSuffix(text, ":")
+		}
+	}
+	if text != "" {
+		fmt.Fprintf(sb, "<p>%s</p>\n", p.inline(text))
+	}
+	if !literal {
+		return j
+	}
+	for j < len(lines) && lines[j] == "" {
+		j++
+	}
+	if j == len(lines) || indentOf(lines[j]) == 0 {
+		return j
+	}
+	code, next := block(lines, j, 1)
+	fmt.Fprintf(sb, "<pre>%s</pre>\n", html.EscapeString(strings.Join(dedent(code), "\n")))
+	return next
+}
+
+// list converts the bullet or enumerated list starting at line i, whose
+// items start with marker
+func (p *rstParser) list(sb *strings.Builder, lines []string, i int, marker *regexp.Regexp, tag string) int {
+	attrs := ""
+	if tag == "ol" {
+		m := marker.FindStringSubmatch(lines[i])
+		switch c := m[1][0]; {
+		case c >= 'a' && c <= 'z':
+			attrs = ` type="a"`
+		case c >= 'A' && c <= 'Z':
+			attrs = ` type="A"`
+		case m[1] != "#" && m[1] != "1":
+			attrs = fmt.Sprintf(` start="%s"`, m[1])
+		}
+	}
+	fmt.Fprintf(sb, "<%s%s>\n", tag, attrs)
+	for i < len(lines) && marker.MatchString(lines[i]) {
+		m := marker.FindString(lines[i])
+		first := strings.TrimSpace(lines[i][len(m):])
+		rest, next := block(lines, i+1, 1)
+		item := append([]string{first}, dedent(rest)...)
+		fmt.Fprintf(sb, "<li>%s</li>\n", unwrapParagraph(p.blocks(item)))
+		i = next
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+	}
+	fmt.Fprintf(sb, "</%s>\n", tag)
+	return i
+}
+
+// unwrapParagraph drops the paragraph around the HTML of a list item or
+// table cell holding nothing else
+func unwrapParagraph(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "<p>") && strings.HasSuffix(s, "</p>") && strings.Count(s, "<p>") == 1 {
+		return s[3 : len(s)-4]
+	}
+	return s
+}
+
+// fieldList converts the field list starting at line i
+func (p *rstParser) fieldList(sb *strings.Builder, lines []string, i int) int {
+	sb.WriteString("<dl class=\"field-list\">\n")
+	for i < len(lines) && rstField.MatchString(lines[i]) {
+		m := rstField.FindStringSubmatch(lines[i])
+		first := strings.TrimSpace(lines[i][len(m[0]):])
+		rest, next := block(lines, i+1, 1)
+		body := append([]string{first}, dedent(rest)...)
+		fmt.Fprintf(sb, "<dt>%s</dt><dd>%s</dd>\n", p.inline(m[1]), unwrapParagraph(p.blocks(body)))
+		i = next
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+	}
+	sb.WriteString("</dl>\n")
+	return i
+}
+
+// definitionList converts the definition list starting at line i: terms
+// each directly followed by their indented definition
+func (p *rstParser) definitionList(sb *strings.Builder, lines []string, i int) int {
+	sb.WriteString("<dl>\n")
+	for i+1 < len(lines) && lines[i] != "" && indentOf(lines[i]) == 0 && lines[i+1] != "" && indentOf(lines[i+1]) > 0 {
+		term := lines[i]
+		definition, next := block(lines, i+1, 1)
+		fmt.Fprintf(sb, "<dt>%s</dt><dd>%s</dd>\n", p.inline(term), unwrapParagraph(p.blocks(dedent(definition))))
+		i = next
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+	}
+	sb.WriteString("</dl>\n")
+	return i
+}
+
+// explicit converts the explicit markup starting at line i: a directive,
+// citation, target or comment
+func (p *rstParser) explicit(sb *strings.Builder, lines []string, i int) int {
+	body, next := block(lines, i+1, 1)
+	body = dedent(body)
+	line := lines[i]
+	if m := rstCitation.FindStringSubmatch(line); m != nil {
+		content := append([]string{m[2]}, body...)
+		fmt.Fprintf(sb, "<div class=\"citation\" id=\"%s\"><span class=\"label\">[%s]</span> %s</div>\n",
+			p.citationID(m[1]), html.EscapeString(m[1]), unwrapParagraph(p.blocks(dedent(content))))
+		return next
+	}
+	m := rstDirective.FindStringSubmatch(line)
+	if m == nil {
+		// A target, collected up front, or a comment
+		return next
+	}
+	name, arg := m[1], strings.TrimSpace(m[2])
+
+	// Options come first in the body, the content after a blank line
+	options := map[string]string{}
+	for len(body) > 0 {
+		f := rstField.FindStringSubmatch(body[0])
+		if f == nil {
+			break
+		}
+		options[f[1]] = strings.TrimSpace(body[0][len(f[0]):])
+		body = body[1:]
+	}
+	for len(body) > 0 && body[0] == "" {
+		body = body[1:]
+	}
+
+	switch name {
+	case "meta", "contents", "sectnum", "section-numbering", "header", "footer", "title", "highlight", "default-role", "role", "index", "include":
+		// Metadata, or generated by the PDF already
+	case "raw":
+		if strings.Contains(arg, "html") {
+			sb.WriteString(strings.Join(body, "\n") + "\n")
+		}
+	case "math":
+		// Formulas are separated by blank lines
+		formula := append([]string{arg}, body...)
+		for _, tex := range strings.Split(strings.Join(formula, "\n"), "\n\n") {
+			if tex = strings.TrimSpace(tex); tex != "" {
+				fmt.Fprintf(sb, "<div class=\"math\">%s</div>\n", html.EscapeString(tex))
+			}
+		}
+	case "code", "code-block", "sourcecode":
+		class := ""
+		if arg != "" {
+			class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(arg))
+		}
+		fmt.Fprintf(sb, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(strings.Join(body, "\n")))
+	case "mermaid", "graphviz", "digraph", "graph":
+		// Of the sphinxcontrib extensions, the argument names a source file
+		lang := name
+		switch {
+		case name == "digraph" || name == "graph":
+			lang = "dot"
+			body = append([]string{name + " " + arg + " {"}, append(body, "}")...)
+		case len(body) == 0 && arg != "":
+			fmt.Fprintf(sb, "<img src=\"%s\" alt=\"%s\">\n", html.EscapeString(arg), html.EscapeString(options["alt"]))
+			return next
+		}
+		fmt.Fprintf(sb, "<pre><code class=\"language-%s\">%s</code></pre>\n", lang, html.EscapeString(strings.Join(body, "\n")))
+	case "image", "figure":
+		alt := options["alt"]
+		fmt.Fprintf(sb, "<img src=\"%s\" alt=\"%s\">\n", html.EscapeString(arg), html.EscapeString(alt))
+		if name == "figure" && len(body) > 0 {
+			fmt.Fprintf(sb, "<div class=\"caption\">%s</div>\n", p.blocks(body))
+		}
+	case "note", "warning", "important", "tip", "hint", "caution", "attention", "danger", "error", "admonition", "topic", "sidebar":
+		heading := arg
+		if name != "admonition" && name != "topic" && name != "sidebar" {
+			heading = strings.ToUpper(name[:1]) + name[1:]
+			if arg != "" {
+				body = append([]string{arg}, body...)
+			}
+		}
+		fmt.Fprintf(sb, "<div class=\"admonition %s\"><p class=\"admonition-title\">%s</p>\n%s</div>\n", name, p.inline(heading), p.blocks(body))
+	default:
+		slog.Debug("Skipping unsupported reStructuredText directive", "directive", name)
+	}
+	return next
+}
+
+// citationID returns the element ID of the citation label
+func (p *rstParser) citationID(label string) string {
+	return "cite-" + strings.Trim(rstNonWord.ReplaceAllString(strings.ToLower(label), "-"), "-")
+}
+
+// gridTable converts the grid table starting at line i. Cells spanning
+// columns or rows are not recognized.
+func (p *rstParser) gridTable(sb *strings.Builder, lines []string, i int) int {
+	var bounds []int // Columns of the cell borders
+	for j, c := range lines[i] {
+		if c == '+' {
+			bounds = append(bounds, j)
+		}
+	}
+	var (
+		head, rows [][]string
+		cells      [][]string // Lines of each cell of the current row
+	)
+	flush := func() {
+		if cells == nil {
+			return
+		}
+		row := make([]string, len(cells))
+		for k, cell := range cells {
+			row[k] = unwrapParagraph(p.blocks(dedent(cell)))
+		}
+		rows = append(rows, row)
+		cells = nil
+	}
+	for ; i < len(lines) && (strings.HasPrefix(lines[i], "+") || strings.HasPrefix(lines[i], "|")); i++ {
+		line := lines[i]
+		if line[0] == '+' {
+			flush()
+			if strings.HasPrefix(line, "+=") && head == nil {
+				head, rows = rows, nil
+			}
+			continue
+		}
+		if cells == nil {
+			cells = make([][]string, len(bounds)-1)
+		}
+		for k := 0; k+1 < len(bounds); k++ {
+			from, to := bounds[k]+1, min(bounds[k+1], len(line))
+			if from < to {
+				cells[k] = append(cells[k], strings.TrimRight(line[from:to], " "))
+			}
+		}
+	}
+	flush()
+	writeTable(sb, head, rows)
+	return i
+}
+
+// simpleTable converts the simple table starting at line i
+func (p *rstParser) simpleTable(sb *strings.Builder, lines []string, i int) int {
+	border := lines[i]
+	var cols [][2]int // Start and end of each column
+	for j := 0; j < len(border); {
+		if border[j] != '=' {
+			j++
+			continue
+		}
+		k := j
+		for k < len(border) && border[k] == '=' {
+			k++
+		}
+		cols = append(cols, [2]int{j, k})
+		j = k
+	}
+	var head, rows [][]string
+	i++
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if rstSimple.MatchString(line) {
+			// A border closes the header or, before a blank line, the table
+			if i+1 == len(lines) || lines[i+1] == "" || head != nil {
+				i++
+				break
+			}
+			head, rows = rows, nil
+			continue
+		}
+		if line == "" || strings.Trim(line, "- ") == "" {
+			continue
+		}
+		row := make([]string, len(cols))
+		for k, col := range cols {
+			from, to := col[0], col[1]
+			if k+1 == len(cols) {
+				to = len(line)
+			}
+			if from < len(line) {
+				row[k] = strings.TrimSpace(line[from:min(to, len(line))])
+			}
+		}
+		// Lines with an empty first column continue the row above
+		if row[0] == "" && len(rows) > 0 {
+			for k, text := range row {
+				if text != "" {
+					rows[len(rows)-1][k] += " " + text
+				}
+			}
+			continue
+		}
+		rows = append(rows, row)
+	}
+	for _, r := range [][][]string{head, rows} {
+		for _, row := range r {
+			for k, text := range row {
+				row[k] = p.inline(strings.TrimSpace(text))
+			}
+		}
+	}
+	writeTable(sb, head, rows)
+	return i
+}
+
+// writeTable writes a table of the converted cells
+func writeTable(sb *strings.Builder, head, rows [][]string) {
+	sb.WriteString("<table>\n")
+	for _, row := range head {
+		sb.WriteString("<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(sb, "<th>%s</th>", cell)
+		}
+		sb.WriteString("</tr>\n")
+	}
+	for _, row := range rows {
+		sb.WriteString("<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(sb, "<td>%s</td>", cell)
+		}
+		sb.WriteString("</tr>\n")
+	}
+	sb.WriteString("</table>\n")
+}
+
+// inline converts the inline markup of text
+func (p *rstParser) inline(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range rstInline.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(rstText(text[last:m[0]]))
+		last = m[1]
+		group := func(n int) (string, bool) {
+			if m[2*n] < 0 {
+				return "", false
+			}
+			return text[m[2*n]:m[2*n+1]], true
+		}
+		whole := text[m[0]:m[1]]
+		if s, ok := group(1); ok {
+			fmt.Fprintf(&sb, "<code>%s</code>", html.EscapeString(s))
+		} else if s, ok := group(2); ok {
+			if strings.HasPrefix(whole, ":math:") {
+				fmt.Fprintf(&sb, `<span class="math">%s</span>`, html.EscapeString(s))
+			} else {
+				fmt.Fprintf(&sb, "<code>%s</code>", html.EscapeString(s))
+			}
+		} else if url, ok := group(4); ok {
+			label, _ := group(3)
+			if target, ok := strings.CutSuffix(url, "_"); ok {
+				url = p.targets[rstName(target)]
+			} else if label != "" {
+				p.targets[rstName(label)] = url
+			}
+			if label == "" {
+				label = url
+			}
+			fmt.Fprintf(&sb, "<a href=\"%s\">%s</a>", rstURL(url), rstText(label))
+		} else if s, ok := group(5); ok {
+			if url, ok := p.targets[rstName(s)]; ok && strings.HasSuffix(whole, "_") {
+				fmt.Fprintf(&sb, "<a href=\"%s\">%s</a>", rstURL(url), rstText(s))
+			} else {
+				fmt.Fprintf(&sb, "<cite>%s</cite>", rstText(s))
+			}
+		} else if s, ok := group(6); ok {
+			fmt.Fprintf(&sb, "<cite>%s</cite>", rstText(s))
+		} else if s, ok := group(7); ok {
+			fmt.Fprintf(&sb, "<strong>%s</strong>", rstText(s))
+		} else if s, ok := group(8); ok {
+			fmt.Fprintf(&sb, "<em>%s</em>", rstText(s))
+		} else if s, ok := group(9); ok {
+			fmt.Fprintf(&sb, "<a class=\"citation-reference\" href=\"#%s\">[%s]</a>", p.citationID(s), html.EscapeString(s))
+		} else if s, ok := group(10); ok {
+			if url, ok := p.targets[rstName(s)]; ok {
+				fmt.Fprintf(&sb, "<a href=\"%s\">%s</a>", rstURL(url), rstText(s))
+			} else {
+				sb.WriteString(rstText(whole))
+			}
+		} else if strings.HasPrefix(whole, "http") {
+			fmt.Fprintf(&sb, "<a href=\"%s\">%s</a>", html.EscapeString(whole), html.EscapeString(whole))
+		} else {
+			sb.WriteString(whole) // Template syntax
+		}
+	}
+	sb.WriteString(rstText(text[last:]))
+	return sb.String()
+}
+
+// rstURL escapes url for an attribute, unless it is template syntax the
+// template renderer still has to see as it is
+func rstURL(url string) string {
+	if strings.HasPrefix(url, "{{") {
+		return url
+	}
+	return html.EscapeString(url)
+}
+
+// rstText escapes plain text, removing the backslashes that escape markup
+func rstText(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return html.EscapeString(sb.String())
+}
@@ -0,0 +1,128 @@
+package htmlproc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// DefaultSanitize is the sanitization profile used unless another one is
+// configured
+const DefaultSanitize = "default"
+
+// SanitizeRules say what is stripped from pages before they are processed
+type SanitizeRules struct {
+	// Remove is a CSS selector group of elements to drop, with their content
+	Remove string
+	// Keep is a CSS selector group of elements kept although Remove or the
+	// boilerplate selectors match them, e.g. "table style"
+	Keep string
+	// Attributes lists the attributes to keep, all of them if empty. A name
+	// ending in * stands for all those starting with it, e.g. "data-*".
+	// Links and images need id, href, src and alt, which are always kept.
+	Attributes []string
+}
+
+// sanitizeProfiles are the built-in sets of rules
+var sanitizeProfiles = map[string]SanitizeRules{
+	// Scripts, stylesheets and embedded frames, which have no place in print
+	"default": {Remove: "script, style, link, meta, iframe, noscript"},
+
+	// The style blocks of pages are kept, e.g. those laying out tables
+	"keep-styles": {Remove: "script, link, meta, iframe, noscript"},
+
+	// Plain markup: forms, embedded objects and inline styles and event
+	// handlers go too
+	"strict": {
+		Remove: "script, style, link, meta, iframe, noscript, object, embed, form, button, input, select, textarea",
+		Attributes: []string{
+			"id", "href", "src", "alt", "title", "class", "lang", "dir", "name",
+			"colspan", "rowspan", "headers", "scope", "width", "height",
+			"start", "type", "value", "datetime", "cite",
+		},
+	},
+}
+
+// SanitizeProfiles returns the names of the built-in sanitization profiles
+func SanitizeProfiles() []string {
+	var names []string
+	for name := range sanitizeProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SanitizeProfile returns the rules of the built-in profile called name
+func SanitizeProfile(name string) (SanitizeRules, error) {
+	rules, ok := sanitizeProfiles[name]
+	if !ok {
+		return SanitizeRules{}, fmt.Errorf("unknown sanitization profile %q, expected %s", name, strings.Join(SanitizeProfiles(), ", "))
+	}
+	rules.Attributes = append([]string(nil), rules.Attributes...)
+	return rules, nil
+}
+
+// Check returns an error if a selector of r is invalid
+func (r *SanitizeRules) Check() error {
+	for _, s := range []struct{ name, group string }{{"remove", r.Remove}, {"keep", r.Keep}} {
+		if s.group == "" {
+			continue
+		}
+		if _, err := cascadia.ParseGroup(s.group); err != nil {
+			return fmt.Errorf("invalid %s selector %q: %w", s.name, s.group, err)
+		}
+	}
+	return nil
+}
+
+// String describes r, for cache keys
+func (r *SanitizeRules) String() string {
+	return fmt.Sprintf("remove=%q keep=%q attributes=%q", r.Remove, r.Keep, r.Attributes)
+}
+
+// clean drops the elements of doc matched by Remove or boilerplate, but not
+// Keep, and the attributes not listed in Attributes
+func (r *SanitizeRules) clean(doc *goquery.Document, boilerplate string) {
+	for _, group := range []string{r.Remove, boilerplate} {
+		if group == "" {
+			continue
+		}
+		s := doc.Find(group)
+		if r.Keep != "" {
+			s = s.Not(r.Keep)
+		}
+		s.Remove()
+	}
+	if len(r.Attributes) == 0 {
+		return
+	}
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		node := s.Get(0)
+		attrs := node.Attr[:0]
+		for _, a := range node.Attr {
+			if r.keepsAttribute(a.Key) {
+				attrs = append(attrs, a)
+			}
+		}
+		node.Attr = attrs
+	})
+}
+
+// keepsAttribute reports whether the attribute called name is kept
+func (r *SanitizeRules) keepsAttribute(name string) bool {
+	switch name = strings.ToLower(name); name {
+	case "id", "href", "src", "alt":
+		return true
+	}
+	for _, a := range r.Attributes {
+		a = strings.ToLower(a)
+		if a == name || strings.HasSuffix(a, "*") && strings.HasPrefix(name, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package htmlproc
+
+import (
+	"log/slog"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SourceLinks says where the pages of a documentation directory are
+// published and kept, for NoteSources
+type SourceLinks struct {
+	// BaseURL is the URL of the directory on the website, e.g.
+	// "https://geti2p.net/en/docs", empty to give no URLs. SpecsURL is that
+	// of the specifications under SpecsPath, which live beside the docs.
+	BaseURL  string
+	SpecsURL string
+	// RepoPath is the path of the directory in its repository, e.g.
+	// "i2p2www/pages/site/docs", and SpecsRepoPath that of the
+	// specifications; with neither, source files are given relative to the
+	// directory
+	RepoPath      string
+	SpecsRepoPath string
+}
+
+// NoteSources sets the URL and Source of the pages of tree, whose files are
+// under inputDir, so readers of the document can find the live, possibly
+// newer, version of each page
+func NoteSources(tree *Node, inputDir string, links SourceLinks) {
+	tree.Walk(func(n *Node) {
+		if n.File == "" {
+			return
+		}
+		rel, err := filepath.Rel(inputDir, n.File)
+		if err != nil {
+			slog.Debug("Page outside the input directory", "file", n.File)
+			return
+		}
+		rel = filepath.ToSlash(rel)
+		base, repo, page := links.BaseURL, links.RepoPath, n.Path
+		if spec, ok := strings.CutPrefix(rel, SpecsPath+"/"); ok && (links.SpecsURL != "" || links.SpecsRepoPath != "") {
+			base, repo, rel = links.SpecsURL, links.SpecsRepoPath, spec
+			page = strings.TrimPrefix(strings.TrimPrefix(page, SpecsPath), "/")
+		}
+		if base != "" {
+			n.URL = strings.TrimSuffix(base, "/")
+			if page != "" {
+				n.URL += "/" + (&url.URL{Path: page}).EscapedPath()
+			}
+		}
+		n.Source = path.Join(repo, rel)
+	})
+}
@@ -0,0 +1,164 @@
+package htmlproc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// InlineAssets copies the HTML document r to w, making it self-contained by
+// replacing local image references with data URIs and local stylesheets with
+// <style> elements. Relative references are resolved against baseDir; remote
+// ones are kept. The document is copied tag by tag as it is read, only the
+// elements changed are written anew.
+func InlineAssets(r io.Reader, w io.Writer, baseDir string) error {
+	bw := bufio.NewWriter(w)
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return err
+			}
+			return bw.Flush()
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			bw.Write(z.Raw())
+			continue
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		token := z.Token()
+		switch {
+		case token.Data == "style":
+			// The fonts of @font-face rules, and any other url()
+			bw.Write(raw)
+			if z.Next() == html.TextToken {
+				bw.Write(inlineCSSURLs(z.Raw(), baseDir))
+			} else {
+				bw.Write(z.Raw())
+			}
+			continue
+		case token.Data == "img":
+			if inlineImage(&token, baseDir) {
+				bw.WriteString(token.String())
+				continue
+			}
+		case token.Data == "link" && attr(token, "rel") == "stylesheet":
+			href := attr(token, "href")
+			data, err := readLocalAsset(baseDir, href)
+			if err != nil {
+				slog.Warn("Cannot inline stylesheet", "href", href, "err", err)
+			} else if data != nil {
+				bw.WriteString("<style>")
+				bw.Write(inlineCSSURLs(data, filepath.Dir(filepath.Join(baseDir, filepath.FromSlash(href)))))
+				bw.WriteString("</style>")
+				continue
+			}
+		}
+		bw.Write(raw)
+	}
+}
+
+// WriteStandalone writes the document of tree to w like WriteDocument, with
+// its assets inlined like InlineAssets does, so it is a single file
+func WriteStandalone(w io.Writer, tree *Node, opts DocumentOptions, baseDir string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(WriteDocument(pw, tree, opts))
+	}()
+	err := InlineAssets(pr, w, baseDir)
+	// Stop the writer if inlining failed half way
+	pr.CloseWithError(err)
+	return err
+}
+
+// inlineImage replaces the src of the img tag with a data URI, if it refers
+// to a local file, and reports whether it did
+func inlineImage(token *html.Token, baseDir string) bool {
+	for i, a := range token.Attr {
+		if a.Namespace != "" || a.Key != "src" {
+			continue
+		}
+		data, err := readLocalAsset(baseDir, a.Val)
+		if err != nil {
+			slog.Warn("Cannot inline image", "src", a.Val, "err", err)
+			return false
+		}
+		if data == nil {
+			return false
+		}
+		token.Attr[i].Val = dataURI(a.Val, data)
+		return true
+	}
+	return false
+}
+
+// cssURL matches the url() references of a stylesheet
+var cssURL = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^'")\s]*))\s*\)`)
+
+// inlineCSSURLs replaces the local files the url() references of css point
+// to, relative to baseDir, with data URIs
+func inlineCSSURLs(css []byte, baseDir string) []byte {
+	return cssURL.ReplaceAllFunc(css, func(m []byte) []byte {
+		sub := cssURL.FindSubmatch(m)
+		ref := string(sub[1]) + string(sub[2]) + string(sub[3])
+		data, err := readLocalAsset(baseDir, ref)
+		if err != nil {
+			slog.Warn("Cannot inline stylesheet reference", "url", ref, "err", err)
+			return m
+		}
+		if data == nil {
+			return m
+		}
+		return []byte(`url("` + dataURI(ref, data) + `")`)
+	})
+}
+
+// attr returns the value of attribute key of the tag, or ""
+func attr(token html.Token, key string) string {
+	for _, a := range token.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// readLocalAsset reads the file ref points to, or returns nil data for
+// references that aren't local files (remote URLs, existing data URIs)
+func readLocalAsset(baseDir, ref string) ([]byte, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	switch u.Scheme {
+	case "":
+		path = filepath.Join(baseDir, filepath.FromSlash(u.Path))
+	case "file":
+		path = filepath.FromSlash(u.Path)
+	default:
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+// dataURI encodes data as a base64 data URI, guessing the media type from the
+// file name and falling back to content sniffing
+func dataURI(name string, data []byte) string {
+	mediaType := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	if mediaType == "" {
+		mediaType = http.DetectContentType(data)
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,68 @@
+package htmlproc
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Stats summarizes what went into a document, to track its growth over
+// releases
+type Stats struct {
+	Pages         int            `json:"pages"`          // Source pages included
+	Skipped       int            `json:"skipped"`        // Source pages left out by the filter
+	Empty         []EmptyPage    `json:"empty"`          // Source pages left out as empty or redirects
+	Words         int            `json:"words"`          // Words of text in the pages
+	Images        int            `json:"images"`         // Images shown in the pages
+	MissingAssets []string       `json:"missing_assets"` // Image references that weren't found
+	Sections      []SectionStats `json:"sections"`       // Breakdown by top-level section
+}
+
+// SectionStats counts the pages, words and images of a top-level section
+// of the document, or of the docs index page
+type SectionStats struct {
+	Path   string `json:"path"`
+	Title  string `json:"title"`
+	Pages  int    `json:"pages"`
+	Words  int    `json:"words"`
+	Images int    `json:"images"`
+}
+
+// Stats counts the contents of tree, as returned by the last Build
+func (p *Pipeline) Stats(tree *Node) Stats {
+	stats := Stats{Skipped: p.skipped, Empty: append([]EmptyPage{}, p.empty...), MissingAssets: []string{}, Sections: []SectionStats{}}
+	if p.Assets != nil {
+		stats.MissingAssets = append(stats.MissingAssets, p.Assets.Missing()...)
+	}
+	count := func(section *SectionStats, n *Node) {
+		if n.File == "" {
+			return
+		}
+		section.Pages++
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(n.Content))
+		if err != nil {
+			return
+		}
+		section.Words += len(strings.Fields(doc.Text()))
+		section.Images += doc.Find("img").Length()
+	}
+
+	add := func(section SectionStats) {
+		stats.Pages += section.Pages
+		stats.Words += section.Words
+		stats.Images += section.Images
+		stats.Sections = append(stats.Sections, section)
+	}
+	if tree.File != "" {
+		// The index page alone, its children are the other sections
+		index := SectionStats{Path: pageName(tree), Title: tree.DisplayName()}
+		count(&index, tree)
+		add(index)
+	}
+	for _, c := range tree.Children {
+		section := SectionStats{Path: c.Path, Title: c.DisplayName()}
+		c.Walk(func(n *Node) { count(&section, n) })
+		add(section)
+	}
+	return stats
+}
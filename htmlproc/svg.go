@@ -0,0 +1,75 @@
+package htmlproc
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// cssDPI is the resolution of CSS pixels, which SVG user units map to
+const cssDPI = 96
+
+// SVGRasterizer converts SVG images to PNG, for renderers that draw SVGs
+// blank or mangled. Tool is "go" for the built-in renderer or "rsvg-convert"
+// for librsvg, which supports more of SVG (text, filters, CSS).
+type SVGRasterizer struct {
+	DPI  float64 // Resolution of the PNG, e.g. 192 for twice the screen size
+	Tool string
+}
+
+// svgSize returns the intrinsic size of an SVG in CSS pixels
+func svgSize(file string) (w, h float64, err error) {
+	icon, err := oksvg.ReadIcon(file, oksvg.IgnoreErrorMode)
+	if err != nil {
+		return 0, 0, err
+	}
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+		return 0, 0, fmt.Errorf("%s has no size", file)
+	}
+	return icon.ViewBox.W, icon.ViewBox.H, nil
+}
+
+// Rasterize writes svgFile as a PNG to pngFile
+func (s *SVGRasterizer) Rasterize(svgFile, pngFile string) error {
+	scale := s.DPI / cssDPI
+	if s.Tool == "rsvg-convert" {
+		out, err := exec.Command("rsvg-convert", "--zoom", fmt.Sprint(scale), "--format", "png", "--output", pngFile, svgFile).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("rsvg-convert failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	icon, err := oksvg.ReadIcon(svgFile, oksvg.IgnoreErrorMode)
+	if err != nil {
+		return err
+	}
+	w, h := int(icon.ViewBox.W*scale+0.5), int(icon.ViewBox.H*scale+0.5)
+	if w <= 0 || h <= 0 {
+		return fmt.Errorf("%s has no size", svgFile)
+	}
+	icon.SetTarget(0, 0, float64(w), float64(h))
+
+	// Diagrams usually assume a white page behind them
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	scanner := rasterx.NewScannerGV(w, h, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(w, h, scanner), 1)
+
+	out, err := os.Create(pngFile)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,384 @@
+package htmlproc
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	xhtml "golang.org/x/net/html"
+)
+
+// TemplateFunc implements a Jinja helper such as site_url(); args holds the
+// positional arguments and kwargs the keyword arguments, already evaluated
+type TemplateFunc func(r *TemplateRenderer, args []string, kwargs map[string]string) string
+
+// TemplateRenderer renders the subset of Jinja2 used by the i2p.www pages:
+// blocks, {% trans %}, {% highlight %}, comments and {{ expressions }} built
+// from string literals, variables and the helpers in Funcs. Anything else
+// (extends, if, for, macros) is dropped so it doesn't leak into the PDF.
+type TemplateRenderer struct {
+	Funcs map[string]TemplateFunc
+	Vars  map[string]string
+	// Endpoints maps the endpoints of url_for() and get_url() to URL
+	// patterns, where {name} stands for the keyword argument name, see
+	// DefaultEndpoints
+	Endpoints map[string]string
+	// Version is the current I2P release returned by ver(), empty if unknown
+	Version string
+	// SiteURL, e.g. "https://geti2p.net", makes the endpoint URLs absolute,
+	// so links to pages outside the document lead to the website
+	SiteURL string
+	// Translate returns the translation of a {% trans %} message, or the
+	// message itself when there is none
+	Translate func(msgid string) string
+
+	mu      sync.Mutex      // Guards unknown, pages may be rendered concurrently
+	unknown map[string]bool // helpers already reported as unsupported
+}
+
+var (
+	jinjaComment   = regexp.MustCompile(`(?s){#.*?#}`)
+	jinjaBlock     = regexp.MustCompile(`(?s){%-?\s*block\s+(\w+)\s*-?%}(.*?){%-?\s*endblock(?:\s+\w+)?\s*-?%}`)
+	jinjaTrans     = regexp.MustCompile(`(?s){%-?\s*trans\b(.*?)-?%}(.*?){%-?\s*endtrans\s*-?%}`)
+	jinjaPluralize = regexp.MustCompile(`(?s){%-?\s*pluralize\b.*$`)
+	jinjaHighlight = regexp.MustCompile(`(?s){%-?\s*highlight\b[^%]*-?%}(.*?){%-?\s*endhighlight\s*-?%}`)
+	jinjaExpr      = regexp.MustCompile(`(?s){{-?\s*(.*?)\s*-?}}`)
+	jinjaTag       = regexp.MustCompile(`(?s){%.*?%}`)
+	jinjaTransVar  = regexp.MustCompile(`%\((\w+)\)s`)
+	whitespaceRun  = regexp.MustCompile(`\s+`)
+)
+
+// DefaultEndpoints are the URLs of the i2p2www endpoints pages link to with
+// url_for() and get_url(), relative to the site root like those of
+// site_url(). Links to docs pages become links to their chapters.
+var DefaultEndpoints = map[string]string{
+	"site_show":        "/{page}",
+	"blog_index":       "/blog",
+	"blog_post":        "/blog/post/{slug}",
+	"blog_category":    "/blog/category/{category}",
+	"meetings_index":   "/meetings",
+	"meetings_show":    "/meetings/{id}",
+	"downloads_list":   "/download",
+	"downloads_debian": "/download/debian",
+	"downloads_select": "/download/{version}/{file}",
+	"spec_index":       "/spec",
+	"spec_show":        "/spec/{name}",
+	"proposal_index":   "/spec/proposals",
+	"proposal_show":    "/spec/proposals/{name}",
+	"papers_list":      "/papers",
+}
+
+// jinjaEndpointArg matches a placeholder of an endpoint URL pattern
+var jinjaEndpointArg = regexp.MustCompile(`{(\w+)}`)
+
+// NewTemplateRenderer returns a renderer with the i2p2www helpers installed
+func NewTemplateRenderer() *TemplateRenderer {
+	return &TemplateRenderer{
+		Funcs: map[string]TemplateFunc{
+			"site_url": func(r *TemplateRenderer, args []string, kwargs map[string]string) string {
+				if len(args) == 0 {
+					return "/"
+				}
+				return "/" + strings.TrimPrefix(args[0], "/")
+			},
+			"url_for": (*TemplateRenderer).urlFor,
+			"get_url": (*TemplateRenderer).urlFor,
+			"ver": func(r *TemplateRenderer, args []string, kwargs map[string]string) string {
+				if r.Version == "" {
+					r.reportUnknown("ver() without a version")
+					return ""
+				}
+				if len(args) == 0 {
+					return r.Version
+				}
+				// e.g. ver('i2pinstall_{version}.jar')
+				return strings.ReplaceAll(args[0], "{version}", r.Version)
+			},
+			"i2pconv": func(r *TemplateRenderer, args []string, kwargs map[string]string) string {
+				if len(args) == 0 {
+					return ""
+				}
+				return args[0]
+			},
+			"_": func(r *TemplateRenderer, args []string, kwargs map[string]string) string {
+				if len(args) == 0 {
+					return ""
+				}
+				return r.translate(args[0])
+			},
+		},
+		Vars:      map[string]string{},
+		Endpoints: maps.Clone(DefaultEndpoints),
+		unknown:   map[string]bool{},
+	}
+}
+
+// siteVersion matches the release set in the i2p2www package
+var siteVersion = regexp.MustCompile(`(?m)^CURRENT_I2P_VERSION\s*=\s*['"]([^'"]+)['"]`)
+
+// ReadSiteVersion returns the current I2P release given in file, the
+// i2p2www/__init__.py of an i2p.www checkout, for ver()
+func ReadSiteVersion(file string) (string, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	m := siteVersion.FindSubmatch(src)
+	if m == nil {
+		return "", fmt.Errorf("%s sets no CURRENT_I2P_VERSION", file)
+	}
+	return string(m[1]), nil
+}
+
+// urlFor implements url_for() and get_url(): static files are referred to
+// by their path, which AssetResolver looks up, other endpoints by the URL
+// Endpoints gives for them
+func (r *TemplateRenderer) urlFor(args []string, kwargs map[string]string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if args[0] == "static" {
+		return kwargs["filename"]
+	}
+	pattern, ok := r.Endpoints[args[0]]
+	if !ok {
+		r.reportUnknown("url_for('" + args[0] + "')")
+		return ""
+	}
+	u := jinjaEndpointArg.ReplaceAllStringFunc(pattern, func(m string) string {
+		return strings.Trim(kwargs[m[1:len(m)-1]], "/")
+	})
+	if r.SiteURL != "" && strings.HasPrefix(u, "/") {
+		u = strings.TrimSuffix(r.SiteURL, "/") + u
+	}
+	return u
+}
+
+// Render renders a page template and returns its title block (if any) and the
+// content to include in the document. Pages without a content block are
+// treated as plain HTML with template expressions in them.
+func (r *TemplateRenderer) Render(src string) (title, content string) {
+	src = jinjaComment.ReplaceAllString(src, "")
+	src = jinjaHighlight.ReplaceAllStringFunc(src, func(m string) string {
+		code := jinjaHighlight.FindStringSubmatch(m)[1]
+		return "<pre><code>" + html.EscapeString(strings.Trim(code, "\n")) + "</code></pre>"
+	})
+
+	blocks := map[string]string{}
+	for _, m := range jinjaBlock.FindAllStringSubmatch(src, -1) {
+		blocks[m[1]] = m[2]
+	}
+	if body, ok := blocks["content"]; ok {
+		src = body
+	}
+	if t, ok := blocks["title"]; ok {
+		title = strings.TrimSpace(html.UnescapeString(r.renderText(t)))
+	}
+	return title, r.renderText(src)
+}
+
+// renderText renders trans blocks and expressions and drops all other tags
+func (r *TemplateRenderer) renderText(src string) string {
+	src = jinjaTrans.ReplaceAllStringFunc(src, func(m string) string {
+		sm := jinjaTrans.FindStringSubmatch(m)
+		return r.renderTrans(sm[1], sm[2])
+	})
+	src = jinjaExpr.ReplaceAllStringFunc(src, func(m string) string {
+		return r.eval(jinjaExpr.FindStringSubmatch(m)[1])
+	})
+	return jinjaTag.ReplaceAllString(src, "")
+}
+
+// renderTrans renders a {% trans name=expr, ... %}body{% endtrans %} block.
+// The body is converted to its gettext msgid form, where {{ name }} becomes
+// %(name)s, so that it can be looked up in translation catalogs.
+func (r *TemplateRenderer) renderTrans(params, body string) string {
+	body = jinjaPluralize.ReplaceAllString(body, "")
+	values := map[string]string{}
+	for _, p := range splitArgs(params) {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			values[strings.TrimSpace(k)] = r.eval(v)
+		}
+	}
+
+	msgid := jinjaExpr.ReplaceAllStringFunc(body, func(m string) string {
+		name := strings.TrimSpace(jinjaExpr.FindStringSubmatch(m)[1])
+		if _, ok := values[name]; !ok {
+			values[name] = r.eval(name)
+		}
+		return "%(" + name + ")s"
+	})
+	msgid = strings.TrimSpace(whitespaceRun.ReplaceAllString(msgid, " "))
+
+	return jinjaTransVar.ReplaceAllStringFunc(r.translate(msgid), func(m string) string {
+		return values[jinjaTransVar.FindStringSubmatch(m)[1]]
+	})
+}
+
+// translate looks msgid up through the Translate hook
+func (r *TemplateRenderer) translate(msgid string) string {
+	if r.Translate == nil {
+		return msgid
+	}
+	return r.Translate(msgid)
+}
+
+// eval evaluates a Jinja expression: a string literal, a variable or a helper
+// call, optionally followed by filters (which are ignored)
+func (r *TemplateRenderer) eval(expr string) string {
+	expr = stripFilters(expr)
+	if s, ok := unquote(expr); ok {
+		return s
+	}
+
+	name, rest, isCall := strings.Cut(expr, "(")
+	name = strings.TrimSpace(name)
+	if !isCall {
+		if v, ok := r.Vars[name]; ok {
+			return v
+		}
+		r.reportUnknown(name)
+		return ""
+	}
+
+	fn, ok := r.Funcs[name]
+	if !ok {
+		r.reportUnknown(name + "()")
+		return ""
+	}
+	var args []string
+	kwargs := map[string]string{}
+	for _, a := range splitArgs(strings.TrimSuffix(strings.TrimSpace(rest), ")")) {
+		if k, v, ok := strings.Cut(a, "="); ok && !strings.ContainsAny(k, `'"`) {
+			kwargs[strings.TrimSpace(k)] = r.eval(v)
+		} else {
+			args = append(args, r.eval(a))
+		}
+	}
+	return fn(r, args, kwargs)
+}
+
+// resolveHelpers evaluates the helper calls still in the src and href
+// attributes and the text of doc, such as those of pages that aren't
+// rendered as templates, where they may also be URL-escaped. Other
+// expressions are left alone, as are code blocks, where they are likely
+// examples.
+func (r *TemplateRenderer) resolveHelpers(doc *goquery.Document) {
+	doc.Find("[src], [href]").Each(func(_ int, s *goquery.Selection) {
+		for _, name := range []string{"src", "href"} {
+			value, ok := s.Attr(name)
+			if !ok || !strings.Contains(value, "{{") && !strings.Contains(strings.ToUpper(value), "%7B%7B") {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(value); err == nil {
+				value = unescaped
+			}
+			if resolved, changed := r.evalHelpers(value); changed {
+				s.SetAttr(name, resolved)
+				slog.Debug("Resolved template helper", "attr", name, "value", resolved)
+			}
+		}
+	})
+	doc.Find("body, body *").Not("pre, code, pre *, code *").Contents().Each(func(_ int, s *goquery.Selection) {
+		node := s.Get(0)
+		if node.Type != xhtml.TextNode || !strings.Contains(node.Data, "{{") {
+			return
+		}
+		if resolved, changed := r.evalHelpers(node.Data); changed {
+			node.Data = resolved
+		}
+	})
+}
+
+// evalHelpers replaces the expressions of s that call one of Funcs with
+// their value, and reports whether there were any
+func (r *TemplateRenderer) evalHelpers(s string) (string, bool) {
+	changed := false
+	s = jinjaExpr.ReplaceAllStringFunc(s, func(m string) string {
+		expr := jinjaExpr.FindStringSubmatch(m)[1]
+		name, _, isCall := strings.Cut(stripFilters(expr), "(")
+		if _, ok := r.Funcs[strings.TrimSpace(name)]; !ok || !isCall {
+			return m
+		}
+		changed = true
+		return r.eval(expr)
+	})
+	return s, changed
+}
+
+// reportUnknown logs an unsupported helper or variable once per run
+func (r *TemplateRenderer) reportUnknown(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.unknown[name] {
+		r.unknown[name] = true
+		slog.Warn("Unsupported template expression, leaving it out", "expr", name)
+	}
+}
+
+// splitArgs splits a comma-separated argument list, ignoring commas inside
+// quotes and parentheses
+func splitArgs(s string) []string {
+	var args []string
+	var quote rune
+	depth, start := 0, 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		args = append(args, last)
+	}
+	return args
+}
+
+// stripFilters removes "|filter" suffixes that are outside quotes and parentheses
+func stripFilters(expr string) string {
+	var quote rune
+	depth := 0
+	for i, c := range expr {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '|' && depth == 0:
+			return strings.TrimSpace(expr[:i])
+		}
+	}
+	return strings.TrimSpace(expr)
+}
+
+// unquote returns the contents of a single- or double-quoted string literal
+func unquote(s string) (string, bool) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], true
+	}
+	return "", false
+}
@@ -0,0 +1,152 @@
+package htmlproc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultTheme is the theme used unless another one is configured
+const DefaultTheme = "light"
+
+// themes are the built-in print styles, added after the base stylesheet of
+// documentHead and before any user stylesheets
+var themes = map[string]string{
+	// The base stylesheet as it is
+	"light": ``,
+
+	// Black on white with larger type, underlined links and outlined code,
+	// for low vision and monochrome printers
+	"high-contrast": `
+			body {
+				color: #000;
+				background: #fff;
+				font-size: 14pt;
+				line-height: 1.5;
+			}
+			a {
+				color: #000;
+				text-decoration: underline;
+			}
+			pre {
+				background-color: #fff;
+				border: 2px solid #000;
+			}
+			table, th, td {
+				border: 1px solid #000;
+			}
+	`,
+
+	// No background fills and gray rather than black rules, to save ink and
+	// toner when printing the whole documentation. Inline styles of the
+	// pages are overridden too.
+	"low-ink": `
+			pre, code, table, thead, tbody, tr, th, td, .admonition, .title-page {
+				background: none !important;
+			}
+			pre {
+				border: 1px solid #aaa;
+			}
+			table, th, td {
+				border-color: #aaa !important;
+			}
+			a {
+				color: #333;
+			}
+	`,
+
+	// Smaller type and spacing to save paper
+	"compact": `
+			body {
+				font-size: 9pt;
+				line-height: 1.25;
+				max-width: none;
+				padding: 0;
+			}
+			h1, h2, h3, h4 {
+				margin: 0.8em 0 0.3em;
+			}
+			p, ul, ol, pre {
+				margin: 0.4em 0;
+			}
+			pre {
+				padding: 4px;
+			}
+			.chapter {
+				margin-top: 10px;
+			}
+	`,
+
+	// Large type using the whole width of small screens, to go with a
+	// small --page-size
+	"e-reader": `
+			body {
+				font-size: 16pt;
+				line-height: 1.4;
+				max-width: none;
+				margin: 0;
+				padding: 0;
+			}
+			pre {
+				white-space: pre-wrap;
+				word-wrap: break-word;
+				font-size: 0.8em;
+			}
+			img {
+				max-width: 100%;
+				height: auto;
+			}
+			.title-page {
+				padding-top: 60px;
+			}
+	`,
+}
+
+// grayscaleCSS returns the rules of DocumentOptions.Grayscale
+func grayscaleCSS(grayscale bool) string {
+	if !grayscale {
+		return ""
+	}
+	return `
+			img, svg {
+				filter: grayscale(100%);
+				-webkit-filter: grayscale(100%);
+			}
+			a, .broken-link, .broken-link-note {
+				color: #000;
+			}
+			a {
+				text-decoration: underline;
+			}
+	`
+}
+
+// fontSizeCSS returns the rules of DocumentOptions.FontSize
+func fontSizeCSS(size float64) string {
+	if size <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+			body {
+				font-size: %gpt;
+			}
+	`, size)
+}
+
+// Themes returns the names of the built-in themes
+func Themes() []string {
+	var names []string
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckTheme returns an error unless name is a built-in theme
+func CheckTheme(name string) error {
+	if _, ok := themes[name]; !ok {
+		return fmt.Errorf("unknown theme %q, expected %s", name, strings.Join(Themes(), ", "))
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package htmlproc
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Node is one entry of the documentation tree: a directory, a page, or a
+// directory that has its own index.html
+type Node struct {
+	Name     string  // Readable name of this entry, e.g. "ntcp2"
+	ID       string  // Anchor of this entry's heading in the combined document
+	Path     string  // Slash-separated path relative to the docs root, e.g. "transport/ntcp2"
+	Title    string  // Title declared by the page itself, if any
+	Content  string  // Processed HTML of File
+	File     string  // HTML file rendered for this entry, empty for bare directories
+	Children []*Node // Subsections and pages, in discovery order
+
+	// Updated is when the source of the page last changed, zero if unknown.
+	// It is printed below the page's heading.
+	Updated time.Time
+	// Translations are the page in other languages, written after it, see
+	// AddTranslations. Lang is the language of a translation.
+	Translations []*Node
+	Lang         string
+
+	// Number is the place of the entry in the tree written before its name,
+	// e.g. "3.2", see NumberChapters. Appendix marks back matter, such as
+	// the glossary, that may be lettered instead.
+	Number   string
+	Appendix bool
+	// Part marks a heading grouping chapters, e.g. "Part II: Protocols",
+	// which is not numbered itself
+	Part bool
+
+	// URL is where the page is published and Source its file in the
+	// repository, printed at its end, see NoteSources
+	URL    string
+	Source string
+}
+
+// child returns the child called name, creating it if needed
+func (n *Node) child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &Node{Name: name, ID: n.ID + "-" + anchorSlug(name), Path: path.Join(n.Path, name)}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// BuildTree arranges files found under baseDir into a tree mirroring the
+// directory structure, so a/b/index.html and a/b/c.html become section a →
+// subsection b → page c
+func BuildTree(baseDir string, files []string) *Node {
+	root := &Node{Name: filepath.Base(filepath.Clean(baseDir)), ID: "doc"}
+	for _, file := range files {
+		rel, err := filepath.Rel(baseDir, file)
+		if err != nil {
+			slog.Warn("Skipping page", "file", file, "err", err)
+			continue
+		}
+		// Links name pages composed, whichever way the file system has them
+		parts := strings.Split(norm.NFC.String(filepath.ToSlash(rel)), "/")
+		last := parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+		if name := strings.TrimSuffix(last, filepath.Ext(last)); !strings.EqualFold(name, "index") {
+			parts = append(parts, name)
+		}
+
+		node := root
+		for _, part := range parts {
+			node = node.child(part)
+		}
+		node.File = file
+	}
+	return root
+}
+
+// setID gives n the anchor id and its descendants the anchors derived from it
+func (n *Node) setID(id string) {
+	n.ID = id
+	for _, c := range n.Children {
+		c.setID(id + "-" + anchorSlug(c.Name))
+	}
+}
+
+// Walk calls fn for n and all of its descendants, depth first
+func (n *Node) Walk(fn func(*Node)) {
+	fn(n)
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
+
+// DisplayName is the page's own title when it has one, else the entry name
+func (n *Node) DisplayName() string {
+	if n.Title != "" {
+		return n.Title
+	}
+	return n.Name
+}
+
+// PageError is a page that failed to process
+type PageError struct {
+	Page string `json:"page"` // Page path, "index" for the docs index
+	File string `json:"file"`
+	Err  string `json:"error"`
+}
+
+// ProcessTree fills in Title and Content of every page in the tree, running
+// process on up to jobs pages at once (at least one). Pages that fail to
+// process are logged and left out of the document; it returns their errors
+// in document order.
+func ProcessTree(tree *Node, jobs int, process func(file string) (title, content string, err error)) []PageError {
+	var pages []*Node
+	tree.Walk(func(n *Node) {
+		if n.File != "" {
+			pages = append(pages, n)
+		}
+	})
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	errs := make([]*PageError, len(pages))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker only touches the nodes it takes from the queue
+			for i := range queue {
+				n := pages[i]
+				title, content, err := process(n.File)
+				if err != nil {
+					slog.Error("Cannot process page", "file", n.File, "err", err)
+					errs[i] = &PageError{Page: pageName(n), File: n.File, Err: err.Error()}
+					n.File = ""
+					continue
+				}
+				n.Title, n.Content = title, content
+			}
+		}()
+	}
+	for i := range pages {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	var failed []PageError
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, *err)
+		}
+	}
+	return failed
+}
+
+// anchorSlug turns a path component into something safe to use in an HTML id.
+// Other letters than ASCII are written as their code point, so that names
+// in other scripts don't all become dashes.
+func anchorSlug(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			sb.WriteRune(r)
+		case r >= utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			fmt.Fprintf(&sb, "u%04x", r)
+		default:
+			sb.WriteRune('-')
+		}
+	}
+	return sb.String()
+}
+
+// headingLevel maps a tree depth to an HTML heading level. The document title
+// is the only h1, top-level sections are h2 and anything deeper than h6 is
+// flattened into h6.
+func headingLevel(depth int) int {
+	level := depth + 1
+	if level < 2 {
+		level = 2
+	}
+	if level > 6 {
+		level = 6
+	}
+	return level
+}
+
+// writeTOC writes the children of n as a nested list of links to their
+// headings, depth levels deep (0 for all of them)
+func writeTOC(sb htmlWriter, n *Node, depth int) {
+	if len(n.Children) == 0 {
+		return
+	}
+	sb.WriteString("<ul>")
+	for _, c := range n.Children {
+		sb.WriteString(fmt.Sprintf(`<li><a href="#%s">%s</a>`, c.ID, html.EscapeString(c.Heading())))
+		if depth != 1 {
+			writeTOC(sb, c, depth-1)
+		}
+		sb.WriteString("</li>")
+	}
+	sb.WriteString("</ul>")
+}
+
+// writeChapters writes a heading for n at the level matching depth, followed by
+// its page content (if any) and then its children one level deeper. Because
+// wkhtmltopdf derives the PDF outline from heading levels, this produces
+// bookmarks that follow the directory structure.
+func writeChapters(sb htmlWriter, n *Node, depth int) {
+	level := headingLevel(depth)
+	if n.Part {
+		writePartDivider(sb, n, level)
+	}
+	if n.File != "" {
+		// The page is written as it is rather than formatted, pages can be large
+		if n.Lang != "" {
+			// The document may be in a language written the other way
+			dir := "ltr"
+			if IsRTL(n.Lang) {
+				dir = "rtl"
+			}
+			fmt.Fprintf(sb, `
+				<div class="chapter translation" lang="%s" dir="%s" style="font-family: %s">
+					<h%d id="%s">%s <span class="lang">(%s)</span></h%d>
+					`, htmlLang(n.Lang), dir, html.EscapeString(fontFamilyFor(n.Lang)), level, n.ID, html.EscapeString(n.Heading()), n.Lang, level)
+		} else if n.Part {
+			// The divider has the heading
+			sb.WriteString(`
+				<div class="chapter">
+					`)
+		} else {
+			fmt.Fprintf(sb, `
+				<div class="chapter">
+					<h%d id="%s">%s</h%d>
+					`, level, n.ID, html.EscapeString(n.Heading()), level)
+		}
+		if !n.Updated.IsZero() {
+			fmt.Fprintf(sb, `<p class="last-updated">Last updated %s</p>
+					`, n.Updated.Format("2006-01-02"))
+		}
+		sb.WriteString(n.Content)
+		writeSourceNote(sb, n)
+		sb.WriteString(`
+					<div class="page-break"></div>
+				</div>
+			`)
+		for _, t := range n.Translations {
+			writeChapters(sb, t, depth)
+		}
+	} else if depth > 0 && !n.Part {
+		sb.WriteString(fmt.Sprintf("<h%d class=\"section\" id=\"%s\">%s</h%d>\n", level, n.ID, html.EscapeString(n.Heading()), level))
+	}
+	for _, c := range n.Children {
+		writeChapters(sb, c, depth+1)
+	}
+}
+
+// writePartDivider writes the page opening part n: its title and a list of
+// the chapters in it with their sections, so readers of the printed book find
+// their way around it
+func writePartDivider(sb htmlWriter, n *Node, level int) {
+	fmt.Fprintf(sb, `
+				<div class="part-divider">
+					<h%d class="part" id="%s">%s</h%d>
+					`, level, n.ID, html.EscapeString(n.Heading()), level)
+	writeTOC(sb, n, 2)
+	sb.WriteString(`
+				</div>
+				<div class="page-break"></div>
+			`)
+}
+
+// writeSourceNote writes the line at the end of a page saying where it is
+// published and where its source is, if known
+func writeSourceNote(sb htmlWriter, n *Node) {
+	if n.URL == "" && n.Source == "" {
+		return
+	}
+	sb.WriteString(`<p class="source-note">`)
+	if n.URL != "" {
+		u := html.EscapeString(n.URL)
+		sb.WriteString(`Online: <a href="` + u + `">` + u + `</a>`)
+	}
+	if n.URL != "" && n.Source != "" {
+		sb.WriteString(" · ")
+	}
+	if n.Source != "" {
+		sb.WriteString("Source: <code>" + html.EscapeString(n.Source) + "</code>")
+	}
+	sb.WriteString("</p>")
+}
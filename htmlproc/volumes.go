@@ -0,0 +1,142 @@
+package htmlproc
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// CheckSplitBy returns an error unless by is a way to split the document
+// into volumes
+func CheckSplitBy(by string) error {
+	switch by {
+	case "none", "top-level-dir":
+		return nil
+	}
+	return fmt.Errorf("unknown split %q, expected none or top-level-dir", by)
+}
+
+// Volume is a top-level section of the documentation published as a
+// document of its own
+type Volume struct {
+	Name  string // Top-level directory, e.g. "spec"
+	Title string
+	Tree  *Node // Docs tree holding only this section
+}
+
+// SplitVolumes makes a volume of each top-level section of tree. The docs
+// index page, if any, belongs to none of them; it opens the master index.
+func SplitVolumes(tree *Node) []Volume {
+	volumes := make([]Volume, len(tree.Children))
+	for i, c := range tree.Children {
+		root := &Node{Name: tree.Name, ID: tree.ID, Children: []*Node{c}}
+		volumes[i] = Volume{Name: c.Name, Title: c.Heading(), Tree: root}
+	}
+	return volumes
+}
+
+// LinkVolumes points links to sections in other volumes, which were
+// rewritten to anchors in the combined document, at the files of those
+// volumes instead. file(i) returns the file of volume i relative to the
+// others. Whether readers follow such links depends on the PDF viewer.
+func LinkVolumes(volumes []Volume, file func(i int) string) error {
+	trees := make([]*Node, len(volumes))
+	for i, v := range volumes {
+		trees[i] = v.Tree
+	}
+	return linkDocuments(trees, func(from, to int) string { return file(to) })
+}
+
+// linkDocuments points links to anchors in another of the documents made
+// of trees at the file of that document, file(i, j) being the file of
+// document j relative to document i
+func linkDocuments(trees []*Node, file func(from, to int) string) error {
+	owner := map[string]int{} // Anchor → document
+	for i, tree := range trees {
+		var err error
+		tree.Walk(func(n *Node) {
+			// Roots without a page of their own only hold the document together
+			if n != tree || n.File != "" {
+				owner[n.ID] = i
+			}
+			if n.File == "" || err != nil {
+				return
+			}
+			var doc *goquery.Document
+			doc, err = goquery.NewDocumentFromReader(strings.NewReader(n.Content))
+			if err != nil {
+				return
+			}
+			doc.Find("[id], a[name]").Each(func(_ int, s *goquery.Selection) {
+				owner[s.AttrOr("id", s.AttrOr("name", ""))] = i
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, tree := range trees {
+		var err error
+		tree.Walk(func(n *Node) {
+			if n.File == "" || err != nil {
+				return
+			}
+			var doc *goquery.Document
+			doc, err = goquery.NewDocumentFromReader(strings.NewReader(n.Content))
+			if err != nil {
+				return
+			}
+			changed := false
+			doc.Find(`a[href^="#"]`).Each(func(_ int, s *goquery.Selection) {
+				anchor := strings.TrimPrefix(s.AttrOr("href", ""), "#")
+				if j, ok := owner[anchor]; ok && j != i {
+					s.SetAttr("href", file(i, j)+"#"+anchor)
+					s.AddClass("document-link")
+					changed = true
+				}
+			})
+			if changed {
+				n.Content, err = doc.Find("body").Html()
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildVolumeIndex returns the master index of a document split into
+// volumes: the title page, the docs index page of tree if there is one, and
+// a list of the volumes with the sections they contain, linking to the
+// files given for them
+func BuildVolumeIndex(tree *Node, volumes []Volume, files []string, opts DocumentOptions) string {
+	var sb strings.Builder
+	documentHead(&sb, opts)
+	sb.WriteString(coverHTML(opts))
+	if tree.File != "" {
+		index := *tree
+		index.Children = nil
+		writeChapters(&sb, &index, 0)
+	}
+	sb.WriteString(`<h2 id="volumes">Volumes</h2><ol class="volumes">`)
+	for i, v := range volumes {
+		href := html.EscapeString(files[i])
+		fmt.Fprintf(&sb, `<li><a href="%s">%s</a> <span class="volume-file">(%s)</span>`, href, html.EscapeString(v.Title), href)
+		if sections := v.Tree.Children[0].Children; len(sections) > 0 {
+			sb.WriteString("<ul>")
+			for _, c := range sections {
+				fmt.Fprintf(&sb, `<li><a href="%s#%s">%s</a></li>`, href, c.ID, html.EscapeString(c.Heading()))
+			}
+			sb.WriteString("</ul>")
+		}
+		sb.WriteString("</li>")
+	}
+	sb.WriteString("</ol>")
+	sb.WriteString(colophonHTML(opts))
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
@@ -0,0 +1,111 @@
+package htmlproc
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FitOptions controls what happens to code blocks and tables too wide for
+// the page
+type FitOptions struct {
+	// Mode is "none" to leave them overflowing, "scale" to shrink their type
+	// until they fit, or "rotate" to also put wide tables on landscape pages
+	Mode string
+	// Columns is the number of characters that fit on a line of the page
+	Columns int
+}
+
+const (
+	minScale = 50 // Percent below which wide blocks are wrapped rather than shrunk
+
+	// landscapeRatio is how much wider a landscape page is than a portrait one
+	landscapeRatio = 1.41
+
+	// maxCellWidth is the width in characters a table cell is assumed to wrap at
+	maxCellWidth = 30
+)
+
+// CheckFitMode returns an error unless mode is a FitOptions mode
+func CheckFitMode(mode string) error {
+	switch mode {
+	case "none", "scale", "rotate":
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q, expected none, scale or rotate", mode)
+}
+
+// fitWide shrinks the code blocks and tables of doc that are estimated to be
+// wider than fit.Columns, or turns the tables sideways
+func fitWide(doc *goquery.Document, fit FitOptions) {
+	if fit.Mode == "" || fit.Mode == "none" || fit.Columns <= 0 {
+		return
+	}
+	doc.Find("pre").Each(func(i int, s *goquery.Selection) {
+		if width := preWidth(s.Text()); width > fit.Columns && !shrink(s, width, fit.Columns) {
+			// Lines still too long to shrink legibly wrap instead
+			addStyle(s, "white-space: pre-wrap; word-wrap: break-word;")
+		}
+	})
+	doc.Find("table").Each(func(i int, s *goquery.Selection) {
+		width := tableWidth(s)
+		if width <= fit.Columns {
+			return
+		}
+		if fit.Mode != "rotate" {
+			shrink(s, width, fit.Columns)
+			return
+		}
+		s.AddClass("landscape")
+		if columns := int(float64(fit.Columns) * landscapeRatio); width > columns {
+			shrink(s, width, columns)
+		}
+	})
+}
+
+// shrink scales the type of s so that width characters take up columns, or
+// as far as legible. It reports whether s now fits.
+func shrink(s *goquery.Selection, width, columns int) bool {
+	scale := 100 * columns / width
+	addStyle(s, fmt.Sprintf("font-size: %d%%;", max(scale, minScale)))
+	return scale >= minScale
+}
+
+// addStyle appends declarations to the style attribute of s
+func addStyle(s *goquery.Selection, declarations string) {
+	s.SetAttr("style", strings.TrimSpace(s.AttrOr("style", "")+" "+declarations))
+}
+
+// preWidth returns the length of the longest line of a code block, with tabs
+// expanded
+func preWidth(text string) int {
+	widest := 0
+	for _, line := range strings.Split(text, "\n") {
+		width := 0
+		for _, r := range line {
+			if r == '\t' {
+				width += 8 - width%8
+			} else {
+				width++
+			}
+		}
+		widest = max(widest, width)
+	}
+	return widest
+}
+
+// tableWidth estimates the width of a table in characters from its widest
+// row, taking long cells to wrap
+func tableWidth(table *goquery.Selection) int {
+	widest := 0
+	table.Find("tr").Each(func(i int, row *goquery.Selection) {
+		width := 0
+		row.ChildrenFiltered("td, th").Each(func(i int, cell *goquery.Selection) {
+			width += min(utf8.RuneCountInString(strings.TrimSpace(cell.Text())), maxCellWidth) + 2
+		})
+		widest = max(widest, width)
+	})
+	return widest
+}
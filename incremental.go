@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// renderKey hashes everything a rendered PDF depends on: the render settings
+// and the contents of the given files and directories
+func (o *options) renderKey(paths ...string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "engine=%s\noutline=%d\ntoc=%s %d\nsplit=%t\n", o.engine, o.outlineDepth, o.tocStyle, o.tocDepth, o.splitRender)
+	fmt.Fprintf(h, "metadata=%q\n", o.metadata())
+	fmt.Fprintf(h, "page=%s %s %s %d\nzoom=%g %g\n", o.pageSize, o.orientation, o.margins, o.dpi, o.zoom, o.fontSize)
+	fmt.Fprintf(h, "header=%q\nfooter=%q\n", o.header, o.footer)
+	fmt.Fprintf(h, "split-by=%s %t\npage-pdfs=%s\nbooklet=%s\npage-refs=%t\nattach-sources=%s\n", o.splitBy, o.continuousPages, o.pagePDFs, o.booklet, o.pageRefs, o.attachSources)
+	fmt.Fprintf(h, "optimize=%t %d %s %t\n", o.optimize, o.jpegQuality, o.targetSize, o.linearize)
+	fmt.Fprintf(h, "pdfa=%t %s\n", o.pdfa, o.iccProfile)
+	fmt.Fprintf(h, "encryption=%+v\n", o.encryption())
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			fmt.Fprintf(h, "file=%s\n", filepath.ToSlash(filepath.Join(filepath.Base(root), rel)))
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(h, f)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stampFile is where the render key of the last build of --output is kept
+func (o *options) stampFile() string {
+	abs, err := filepath.Abs(o.outputFile)
+	if err != nil {
+		abs = o.outputFile
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(o.cacheDir, "renders", hex.EncodeToString(sum[:8]))
+}
+
+// upToDate reports whether --output exists and was rendered from inputs with
+// the given key
+func (o *options) upToDate(key string) bool {
+	if o.force {
+		return false
+	}
+	if _, err := os.Stat(o.outputFile); err != nil {
+		return false
+	}
+	stamp, err := os.ReadFile(o.stampFile())
+	return err == nil && string(stamp) == key
+}
+
+// writeStamp records that --output was rendered from inputs with key
+func (o *options) writeStamp(key string) error {
+	if err := os.MkdirAll(filepath.Dir(o.stampFile()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(o.stampFile(), []byte(key), 0644)
+}
+
+// commitFile is where update keeps the i2p.www commit --output was last
+// built from
+func (o *options) commitFile() string {
+	return filepath.Join(filepath.Dir(o.stampFile()), filepath.Base(o.stampFile())+".commit")
+}
+
+// lastBuiltCommit returns the commit recorded by writeBuiltCommit, empty if
+// --output wasn't built by update yet
+func (o *options) lastBuiltCommit() string {
+	data, err := os.ReadFile(o.commitFile())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeBuiltCommit records that --output was built from commit
+func (o *options) writeBuiltCommit(commit string) error {
+	if err := os.MkdirAll(filepath.Dir(o.commitFile()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(o.commitFile(), []byte(commit+"\n"), 0644)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"i2pdoc2pdf/htmlproc"
+	"i2pdoc2pdf/progress"
+)
+
+// runLinkCheck checks the links of the processed pages and writes the report to
+// --link-report, or standard output. With --mark-broken-links the broken
+// links are highlighted in the document.
+func (o *options) runLinkCheck(tree *htmlproc.Node) error {
+	bar := progress.New("Checking links")
+	checker := &htmlproc.LinkChecker{Offline: o.offline, Jobs: o.jobs, Progress: bar.Set}
+	report, err := checker.Check(tree)
+	bar.Finish()
+	if err != nil {
+		return fmt.Errorf("error checking links: %w", err)
+	}
+	slog.Info("Checked links", "checked", report.Checked, "skipped", report.Skipped, "broken", len(report.Broken))
+
+	w := o.stdout
+	if o.linkReport != "" {
+		f, err := os.Create(o.linkReport)
+		if err != nil {
+			return fmt.Errorf("error writing link report: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeLinkReport(w, report, o.linkReportFormat); err != nil {
+		return fmt.Errorf("error writing link report: %w", err)
+	}
+
+	if o.markBrokenLinks {
+		return htmlproc.MarkBrokenLinks(tree, report.Broken)
+	}
+	return nil
+}
+
+// writeLinkReport writes report as text, one broken link per line, or JSON
+func writeLinkReport(w io.Writer, report *htmlproc.LinkReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	for _, b := range report.Broken {
+		if _, err := fmt.Fprintf(w, "%s: %s (%s)\n", b.Page, b.Href, b.Reason); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d links checked, %d skipped, %d broken\n", report.Checked, report.Skipped, len(report.Broken))
+	return err
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"i2pdoc2pdf/progress"
+)
+
+// setupLogging sends log records to the console at the level chosen by
+// --verbose and --quiet, and with --log-file every record, debug included, to
+// that file. Warnings are kept for --json. The returned function closes the
+// log file.
+func (o *options) setupLogging() (func(), error) {
+	if o.verbose && o.quiet {
+		return nil, errors.New("--verbose and --quiet cannot be combined")
+	}
+	level := slog.LevelInfo
+	if o.verbose {
+		level = slog.LevelDebug
+	} else if o.quiet {
+		level = slog.LevelWarn
+	}
+	// git writes straight to the terminal, where it shows its progress,
+	// unless its messages must go through the log
+	if o.logFormat == "text" && !o.quiet && o.logFile == "" {
+		o.repo.Output = os.Stderr
+	}
+	console, err := o.logHandler(progress.Writer(os.Stderr), level, false)
+	if err != nil {
+		return nil, err
+	}
+	o.warnings = &warningLog{}
+	if o.logFile == "" {
+		slog.SetDefault(slog.New(warningHandler{console, o.warnings}))
+		return func() {}, nil
+	}
+
+	f, err := os.OpenFile(o.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open --log-file: %w", err)
+	}
+	file, err := o.logHandler(f, slog.LevelDebug, true)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	slog.SetDefault(slog.New(warningHandler{teeHandler{console, file}, o.warnings}))
+	return func() { f.Close() }, nil
+}
+
+// logHandler returns a handler writing records of at least level to w in the
+// --log-format. Console text leaves out timestamps to stay readable.
+func (o *options) logHandler(w io.Writer, level slog.Level, timestamps bool) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch o.logFormat {
+	case "text":
+		if !timestamps {
+			opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return a
+			}
+		}
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("unknown --log-format %q, expected text or json", o.logFormat)
+}
+
+// teeHandler passes records on to several handlers, each with its own level
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// warningLog keeps the warnings logged during the run
+type warningLog struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+// list returns the warnings logged so far
+func (l *warningLog) list() []string {
+	if l == nil {
+		return []string{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string{}, l.messages...)
+}
+
+// warningHandler passes records on to a handler and keeps the warnings, with
+// their attributes in key=value form, in a warningLog
+type warningHandler struct {
+	slog.Handler
+	log *warningLog
+}
+
+func (h warningHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level == slog.LevelWarn || h.Handler.Enabled(ctx, level)
+}
+
+func (h warningHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelWarn {
+		var sb strings.Builder
+		sb.WriteString(r.Message)
+		r.Attrs(func(a slog.Attr) bool {
+			fmt.Fprintf(&sb, " %s=%v", a.Key, a.Value)
+			return true
+		})
+		h.log.mu.Lock()
+		h.log.messages = append(h.log.messages, sb.String())
+		h.log.mu.Unlock()
+	}
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h warningHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return warningHandler{h.Handler.WithAttrs(attrs), h.log}
+}
+
+func (h warningHandler) WithGroup(name string) slog.Handler {
+	return warningHandler{h.Handler.WithGroup(name), h.log}
+}
@@ -1,394 +1,633 @@
 package main
 
 import (
+	"cmp"
+	"flag"
 	"fmt"
-	"github.com/PuerkitoBio/goquery"
-	"github.com/SebastiaanKlippert/go-wkhtmltopdf"
-	"io/ioutil"
-	"log"
+	"io"
+	"log/slog"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
-	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"i2pdoc2pdf/fetcher"
+	"i2pdoc2pdf/htmlproc"
+	"i2pdoc2pdf/renderer"
+	"i2pdoc2pdf/sam"
 )
 
-// findHTMLFiles returns a slice of HTML files, checking for index.html in directories
-func findHTMLFiles(baseDir string) ([]string, error) {
-	var files []string
-	err := filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Error accessing path %s: %v", path, err)
-			return nil
-		}
+// version is the version of the tool, named in the colophon. Release builds
+// set it with -ldflags "-X main.version=...".
+var version = "dev"
+
+// options holds the settings of all subcommands; each subcommand registers
+// only the flags it uses
+type options struct {
+	repo             fetcher.RepositoryInfo
+	sparse           bool
+	sparsePaths      string
+	specs            bool
+	copyOpts         fetcher.CopyOptions
+	inputDir         string
+	outputFile       string
+	outputTemplate   string // --output before its placeholders are filled in
+	lang             string
+	withLangs        string
+	translationsDir  string
+	sitePath         string
+	siteURL          string
+	tocStyle         string
+	outlineDepth     uint
+	tocDepth         uint
+	numbering        string
+	engine           string
+	preflight        bool
+	chromePath       string
+	renderTimeout    time.Duration
+	renderMemory     string
+	mirrors          string
+	format           string
+	htmlOutput       string
+	htmlTemplate     string // Likewise for --html-output
+	keepIntermediate bool
+	workDir          string
+	dryRun           bool
+	diffFrom         string
+	diffFull         bool
+	changes          *docChanges // Pages changed since --from, for diff
+	profile          string
+	listen           string
+	metricsListen    string
+	pprof            bool
+	rebuildEvery     time.Duration
+	samBridge        string
+	keysFile         string
+	splitRender      bool
+	pageRefs         bool
+	attachSources    string
+	bundle           string
+	latest           string
+	latestCopy       bool
+	keepBuilds       int
+	targets          string
+	benchRuns        int
+	benchCached      bool
+	benchReport      string
+	cpuProfile       string
+	memProfile       string
+	bench            *benchRecorder               // Measures the stages of the build in bench
+	targetConfigs    map[string]map[string]string // Targets of the config file, see loadTargets
+	targetBuilds     []*options                   // Options of each target built, with --targets
+	processing       *sync.Mutex                  // Held by the target processing pages, see runTargets
+	watch            bool
+	title            string
+	subtitle         string
+	logo             string
+	author           string
+	pageSize         string
+	orientation      string
+	margins          string
+	dpi              uint
+	header           string
+	theme            string
+	grayscale        bool
+	zoom             float64
+	fontSize         float64
+	fitWide          string
+	printLinks       string
+	checkLinks       bool
+	offline          bool
+	linkReport       string
+	linkReportFormat string
+	markBrokenLinks  bool
+	statsFile        string
+	reproducible     bool
+	checksums        bool
+	torrent          bool
+	trackers         string
+	webSeeds         string
+	sign             string
+	optimize         bool
+	jpegQuality      int
+	maxImageWidth    int
+	jpegImages       bool
+	targetSize       string
+	linearize        bool
+	userPassword     string
+	ownerPassword    string
+	noPrint          bool
+	noCopy           bool
+	splitBy          string
+	booklet          string
+	continuousPages  bool
+	volumeFiles      []string // PDFs of the volumes of the last build, with --split-by
+	pagePDFs         string
+	pageFiles        []string // PDFs of the pages of the last build, with --page-pdfs
+	onError          string
+	errorReport      string
+	pageErrors       []htmlproc.PageError // Pages that failed to process in the last build
+	pdfa             bool
+	iccProfile       string
+	sourceDate       time.Time // Date of a reproducible build, zero for now
+	css              string
+	fontFamily       string
+	fonts            string
+	footer           string
+	subject          string
+	keywords         string
+	watchDelay       time.Duration
+	cleanClone       bool
+	cleanDocs        bool
+	cleanCache       bool
+	configFile       string
+	orderFile        string
+	navFile          string
+	include          string
+	exclude          string
+	boilerplate      string
+	i2pVersion       string
+	urlMap           string
+	sanitize         string
+	sanitizeRemove   string
+	sanitizeKeep     string
+	sanitizeAttrs    string
+	staticDirs       string
+	svgTool          string
+	svgDPI           float64
+	rstTool          string
+	mathTool         string
+	mathCSS          string // Stylesheet of the typeset formulas
+	diagrams         bool
+	withProposals    bool
+	minWords         int
+	skipRedirects    bool
+	sources          []sourceConfig
+	partTitle        string
+	listFigures      bool
+	glossary         bool
+	changelogDays    uint
+	lastUpdated      bool
+	sourceNotes      bool
+	headings         bool
+	i2p              bool
+	source           string
+	baseURL          string
+	crawlDepth       int
+	crawlDelay       time.Duration
+	cacheDir         string
+	force            bool
+	jobs             int
+	verbose          bool
+	quiet            bool
+	logFile          string
+	logFormat        string
+	jsonResult       bool
+	stdout           io.Writer   // Where reports are printed: stdout, stderr with --json
+	warnings         *warningLog // Warnings logged, for --json
+	built            bool        // Whether a build wrote its outputs
+
+	set  map[string]bool // Flags given on the command line or in --config
+	args []string        // The command line, for the options of --targets
+}
 
-		// If it's a directory, look for index.html
-		if info.IsDir() {
-			indexPath := filepath.Join(path, "index.html")
-			if _, err := os.Stat(indexPath); err == nil {
-				log.Printf("Found index.html in directory: %s", path)
-				files = append(files, indexPath)
-			}
-			return nil
-		}
+// commonFlags registers the flags shared by every subcommand
+func (o *options) commonFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.cacheDir, "cache-dir", defaultCacheDir(), "Directory of the clones, the copied docs, processed pages and build stamps kept between runs")
+	fs.StringVar(&o.configFile, "config", "", "YAML file of flag values; flags given on the command line take precedence")
+	fs.StringVar(&o.repo.CloneDir, "clone-dir", "", "Local directory to clone the repository into (default <cache-dir>/clones/<repo>@<ref>)")
+	fs.StringVar(&o.inputDir, "input", "", "Directory of the HTML docs, setting it makes all skip cloning (default <cache-dir>/docs/<repo>@<ref>)")
+	fs.StringVar(&o.outputFile, "output", "i2p-documentation.pdf", "Path of the generated PDF (i2p-documentation.<lang>.pdf with --lang), may name {ref}, {commit}, {date}, {time} and {lang}")
+	fs.StringVar(&o.lang, "lang", "", "Translate the documentation into this language, e.g. de or pt_BR")
+	fs.StringVar(&o.withLangs, "with-langs", "", "Comma-separated languages to follow each page with its translation into, for a bilingual edition, e.g. es or es,de")
+	fs.StringVar(&o.repo.URL, "repo", "https://github.com/i2p/i2p.www.git", "Git URL of the i2p.www repository (or a fork/mirror)")
+	fs.StringVar(&o.repo.Branch, "branch", "master", "Branch of the repository to pull")
+	fs.StringVar(&o.repo.Ref, "ref", "", "Commit, tag or release of i2p.www to fetch instead of the tip of --branch; it is named on the title page")
+	fs.BoolVar(&o.verbose, "verbose", false, "Also log debug details, such as every page processed")
+	fs.BoolVar(&o.quiet, "quiet", false, "Only log warnings and errors")
+	fs.StringVar(&o.logFile, "log-file", "", "Also append every log record, debug included, to this file")
+	fs.StringVar(&o.logFormat, "log-format", "text", "Log format: text or json")
+	fs.BoolVar(&o.jsonResult, "json", false, "Print a JSON summary of the run (status, outputs, page count, warnings, duration) to stdout when it ends")
+}
 
-		// If it's a file with .html extension (but not index.html in subdirectories)
-		if !info.IsDir() && strings.HasSuffix(strings.ToLower(path), ".html") {
-			dir := filepath.Dir(path)
-			filename := filepath.Base(path)
-			// Only include non-index.html files at the root level
-			if dir == baseDir || filename != "index.html" {
-				log.Printf("Found HTML file: %s", path)
-				files = append(files, path)
-			}
-		}
+// fetchFlags registers the flags for cloning and copying the docs
+func (o *options) fetchFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.source, "source", "git", "Where the docs come from: git (clone i2p.www) or web (crawl the rendered pages at --base-url)")
+	fs.StringVar(&o.baseURL, "base-url", "https://geti2p.net/en/docs", "Website section crawled by --source web")
+	fs.IntVar(&o.crawlDepth, "crawl-depth", 5, "Number of links --source web follows from --base-url (0 for no limit)")
+	fs.DurationVar(&o.crawlDelay, "crawl-delay", time.Second, "Pause between requests of --source web")
+	fs.BoolVar(&o.sparse, "sparse", true, "Fetch only the --sparse-paths subtrees instead of the whole repository")
+	fs.StringVar(&o.sparsePaths, "sparse-paths", "i2p2www/pages/site/docs,i2p2www/pages/global,i2p2www/static,i2p2www/spec", "Comma-separated subtrees to check out in sparse mode")
+	fs.BoolVar(&o.specs, "specs", true, "Also copy the specifications and proposals ("+fetcher.DefaultSpecsPath+") into the docs, under "+htmlproc.SpecsPath+"/")
+	fs.IntVar(&o.repo.Depth, "depth", 1, "History depth to fetch in sparse mode (0 for full history)")
+	fs.StringVar(&o.repo.Proxy, "proxy", "", "HTTP or SOCKS proxy for git, e.g. http://127.0.0.1:4444 or socks5h://127.0.0.1:4447")
+	fs.StringVar(&o.mirrors, "mirrors", strings.Join(fetcher.DefaultMirrors, ","), "Comma-separated URLs of mirrors of the repository, tried in order when --repo cannot be reached (eepsites through the I2P proxy)")
+	fs.DurationVar(&o.repo.Timeout, "git-timeout", 10*time.Minute, "Stop a git command that runs longer than this (0 for no limit)")
+	fs.IntVar(&o.repo.Retries, "git-retries", 3, "Retry a failed git clone, pull or fetch this many times, waiting longer each time")
+	fs.BoolVar(&o.i2p, "i2p", false, "Fetch over I2P: clone from "+fetcher.I2PRepoURL+" through the router's HTTP proxy (unless --repo/--proxy are set)")
+	fs.BoolVar(&o.copyOpts.FollowSymlinks, "follow-symlinks", false, "Copy the targets of symlinks instead of recreating the links")
+	fs.BoolVar(&o.copyOpts.DryRun, "copy-dry-run", false, "Only log what copying the docs would do")
+}
 
-		return nil
-	})
+// buildFlags registers the flags for processing and rendering the docs
+func (o *options) buildFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.translationsDir, "translations", "", "Directory of i2p.www translation catalogs (default <clone-dir>/i2p2www/translations)")
+	fs.StringVar(&o.sitePath, "site-path", "docs", "URL path of the input directory on the website, used to recognize internal links")
+	fs.StringVar(&o.siteURL, "site-url", "https://geti2p.net", "Base URL of the website, used to recognize internal absolute links")
+	fs.StringVar(&o.tocStyle, "toc", "pages", "Table of contents style: pages (generated by wkhtmltopdf, with page numbers), links (hyperlinked list only) or none")
+	fs.UintVar(&o.tocDepth, "toc-depth", 0, "Number of levels in the table of contents, counting the top-level sections as 1 (0 for all of them)")
+	fs.StringVar(&o.numbering, "numbering", "none", "Number chapters and sections in headings, the TOC and bookmarks: none, decimal (1.2.3) or appendix (1.2.3, with the appendices lettered A, B...)")
+	fs.UintVar(&o.outlineDepth, "outline-depth", 4, "Number of heading levels to include in the PDF bookmarks")
+	fs.StringVar(&o.engine, "engine", "auto", "PDF rendering engine: auto, wkhtmltopdf, chrome (headless Chromium via chromedp) or native (pure Go, reduced fidelity)")
+	fs.BoolVar(&o.preflight, "preflight", false, "Report which rendering engines are available and exit")
+	fs.StringVar(&o.chromePath, "chrome-path", "", "Chrome/Chromium executable for --engine chrome (default: search PATH)")
+	fs.DurationVar(&o.renderTimeout, "render-timeout", 30*time.Minute, "Stop wkhtmltopdf or Chrome if rendering a document takes longer than this (0 for no limit)")
+	fs.StringVar(&o.renderMemory, "render-memory", "", "Stop wkhtmltopdf or Chrome once it uses more memory than this, e.g. 1G, and render chapter by chapter instead (Linux only)")
+	fs.StringVar(&o.format, "format", "pdf", "Output format: pdf, html (a single self-contained HTML file), both, or epub (an EPUB 3 book, written to --output with the extension .epub)")
+	fs.StringVar(&o.htmlOutput, "html-output", "", "Path of the self-contained HTML (default <output>.standalone.html), with the placeholders of --output")
+	fs.StringVar(&o.latest, "latest", "", "Also point this file at the output, e.g. i2p-docs-latest.pdf next to a templated --output, with a symbolic link")
+	fs.BoolVar(&o.latestCopy, "latest-copy", false, "Make --latest a copy rather than a symbolic link, for servers that don't follow links")
+	fs.IntVar(&o.keepBuilds, "keep-builds", 0, "Keep the outputs of the last N builds next to --output, listed in builds.json for serve, and delete older ones (0 keeps no history)")
+	fs.StringVar(&o.targets, "targets", "", "Comma-separated targets of the config file to build in one run, e.g. a4,letter,de, or all of them with all; they share the fetch and processed pages and render concurrently")
+	fs.IntVar(&o.jobs, "jobs", 0, "Number of pages processed in parallel (default: one per CPU)")
+	fs.BoolVar(&o.force, "force", false, "Process every page and render the PDF even if nothing changed since the last build")
+	fs.StringVar(&o.title, "title", htmlproc.DefaultTitle, "Title of the document, on the title page and in the PDF metadata")
+	fs.StringVar(&o.subtitle, "subtitle", "", "Subtitle shown on the title page")
+	fs.StringVar(&o.logo, "logo", "", "Image shown on the title page (default: the I2P logo from --static; none for no logo)")
+	fs.StringVar(&o.pageSize, "page-size", "A4", "Paper size: A3, A4, A5, A6, B5, Letter, Legal or <width>x<height>mm")
+	fs.StringVar(&o.orientation, "orientation", "portrait", "Page orientation: portrait or landscape")
+	fs.StringVar(&o.margins, "margins", "20", "Page margins in mm: one value for all sides, or top/bottom right/left, or top right/left bottom, or top right bottom left")
+	fs.UintVar(&o.dpi, "dpi", 96, "Resolution wkhtmltopdf lays pages out at; higher values make content smaller")
+	fs.StringVar(&o.theme, "theme", htmlproc.DefaultTheme, "Print theme: "+strings.Join(htmlproc.Themes(), ", "))
+	fs.BoolVar(&o.grayscale, "grayscale", false, "Print in shades of gray, with images in gray and links underlined, for monochrome printers")
+	fs.Float64Var(&o.zoom, "zoom", 1, "Scale the content by this factor, e.g. 1.3 for large print or 0.8 to fit more on a page (Chrome: 0.1 to 2)")
+	fs.Float64Var(&o.fontSize, "font-size", 0, "Size of the body text in points, e.g. 14 for large print (0 keeps the theme's)")
+	fs.StringVar(&o.css, "css", "", "Comma-separated stylesheets applied after the theme")
+	fs.StringVar(&o.fontFamily, "font-family", "", "CSS font-family of the text (default: the --font families, then fonts suited to --lang)")
+	fs.StringVar(&o.fonts, "font", "", "Comma-separated font files to embed, each as file or Family=file, e.g. \"Noto Sans SC=NotoSansSC-Regular.otf\"")
+	fs.StringVar(&o.fitWide, "fit-wide", "none", "Code blocks and tables wider than the page: none, scale (shrink them to fit) or rotate (also put wide tables on landscape pages, Chrome only)")
+	fs.StringVar(&o.printLinks, "print-links", "none", "Spell out external links for printing: none, footnotes (numbered, listed at the end of each page) or list (listed at the end of each page)")
+	fs.BoolVar(&o.checkLinks, "check-links", false, "Check the links of the pages and report the broken ones")
+	fs.BoolVar(&o.offline, "offline", false, "With --check-links, only check links within the document, not other websites")
+	fs.StringVar(&o.linkReport, "link-report", "", "File to write the --check-links report to (default: standard output)")
+	fs.StringVar(&o.linkReportFormat, "link-report-format", "text", "Format of the --check-links report: text or json")
+	fs.BoolVar(&o.markBrokenLinks, "mark-broken-links", false, "With --check-links, highlight broken links in the document")
+	fs.StringVar(&o.statsFile, "stats", "", "Write a JSON summary of the build (pages, words, images, missing images, PDF pages and size, per section) to this file")
+	fs.StringVar(&o.onError, "on-error", "continue", "What to do when a page fails to process: continue (leave it out, summarize the failures at the end and exit with status 6) or fail (stop the build)")
+	fs.StringVar(&o.errorReport, "error-report", "", "Write the pages that failed to process to this file as JSON")
+	fs.BoolVar(&o.reproducible, "reproducible", false, "Make the PDF byte-for-byte the same for the same docs: date it SOURCE_DATE_EPOCH, or the commit time, and derive its ID from its content")
+	fs.BoolVar(&o.torrent, "torrent", false, "Write a torrent of the outputs to <output>.torrent, for I2PSnark and other clients")
+	fs.StringVar(&o.trackers, "trackers", defaultTrackers, "Comma-separated announce URLs of the --torrent, I2P trackers by default")
+	fs.StringVar(&o.webSeeds, "web-seeds", "", "Comma-separated URLs the --torrent's files can also be downloaded from, e.g. an eepsite from publish")
+	fs.BoolVar(&o.checksums, "checksums", false, "Write the SHA-256 sums of the outputs to <output>.sha256, in the format of sha256sum")
+	fs.StringVar(&o.sign, "sign", "", "Write checksums and sign them and the outputs with this GPG key ID (default for gpg's default key), or ssh:<key file> to sign with ssh-keygen")
+	fs.StringVar(&o.bundle, "bundle", "", "Also package the outputs, a JSON manifest of the pages, the license files and checksums into <output>-<version>.zip (zip) or .tar.gz (tar)")
+	fs.StringVar(&o.splitBy, "split-by", "none", "Split the PDF into volumes: none, or top-level-dir for one PDF per top-level section plus a master index at --output")
+	fs.StringVar(&o.attachSources, "attach-sources", "none", "Embed the source files of the pages in the PDF: pages (one attachment each), zip (one archive) or none")
+	fs.StringVar(&o.booklet, "booklet", "", "Also write a -booklet.pdf of the PDF (each volume with --split-by) imposed two pages per side of sheets of this paper size, e.g. A4 or Letter, for saddle-stitch binding")
+	fs.BoolVar(&o.continuousPages, "continuous-numbering", false, "With --split-by, number the pages of each volume on from the previous one")
+	fs.StringVar(&o.pagePDFs, "page-pdfs", "", "Also write a PDF of each page into this directory, mirroring the docs tree (e.g. transport/ntcp2.pdf)")
+	fs.BoolVar(&o.optimize, "optimize", false, "Shrink the PDF: merge duplicate fonts and images and recompress images")
+	fs.IntVar(&o.jpegQuality, "jpeg-quality", renderer.DefaultQuality, "JPEG quality --optimize and --jpeg-images recompress images at, 1-100")
+	fs.StringVar(&o.targetSize, "target-size", "", "With --optimize, lower the image quality until the PDF is at most this size, e.g. 5MB")
+	fs.BoolVar(&o.linearize, "linearize", false, "Linearize the PDF for fast web viewing (needs qpdf)")
+	fs.BoolVar(&o.pdfa, "pdfa", false, "Convert the PDF to PDF/A-2b for archiving: embed all fonts, add XMP metadata and an sRGB output intent (needs Ghostscript)")
+	fs.StringVar(&o.iccProfile, "icc-profile", "", "sRGB ICC profile for the --pdfa output intent (default: the one installed with Ghostscript or the system)")
+	fs.StringVar(&o.userPassword, "user-password", "", "Encrypt the PDF so that it needs this password to open")
+	fs.StringVar(&o.ownerPassword, "owner-password", "", "Encrypt the PDF with this password for changing it and lifting --no-print and --no-copy")
+	fs.BoolVar(&o.noPrint, "no-print", false, "Encrypt the PDF and don't allow printing it (needs --owner-password)")
+	fs.BoolVar(&o.noCopy, "no-copy", false, "Encrypt the PDF and don't allow copying text and images from it (needs --owner-password)")
+	fs.StringVar(&o.header, "header", renderer.DefaultHeader, "Running header: left|center|right parts using {page}, {pages}, {section}, {title}, {date} and {commit} (empty for none)")
+	fs.StringVar(&o.footer, "footer", "", "Running footer, like --header")
+	fs.StringVar(&o.author, "author", "The I2P Project", "Author recorded in the PDF metadata")
+	fs.StringVar(&o.subject, "subject", "", "Subject recorded in the PDF metadata")
+	fs.StringVar(&o.keywords, "keywords", "I2P, anonymity, privacy, networking", "Comma-separated keywords recorded in the PDF metadata")
+	fs.BoolVar(&o.watch, "watch", false, "Keep running and rebuild whenever a file in --input or the navigation template changes")
+	fs.DurationVar(&o.watchDelay, "watch-delay", 500*time.Millisecond, "With --watch, how long files must stay unchanged before rebuilding")
+	fs.BoolVar(&o.splitRender, "split-render", false, "Render each chapter separately, --jobs at a time, and merge them (needs less memory for large docs)")
+	fs.BoolVar(&o.pageRefs, "page-refs", false, "Follow links within the document with the section number and page of their target, e.g. (§3.2, p. 147), rendering the PDF twice or more")
+	fs.BoolVar(&o.keepIntermediate, "keep-intermediate", false, "Keep the combined HTML file next to the PDF")
+	fs.StringVar(&o.metricsListen, "metrics", "", "Address to serve Prometheus metrics of the builds on at /metrics, e.g. 127.0.0.1:9090, for --watch, serve and update")
+	fs.BoolVar(&o.pprof, "pprof", false, "Also serve Go profiles at /debug/pprof/ on the --metrics address")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Only list the pages in reading order, the images they use and the estimated size, without fetching or rendering")
+	fs.StringVar(&o.workDir, "workdir", "", "Directory to write and keep the intermediate files in, for debugging (default: a temporary directory)")
+	fs.StringVar(&o.orderFile, "order", "", "File listing page paths in reading order, or a YAML or JSON chapter manifest with titles and parts (default: follow the site navigation)")
+	fs.StringVar(&o.include, "include", "", "Comma-separated page patterns to include, e.g. spec/** (globs, or regular expressions prefixed with re:)")
+	fs.StringVar(&o.exclude, "exclude", "", "Comma-separated page patterns to leave out, e.g. how/tech-intro")
+	fs.StringVar(&o.boilerplate, "boilerplate", htmlproc.DefaultBoilerplate, "CSS selectors of site navigation, footers etc. to remove from every page (empty keeps everything)")
+	fs.StringVar(&o.sanitize, "sanitize", htmlproc.DefaultSanitize, "Rules for stripping pages: "+strings.Join(htmlproc.SanitizeProfiles(), ", "))
+	fs.StringVar(&o.sanitizeRemove, "sanitize-remove", "", "CSS selectors of elements to remove from every page instead of those of --sanitize")
+	fs.StringVar(&o.sanitizeKeep, "sanitize-keep", "", "CSS selectors of elements to keep although --sanitize or --boilerplate would remove them, e.g. \"table style\"")
+	fs.StringVar(&o.sanitizeAttrs, "sanitize-attrs", "", "Comma-separated attributes to keep instead of those of --sanitize, e.g. class,colspan,data-* (id, href, src and alt are always kept)")
+	fs.StringVar(&o.i2pVersion, "i2p-version", "", "I2P release the ver() template helper prints (default: CURRENT_I2P_VERSION of <clone-dir>/i2p2www/__init__.py)")
+	fs.StringVar(&o.urlMap, "url-map", "", "Comma-separated endpoint=URL pairs for url_for() and get_url() in addition to the i2p2www ones, e.g. blog_post=/blog/post/{slug}")
+	fs.StringVar(&o.staticDirs, "static", "", "Comma-separated directories searched for images the pages reference (default <clone-dir>/i2p2www/static)")
+	fs.StringVar(&o.svgTool, "svg", "go", "Convert SVG images to PNG with: go (built-in), rsvg-convert, or none to keep them as SVG")
+	fs.Float64Var(&o.svgDPI, "svg-dpi", 192, "Resolution of SVG images converted to PNG")
+	fs.IntVar(&o.maxImageWidth, "max-image-width", 0, "Scale PNG and JPEG images wider than this many pixels down, e.g. 1200 for 150 DPI print (0 keeps them)")
+	fs.BoolVar(&o.jpegImages, "jpeg-images", false, "Convert photo-like PNG images to JPEG and recompress JPEG images at --jpeg-quality")
+	fs.StringVar(&o.rstTool, "rst", "go", "Convert reStructuredText pages with: go (built-in), rst2html, pandoc, or none to leave them out")
+	fs.StringVar(&o.mathTool, "math", "auto", "Typeset LaTeX formulas with: katex, tex2svg (MathJax), auto for the first found, or none to leave them as source")
+	fs.BoolVar(&o.diagrams, "diagrams", true, "Draw mermaid and dot (Graphviz) code blocks, and images of .mmd, .dot and .gv files, with mmdc and dot; diagrams whose command is missing stay code")
+	fs.BoolVar(&o.listFigures, "list-of-figures", false, "Number the images that have a caption or alt text per chapter, caption them and list them after the TOC")
+	fs.BoolVar(&o.glossary, "glossary", false, "Collect the terms of the definition lists of all pages into an alphabetized glossary chapter at the end, linking to the pages using them")
+	fs.UintVar(&o.changelogDays, "changelog", 0, "Append a changelog chapter of the commits touching the docs in the N days up to the checked out commit, with the pages they changed (0 none)")
+	fs.BoolVar(&o.sourceNotes, "source-notes", true, "End each page with its URL on the website and its source file, so readers can find the live version")
+	fs.BoolVar(&o.lastUpdated, "last-updated", false, "Print below the heading of each page the date of the last commit that changed its source")
+	fs.BoolVar(&o.headings, "normalize-headings", true, "Move the headings of each page below its own heading, so chapter titles are h2 and page headings nest under them")
+	fs.StringVar(&o.partTitle, "part-title", "I2P", "Title of the part holding the i2p.www docs when the config file lists other sources")
+	fs.BoolVar(&o.withProposals, "with-proposals", false, "Include the proposals ("+htmlproc.ProposalsPath+"/) as an appendix ordered by number, with their status in the TOC")
+	fs.IntVar(&o.minWords, "min-words", 10, "Leave out pages with fewer words and no images, tables or code, such as stubs (0 to keep them)")
+	fs.BoolVar(&o.skipRedirects, "skip-redirects", true, "Leave out pages that only redirect to another page with a meta refresh")
+	fs.StringVar(&o.navFile, "nav", "", "Navigation template giving the reading order (default <clone-dir>/i2p2www/pages/global/nav.html)")
+}
 
-	return files, err
+// cleanFlags registers the flags choosing what clean removes
+func (o *options) cleanFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.cleanClone, "clone", true, "Remove the clone of the repository")
+	fs.BoolVar(&o.cleanDocs, "docs", true, "Remove the docs copied to --input")
+	if fs.Lookup("workdir") == nil {
+		// Already defined where the build flags are too, as for --config
+		fs.StringVar(&o.workDir, "workdir", "", "Also remove the intermediate files builds kept in this --workdir")
+	}
+	fs.BoolVar(&o.cleanCache, "cache", false, "Remove all of --cache-dir: the clones and docs of every repository and ref, processed pages and build stamps")
 }
 
-// IGNORE THIS (notes): wget http://archive.ubuntu.com/ubuntu/pool/main/o/openssl/libssl1.1_1.1.1f-1ubuntu2.23_amd64.deb
-// cleanupDownloadDir removes incomplete or failed downloads
-func cleanupDownloadDir(dir string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+// parse parses args, fills in the remaining flags from --config and applies
+// the defaults that depend on other flags
+func (o *options) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	o.args = args
+	if o.configFile != "" {
+		if err := applyConfig(fs, o.configFile); err != nil {
+			return err
+		}
+		sources, err := loadSources(o.configFile)
 		if err != nil {
 			return err
 		}
-		// Remove temporary wget files
-		if strings.HasSuffix(path, ".tmp") || strings.HasSuffix(path, ".wget") {
-			if err := os.Remove(path); err != nil {
-				return fmt.Errorf("failed to remove temporary file %s: %w", path, err)
-			}
+		o.sources = sources
+		if o.targetConfigs, err = loadTargets(o.configFile); err != nil {
+			return err
 		}
-		return nil
+	}
+	o.set = map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		o.set[f.Name] = true
 	})
-}
-
-// RepositoryInfo holds information about the Git repository
-type RepositoryInfo struct {
-	URL      string // e.g., "https://github.com/username/i2p.www.git"
-	Branch   string // e.g., "main"
-	CloneDir string // Local directory to clone into
-}
-
-// ExecuteCommand runs a shell command and returns its output or an error
-func ExecuteCommand(dir string, name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
 
-	// Run the command and capture any errors
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("command failed: %s %v, error: %v", name, args, err)
+	o.repo.SparsePaths = splitList(o.sparsePaths)
+	if o.source == "web" {
+		// Crawled pages link to the crawled site
+		if u, err := url.Parse(o.baseURL); err == nil {
+			if !o.set["site-url"] {
+				o.siteURL = u.Scheme + "://" + u.Host
+			}
+			if !o.set["site-path"] {
+				o.sitePath = langSegment.ReplaceAllString(strings.Trim(u.Path, "/"), "")
+			}
+		}
 	}
-	return nil
-}
-
-func CloneRepo(repo RepositoryInfo) error {
-	// Ensure the clone directory exists
-	if _, err := os.Stat(repo.CloneDir); os.IsNotExist(err) {
-		err := os.MkdirAll(repo.CloneDir, 0755)
-		if err != nil {
-			return fmt.Errorf("failed to create directory %s: %v", repo.CloneDir, err)
+	if o.i2p {
+		if !o.set["repo"] {
+			o.repo.URL = fetcher.I2PRepoURL
+		}
+		if !o.set["proxy"] {
+			o.repo.Proxy = fetcher.I2PProxy
+		}
+		if !o.set["base-url"] {
+			o.baseURL = fetcher.I2PSiteURL + "/en/docs"
 		}
 	}
-
-	// Step 1: Initialize the Git repository
-	fmt.Println("Initializing Git repository...")
-	if err := ExecuteCommand(repo.CloneDir, "git", "init"); err != nil {
-		return err
+	// The default mirrors are of i2p.www, not of another --repo
+	if !o.set["repo"] || o.set["mirrors"] {
+		for _, mirror := range splitList(o.mirrors) {
+			if mirror != o.repo.URL {
+				o.repo.Mirrors = append(o.repo.Mirrors, mirror)
+			}
+		}
 	}
-
-	// Step 2: Add remote origin
-	fmt.Println("Adding remote origin...")
-	if err := ExecuteCommand(repo.CloneDir, "git", "remote", "add", "origin", repo.URL); err != nil {
-		return err
+	// Clones and copied docs are kept in the cache, one per repository and ref
+	key := cacheKey(o.repo.URL, cmp.Or(o.repo.Ref, o.repo.Branch))
+	if o.repo.CloneDir == "" {
+		o.repo.CloneDir = filepath.Join(o.cacheDir, "clones", key)
 	}
-
-	// Step 5: Pull the specified branch
-	fmt.Printf("Pulling branch '%s'...\n", repo.Branch)
-	if err := ExecuteCommand(repo.CloneDir, "git", "pull", "origin", repo.Branch); err != nil {
-		return err
+	if o.inputDir == "" {
+		o.inputDir = filepath.Join(o.cacheDir, "docs", key)
 	}
-
-	fmt.Println("Sparse clone completed successfully.")
-	return nil
-}
-
-func copyDir(source, destination string) {
-	// Define the source and destination paths
-	//source := "./i2p-www-docs/i2p2www/pages/site/docs"
-	//destination := "./docs"
-
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "windows":
-		if _, err := os.Stat(destination); os.IsNotExist(err) {
-			err := os.MkdirAll(destination, 0755)
-			if err != nil {
-				log.Fatalf("Failed to create destination directory: %v", err)
-			}
+	if o.lang != "" {
+		if !o.set["output"] {
+			o.outputFile = fmt.Sprintf("i2p-documentation.%s.pdf", o.lang)
 		}
-		cmd = exec.Command("robocopy", source, destination, "/E", "/COPYALL", "/MOVE", "/R:1", "/W:1")
-		// Option 2: Using PowerShell's Copy-Item
-		/*
-			cmd = exec.Command("powershell", "-Command",
-				fmt.Sprintf("Copy-Item -Path '%s' -Destination '%s' -Recurse -Force", source, destination))
-		*/
-	default:
-		// Assume Unix-like system, use cp -r
-		cmd = exec.Command("cp", "-r", source, destination)
 	}
+	if o.lang != "" || o.targetsTranslate() {
+		o.repo.SparsePaths = append(o.repo.SparsePaths, "i2p2www/translations")
+	}
+	return nil
+}
 
-	// Set the standard output and error to the program's output
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	fmt.Printf("Executing command: %v\n", cmd.Args)
+// langSegment matches the language at the start of an i2p.www URL path
+var langSegment = regexp.MustCompile(`^[a-z]{2}(_[A-Z]{2})?(/|$)`)
 
-	// Run the command
-	err := cmd.Run()
+// defaultCacheDir returns the directory of i2pdoc2pdf in the user's cache
+// directory, e.g. ~/.cache/i2pdoc2pdf or $XDG_CACHE_HOME/i2pdoc2pdf on Linux,
+// or one in the working directory if the user has none
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
 	if err != nil {
-		log.Fatalf("Command execution failed: %v", err)
+		return ".i2pdoc2pdf-cache"
 	}
+	return filepath.Join(dir, "i2pdoc2pdf")
+}
 
-	fmt.Println("Directory copied successfully.")
+// cacheKey names the cache entries of a repository and ref, e.g.
+// "github.com-i2p-i2p.www.git@master"
+func cacheKey(repo, ref string) string {
+	if u, err := url.Parse(repo); err == nil && u.Host != "" {
+		repo = u.Host + u.Path
+	}
+	key := cacheKeyChars.ReplaceAllString(strings.Trim(repo, "/"), "-")
+	if key == "" {
+		key = "default"
+	}
+	if ref != "" {
+		key += "@" + cacheKeyChars.ReplaceAllString(ref, "-")
+	}
+	return key
 }
 
-// replaceURLForPlaceholders replaces {{ url_for('static', filename='path/to/image.png') }} with the relative path
-func replaceURLForPlaceholders(doc *goquery.Document) {
-	// Regular expression to match the url_for pattern
-	re := regexp.MustCompile(`{{\s*url_for\(\s*'static'\s*,\s*filename\s*=\s*'([^']+)'\s*\)\s*}}`)
+// cacheKeyChars matches what cacheKey replaces to make file names
+var cacheKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
 
-	// Find all img tags
-	doc.Find("img").Each(func(i int, s *goquery.Selection) {
-		src, exists := s.Attr("src")
-		if exists {
-			// Check if src matches the url_for pattern
-			matches := re.FindStringSubmatch(src)
-			if len(matches) == 2 {
-				// matches[1] contains the filename
-				newSrc := matches[1]
-				s.SetAttr("src", newSrc)
-				log.Printf("Replaced img src with relative path: %s", newSrc)
-			}
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
-	})
+	}
+	return items
 }
 
-func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	// Get docs
-	// Define the repository information
-	repo := RepositoryInfo{
-		URL:      "https://github.com/i2p/i2p.www.git",
-		Branch:   "master",
-		CloneDir: "i2p-www-docs", // Local directory name
+// parseSize parses a size in bytes with an optional k, M or G suffix (powers
+// of 1024), e.g. "800k" or "5MB"
+func parseSize(value string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
 	}
-
-	// Get absolute path for CloneDir
-	absPath, err := filepath.Abs(repo.CloneDir)
-	if err != nil {
-		log.Fatalf("Failed to get absolute path: %v", err)
+	if unit > 1 {
+		s = s[:len(s)-1]
 	}
-	repo.CloneDir = absPath
-
-	// Start the sparse clone process
-	// Check if the clone directory already exists
-	if _, err := os.Stat(repo.CloneDir); os.IsNotExist(err) {
-		// Directory does not exist, proceed to clone
-		fmt.Printf("Repository directory '%s' does not exist. Starting clone...\n", repo.CloneDir)
-		if err := CloneRepo(repo); err != nil {
-			log.Fatalf("Failed to clone repository: %v", err)
-		}
-	} else {
-		// Directory exists, skip cloning
-		fmt.Printf("Repository directory '%s' already exists. Skipping clone.\n", repo.CloneDir)
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 800k or 5MB", value)
 	}
-	/*
-		if err := CloneSparseRepo(repo); err != nil {
-			log.Fatalf("Failed to clone repository: %v", err)
-		}
-
-	*/
-
-	fmt.Printf("The '%s' directory has been successfully cloned.")
-
-	copyDir("./i2p-www-docs/i2p2www/pages/site/docs", "./docs")
+	return int64(n * float64(unit)), nil
+}
 
-	inputDir := "./docs"
-	outputFile := "i2p-documentation.pdf"
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	flags   func(o *options, fs *flag.FlagSet)
+	run     func(o *options) error
+}
 
-	// Find all HTML files
-	htmlFiles, err := findHTMLFiles(inputDir)
-	if err != nil {
-		log.Fatalf("Error finding HTML files: %v", err)
-	}
+var commands = []command{
+	{"fetch", "clone or update i2p.www and copy the docs to --input", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.fetchFlags(fs)
+	}, runFetch},
+	{"build", "process the pages in --input and render them", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.buildFlags(fs)
+	}, runBuild},
+	{"update", "pull i2p.www and rebuild only if the docs changed since the last update", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.fetchFlags(fs)
+		o.buildFlags(fs)
+	}, runUpdate},
+	{"select", "pick the sections and page settings in a terminal UI and save them to --profile", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.buildFlags(fs)
+		fs.StringVar(&o.profile, "profile", "i2pdoc2pdf.yaml", "Config file to save the selection to, for --config; its other settings are kept")
+	}, runSelect},
+	{"serve", "serve the built documentation over HTTP, rebuilding it on a schedule", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.fetchFlags(fs)
+		o.buildFlags(fs)
+		fs.StringVar(&o.listen, "listen", "127.0.0.1:8080", "Address to serve the documentation on")
+		fs.DurationVar(&o.rebuildEvery, "rebuild-every", 24*time.Hour, "How often to pull the docs and rebuild them if they changed (0 never)")
+	}, runServe},
+	{"publish", "serve the built documentation on an eepsite through the router's SAM bridge", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.fetchFlags(fs)
+		o.buildFlags(fs)
+		fs.StringVar(&o.samBridge, "sam", sam.DefaultAddress, "Address of the SAMv3 bridge of the I2P router")
+		fs.StringVar(&o.keysFile, "keys", defaultKeysFile(), "File keeping the private keys of the eepsite, created on first use; keep it to keep the address")
+		fs.DurationVar(&o.rebuildEvery, "rebuild-every", 24*time.Hour, "How often to pull the docs and rebuild them if they changed (0 never)")
+	}, runPublish},
+	{"diff", "build the pages that changed between two refs of i2p.www, with a \"What changed\" chapter", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.fetchFlags(fs)
+		o.buildFlags(fs)
+		fs.StringVar(&o.diffFrom, "from", "", "Commit, tag or branch to compare with (required)")
+		fs.StringVar(&o.repo.Ref, "to", "", "Commit, tag or branch to compare, the tip of --branch if empty; same as --ref")
+		fs.BoolVar(&o.diffFull, "full", false, "Build every page, with \"What changed\" as an appendix")
+	}, runDiff},
+	{"bench", "process the pages in --input without rendering them and report the time and memory each stage takes", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.buildFlags(fs)
+		fs.IntVar(&o.benchRuns, "runs", 3, "How many times to process the pages")
+		fs.BoolVar(&o.benchCached, "cached", false, "Take unchanged pages from the page cache as build does, instead of processing them all")
+		fs.StringVar(&o.benchReport, "report", "", "Also write the measurements to this file as JSON, for comparing runs")
+		fs.StringVar(&o.cpuProfile, "cpu-profile", "", "Write a pprof CPU profile of the runs to this file")
+		fs.StringVar(&o.memProfile, "mem-profile", "", "Write a pprof heap profile to this file after the runs")
+	}, runBench},
+	{"clean", "remove the clone, the copied docs and intermediate files", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.cleanFlags(fs)
+	}, runClean},
+	{"all", "fetch, then build (the default)", func(o *options, fs *flag.FlagSet) {
+		o.commonFlags(fs)
+		o.fetchFlags(fs)
+		o.buildFlags(fs)
+	}, runAll},
+}
 
-	if len(htmlFiles) == 0 {
-		log.Fatal("No HTML files found in directory")
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-6s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
 
-	log.Printf("Found %d HTML files to process", len(htmlFiles))
-
-	// Create combined HTML document
-	combinedHTML := strings.Builder{}
-	combinedHTML.WriteString(`
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="UTF-8">
-		<title>I2P Documentation</title>
-		<style>
-			body { 
-				font-family: Arial, sans-serif;
-				max-width: 800px;
-				margin: 0 auto;
-				padding: 20px;
-			}
-			.page-break { 
-				page-break-after: always;
-				height: 1px;
-			}
-			.chapter { 
-				margin-top: 30px;
-			}
-			pre {
-				background-color: #f5f5f5;
-				padding: 10px;
-				border-radius: 5px;
-				overflow-x: auto;
-			}
-			code {
-				font-family: monospace;
-			}
-		</style>
-	</head>
-	<body>
-	<h1>I2P Documentation</h1>
-	<div class="page-break"></div>
-`)
+// fatal logs err and exits
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
 
-	// Add table of contents
-	combinedHTML.WriteString("<h2>Table of Contents</h2><ul>")
-	for _, htmlFile := range htmlFiles {
-		// Create readable section name from file path
-		sectionName := strings.TrimPrefix(htmlFile, inputDir)
-		sectionName = strings.TrimPrefix(sectionName, "/")
-		sectionName = strings.TrimSuffix(sectionName, "/index.html")
-		sectionName = strings.TrimSuffix(sectionName, ".html")
-		sectionName = strings.ReplaceAll(sectionName, "/", " → ")
-		combinedHTML.WriteString(fmt.Sprintf("<li>%s</li>", sectionName))
+func main() {
+	// Without a subcommand, run everything as earlier versions did
+	name, args := "all", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage()
+		return
 	}
-	combinedHTML.WriteString("</ul><div class=\"page-break\"></div>")
-
-	// Process each HTML file
-	for _, htmlFile := range htmlFiles {
-		log.Printf("Processing %s", htmlFile)
 
-		content, err := ioutil.ReadFile(htmlFile)
-		if err != nil {
-			log.Printf("Error reading file %s: %v", htmlFile, err)
+	for _, c := range commands {
+		if c.name != name {
 			continue
 		}
-
-		doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(content)))
+		o := &options{}
+		fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+		c.flags(o, fs)
+		if err := o.parse(fs, args); err != nil {
+			fatal(err)
+		}
+		closeLog, err := o.setupLogging()
 		if err != nil {
-			log.Printf("Error parsing HTML from %s: %v", htmlFile, err)
-			continue
+			fatal(err)
 		}
-
-		// Clean up HTML
-		doc.Find("script").Remove()
-		doc.Find("style").Remove()
-		doc.Find("link").Remove()
-		doc.Find("meta").Remove()
-		doc.Find("iframe").Remove()
-		doc.Find("noscript").Remove()
-
-		// Replace url_for placeholders in img src attributes
-		replaceURLForPlaceholders(doc)
-
-		// Extract the body content
-		bodyContent := doc.Find("body").First()
-		if bodyContent.Length() > 0 {
-			// Create section title from file path
-			sectionName := strings.TrimPrefix(htmlFile, inputDir)
-			sectionName = strings.TrimPrefix(sectionName, "/")
-			sectionName = strings.TrimSuffix(sectionName, "/index.html")
-			sectionName = strings.TrimSuffix(sectionName, ".html")
-			sectionName = strings.ReplaceAll(sectionName, "/", " → ")
-
-			// Get HTML content and handle potential error
-			htmlContent, err := bodyContent.Html()
-			if err != nil {
-				log.Printf("Error getting HTML content from %s: %v", htmlFile, err)
-				continue
-			}
-
-			combinedHTML.WriteString(fmt.Sprintf(`
-				<div class="chapter">
-					<h2>%s</h2>
-					%s
-					<div class="page-break"></div>
-				</div>
-			`, sectionName, htmlContent))
+		if o.metricsListen != "" {
+			o.serveMetrics()
 		}
+		// Keep stdout to the result with --json
+		start := time.Now()
+		o.stdout = os.Stdout
+		if o.jsonResult {
+			o.stdout = os.Stderr
+		}
+		err = c.run(o)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+		closeLog()
+		o.printResult(c.name, start, err)
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+		return
 	}
-
-	combinedHTML.WriteString("</body></html>")
-
-	// Write combined HTML to file
-	tempFile := "combined.html"
-	err = ioutil.WriteFile(tempFile, []byte(combinedHTML.String()), 0644)
-	if err != nil {
-		log.Fatalf("Error writing combined HTML: %v", err)
-	}
-	defer os.Remove(tempFile)
-
-	// Initialize PDF generator
-	pdfg, err := wkhtmltopdf.NewPDFGenerator()
-	if err != nil {
-		log.Fatalf("Failed to create PDF generator: %v", err)
-	}
-
-	// Configure PDF settings
-	pdfg.Dpi.Set(96)
-	pdfg.MarginBottom.Set(20)
-	pdfg.MarginTop.Set(20)
-	pdfg.MarginLeft.Set(20)
-	pdfg.MarginRight.Set(20)
-	pdfg.Orientation.Set(wkhtmltopdf.OrientationPortrait)
-	pdfg.PageSize.Set(wkhtmltopdf.PageSizeA4)
-
-	// Create page from combined HTML
-	page := wkhtmltopdf.NewPage(tempFile)
-	page.EnableLocalFileAccess.Set(true)
-	page.LoadErrorHandling.Set("ignore")
-	//page.EnableJavascript.Set(false)
-	page.LoadMediaErrorHandling.Set("ignore")
-	page.HeaderRight.Set("[page]/[toPage]")
-
-	pdfg.AddPage(page)
-
-	// Generate PDF
-	log.Println("Generating PDF...")
-	err = pdfg.Create()
-	if err != nil {
-		log.Fatalf("Error creating PDF: %v", err)
-	}
-
-	// Write to file
-	log.Printf("Writing PDF to %s", outputFile)
-	err = pdfg.WriteFile(outputFile)
-	if err != nil {
-		log.Fatalf("Error writing PDF: %v", err)
-	}
-
-	log.Println("PDF generation complete!")
+	usage()
+	os.Exit(exitUsage)
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// buildMetrics counts the builds of a long-running process for --metrics
+type buildMetrics struct {
+	mu          sync.Mutex
+	succeeded   int64
+	failed      int64
+	durationSum float64 // Seconds spent in builds
+	lastSeconds float64
+	lastBuild   time.Time
+	lastSuccess time.Time
+	pages       int64 // Pages processed
+	pageErrors  int64 // Pages that failed to process
+}
+
+// metrics are those of this process
+var metrics = &buildMetrics{}
+
+// recordBuild counts a build that started at start and ended with err
+func (m *buildMetrics) recordBuild(start time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.lastSeconds = now.Sub(start).Seconds()
+	m.durationSum += m.lastSeconds
+	m.lastBuild = now
+	if err != nil {
+		m.failed++
+		return
+	}
+	m.succeeded++
+	m.lastSuccess = now
+}
+
+// recordPages counts the pages a build processed and those that failed
+func (m *buildMetrics) recordPages(pages, errors int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pages += int64(pages)
+	m.pageErrors += int64(errors)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format, along with
+// those of the Go runtime
+func (m *buildMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metric := func(name, kind, help string, values ...string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, v := range values {
+			fmt.Fprintf(w, "%s%s\n", name, v)
+		}
+	}
+	unix := func(t time.Time) string {
+		if t.IsZero() {
+			return " 0"
+		}
+		return fmt.Sprintf(" %d", t.Unix())
+	}
+	metric("i2pdoc2pdf_build_info", "gauge", "Version of i2pdoc2pdf.", fmt.Sprintf("{version=%q} 1", version))
+	metric("i2pdoc2pdf_builds_total", "counter", "Builds run, by result.",
+		fmt.Sprintf(`{result="success"} %d`, m.succeeded), fmt.Sprintf(`{result="failure"} %d`, m.failed))
+	metric("i2pdoc2pdf_build_duration_seconds", "summary", "Time spent in builds.")
+	fmt.Fprintf(w, "i2pdoc2pdf_build_duration_seconds_sum %g\ni2pdoc2pdf_build_duration_seconds_count %d\n", m.durationSum, m.succeeded+m.failed)
+	metric("i2pdoc2pdf_last_build_duration_seconds", "gauge", "Duration of the last build.", fmt.Sprintf(" %g", m.lastSeconds))
+	metric("i2pdoc2pdf_last_build_timestamp_seconds", "gauge", "When the last build ended.", unix(m.lastBuild))
+	metric("i2pdoc2pdf_last_success_timestamp_seconds", "gauge", "When the last successful build ended.", unix(m.lastSuccess))
+	metric("i2pdoc2pdf_pages_processed_total", "counter", "Pages processed by builds.", fmt.Sprintf(" %d", m.pages))
+	metric("i2pdoc2pdf_page_errors_total", "counter", "Pages that failed to process.", fmt.Sprintf(" %d", m.pageErrors))
+
+	metric("go_goroutines", "gauge", "Number of goroutines that currently exist.", fmt.Sprintf(" %d", runtime.NumGoroutine()))
+	metric("go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.", fmt.Sprintf(" %d", mem.Alloc))
+	metric("go_memstats_sys_bytes", "gauge", "Number of bytes obtained from the system.", fmt.Sprintf(" %d", mem.Sys))
+	metric("go_memstats_heap_objects", "gauge", "Number of allocated objects.", fmt.Sprintf(" %d", mem.HeapObjects))
+	metric("go_gc_cycles_total", "counter", "Number of completed GC cycles.", fmt.Sprintf(" %d", mem.NumGC))
+	metric("go_gc_pause_seconds_total", "counter", "Time spent in GC pauses.", fmt.Sprintf(" %g", float64(mem.PauseTotalNs)/1e9))
+}
+
+// serveMetrics serves /metrics, and with --pprof the profiles under
+// /debug/pprof/, on --metrics in the background
+func (o *options) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	if o.pprof {
+		// Not /debug/pprof/cmdline, the arguments may hold passwords such
+		// as --user-password
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	srv := &http.Server{Addr: o.metricsListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			slog.Error("Cannot serve metrics", "err", err)
+		}
+	}()
+	slog.Info("Serving metrics", "url", "http://"+o.metricsListen+"/metrics", "pprof", o.pprof)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"i2pdoc2pdf/fetcher"
+)
+
+// namePlaceholder matches the placeholders of --output and --html-output,
+// e.g. "{date}"
+var namePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// commitPlaceholder matches {commit} with a separator next to it, left out
+// along with it when the docs have no commit and other text remains
+var commitPlaceholder = regexp.MustCompile(`\{commit\}[-_]|[-_.]?\{commit\}`)
+
+// expandOutputs fills the placeholders of --output and --html-output in for
+// this build, so scheduled builds each write their own files, e.g.
+// "i2p-docs-{ref}-{date}-{lang}.pdf". The names as given are kept for the
+// next builds of --watch.
+func (o *options) expandOutputs() error {
+	if o.outputTemplate == "" {
+		o.outputTemplate, o.htmlTemplate = o.outputFile, o.htmlOutput
+	}
+	var err error
+	if o.outputFile, err = o.expandName(o.outputTemplate); err != nil {
+		return fmt.Errorf("invalid --output: %w", err)
+	}
+	if o.htmlOutput, err = o.expandName(o.htmlTemplate); err != nil {
+		return fmt.Errorf("invalid --html-output: %w", err)
+	}
+	return nil
+}
+
+// expandName replaces the placeholders in name:
+//
+//	{ref}     the --ref, or --branch, of the docs
+//	{commit}  the short hash of the commit of the docs, left out with a
+//	          separator next to it if they have none, or "nocommit" if
+//	          that would leave the file without a name
+//	{date}    the build date, e.g. 2024-05-31
+//	{time}    the build time in UTC, e.g. 153000
+//	{lang}    the --lang, en by default
+//
+// Values are made safe for file names, "release/2.5" giving "release-2.5".
+func (o *options) expandName(name string) (string, error) {
+	if strings.Contains(name, "{commit}") {
+		if _, err := fetcher.HeadCommit(o.repo.CloneDir); err != nil || o.revision() == "" {
+			// Docs from the web or --input have no commit to name
+			slog.Warn("The docs have no commit for {commit}, leaving it out", "err", err)
+			stripped := commitPlaceholder.ReplaceAllString(name, "")
+			if base := filepath.Base(stripped); strings.TrimSuffix(base, filepath.Ext(base)) == "" {
+				stripped = strings.ReplaceAll(name, "{commit}", "nocommit")
+			}
+			name = stripped
+		}
+	}
+	var err error
+	expanded := namePlaceholder.ReplaceAllStringFunc(name, func(p string) string {
+		var value string
+		switch p {
+		case "{ref}":
+			value = cmp.Or(o.repo.Ref, o.repo.Branch)
+		case "{commit}":
+			value, _ = fetcher.HeadCommit(o.repo.CloneDir)
+		case "{date}":
+			value = o.buildDate().UTC().Format("2006-01-02")
+		case "{time}":
+			value = o.buildDate().UTC().Format("150405")
+		case "{lang}":
+			value = cmp.Or(o.lang, "en")
+		default:
+			if err == nil {
+				err = fmt.Errorf("unknown placeholder %s, expected {ref}, {commit}, {date}, {time} or {lang}", p)
+			}
+			return p
+		}
+		return strings.Trim(unsafeVersion.ReplaceAllString(value, "-"), "-")
+	})
+	return expanded, err
+}
+
+// updateLatest points --latest at the main output of the build: a symbolic
+// link relative to it, or a copy with --latest-copy or where links cannot
+// be made
+func (o *options) updateLatest() error {
+	if o.latest == "" {
+		return nil
+	}
+	target := o.outputFile
+	switch o.format {
+	case "html":
+		target = o.htmlOutput
+	case "epub":
+		target = o.epubFile()
+	}
+	if abs, err := filepath.Abs(target); err == nil {
+		if latest, err := filepath.Abs(o.latest); err == nil && abs == latest {
+			return fmt.Errorf("--latest %s is the output itself", o.latest)
+		}
+	}
+	if !o.latestCopy {
+		rel, err := filepath.Rel(filepath.Dir(o.latest), target)
+		if err != nil {
+			rel, _ = filepath.Abs(target)
+		}
+		// Replaced in one rename, so readers never find it missing
+		tmp := filepath.Join(filepath.Dir(o.latest), "."+filepath.Base(o.latest)+".link")
+		os.Remove(tmp)
+		err = os.Symlink(rel, tmp)
+		if err == nil {
+			if err = os.Rename(tmp, o.latest); err == nil {
+				slog.Info("Linked latest", "file", o.latest, "target", rel)
+				return nil
+			}
+			os.Remove(tmp)
+		}
+		slog.Warn("Cannot link latest, copying instead", "file", o.latest, "err", err)
+	}
+	err := writeFile(o.latest, func(w io.Writer) error {
+		f, err := os.Open(target)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error copying latest: %w", err)
+	}
+	slog.Info("Copied latest", "file", o.latest, "target", target)
+	return nil
+}
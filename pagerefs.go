@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+
+	"i2pdoc2pdf/htmlproc"
+	"i2pdoc2pdf/renderer"
+)
+
+// pageRefPasses is how many times --page-refs renders a document at most:
+// the references may push their targets onto later pages, which changes
+// the references, until the pages settle
+const pageRefPasses = 3
+
+// renderWithPageRefs renders the combined HTML file input to output with
+// the internal links followed by the page of their target. The pages are
+// found in the outline of a first rendering, and the document is rendered
+// again with them until they stay the same.
+func (o *options) renderWithPageRefs(r renderer.Renderer, tree *htmlproc.Node, input, output string) error {
+	// The copy with references is next to input, so it finds the images
+	refs := strings.TrimSuffix(input, ".html") + ".refs.html"
+	if !o.keepFiles() {
+		defer os.Remove(refs)
+	}
+	rendered := input
+	var pages map[string]int
+	for pass := 1; ; pass++ {
+		slog.Info("Rendering to find the pages of cross-references", "pass", pass)
+		if err := r.Render(rendered, output); err != nil {
+			return err
+		}
+		outline, err := renderer.Outline(output)
+		if err != nil {
+			return err
+		}
+		if len(outline) == 0 {
+			slog.Warn("The PDF has no outline to find the pages of cross-references in, leaving them out")
+			return r.Render(input, output)
+		}
+		bookmarks := make([]htmlproc.Bookmark, len(outline))
+		for i, e := range outline {
+			bookmarks[i] = htmlproc.Bookmark{Title: e.Title, Page: e.Page}
+		}
+		found, err := htmlproc.AnchorPages(rendered, bookmarks)
+		if err != nil {
+			return fmt.Errorf("error finding the pages of cross-references: %w", err)
+		}
+		if maps.Equal(found, pages) {
+			return nil
+		}
+		if pass == pageRefPasses {
+			slog.Warn("Cross-references may be a page off, their pages didn't settle", "passes", pass)
+			return nil
+		}
+		pages = found
+		count, err := htmlproc.AddPageRefs(input, refs, tree, pages)
+		if err != nil {
+			return fmt.Errorf("error adding the pages of cross-references: %w", err)
+		}
+		slog.Debug("Added page references", "links", count)
+		rendered = refs
+	}
+}
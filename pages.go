@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"i2pdoc2pdf/htmlproc"
+	"i2pdoc2pdf/progress"
+	"i2pdoc2pdf/renderer"
+)
+
+// pageFile returns where the PDF of a page is written in --page-pdfs
+func (o *options) pageFile(p htmlproc.Page) string {
+	if p.Path == "" {
+		return filepath.Join(o.pagePDFs, "index.pdf")
+	}
+	return filepath.Join(o.pagePDFs, filepath.FromSlash(p.Path)+".pdf")
+}
+
+// pageHTML returns where the HTML of page i is written, next to the combined
+// HTML file so they share its images
+func pageHTML(combined string, i int) string {
+	return fmt.Sprintf("%s-page-%04d.html", strings.TrimSuffix(combined, filepath.Ext(combined)), i)
+}
+
+// splitPages splits tree into its pages if --page-pdfs asks for them and
+// records their files
+func (o *options) splitPages(tree *htmlproc.Node) []htmlproc.Page {
+	if o.pagePDFs == "" {
+		return nil
+	}
+	pages := htmlproc.SplitPages(tree)
+	o.pageFiles = make([]string, len(pages))
+	for i, p := range pages {
+		o.pageFiles[i] = o.pageFile(p)
+	}
+	return pages
+}
+
+// renderPages renders each page of tree into a PDF of its own in
+// --page-pdfs, in directories mirroring the docs tree. Links between pages
+// point at the other page's file.
+func (o *options) renderPages(tree *htmlproc.Node, combined string, docOpts htmlproc.DocumentOptions, setup renderer.PageSetup, running renderer.Running) error {
+	pages := o.splitPages(tree)
+	err := htmlproc.LinkPages(pages, func(from, to int) string {
+		rel, err := filepath.Rel(filepath.Dir(o.pageFiles[from]), o.pageFiles[to])
+		if err != nil {
+			return o.pageFiles[to]
+		}
+		return filepath.ToSlash(rel)
+	})
+	if err != nil {
+		return fmt.Errorf("error linking pages: %w", err)
+	}
+
+	opts := docOpts
+	opts.TOC = "none"
+	opts.Cover = false
+	opts.Generator = "" // No colophon
+	opts.Figures = nil
+	r, err := renderer.New(o.engine, renderer.Options{
+		OutlineDepth: o.outlineDepth,
+		ChromePath:   o.chromePath,
+		Timeout:      o.renderTimeout,
+		MemoryLimit:  o.memoryLimit(),
+		Page:         setup,
+		Grayscale:    o.grayscale,
+		Zoom:         o.zoom,
+		FontSize:     o.fontSize,
+		Running:      running,
+	})
+	if err != nil {
+		return err
+	}
+
+	jobs := o.jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	bar := progress.New("Rendering pages")
+	defer bar.Finish()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		done     atomic.Int64
+	)
+	sem := make(chan struct{}, jobs)
+	for i, p := range pages {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if err := o.renderPage(r, p, pageHTML(combined, i), o.pageFiles[i], opts); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("error creating PDF of %s: %w", p.Title, err)
+				}
+				mu.Unlock()
+			}
+			bar.Set(int(done.Add(1)), len(pages))
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// renderPage renders the document of page p, written to input, into output
+func (o *options) renderPage(r renderer.Renderer, p htmlproc.Page, input, output string, opts htmlproc.DocumentOptions) error {
+	err := writeFile(input, func(w io.Writer) error {
+		return htmlproc.WriteDocument(w, p.Tree, opts)
+	})
+	if err != nil {
+		return err
+	}
+	if !o.keepFiles() {
+		defer os.Remove(input)
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	return replaceFile(output, func(pdf string) error {
+		if err := r.Render(input, pdf); err != nil {
+			return err
+		}
+		meta := o.metadata()
+		meta.Title = p.Title
+		return o.finishPDF(pdf, meta)
+	})
+}
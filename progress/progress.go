@@ -0,0 +1,130 @@
+// Package progress reports how far long-running stages have got: as a bar
+// with counts and an ETA on a terminal, or as occasional log lines otherwise.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logInterval is how often a stage logs its progress when not on a terminal
+const logInterval = 10 * time.Second
+
+const barWidth = 30
+
+var (
+	mu     sync.Mutex
+	out    io.Writer = os.Stderr
+	tty              = isTerminal(os.Stderr)
+	active *Bar      // The bar currently drawn on the terminal, if any
+)
+
+// isTerminal reports whether f is a character device, such as a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Bar reports the progress of one stage
+type Bar struct {
+	stage       string
+	start       time.Time
+	logged      time.Time
+	done, total int
+}
+
+// New starts reporting the progress of stage. Call Set as work gets done and
+// Finish at the end.
+func New(stage string) *Bar {
+	now := time.Now()
+	return &Bar{stage: stage, start: now, logged: now}
+}
+
+// Set records that done of total items are complete, finishing the stage once
+// all are. It is safe to call from several goroutines, and fits the progress
+// callbacks of the other packages.
+func (b *Bar) Set(done, total int) {
+	if !slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		return
+	}
+	mu.Lock()
+	b.done, b.total = done, total
+	if tty {
+		active = b
+		b.draw()
+		if total > 0 && done >= total {
+			fmt.Fprintln(out)
+			active = nil
+		}
+		mu.Unlock()
+		return
+	}
+	report := time.Since(b.logged) >= logInterval
+	if report {
+		b.logged = time.Now()
+	}
+	eta := b.eta()
+	mu.Unlock()
+	// Logging goes through Writer, which takes the lock itself
+	if report {
+		slog.Info(b.stage, "done", done, "total", total, "eta", eta.String())
+	}
+}
+
+// Finish ends the stage early, leaving the last count on the terminal
+func (b *Bar) Finish() {
+	mu.Lock()
+	defer mu.Unlock()
+	if active == b {
+		b.draw()
+		fmt.Fprintln(out)
+		active = nil
+	}
+}
+
+// eta estimates the time left from the average pace so far
+func (b *Bar) eta() time.Duration {
+	if b.done == 0 || b.done >= b.total {
+		return 0
+	}
+	elapsed := time.Since(b.start)
+	return (elapsed / time.Duration(b.done) * time.Duration(b.total-b.done)).Round(time.Second)
+}
+
+// draw redraws the bar over the current terminal line
+func (b *Bar) draw() {
+	filled := barWidth
+	if b.total > 0 && b.done < b.total {
+		filled = barWidth * b.done / b.total
+	}
+	fmt.Fprintf(out, "\r\033[K%s [%s%s] %d/%d", b.stage, strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), b.done, b.total)
+	if eta := b.eta(); eta > 0 {
+		fmt.Fprintf(out, " ETA %s", eta)
+	}
+}
+
+// Writer wraps the writer log output goes to, so that lines logged while a
+// bar is drawn appear above it instead of running into it
+func Writer(w io.Writer) io.Writer {
+	return writer{w}
+}
+
+type writer struct{ w io.Writer }
+
+func (w writer) Write(p []byte) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if active == nil {
+		return w.w.Write(p)
+	}
+	fmt.Fprint(out, "\r\033[K")
+	n, err := w.w.Write(p)
+	active.draw()
+	return n, err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"i2pdoc2pdf/sam"
+)
+
+// runPublish serves the documentation as serve does, but inside I2P: on an
+// eepsite whose destination is created through the router's SAM bridge at
+// --sam. Its keys are kept in --keys so the address stays the same.
+func runPublish(o *options) error {
+	keys, err := sam.LoadKeys(o.samBridge, o.keysFile)
+	if err != nil {
+		return fmt.Errorf("cannot load the destination keys: %w", err)
+	}
+	id := make([]byte, 4)
+	rand.Read(id)
+	slog.Info("Creating I2P tunnels, this can take a minute", "sam", o.samBridge)
+	session, err := sam.NewSession(o.samBridge, "i2pdoc2pdf-"+hex.EncodeToString(id), keys)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	slog.Info("Publishing on I2P", "address", session.Address(), "keys", o.keysFile)
+	return serveDocs(o, session.Listen(), "http://"+session.Address()+"/")
+}
+
+// defaultKeysFile returns where the keys of the eepsite are kept, in the
+// user's config directory as they must outlive the cache
+func defaultKeysFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".i2pdoc2pdf.keys"
+	}
+	return filepath.Join(dir, "i2pdoc2pdf", "publish.keys")
+}
@@ -0,0 +1,64 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Attachment is a file to embed in a PDF
+type Attachment struct {
+	Name string // Name readers show and save it as, e.g. "how/intro.html"
+	File string // Path of the file
+}
+
+// Attach embeds files in the PDF file. A non-zero date is given as their
+// modification time instead of that of the files and the PDF is written
+// canonically, see SetMetadata.
+func Attach(file string, files []Attachment, date time.Time) error {
+	ctx, err := api.ReadContextFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	for _, a := range files {
+		data, err := os.ReadFile(a.File)
+		if err != nil {
+			return err
+		}
+		modTime := date
+		if modTime.IsZero() {
+			info, err := os.Stat(a.File)
+			if err != nil {
+				return err
+			}
+			modTime = info.ModTime()
+		}
+		attachment := model.Attachment{Reader: bytes.NewReader(data), ID: a.Name, ModTime: &modTime}
+		if err := ctx.AddAttachment(attachment, false); err != nil {
+			return fmt.Errorf("failed to attach %s: %w", a.Name, err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".attach-*.pdf")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if info, err := os.Stat(file); err == nil {
+		os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	write := api.WriteContextFile
+	if !date.IsZero() {
+		write = writeCanonical
+	}
+	if err := write(ctx, tmp.Name()); err != nil {
+		return fmt.Errorf("failed to write attachments: %w", err)
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,72 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// maxBookletPages is the most pages a saddle-stitched booklet folds well
+// with, 15 sheets
+const maxBookletPages = 60
+
+// Booklet imposes the pages of the PDF file for saddle-stitch binding,
+// writing them to out: two pages side by side on each side of the sheets of
+// paper size sheet (e.g. A4, Letter), in the order that makes them read in
+// sequence once the sheets, printed double-sided flipping on the long edge,
+// are folded in the middle and stapled. Pages are scaled to half the sheet.
+// password opens file if it is encrypted; the booklet is encrypted alike.
+func Booklet(file, out, sheet, password string) error {
+	conf := model.NewDefaultConfiguration()
+	conf.UserPW, conf.OwnerPW = password, password
+	nup, err := bookletConfig(sheet, conf)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	pages, err := api.PageCount(f, conf)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if pages > maxBookletPages {
+		slog.Warn("The booklet may be too thick to fold and staple, print a section of it with --include or --split-by", "pages", pages)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(out), ".booklet-*.pdf")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := api.BookletFile([]string{file}, tmp.Name(), nil, nup, conf); err != nil {
+		return fmt.Errorf("cannot impose the booklet: %w", err)
+	}
+	return os.Rename(tmp.Name(), out)
+}
+
+// bookletConfig returns the pdfcpu configuration of booklets on sheet
+func bookletConfig(sheet string, conf *model.Configuration) (*model.NUp, error) {
+	return api.PDFBookletConfig(2, fmt.Sprintf("formsize:%s, binding:long", sheet), conf)
+}
+
+// CheckSheet returns an error unless sheet is a paper size Booklet knows
+func CheckSheet(sheet string) error {
+	if _, err := bookletConfig(sheet, nil); err != nil {
+		// pdfcpu ends some messages with a newline
+		return errors.New(strings.TrimSpace(err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package renderer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// writeCanonical writes ctx to file in a canonical form, so that equal
+// documents give equal files: pdfcpu numbers and writes objects in the order
+// of Go maps, which differs from run to run. Only the objects reachable from
+// the catalog and the document information are written, numbered in the
+// order they are found with dictionary keys sorted, without object streams,
+// and the file ID is a hash of the content.
+func writeCanonical(ctx *model.Context, file string) error {
+	c := canonicalizer{ctx: ctx, numbers: map[int]int{}}
+	if ctx.Root == nil {
+		return fmt.Errorf("no catalog")
+	}
+	roots := []types.Object{*ctx.Root}
+	if ctx.Info != nil {
+		roots = append(roots, *ctx.Info)
+	}
+	for _, root := range roots {
+		if err := c.number(root); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", ctx.XRefTable.Version())
+	offsets := make([]int, len(c.order)+1)
+	for i, old := range c.order {
+		offsets[i+1] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		switch o := c.rewrite(c.object(old)).(type) {
+		case nil:
+			buf.WriteString("null")
+		case types.StreamDict:
+			buf.WriteString(o.Dict.PDFString())
+			buf.WriteString("\nstream\n")
+			buf.Write(o.Raw)
+			buf.WriteString("\nendstream")
+		default:
+			buf.WriteString(o.PDFString())
+		}
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	id := types.HexLiteral(hex.EncodeToString(sum[:16]))
+	trailer := types.Dict{
+		"Size": types.Integer(len(offsets)),
+		"Root": c.rewrite(*ctx.Root),
+		"ID":   types.Array{id, id},
+	}
+	if ctx.Info != nil {
+		trailer["Info"] = c.rewrite(*ctx.Info)
+	}
+	fmt.Fprintf(&buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer.PDFString(), xref)
+	return os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// canonicalizer renumbers the objects of a document
+type canonicalizer struct {
+	ctx     *model.Context
+	numbers map[int]int // Old object number → new one
+	order   []int       // Old object numbers in the order of the new ones
+}
+
+// object returns the object with the old number n, nil if there is none
+func (c *canonicalizer) object(n int) types.Object {
+	entry, ok := c.ctx.Table[n]
+	if !ok || entry.Free {
+		return nil
+	}
+	return entry.Object
+}
+
+// number numbers the objects o refers to, depth first
+func (c *canonicalizer) number(o types.Object) error {
+	switch o := o.(type) {
+	case types.IndirectRef:
+		n := o.ObjectNumber.Value()
+		if _, ok := c.numbers[n]; ok {
+			return nil
+		}
+		c.order = append(c.order, n)
+		c.numbers[n] = len(c.order)
+		return c.number(c.object(n))
+	case types.Dict:
+		for _, key := range sortedKeys(o) {
+			if err := c.number(o[key]); err != nil {
+				return err
+			}
+		}
+	case types.StreamDict:
+		if o.Raw == nil && o.Content != nil {
+			return fmt.Errorf("stream without encoded content")
+		}
+		// The length is written directly
+		d := types.Dict{}
+		for key, value := range o.Dict {
+			if key != "Length" {
+				d[key] = value
+			}
+		}
+		return c.number(d)
+	case types.Array:
+		for _, item := range o {
+			if err := c.number(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewrite returns a copy of o referring to the new object numbers
+func (c *canonicalizer) rewrite(o types.Object) types.Object {
+	switch o := o.(type) {
+	case types.IndirectRef:
+		return *types.NewIndirectRef(c.numbers[o.ObjectNumber.Value()], 0)
+	case types.Dict:
+		d := types.Dict{}
+		for key, value := range o {
+			d[key] = c.rewrite(value)
+		}
+		return d
+	case types.StreamDict:
+		d := c.rewrite(o.Dict).(types.Dict)
+		d["Length"] = types.Integer(len(o.Raw))
+		o.Dict = d
+		return o
+	case types.Array:
+		a := make(types.Array, len(o))
+		for i, item := range o {
+			a[i] = c.rewrite(item)
+		}
+		return a
+	}
+	return o
+}
+
+// sortedKeys returns the keys of d in order
+func sortedKeys(d types.Dict) []string {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
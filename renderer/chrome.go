@@ -0,0 +1,98 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// mmPerInch converts page geometry to inches, which Chrome takes
+const mmPerInch = 25.4
+
+// Chrome renders with headless Chrome or Chromium through the DevTools
+// Page.printToPDF command
+type Chrome struct {
+	Options
+}
+
+// Render renders the combined HTML in input to the PDF output
+func (c *Chrome) Render(input, output string) error {
+	setup := c.page()
+	width, height, err := setup.Dimensions()
+	if err != nil {
+		return err
+	}
+	if c.Running.usesSection() {
+		slog.Warn("Chrome cannot print the section in headers and footers, leaving {section} empty")
+	}
+	inputURL, err := fileURL(input)
+	if err != nil {
+		return err
+	}
+
+	allocOpts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.Flag("allow-file-access-from-files", true))
+	if c.ChromePath != "" {
+		allocOpts = append(allocOpts, chromedp.ExecPath(c.ChromePath))
+	}
+	allocCtx, kill := chromedp.NewExecAllocator(context.Background(), allocOpts...)
+	defer kill()
+	ctx, cancel := chromedp.NewContext(allocCtx)
+	defer cancel()
+	ctx, cancel = withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	var pdf []byte
+	watch := watchMemory(0, 0, nil)
+	err = chromedp.Run(ctx,
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			// The browser is running by now
+			if p := chromedp.FromContext(ctx).Browser.Process(); p != nil {
+				watch = watchMemory(p.Pid, c.MemoryLimit, kill)
+			}
+			return nil
+		}),
+		chromedp.Navigate(inputURL),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			zoom := c.Zoom
+			if zoom <= 0 {
+				zoom = 1
+			}
+			pdf, _, err = page.PrintToPDF().
+				WithScale(zoom).
+				WithPaperWidth(width / mmPerInch).
+				WithPaperHeight(height / mmPerInch).
+				WithMarginTop(setup.Margins.Top / mmPerInch).
+				WithMarginBottom(setup.Margins.Bottom / mmPerInch).
+				WithMarginLeft(setup.Margins.Left / mmPerInch).
+				WithMarginRight(setup.Margins.Right / mmPerInch).
+				WithPrintBackground(true).
+				// Only for the landscape pages of wide tables, the others have no size
+				WithPreferCSSPageSize(true).
+				WithDisplayHeaderFooter(c.Running.Header != "" || c.Running.Footer != "").
+				WithHeaderTemplate(c.Running.chromeTemplate(c.Running.Header, setup.Margins)).
+				WithFooterTemplate(c.Running.chromeTemplate(c.Running.Footer, setup.Margins)).
+				WithGenerateDocumentOutline(c.OutlineDepth > 0).
+				Do(ctx)
+			return err
+		}),
+	)
+	used := watch.end()
+	if err != nil {
+		if timedOut(ctx) {
+			return fmt.Errorf("chrome timed out after %s printing %s", c.Timeout, input)
+		}
+		if used > 0 {
+			return fmt.Errorf("chrome used %d MB of memory, over the limit of %d MB, printing %s: %w", used>>20, c.MemoryLimit>>20, input, ErrKilled)
+		}
+		return fmt.Errorf("chrome failed to print %s: %w", input, err)
+	}
+
+	// Write to file
+	slog.Info("Writing PDF", "file", output)
+	return os.WriteFile(output, pdf, 0644)
+}
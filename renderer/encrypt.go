@@ -0,0 +1,77 @@
+package renderer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Encryption protects a PDF with passwords and restricts what readers that
+// honor the restrictions let users do with it
+type Encryption struct {
+	UserPassword  string // Needed to open the document, "" for none
+	OwnerPassword string // Needed to change the document or lift the restrictions
+	NoPrint       bool
+	NoCopy        bool // Don't allow copying text and images
+}
+
+// Enabled reports whether e asks for encryption at all
+func (e Encryption) Enabled() bool {
+	return e.UserPassword != "" || e.OwnerPassword != "" || e.NoPrint || e.NoCopy
+}
+
+// Check returns an error if e cannot be applied: restrictions mean nothing
+// without an owner password, as anyone could lift them
+func (e Encryption) Check() error {
+	if (e.NoPrint || e.NoCopy) && e.OwnerPassword == "" {
+		return fmt.Errorf("restricting printing or copying needs an owner password")
+	}
+	return nil
+}
+
+// permissions returns the permission flags for e. Extraction for
+// accessibility stays allowed, so screen readers keep working.
+func (e Encryption) permissions() model.PermissionFlags {
+	p := model.PermissionsAll
+	if e.NoPrint {
+		p &^= model.PermissionPrintRev2 | model.PermissionPrintRev3
+	}
+	if e.NoCopy {
+		p &^= model.PermissionExtract
+	}
+	return p
+}
+
+// Encrypt encrypts the PDF file in place with AES-256
+func Encrypt(file string, e Encryption) error {
+	if err := e.Check(); err != nil {
+		return err
+	}
+	owner := e.OwnerPassword
+	if owner == "" {
+		// Without one, the user password also grants full access
+		owner = e.UserPassword
+	}
+	conf := model.NewAESConfiguration(e.UserPassword, owner, 256)
+	conf.Permissions = e.permissions()
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".encrypt-*.pdf")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := api.EncryptFile(file, tmp.Name(), conf); err != nil {
+		return err
+	}
+	// CreateTemp makes the file private, keep the permissions of the original
+	os.Chmod(tmp.Name(), info.Mode().Perm())
+	return os.Rename(tmp.Name(), file)
+}
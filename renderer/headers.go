@@ -0,0 +1,103 @@
+package renderer
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// DefaultHeader numbers the pages at the top right
+const DefaultHeader = "||{page}/{pages}"
+
+// Running holds the running header and footer printed on every page. Each
+// template has up to three parts separated by "|", printed at the left, center
+// and right; parts may use the variables {page}, {pages}, {section} (the
+// chapter the page is in), {title}, {date} and {commit}.
+type Running struct {
+	Header string // Empty for no header
+	Footer string // Empty for no footer
+	Title  string // Values of {title}, {date} and {commit}
+	Date   string
+	Commit string
+	// PageOffset is added to page numbers, so that volumes of a document can
+	// number on from the previous one. {pages} still counts the pages of the
+	// file. Chrome ignores it outside RenderChapters.
+	PageOffset int
+}
+
+// parts splits a template into its left, center and right parts
+func parts(template string) [3]string {
+	var p [3]string
+	copy(p[:], strings.SplitN(template, "|", 3))
+	return p
+}
+
+// Mirrored returns r with the left and right parts of the header and footer
+// swapped, for documents written right to left
+func (r Running) Mirrored() Running {
+	for _, template := range []*string{&r.Header, &r.Footer} {
+		if *template != "" {
+			p := parts(*template)
+			*template = p[2] + "|" + p[1] + "|" + p[0]
+		}
+	}
+	return r
+}
+
+// expand fills in the variables of a template part. page, pages and section
+// are what the engine uses for them; other text is passed through escape.
+func (r Running) expand(part, page, pages, section string, escape func(string) string) string {
+	var sb strings.Builder
+	for part != "" {
+		start := strings.IndexByte(part, '{')
+		end := strings.IndexByte(part[start+1:], '}') + start + 1
+		if start < 0 || end <= start {
+			sb.WriteString(escape(part))
+			break
+		}
+		sb.WriteString(escape(part[:start]))
+		switch name := part[start+1 : end]; name {
+		case "page":
+			sb.WriteString(page)
+		case "pages":
+			sb.WriteString(pages)
+		case "section":
+			sb.WriteString(section)
+		case "title":
+			sb.WriteString(escape(r.Title))
+		case "date":
+			sb.WriteString(escape(r.Date))
+		case "commit":
+			sb.WriteString(escape(r.Commit))
+		default:
+			sb.WriteString(escape(part[start : end+1]))
+		}
+		part = part[end+1:]
+	}
+	return sb.String()
+}
+
+// usesSection reports whether a header or footer shows the section
+func (r Running) usesSection() bool {
+	return strings.Contains(r.Header, "{section}") || strings.Contains(r.Footer, "{section}")
+}
+
+// plain leaves text as it is
+func plain(s string) string { return s }
+
+// chromeTemplate returns a header or footer template for Chrome's printToPDF,
+// which fills in elements with the classes pageNumber, totalPages and title
+func (r Running) chromeTemplate(template string, margins Margins) string {
+	if template == "" {
+		return "<div></div>"
+	}
+	p := parts(template)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<div style="font-size: 9px; width: 100%%; display: flex; margin: 0 %gmm 0 %gmm;">`, margins.Right, margins.Left)
+	for i, align := range []string{"left", "center", "right"} {
+		text := r.expand(p[i], `<span class="pageNumber"></span>`, `<span class="totalPages"></span>`, "", html.EscapeString)
+		sb.WriteString(`<div style="flex: 1; text-align: ` + align + `;">` + text + `</div>`)
+	}
+	sb.WriteString("</div>")
+	return sb.String()
+}
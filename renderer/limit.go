@@ -0,0 +1,79 @@
+package renderer
+
+import (
+	"errors"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrKilled is returned, wrapped, when the engine was killed before it
+// finished, by Options.MemoryLimit or by the system running out of memory,
+// so that rendering the document in smaller parts may still succeed
+var ErrKilled = errors.New("rendering engine killed")
+
+// memoryPoll is how often the memory of the engine is checked
+const memoryPoll = 250 * time.Millisecond
+
+// memoryWatch kills the engine once its processes use too much memory
+type memoryWatch struct {
+	stop chan struct{}
+	done sync.WaitGroup
+	used int64 // Memory found when killing the engine, 0 if it wasn't
+}
+
+// watchMemory checks every memoryPoll the memory the process pid and its
+// children use together and calls kill once it is over limit. It does
+// nothing if limit is 0.
+func watchMemory(pid int, limit int64, kill func()) *memoryWatch {
+	w := &memoryWatch{stop: make(chan struct{})}
+	if limit <= 0 {
+		return w
+	}
+	w.done.Add(1)
+	go func() {
+		defer w.done.Done()
+		ticker := time.NewTicker(memoryPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+			used, err := processMemory(pid)
+			if err != nil {
+				slog.Warn("Cannot watch the memory of the rendering engine", "err", err)
+				return
+			}
+			if used > limit {
+				w.used = used
+				kill()
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// end stops watching and returns the memory the engine was using when it was
+// killed for it, 0 if it wasn't
+func (w *memoryWatch) end() int64 {
+	close(w.stop)
+	w.done.Wait()
+	return w.used
+}
+
+// signaled reports whether err is that of a process killed with SIGKILL, as
+// the out of memory killer ends engines. Other signals, such as a crash, are
+// left for the caller to report as they are.
+func signaled(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGKILL
+}
@@ -0,0 +1,48 @@
+package renderer
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// processMemory returns the resident memory of the process pid and all its
+// descendants, such as the renderer processes of Chrome, read from /proc
+func processMemory(pid int) (int64, error) {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return 0, err
+	}
+	children := map[int][]int{}
+	pages := map[int]int64{}
+	for _, file := range stats {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue // The process has ended
+		}
+		// The fields after the command, which is in parentheses and may
+		// hold spaces, start with the state and the parent
+		s := string(data)
+		fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		p, _ := strconv.Atoi(filepath.Base(filepath.Dir(file)))
+		parent, _ := strconv.Atoi(fields[1])
+		rss, _ := strconv.ParseInt(fields[21], 10, 64)
+		children[parent] = append(children[parent], p)
+		pages[p] = rss
+	}
+	if _, ok := pages[pid]; !ok {
+		return 0, nil
+	}
+	var total int64
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = append(queue[1:], children[p]...)
+		total += pages[p]
+	}
+	return total * int64(os.Getpagesize()), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package renderer
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// processMemory is only implemented on Linux
+func processMemory(pid int) (int64, error) {
+	return 0, fmt.Errorf("limiting the memory of the engine is not supported on %s", runtime.GOOS)
+}
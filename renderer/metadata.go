@@ -0,0 +1,98 @@
+package renderer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Metadata is the document information readers show instead of the file name
+type Metadata struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	Creator  string // Program that made the document
+	Language string // BCP 47 language tag, e.g. "en" or "pt-BR"
+	// Date, if set, is the creation and modification date instead of now,
+	// and the file ID is derived from the content, so that rendering the same
+	// document again gives the same file
+	Date time.Time
+}
+
+// SetMetadata writes meta into the PDF file, whichever engine rendered it.
+// Empty fields are left as they are.
+func SetMetadata(file string, meta Metadata) error {
+	ctx, err := api.ReadContextFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	properties := map[string]string{}
+	for key, value := range map[string]string{
+		"Title":    meta.Title,
+		"Author":   meta.Author,
+		"Subject":  meta.Subject,
+		"Keywords": meta.Keywords,
+		"Creator":  meta.Creator,
+	} {
+		if value != "" {
+			properties[key] = value
+		}
+	}
+	if err := pdfcpu.PropertiesAdd(ctx, properties); err != nil {
+		return err
+	}
+	if meta.Language != "" {
+		ctx.RootDict.Update("Lang", types.StringLiteral(meta.Language))
+	}
+	if !meta.Date.IsZero() {
+		// pdfcpu dates the document now when changing its properties
+		info, err := ctx.DereferenceDict(*ctx.Info)
+		if err != nil {
+			return err
+		}
+		date := types.StringLiteral(types.DateString(meta.Date.UTC()))
+		info.Update("CreationDate", date)
+		info.Update("ModDate", date)
+	}
+
+	// Write next to the file and replace it, so a failure leaves it intact
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".metadata-*.pdf")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes the file private, keep the permissions of the original
+	if info, err := os.Stat(file); err == nil {
+		os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	write := api.WriteContextFile
+	if !meta.Date.IsZero() {
+		write = writeCanonical
+	}
+	if err := write(ctx, tmp.Name()); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// PageCount returns the number of pages of a PDF file, opened with password
+// if it is encrypted
+func PageCount(file, password string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	conf := model.NewDefaultConfiguration()
+	conf.UserPW = password
+	return api.PageCount(f, conf)
+}
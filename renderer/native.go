@@ -0,0 +1,515 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/net/html"
+)
+
+var whitespaceRun = regexp.MustCompile(`\s+`)
+
+// headingSizes are the font sizes, in points, of h1 to h6 with text of
+// textSize
+var headingSizes = [...]float64{20, 16, 14, 12, 11, 11}
+
+// textSize is the default font size of the text, in points
+const textSize = 11
+
+// layout holds the state of laying out a document with fpdf
+type layout struct {
+	pdf     *fpdf.Fpdf
+	tr      func(string) string // Converts UTF-8 to the core fonts' encoding
+	baseDir string              // Directory relative image paths are resolved in
+	opts    Options
+
+	links     map[string]int // Anchor ID → fpdf internal link
+	link      int            // Internal link of the text being written, 0 for none
+	linkURL   string         // External link of the text being written
+	bold      int
+	italic    int
+	mono      int
+	pre       int
+	size      float64
+	scale     float64 // Of the font sizes, by Options.FontSize and Zoom
+	lineStart bool    // Nothing written on the current line yet
+	outline   int     // Level of the last bookmark, to keep the outline well-formed
+
+	// section is the latest chapter heading, pageSection the one shown in the
+	// running header and footer of the current page: the first chapter
+	// heading on the page, else the one carried over from earlier pages
+	section, pageSection string
+	pageHasSection       bool
+}
+
+// Native lays out the combined HTML document directly with fpdf. It only
+// understands basic structure (headings, paragraphs, lists, code, links,
+// images and tables) and core fonts, so fidelity is lower than with a browser
+// engine, but it needs no external programs.
+type Native struct {
+	Options
+}
+
+// Render renders the combined HTML in input to the PDF output
+func (r *Native) Render(input, output string) error {
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	root, err := html.Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", input, err)
+	}
+
+	setup := r.page()
+	width, height, err := setup.Dimensions()
+	if err != nil {
+		return err
+	}
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           fpdf.SizeType{Wd: width, Ht: height},
+	})
+	pdf.SetMargins(setup.Margins.Left, setup.Margins.Top, setup.Margins.Right)
+	pdf.SetAutoPageBreak(true, setup.Margins.Bottom)
+	pdf.AliasNbPages("")
+	// Write fonts and images in a fixed order, for reproducible builds
+	pdf.SetCatalogSort(true)
+	n := &layout{
+		pdf:       pdf,
+		tr:        pdf.UnicodeTranslatorFromDescriptor(""),
+		baseDir:   filepath.Dir(input),
+		opts:      r.Options,
+		links:     map[string]int{},
+		scale:     1,
+		lineStart: true,
+		outline:   -1,
+	}
+	if r.FontSize > 0 {
+		n.scale = r.FontSize / textSize
+	}
+	if r.Zoom > 0 {
+		n.scale *= r.Zoom
+	}
+	n.size = textSize * n.scale
+	pdf.SetHeaderFuncMode(func() {
+		n.pageSection, n.pageHasSection = n.section, false
+	}, true)
+	// The running header is drawn when the page is done, once its section
+	// is known
+	pdf.SetFooterFunc(func() {
+		n.running(r.Running.Header, setup.Margins.Top/2)
+		_, height := pdf.GetPageSize()
+		n.running(r.Running.Footer, height-setup.Margins.Bottom/2-5)
+		n.setFont()
+	})
+	pdf.AddPage()
+	n.setFont()
+	n.render(root)
+
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+	slog.Info("Writing PDF", "file", output)
+	return pdf.OutputFileAndClose(output)
+}
+
+// setFont applies the current style state
+func (n *layout) setFont() {
+	family, style := "Helvetica", ""
+	if n.mono > 0 {
+		family = "Courier"
+	}
+	if n.bold > 0 {
+		style += "B"
+	}
+	if n.italic > 0 {
+		style += "I"
+	}
+	n.pdf.SetFont(family, style, n.size)
+}
+
+// lineHeight is the height of a line of text at the current font size, in mm
+func (n *layout) lineHeight() float64 {
+	return n.size * 0.3528 * 1.35
+}
+
+// newline ends the current line unless nothing has been written on it
+func (n *layout) newline() {
+	if !n.lineStart {
+		n.pdf.Ln(n.lineHeight())
+		n.lineStart = true
+	}
+}
+
+// linkFor returns the internal link for an anchor ID, creating it on first use
+// so that links can point forward in the document
+func (n *layout) linkFor(id string) int {
+	link, ok := n.links[id]
+	if !ok {
+		link = n.pdf.AddLink()
+		n.links[id] = link
+	}
+	return link
+}
+
+// write adds inline text, honoring the current link
+func (n *layout) write(text string) {
+	if text == "" {
+		return
+	}
+	text = n.tr(text)
+	switch {
+	case n.link != 0:
+		n.pdf.WriteLinkID(n.lineHeight(), text, n.link)
+	case n.linkURL != "":
+		n.pdf.WriteLinkString(n.lineHeight(), text, n.linkURL)
+	default:
+		n.pdf.Write(n.lineHeight(), text)
+	}
+	n.lineStart = false
+}
+
+// text writes a text node, collapsing whitespace outside of pre blocks
+func (n *layout) text(data string) {
+	if n.pre > 0 {
+		lines := strings.Split(data, "\n")
+		for i, line := range lines {
+			if i > 0 {
+				n.pdf.Ln(n.lineHeight())
+				n.lineStart = true
+			}
+			n.write(strings.ReplaceAll(line, "\t", "    "))
+		}
+		return
+	}
+	data = whitespaceRun.ReplaceAllString(data, " ")
+	if n.lineStart {
+		data = strings.TrimLeft(data, " ")
+	}
+	n.write(data)
+}
+
+// renderChildren renders all children of node in order
+func (n *layout) renderChildren(node *html.Node) {
+	for c := node.FirstChild; c != nil; c = c.NextSibling {
+		n.render(c)
+	}
+}
+
+// render lays out node and its descendants
+func (n *layout) render(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		n.text(node.Data)
+		return
+	case html.ElementNode:
+	default:
+		n.renderChildren(node)
+		return
+	}
+
+	if id := attr(node, "id"); id != "" {
+		n.pdf.SetLink(n.linkFor(id), n.pdf.GetY(), -1)
+	}
+
+	switch node.Data {
+	case "head", "script", "style", "title":
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		n.heading(node, int(node.Data[1]-'0'))
+	case "p", "div", "section", "article", "blockquote", "dl", "dt", "dd", "figure", "figcaption":
+		if hasClass(node, "page-break") {
+			n.newline()
+			n.pdf.AddPage()
+			return
+		}
+		n.newline()
+		n.renderChildren(node)
+		n.newline()
+		if node.Data == "p" {
+			n.pdf.Ln(2)
+		}
+	case "br":
+		n.pdf.Ln(n.lineHeight())
+		n.lineStart = true
+	case "hr":
+		n.newline()
+		left, _, right, _ := n.pdf.GetMargins()
+		width, _ := n.pdf.GetPageSize()
+		y := n.pdf.GetY() + 1
+		n.pdf.Line(left, y, width-right, y)
+		n.pdf.Ln(3)
+	case "pre":
+		n.newline()
+		n.pre++
+		n.mono++
+		n.setFont()
+		n.renderChildren(node)
+		n.mono--
+		n.pre--
+		n.setFont()
+		n.newline()
+		n.pdf.Ln(2)
+	case "ul", "ol":
+		n.list(node)
+	case "b", "strong", "th":
+		n.bold++
+		n.setFont()
+		n.renderChildren(node)
+		n.bold--
+		n.setFont()
+		if node.Data == "th" {
+			n.write("  ")
+		}
+	case "i", "em", "cite", "var":
+		n.italic++
+		n.setFont()
+		n.renderChildren(node)
+		n.italic--
+		n.setFont()
+	case "code", "tt", "kbd", "samp":
+		n.mono++
+		n.setFont()
+		n.renderChildren(node)
+		n.mono--
+		n.setFont()
+	case "a":
+		n.anchor(node)
+	case "img":
+		n.image(node)
+	case "tr":
+		n.newline()
+		n.renderChildren(node)
+		n.newline()
+	case "td":
+		n.renderChildren(node)
+		n.write("  ")
+	default:
+		n.renderChildren(node)
+	}
+}
+
+// heading writes a heading and adds it to the PDF outline
+func (n *layout) heading(node *html.Node, level int) {
+	n.newline()
+	n.pdf.Ln(2)
+	text := strings.TrimSpace(whitespaceRun.ReplaceAllString(textContent(node), " "))
+
+	// Bookmark levels may only go one deeper at a time
+	outline := level - 1
+	if outline > n.outline+1 {
+		outline = n.outline + 1
+	}
+	if uint(outline) < n.opts.OutlineDepth && text != "" {
+		n.pdf.Bookmark(text, outline, -1)
+		n.outline = outline
+	}
+
+	// Chapters are h2, the title page h1
+	if level <= 2 && text != "" {
+		n.section = text
+		if !n.pageHasSection {
+			n.pageSection, n.pageHasSection = text, true
+		}
+	}
+
+	oldSize := n.size
+	n.size = headingSizes[level-1] * n.scale
+	n.bold++
+	n.setFont()
+	n.write(text)
+	n.newline()
+	n.bold--
+	n.size = oldSize
+	n.setFont()
+	n.pdf.Ln(1)
+}
+
+// running draws a header or footer template at y
+func (n *layout) running(template string, y float64) {
+	if template == "" {
+		return
+	}
+	n.pdf.SetFont("Helvetica", "", 8)
+	for i, align := range []string{"L", "C", "R"} {
+		text := n.opts.Running.expand(parts(template)[i], fmt.Sprint(n.pdf.PageNo()+n.opts.Running.PageOffset), "{nb}", n.pageSection, plain)
+		if text != "" {
+			n.pdf.SetY(y)
+			n.pdf.CellFormat(0, 5, n.tr(text), "", 0, align, false, 0, "")
+		}
+	}
+}
+
+// list writes the items of an ul or ol element, indented with a marker
+func (n *layout) list(node *html.Node) {
+	const indent = 6
+	n.newline()
+	left, top, right, _ := n.pdf.GetMargins()
+	n.pdf.SetLeftMargin(left + indent)
+	n.pdf.SetX(left + indent)
+
+	item := 0
+	for c := node.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.Data != "li" {
+			n.render(c)
+			continue
+		}
+		item++
+		n.newline()
+		if node.Data == "ol" {
+			n.write(fmt.Sprintf("%d. ", item))
+		} else {
+			n.write("• ")
+		}
+		n.renderChildren(c)
+	}
+
+	n.newline()
+	n.pdf.SetMargins(left, top, right)
+	n.pdf.SetX(left)
+}
+
+// anchor writes link text, linking internally for #fragments. Relative
+// links to other PDFs, e.g. between volumes, are kept as they are.
+func (n *layout) anchor(node *html.Node) {
+	href := attr(node, "href")
+	oldLink, oldURL := n.link, n.linkURL
+	switch {
+	case strings.HasPrefix(href, "#") && len(href) > 1:
+		n.link = n.linkFor(href[1:])
+	case strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://"):
+		n.linkURL = href
+	case strings.HasSuffix(strings.SplitN(href, "#", 2)[0], ".pdf"):
+		n.linkURL = href
+	}
+	n.renderChildren(node)
+	n.link, n.linkURL = oldLink, oldURL
+}
+
+// image places a local PNG, JPEG or GIF image scaled to fit the page width.
+// Other images are replaced by their alt text.
+func (n *layout) image(node *html.Node) {
+	src := attr(node, "src")
+	// The copies of images are referred to percent-encoded
+	file := src
+	if u, err := url.Parse(src); err == nil && u.Scheme == "" {
+		file = u.Path
+	}
+	path := filepath.Join(n.baseDir, filepath.FromSlash(file))
+	imageType := ""
+	if f, err := os.Open(path); err == nil {
+		_, imageType, err = image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			imageType = ""
+		}
+	}
+	if imageType == "" || strings.Contains(src, ":") {
+		if alt := attr(node, "alt"); alt != "" {
+			n.text("[" + alt + "]")
+		}
+		return
+	}
+
+	opts := fpdf.ImageOptions{ImageType: imageType, ReadDpi: true}
+	var info *fpdf.ImageInfoType
+	if n.opts.Grayscale {
+		path += "#gray" // Registered under its own name, the file is left alone
+		info = n.registerGray(path, opts)
+		opts.ImageType = "png"
+	} else {
+		info = n.pdf.RegisterImageOptions(path, opts)
+	}
+	if info == nil {
+		return
+	}
+	w, h := info.Extent()
+	left, _, right, bottom := n.pdf.GetMargins()
+	pageWidth, pageHeight := n.pdf.GetPageSize()
+	if maxWidth := pageWidth - left - right; w > maxWidth {
+		w, h = maxWidth, h*maxWidth/w
+	}
+
+	n.newline()
+	if n.pdf.GetY()+h > pageHeight-bottom {
+		n.pdf.AddPage()
+	}
+	y := n.pdf.GetY()
+	n.pdf.ImageOptions(path, left, y, w, h, false, opts, 0, "")
+	n.pdf.SetY(y + h + 2)
+	n.lineStart = true
+}
+
+// registerGray registers the image at path, less its "#gray" suffix, in
+// shades of gray
+func (n *layout) registerGray(path string, opts fpdf.ImageOptions) *fpdf.ImageInfoType {
+	if info := n.pdf.GetImageInfo(path); info != nil {
+		return info
+	}
+	f, err := os.Open(strings.TrimSuffix(path, "#gray"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		slog.Debug("Cannot decode image", "file", f.Name(), "err", err)
+		return nil
+	}
+	// Transparent parts are on the white page
+	gray := image.NewGray(img.Bounds())
+	draw.Draw(gray, gray.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Over)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gray); err != nil {
+		return nil
+	}
+	opts.ImageType = "png"
+	return n.pdf.RegisterImageOptionsReader(path, opts, &buf)
+}
+
+// attr returns the value of the named attribute of node
+func attr(node *html.Node, name string) string {
+	for _, a := range node.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasClass reports whether node has the CSS class name
+func hasClass(node *html.Node, name string) bool {
+	for _, c := range strings.Fields(attr(node, "class")) {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent returns the concatenated text of node and its descendants
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	var sb strings.Builder
+	for c := node.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
@@ -0,0 +1,311 @@
+package renderer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// DefaultQuality is the JPEG quality Optimize recompresses images at
+const DefaultQuality = 75
+
+// minQuality is the lowest JPEG quality Optimize goes to for a target size
+const minQuality = 30
+
+// OptimizeOptions tune Optimize
+type OptimizeOptions struct {
+	Recompress bool // Recompress images, rather than only merging duplicates
+	Quality    int  // JPEG quality images are recompressed at, 0 for DefaultQuality
+	// TargetSize, if not 0, is the size in bytes to get the file under: the
+	// quality is lowered step by step and opaque lossless images are made
+	// JPEGs until it fits, or the quality gets too poor
+	TargetSize int64
+	Linearize  bool // Arrange the file for fast web viewing, with qpdf
+	Canonical  bool // Write the file in a canonical form, see Metadata.Date
+}
+
+// DetectQpdf returns the path of qpdf, which linearizes PDFs, or "" if it
+// isn't installed
+func DetectQpdf() string {
+	path, err := exec.LookPath("qpdf")
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// Optimize makes the PDF file smaller in place: it merges duplicate fonts
+// and images, optionally recompresses JPEG images at a lower quality and
+// lossless ones harder, keeping whichever is smaller, and optionally
+// linearizes the file. It returns the sizes before and after.
+func Optimize(file string, opts OptimizeOptions) (before, after int64, err error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	before = info.Size()
+	quality := opts.Quality
+	if quality <= 0 || quality > 100 {
+		quality = DefaultQuality
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".optimize-*.pdf")
+	if err != nil {
+		return 0, 0, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes the file private, keep the permissions of the original
+	os.Chmod(tmp.Name(), info.Mode().Perm())
+
+	toJPEG := false
+	for {
+		size, err := optimizeTo(file, tmp.Name(), opts.Recompress, quality, toJPEG, opts.Canonical)
+		if err != nil {
+			return 0, 0, err
+		}
+		if size >= before {
+			// Nothing to gain, rewriting the file only added overhead
+			if err := copyFile(file, tmp.Name()); err != nil {
+				return 0, 0, err
+			}
+			size = before
+		}
+		if !opts.Recompress || opts.TargetSize <= 0 || size <= opts.TargetSize {
+			break
+		}
+		if toJPEG && quality <= minQuality {
+			slog.Warn("Cannot optimize the PDF down to the target size", "size", size, "target", opts.TargetSize)
+			break
+		}
+		if !toJPEG {
+			toJPEG = true
+		} else {
+			quality = max(quality-15, minQuality)
+		}
+		slog.Debug("Optimizing harder for the target size", "size", size, "quality", quality, "jpeg", toJPEG)
+	}
+	if err := finishOptimize(tmp.Name(), file, opts); err != nil {
+		return 0, 0, err
+	}
+	if info, err = os.Stat(file); err != nil {
+		return 0, 0, err
+	}
+	return before, info.Size(), nil
+}
+
+// optimizeTo writes an optimized copy of file to out and returns its size.
+// With toJPEG opaque lossless images become JPEGs too.
+func optimizeTo(file, out string, recompress bool, quality int, toJPEG, canonical bool) (int64, error) {
+	ctx, err := api.ReadContextFile(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if err := api.OptimizeContext(ctx); err != nil {
+		return 0, err
+	}
+	if recompress {
+		if err := recompressImages(ctx, quality, toJPEG); err != nil {
+			return 0, err
+		}
+	}
+	write := api.WriteContextFile
+	if canonical {
+		write = writeCanonical
+	}
+	if err := write(ctx, out); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(out)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// finishOptimize linearizes the optimized file tmp if asked to and moves it
+// over file
+func finishOptimize(tmp, file string, opts OptimizeOptions) error {
+	if opts.Linearize {
+		qpdf := DetectQpdf()
+		if qpdf == "" {
+			slog.Warn("Cannot linearize the PDF without qpdf, which was not found in PATH")
+		} else {
+			linearized := tmp + ".linearized"
+			defer os.Remove(linearized)
+			out, err := exec.Command(qpdf, "--linearize", "--deterministic-id", tmp, linearized).CombinedOutput()
+			// qpdf exits with 3 for warnings, the file is written all the same
+			if exit, ok := err.(*exec.ExitError); err != nil && !(ok && exit.ExitCode() == 3) {
+				return fmt.Errorf("qpdf failed: %w: %s", err, strings.TrimSpace(string(out)))
+			}
+			if err := os.Rename(linearized, tmp); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(tmp, file)
+}
+
+// copyFile copies the content of source over destination
+func copyFile(source, destination string) error {
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(destination, data, 0644)
+}
+
+// recompressImages recompresses the images of ctx, replacing each one whose
+// new encoding is smaller
+func recompressImages(ctx *model.Context, quality int, toJPEG bool) error {
+	// Soft masks are images too, but lossy ones would fringe the edges
+	masks := map[int]bool{}
+	var images []int
+	for n, entry := range ctx.Table {
+		sd, ok := entry.Object.(types.StreamDict)
+		if !ok || sd.Subtype() == nil || *sd.Subtype() != "Image" {
+			continue
+		}
+		images = append(images, n)
+		if ref := sd.IndirectRefEntry("SMask"); ref != nil {
+			masks[ref.ObjectNumber.Value()] = true
+		}
+	}
+	sort.Ints(images)
+
+	for _, n := range images {
+		entry := ctx.Table[n]
+		sd := entry.Object.(types.StreamDict)
+		var (
+			raw    []byte
+			filter string
+			err    error
+		)
+		switch {
+		case len(sd.FilterPipeline) != 1:
+			continue
+		case sd.FilterPipeline[0].Name == "DCTDecode":
+			raw, err = reencodeJPEG(sd.Raw, quality)
+			filter = "DCTDecode"
+		case sd.FilterPipeline[0].Name == "FlateDecode":
+			if toJPEG && !masks[n] && sd.IndirectRefEntry("SMask") == nil {
+				raw, err = flateToJPEG(&sd, quality)
+				filter = "DCTDecode"
+			}
+			if raw == nil && err == nil {
+				raw, err = deflateBest(&sd)
+				filter = "FlateDecode"
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			slog.Debug("Cannot recompress image", "object", n, "err", err)
+			continue
+		}
+		if raw == nil || len(raw) >= len(sd.Raw) {
+			continue
+		}
+		sd.Raw = raw
+		sd.Content = nil
+		sd.FilterPipeline = []types.PDFFilter{{Name: filter}}
+		sd.Update("Filter", types.Name(filter))
+		sd.Delete("DecodeParms")
+		length := int64(len(raw))
+		sd.StreamLength = &length
+		sd.Update("Length", types.Integer(length))
+		entry.Object = sd
+	}
+	return nil
+}
+
+// reencodeJPEG re-encodes a JPEG at quality. It returns nil for CMYK
+// JPEGs, which the encoder would turn into RGB.
+func reencodeJPEG(raw []byte, quality int) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := img.(*image.CMYK); ok {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flateToJPEG encodes a losslessly compressed 8-bit gray or RGB image as a
+// JPEG at quality. It returns nil for other images.
+func flateToJPEG(sd *types.StreamDict, quality int) ([]byte, error) {
+	width, height := sd.IntEntry("Width"), sd.IntEntry("Height")
+	bpc := sd.IntEntry("BitsPerComponent")
+	cs := sd.NameEntry("ColorSpace")
+	if width == nil || height == nil || bpc == nil || *bpc != 8 || cs == nil {
+		return nil, nil
+	}
+	if err := sd.Decode(); err != nil {
+		return nil, err
+	}
+	w, h := *width, *height
+	var img image.Image
+	switch *cs {
+	case "DeviceGray":
+		if len(sd.Content) < w*h {
+			return nil, fmt.Errorf("short image data")
+		}
+		img = &image.Gray{Pix: sd.Content[:w*h], Stride: w, Rect: image.Rect(0, 0, w, h)}
+	case "DeviceRGB":
+		if len(sd.Content) < 3*w*h {
+			return nil, fmt.Errorf("short image data")
+		}
+		rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i := 0; i < w*h; i++ {
+			copy(rgba.Pix[4*i:4*i+3], sd.Content[3*i:3*i+3])
+			rgba.Pix[4*i+3] = 0xff
+		}
+		img = rgba
+	default:
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deflateBest compresses the samples of a losslessly compressed image at
+// the best compression level
+func deflateBest(sd *types.StreamDict) ([]byte, error) {
+	if sd.Content == nil {
+		if err := sd.Decode(); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(sd.Content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
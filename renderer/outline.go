@@ -0,0 +1,33 @@
+package renderer
+
+import (
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// OutlineEntry is a bookmark of a PDF and the page it leads to
+type OutlineEntry struct {
+	Title string
+	Page  int // From 1
+}
+
+// Outline returns the bookmarks of a PDF in reading order, each followed by
+// its children, nil if it has none
+func Outline(file string) ([]OutlineEntry, error) {
+	conf := model.NewDefaultConfiguration()
+	conf.CreateBookmarks = false
+	bms, err := readBookmarks(file, conf)
+	if err != nil {
+		return nil, err
+	}
+	var entries []OutlineEntry
+	var add func(bms []pdfcpu.Bookmark)
+	add = func(bms []pdfcpu.Bookmark) {
+		for _, bm := range bms {
+			entries = append(entries, OutlineEntry{Title: bm.Title, Page: bm.PageFrom})
+			add(bm.Kids)
+		}
+	}
+	add(bms)
+	return entries, nil
+}
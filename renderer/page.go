@@ -0,0 +1,102 @@
+package renderer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PageSetup is the page geometry shared by the engines
+type PageSetup struct {
+	Size      string  // Paper size name, see pageSizes, or "<width>x<height>mm"
+	Landscape bool    // Turn the paper sideways
+	Margins   Margins // Page margins
+	DPI       uint    // Resolution wkhtmltopdf lays pages out at
+}
+
+// Margins are page margins in millimeters
+type Margins struct {
+	Top, Right, Bottom, Left float64
+}
+
+// DefaultPageSetup is A4 portrait with 20mm margins at 96 DPI
+var DefaultPageSetup = PageSetup{Size: "A4", Margins: Margins{20, 20, 20, 20}, DPI: 96}
+
+// pageSizes are the portrait dimensions of the named paper sizes, in mm. All
+// of them are known to wkhtmltopdf by name as well.
+var pageSizes = map[string][2]float64{
+	"A3":     {297, 420},
+	"A4":     {210, 297},
+	"A5":     {148, 210},
+	"A6":     {105, 148},
+	"B5":     {176, 250},
+	"Letter": {215.9, 279.4},
+	"Legal":  {215.9, 355.6},
+}
+
+// pageSizeName returns the canonical spelling of a named paper size
+func pageSizeName(size string) (string, bool) {
+	for name := range pageSizes {
+		if strings.EqualFold(name, size) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Dimensions returns the width and height of the paper in mm, turned
+// sideways for landscape
+func (p PageSetup) Dimensions() (width, height float64, err error) {
+	if name, ok := pageSizeName(p.Size); ok {
+		width, height = pageSizes[name][0], pageSizes[name][1]
+	} else {
+		w, h, ok := strings.Cut(strings.TrimSuffix(strings.ToLower(p.Size), "mm"), "x")
+		if ok {
+			width, err = strconv.ParseFloat(w, 64)
+			if err == nil {
+				height, err = strconv.ParseFloat(h, 64)
+			}
+		}
+		if !ok || err != nil || width <= 0 || height <= 0 {
+			return 0, 0, fmt.Errorf("unknown page size %q, expected A3, A4, A5, A6, B5, Letter, Legal or <width>x<height>mm", p.Size)
+		}
+	}
+	if p.Landscape {
+		width, height = height, width
+	}
+	return width, height, nil
+}
+
+// ParseMargins parses margins in millimeters given like in CSS: one value for
+// all sides, or top and bottom then right and left, or top, right and left,
+// bottom, or top, right, bottom, left. Values may have an "mm" suffix.
+func ParseMargins(s string) (Margins, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' })
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(field, "mm"), 64)
+		if err != nil || v < 0 {
+			return Margins{}, fmt.Errorf("invalid margin %q, expected millimeters", field)
+		}
+		values[i] = v
+	}
+	switch len(values) {
+	case 1:
+		return Margins{values[0], values[0], values[0], values[0]}, nil
+	case 2:
+		return Margins{values[0], values[1], values[0], values[1]}, nil
+	case 3:
+		return Margins{values[0], values[1], values[2], values[1]}, nil
+	case 4:
+		return Margins{values[0], values[1], values[2], values[3]}, nil
+	}
+	return Margins{}, fmt.Errorf("invalid margins %q, expected 1 to 4 values", s)
+}
+
+// page returns the page setup to render with, DefaultPageSetup if none was set
+func (o Options) page() PageSetup {
+	if o.Page.Size == "" {
+		return DefaultPageSetup
+	}
+	return o.Page
+}
@@ -0,0 +1,188 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// iccProfileLocations are where sRGB profiles are commonly installed, as globs
+var iccProfileLocations = []string{
+	"/usr/share/color/icc/sRGB.icc",
+	"/usr/share/color/icc/colord/sRGB.icc",
+	"/usr/share/color/icc/ghostscript/srgb.icc",
+	"/usr/share/ghostscript/*/iccprofiles/srgb.icc",
+	"/usr/local/share/ghostscript/*/iccprofiles/srgb.icc",
+	"/opt/homebrew/share/ghostscript/*/iccprofiles/srgb.icc",
+	"/System/Library/ColorSync/Profiles/sRGB Profile.icc",
+	`C:\Program Files\gs\*\iccprofiles\srgb.icc`,
+	`C:\Windows\System32\spool\drivers\color\sRGB Color Space Profile.icm`,
+}
+
+// pdfaDefinition is the PostScript Ghostscript runs before the document to
+// declare the sRGB output intent PDF/A requires, with the profile file name
+const pdfaDefinition = `%%!
+[/_objdef {icc_PDFA} /type /stream /OBJ pdfmark
+[{icc_PDFA} << /N 3 >> /PUT pdfmark
+[{icc_PDFA} (%s) (r) file /PUT pdfmark
+[/_objdef {OutputIntent_PDFA} /type /dict /OBJ pdfmark
+[{OutputIntent_PDFA} << /Type /OutputIntent /S /GTS_PDFA1 /DestOutputProfile {icc_PDFA} /OutputConditionIdentifier (sRGB) >> /PUT pdfmark
+[{Catalog} << /OutputIntents [ {OutputIntent_PDFA} ] >> /PUT pdfmark
+`
+
+// DetectGhostscript returns the path of Ghostscript, which converts PDFs to
+// PDF/A, or "" if it isn't installed
+func DetectGhostscript() string {
+	for _, name := range []string{"gs", "gswin64c", "gswin32c"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// findICCProfile returns the first sRGB profile found in iccProfileLocations
+func findICCProfile() string {
+	for _, pattern := range iccProfileLocations {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			sort.Strings(matches)
+			return matches[len(matches)-1] // The latest Ghostscript version
+		}
+	}
+	return ""
+}
+
+// ConvertPDFA converts file in place to PDF/A-2b with Ghostscript: it embeds
+// all fonts, converts colors to sRGB with iccProfile as the output intent
+// (found in the usual places if empty) and adds XMP metadata matching the
+// document information. A non-zero date is passed on as SOURCE_DATE_EPOCH,
+// for reproducible output.
+func ConvertPDFA(file, iccProfile string, date time.Time) error {
+	gs := DetectGhostscript()
+	if gs == "" {
+		return fmt.Errorf("PDF/A output needs Ghostscript (gs), which was not found in PATH")
+	}
+	if iccProfile == "" {
+		if iccProfile = findICCProfile(); iccProfile == "" {
+			return fmt.Errorf("no sRGB ICC profile found for the PDF/A output intent, give one with --icc-profile")
+		}
+	}
+	iccProfile, err := filepath.Abs(iccProfile)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(file), ".pdfa-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	definition := filepath.Join(tmpDir, "PDFA_def.ps")
+	escaped := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(filepath.ToSlash(iccProfile))
+	if err := os.WriteFile(definition, []byte(fmt.Sprintf(pdfaDefinition, escaped)), 0644); err != nil {
+		return err
+	}
+	converted := filepath.Join(tmpDir, "pdfa.pdf")
+
+	cmd := exec.Command(gs, "-q", "-dBATCH", "-dNOPAUSE", "-dSAFER",
+		"--permit-file-read="+iccProfile,
+		"-sDEVICE=pdfwrite", "-dPDFA=2", "-dPDFACompatibilityPolicy=1",
+		"-sColorConversionStrategy=RGB", "-dEmbedAllFonts=true", "-dSubsetFonts=true",
+		"-sOutputFile="+converted, definition, file)
+	cmd.Env = os.Environ()
+	if !date.IsZero() {
+		cmd.Env = append(cmd.Env, "SOURCE_DATE_EPOCH="+strconv.FormatInt(date.Unix(), 10))
+	}
+	var stderr bytes.Buffer
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+	slog.Info("Converting to PDF/A-2b", "file", file)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ghostscript failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out := strings.TrimSpace(stderr.String()); out != "" {
+		slog.Debug("Ghostscript", "output", out)
+	}
+	return os.Rename(converted, file)
+}
+
+// CheckPDFA checks file for PDF/A-2b conformance with veraPDF if it is
+// installed, otherwise for the requirements most often missed: embedded
+// fonts, XMP metadata, an output intent and no encryption. It returns the
+// problems found.
+func CheckPDFA(file string) ([]string, error) {
+	if verapdf, err := exec.LookPath("verapdf"); err == nil {
+		out, err := exec.Command(verapdf, "--flavour", "2b", "--format", "text", file).Output()
+		if len(out) == 0 && err != nil {
+			return nil, fmt.Errorf("verapdf failed: %w", err)
+		}
+		if strings.HasPrefix(strings.TrimSpace(string(out)), "PASS") {
+			return nil, nil
+		}
+		return []string{"veraPDF: " + strings.TrimSpace(string(out))}, nil
+	}
+
+	ctx, err := api.ReadContextFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	if ctx.Encrypt != nil {
+		problems = append(problems, "the file is encrypted")
+	}
+	if _, ok := ctx.RootDict["Metadata"]; !ok {
+		problems = append(problems, "no XMP metadata")
+	}
+	if _, ok := ctx.RootDict["OutputIntents"]; !ok {
+		problems = append(problems, "no output intent")
+	}
+
+	unembedded := map[string]bool{}
+	for _, entry := range ctx.Table {
+		d, ok := entry.Object.(types.Dict)
+		if !ok || d.Type() == nil {
+			continue
+		}
+		switch *d.Type() {
+		case "Font":
+			// Type0 and Type3 fonts have no descriptor of their own
+			if _, ok := d["FontDescriptor"]; !ok && d.Subtype() != nil && *d.Subtype() != "Type0" && *d.Subtype() != "Type3" {
+				unembedded[nameEntry(d, "BaseFont")] = true
+			}
+		case "FontDescriptor":
+			_, file1 := d["FontFile"]
+			_, file2 := d["FontFile2"]
+			_, file3 := d["FontFile3"]
+			if !file1 && !file2 && !file3 {
+				unembedded[nameEntry(d, "FontName")] = true
+			}
+		}
+	}
+	if len(unembedded) > 0 {
+		var names []string
+		for name := range unembedded {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		problems = append(problems, "fonts not embedded: "+strings.Join(names, ", "))
+	}
+	return problems, nil
+}
+
+// nameEntry returns the name d has for key, "?" if none
+func nameEntry(d types.Dict, key string) string {
+	if name := d.NameEntry(key); name != nil {
+		return *name
+	}
+	return "?"
+}
@@ -0,0 +1,211 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/SebastiaanKlippert/go-wkhtmltopdf"
+)
+
+// WkhtmltopdfInfo describes the wkhtmltopdf binary found by the preflight check
+type WkhtmltopdfInfo struct {
+	Path      string
+	Version   string
+	PatchedQt bool // Unpatched builds can't do covers, TOCs, outlines or headers
+}
+
+var (
+	wkhtmltopdfVersion   = regexp.MustCompile(`wkhtmltopdf\s+([0-9][0-9.]*)`)
+	wkhtmltopdfPatchedQt = regexp.MustCompile(`(?i)with patched qt`)
+)
+
+// wkhtmltopdfCandidates lists where to look for wkhtmltopdf, in order:
+// the WKHTMLTOPDF_PATH override (a binary or the directory containing it),
+// PATH, and the default install locations of the platform
+func wkhtmltopdfCandidates() []string {
+	exe := "wkhtmltopdf"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+
+	var candidates []string
+	if override := os.Getenv("WKHTMLTOPDF_PATH"); override != "" {
+		if info, err := os.Stat(override); err == nil && info.IsDir() {
+			override = filepath.Join(override, exe)
+		}
+		candidates = append(candidates, override)
+	}
+	if path, err := exec.LookPath(exe); err == nil {
+		candidates = append(candidates, path)
+	}
+	switch runtime.GOOS {
+	case "windows":
+		candidates = append(candidates,
+			filepath.Join(os.Getenv("ProgramFiles"), "wkhtmltopdf", "bin", exe),
+			filepath.Join(os.Getenv("ProgramFiles(x86)"), "wkhtmltopdf", "bin", exe))
+	case "darwin":
+		candidates = append(candidates, "/usr/local/bin/wkhtmltopdf", "/opt/homebrew/bin/wkhtmltopdf")
+	default:
+		candidates = append(candidates, "/usr/local/bin/wkhtmltopdf", "/usr/bin/wkhtmltopdf")
+	}
+	return candidates
+}
+
+// DetectWkhtmltopdf finds a working wkhtmltopdf and reports its version
+func DetectWkhtmltopdf() (*WkhtmltopdfInfo, error) {
+	var lastErr error
+	for _, path := range wkhtmltopdfCandidates() {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		out, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+		cancel()
+		if err != nil {
+			lastErr = fmt.Errorf("%s --version failed: %v", path, err)
+			continue
+		}
+		info := &WkhtmltopdfInfo{Path: path, PatchedQt: wkhtmltopdfPatchedQt.Match(out)}
+		if m := wkhtmltopdfVersion.FindSubmatch(out); m != nil {
+			info.Version = string(m[1])
+		}
+		return info, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("wkhtmltopdf not found")
+}
+
+// DetectChrome returns the path of a Chrome or Chromium executable, or "" if
+// none is installed in a usual location
+func DetectChrome() string {
+	for _, name := range []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "chrome", "headless-shell"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	var paths []string
+	switch runtime.GOOS {
+	case "darwin":
+		paths = []string{
+			"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+			"/Applications/Chromium.app/Contents/MacOS/Chromium",
+		}
+	case "windows":
+		paths = []string{
+			filepath.Join(os.Getenv("ProgramFiles"), "Google", "Chrome", "Application", "chrome.exe"),
+			filepath.Join(os.Getenv("ProgramFiles(x86)"), "Google", "Chrome", "Application", "chrome.exe"),
+			filepath.Join(os.Getenv("LocalAppData"), "Google", "Chrome", "Application", "chrome.exe"),
+		}
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// wkhtmltopdfInstallHint explains how to get a patched-qt wkhtmltopdf on this OS
+func wkhtmltopdfInstallHint() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "Install wkhtmltopdf with `choco install wkhtmltopdf` or the installer from https://wkhtmltopdf.org/downloads.html, " +
+			"then add its bin directory to PATH or set WKHTMLTOPDF_PATH to it."
+	case "darwin":
+		return "Install wkhtmltopdf with `brew install --cask wkhtmltopdf` or the package from https://wkhtmltopdf.org/downloads.html."
+	default:
+		return "Distribution packages of wkhtmltopdf are usually built without patched qt. Install the wkhtmltox package for your " +
+			"distribution from https://wkhtmltopdf.org/downloads.html (newer distributions may additionally need libssl1.1), " +
+			"or set WKHTMLTOPDF_PATH to an existing binary."
+	}
+}
+
+// SelectEngine resolves the requested engine to one that is usable here.
+// "auto" prefers a patched-qt wkhtmltopdf, then Chrome, then the native
+// renderer; an explicitly requested engine that is missing is an error.
+// The returned info is set when the engine is wkhtmltopdf.
+func SelectEngine(requested, chromePath string) (string, *WkhtmltopdfInfo, error) {
+	switch requested {
+	case "native":
+		return requested, nil, nil
+	case "chrome":
+		if chromePath == "" && DetectChrome() == "" {
+			return "", nil, fmt.Errorf("chrome not found; install Chrome or Chromium, or pass --chrome-path")
+		}
+		return requested, nil, nil
+	}
+
+	info, err := DetectWkhtmltopdf()
+	if err == nil {
+		wkhtmltopdf.SetPath(info.Path)
+		if requested == "wkhtmltopdf" || info.PatchedQt {
+			warnUnpatched(info)
+			return "wkhtmltopdf", info, nil
+		}
+	} else if requested == "wkhtmltopdf" {
+		return "", nil, fmt.Errorf("%v. %s", err, wkhtmltopdfInstallHint())
+	} else {
+		slog.Warn(err.Error(), "hint", wkhtmltopdfInstallHint())
+	}
+
+	if chromePath != "" || DetectChrome() != "" {
+		slog.Warn("Falling back to --engine chrome")
+		return "chrome", nil, nil
+	}
+	if err == nil {
+		// An unpatched wkhtmltopdf still beats the native renderer
+		warnUnpatched(info)
+		return "wkhtmltopdf", info, nil
+	}
+	slog.Warn("Neither wkhtmltopdf nor Chrome is available, falling back to the reduced-fidelity --engine native")
+	return "native", nil, nil
+}
+
+// warnUnpatched warns that the selected wkhtmltopdf lacks the features of
+// patched qt, if it does
+func warnUnpatched(info *WkhtmltopdfInfo) {
+	if !info.PatchedQt {
+		slog.Warn("wkhtmltopdf is not built with patched qt; covers, generated TOCs, outlines and headers will be missing",
+			"version", info.Version, "path", info.Path, "hint", wkhtmltopdfInstallHint())
+	}
+}
+
+// PrintPreflight reports to w which rendering engines are available
+func PrintPreflight(w io.Writer, chromePath string) {
+	if info, err := DetectWkhtmltopdf(); err != nil {
+		fmt.Fprintf(w, "wkhtmltopdf: not found (%v)\n  %s\n", err, wkhtmltopdfInstallHint())
+	} else {
+		patched := "with patched qt"
+		if !info.PatchedQt {
+			patched = "WITHOUT patched qt (covers, TOCs, outlines and headers unsupported)"
+		}
+		fmt.Fprintf(w, "wkhtmltopdf: %s, version %s, %s\n", info.Path, info.Version, patched)
+		if !info.PatchedQt {
+			fmt.Fprintf(w, "  %s\n", wkhtmltopdfInstallHint())
+		}
+	}
+	if chromePath == "" {
+		chromePath = DetectChrome()
+	}
+	if chromePath == "" {
+		fmt.Fprintln(w, "chrome: not found")
+	} else {
+		fmt.Fprintf(w, "chrome: %s\n", chromePath)
+	}
+	fmt.Fprintln(w, "native: always available")
+	if gs := DetectGhostscript(); gs == "" {
+		fmt.Fprintln(w, "ghostscript: not found (needed for --pdfa)")
+	} else {
+		fmt.Fprintf(w, "ghostscript: %s\n", gs)
+	}
+}
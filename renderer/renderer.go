@@ -0,0 +1,94 @@
+// Package renderer turns the combined HTML document into a PDF with one of
+// several engines: wkhtmltopdf, headless Chrome, or a pure-Go fallback.
+package renderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Renderer turns a combined HTML document into a PDF
+type Renderer interface {
+	// Render renders the HTML file input to the PDF file output
+	Render(input, output string) error
+}
+
+// Options are the settings shared by the rendering engines
+type Options struct {
+	CoverFile    string    // Title page rendered before a generated TOC (wkhtmltopdf only)
+	TOCDepth     uint      // Heading levels in the generated TOC, 0 for all of them
+	OutlineDepth uint      // Number of heading levels in the PDF bookmarks
+	ChromePath   string    // Chrome executable, empty to let chromedp find one
+	Page         PageSetup // Paper and margins, DefaultPageSetup if Size is empty
+	Running      Running   // Header and footer, none if both templates are empty
+	Grayscale    bool      // Print in shades of gray, for monochrome printers
+	Zoom         float64   // Scale of the content, 0 for 1
+	// FontSize is the size of the text in points for the native engine,
+	// which reads no stylesheets, 0 for its default of 11
+	FontSize float64
+
+	// Timeout stops wkhtmltopdf or Chrome if a render takes longer, 0 for no
+	// limit, so a hung engine doesn't stall the build
+	Timeout time.Duration
+	// MemoryLimit stops wkhtmltopdf or Chrome, with ErrKilled, once its
+	// processes use more bytes of memory together, 0 for no limit. It is
+	// only enforced on Linux.
+	MemoryLimit int64
+}
+
+// New returns the renderer for an engine name as accepted by SelectEngine
+func New(engine string, opts Options) (Renderer, error) {
+	switch engine {
+	case "wkhtmltopdf":
+		return &Wkhtmltopdf{opts}, nil
+	case "chrome":
+		return &Chrome{opts}, nil
+	case "native":
+		return &Native{opts}, nil
+	}
+	return nil, fmt.Errorf("unknown rendering engine %q", engine)
+}
+
+// withTimeout returns ctx limited to timeout, unless it is 0
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// fileURL returns the file:// URL of a local file for the engines to open,
+// percent-encoded so that names with spaces, # or non-ASCII letters survive,
+// and without the \\?\ prefix of long Windows paths, which URLs cannot carry
+func fileURL(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	abs = filepath.ToSlash(abs)
+	if unc, ok := strings.CutPrefix(abs, "//?/UNC/"); ok {
+		abs = "//" + unc
+	} else {
+		abs = strings.TrimPrefix(abs, "//?/")
+	}
+	u := url.URL{Scheme: "file", Path: abs}
+	if share, ok := strings.CutPrefix(abs, "//"); ok {
+		// \\server\share\file is file://server/share/file
+		u.Host, u.Path, _ = strings.Cut(share, "/")
+		u.Path = "/" + u.Path
+	} else if !strings.HasPrefix(u.Path, "/") {
+		// C:/dir/file is file:///C:/dir/file
+		u.Path = "/" + u.Path
+	}
+	return u.String(), nil
+}
+
+// timedOut reports whether ctx ended because its timeout passed
+func timedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
@@ -0,0 +1,261 @@
+package renderer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// runningStamp places a part of the running header or footer where the
+// engines put theirs: within the side margins, half way into the top or
+// bottom margin. The offsets are in points.
+const runningStamp = "font:Helvetica, points:8, pos:%s, off:%.0f %.0f, scale:1 abs, rot:0, fillcolor:#000000"
+
+// pointsPerMM converts millimeters to PDF points
+const pointsPerMM = 72 / 25.4
+
+// SplitOptions controls RenderChapters
+type SplitOptions struct {
+	Jobs int       // Chapters rendered at once, at least one
+	Page PageSetup // Page geometry the chapters are rendered with, for placing the header and footer
+	// Running is printed on the merged pages, with the chapter titles in
+	// Titles as {section}. The renderer itself should print none.
+	Running Running
+	Titles  []string
+	// Progress, if not nil, is called as chapters are done
+	Progress func(done, total int)
+}
+
+// FrontMatter writes the HTML of the pages before the first chapter, given
+// the page each chapter starts on, and returns its file
+type FrontMatter func(starts []int) (string, error)
+
+// RenderChapters renders each chapter file to a PDF of its own, several at a
+// time, and merges them behind the front matter into output. Chapter
+// bookmarks are moved to their pages in the merged document and the running
+// header and footer number pages continuously. Rendering chapters separately needs far less memory
+// than rendering the whole document at once.
+func RenderChapters(r Renderer, chapters []string, front FrontMatter, output string, opts SplitOptions) error {
+	tmpDir, err := os.MkdirTemp("", "i2pdoc2pdf-chapters-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pdfs := make([]string, len(chapters))
+	errs := make([]error, len(chapters))
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	var done atomic.Int64
+	for i, chapter := range chapters {
+		pdfs[i] = filepath.Join(tmpDir, fmt.Sprintf("chapter-%03d.pdf", i))
+		wg.Add(1)
+		go func(i int, chapter string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			slog.Debug("Rendering chapter", "chapter", i+1, "of", len(chapters))
+			errs[i] = r.Render(chapter, pdfs[i])
+			if opts.Progress != nil {
+				opts.Progress(int(done.Add(1)), len(chapters))
+			}
+		}(i, chapter)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", chapters[i], err)
+		}
+	}
+
+	counts := make([]int, len(pdfs))
+	for i, pdf := range pdfs {
+		if counts[i], err = api.PageCountFile(pdf); err != nil {
+			return fmt.Errorf("failed to read %s: %w", pdf, err)
+		}
+	}
+
+	// The front matter lists where chapters start, which depends on its own
+	// length: render it once to measure it, then again with the real numbers
+	frontPDF := filepath.Join(tmpDir, "front.pdf")
+	starts := make([]int, len(chapters))
+	frontPages := 0
+	for pass := 0; pass < 2; pass++ {
+		page := frontPages + 1
+		for i, count := range counts {
+			starts[i] = page
+			page += count
+		}
+		frontFile, err := front(starts)
+		if err != nil {
+			return err
+		}
+		if err := r.Render(frontFile, frontPDF); err != nil {
+			return fmt.Errorf("failed to render the front matter: %w", err)
+		}
+		if frontPages, err = api.PageCountFile(frontPDF); err != nil {
+			return err
+		}
+	}
+
+	conf := model.NewDefaultConfiguration()
+	conf.CreateBookmarks = false
+	var bookmarks []pdfcpu.Bookmark
+	sections := make([]string, frontPages) // Section of each merged page
+	for i, pdf := range append([]string{frontPDF}, pdfs...) {
+		bms, err := readBookmarks(pdf, conf)
+		if err != nil {
+			return err
+		}
+		bookmarks = append(bookmarks, shiftBookmarks(bms, len(sections))...)
+		if i > 0 {
+			title := ""
+			if i-1 < len(opts.Titles) {
+				title = opts.Titles[i-1]
+			}
+			for p := 0; p < counts[i-1]; p++ {
+				sections = append(sections, title)
+			}
+		}
+	}
+
+	slog.Info("Merging chapters", "count", len(chapters))
+	merged := filepath.Join(tmpDir, "merged.pdf")
+	if err := api.MergeCreateFile(append([]string{frontPDF}, pdfs...), merged, false, conf); err != nil {
+		return fmt.Errorf("failed to merge chapters: %w", err)
+	}
+	if len(bookmarks) > 0 {
+		withBookmarks := filepath.Join(tmpDir, "bookmarked.pdf")
+		if err := api.AddBookmarksFile(merged, withBookmarks, bookmarks, true, conf); err != nil {
+			return fmt.Errorf("failed to add bookmarks: %w", err)
+		}
+		merged = withBookmarks
+	}
+
+	slog.Info("Writing PDF", "file", output)
+	return stampRunning(merged, output, opts, sections, conf)
+}
+
+// stampRunning writes in to output with the running header and footer
+// printed on every page, sections giving the {section} of each page
+func stampRunning(in, output string, opts SplitOptions, sections []string, conf *model.Configuration) error {
+	margins := opts.Page.Margins
+	if opts.Page.Size == "" {
+		margins = DefaultPageSetup.Margins
+	}
+	left, right := margins.Left*pointsPerMM, -margins.Right*pointsPerMM
+	type position struct {
+		part string
+		pos  string
+		x, y float64
+	}
+	var positions []position
+	header, footer := parts(opts.Running.Header), parts(opts.Running.Footer)
+	top, bottom := -margins.Top/2*pointsPerMM, margins.Bottom/2*pointsPerMM
+	for i, x := range []float64{left, 0, right} {
+		positions = append(positions,
+			position{header[i], []string{"tl", "tc", "tr"}[i], x, top},
+			position{footer[i], []string{"bl", "bc", "br"}[i], x, bottom})
+	}
+
+	// pdfcpu fills in %p and %P; pages of a chapter share their stamps
+	stamps := map[string]*model.Watermark{}
+	pages := map[int][]*model.Watermark{}
+	for page, section := range sections {
+		number := "%p"
+		if opts.Running.PageOffset != 0 {
+			number = fmt.Sprint(page + 1 + opts.Running.PageOffset)
+		}
+		for _, p := range positions {
+			if p.part == "" {
+				continue
+			}
+			text := opts.Running.expand(p.part, number, "%P", section, plain)
+			if strings.TrimSpace(text) == "" {
+				continue // e.g. {section} on the title page
+			}
+			key := p.pos + "\x00" + text
+			wm, ok := stamps[key]
+			if !ok {
+				var err error
+				wm, err = api.TextWatermark(text, fmt.Sprintf(runningStamp, p.pos, p.x, p.y), true, false, types.POINTS)
+				if err != nil {
+					return fmt.Errorf("invalid header or footer %q: %w", p.part, err)
+				}
+				stamps[key] = wm
+			}
+			pages[page+1] = append(pages[page+1], wm)
+		}
+	}
+	if len(pages) == 0 {
+		data, err := os.ReadFile(in)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(output, data, 0644)
+	}
+	f, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	conf.Cmd = model.ADDWATERMARKS
+	ctx, err := api.ReadValidateAndOptimize(f, conf)
+	if err != nil {
+		return err
+	}
+	// One page at a time: pdfcpu numbers the objects it adds in map order,
+	// which would make every build differ
+	for page := 1; page <= len(sections); page++ {
+		if len(pages[page]) == 0 {
+			continue
+		}
+		if err := pdfcpu.AddWatermarksSliceMap(ctx, map[int][]*model.Watermark{page: pages[page]}); err != nil {
+			return err
+		}
+	}
+	return api.WriteContextFile(ctx, output)
+}
+
+// readBookmarks returns the outline of a PDF, nil if it has none
+func readBookmarks(file string, conf *model.Configuration) ([]pdfcpu.Bookmark, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	bms, err := api.Bookmarks(f, conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the bookmarks of %s: %w", file, err)
+	}
+	return bms, nil
+}
+
+// shiftBookmarks moves bookmarks and their children offset pages further
+func shiftBookmarks(bms []pdfcpu.Bookmark, offset int) []pdfcpu.Bookmark {
+	shifted := make([]pdfcpu.Bookmark, len(bms))
+	for i, bm := range bms {
+		shifted[i] = pdfcpu.Bookmark{
+			Title:    bm.Title,
+			PageFrom: bm.PageFrom + offset,
+			Bold:     bm.Bold,
+			Italic:   bm.Italic,
+			Color:    bm.Color,
+			Kids:     shiftBookmarks(bm.Kids, offset),
+		}
+	}
+	return shifted
+}
@@ -0,0 +1,150 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/SebastiaanKlippert/go-wkhtmltopdf"
+)
+
+// Wkhtmltopdf renders with wkhtmltopdf, the only engine that can generate a
+// table of contents with page numbers
+type Wkhtmltopdf struct {
+	Options
+}
+
+// Render renders the combined HTML in input to the PDF output
+func (w *Wkhtmltopdf) Render(input, output string) error {
+	// Initialize PDF generator
+	pdfg, err := wkhtmltopdf.NewPDFGenerator()
+	if err != nil {
+		return fmt.Errorf("failed to create PDF generator: %w", err)
+	}
+
+	// Configure PDF settings
+	setup := w.page()
+	pdfg.Dpi.Set(setup.DPI)
+	pdfg.MarginBottom.Set(uint(math.Round(setup.Margins.Bottom)))
+	pdfg.MarginTop.Set(uint(math.Round(setup.Margins.Top)))
+	pdfg.MarginLeft.Set(uint(math.Round(setup.Margins.Left)))
+	pdfg.MarginRight.Set(uint(math.Round(setup.Margins.Right)))
+	if name, ok := pageSizeName(setup.Size); ok {
+		pdfg.PageSize.Set(name)
+		if setup.Landscape {
+			pdfg.Orientation.Set(wkhtmltopdf.OrientationLandscape)
+		} else {
+			pdfg.Orientation.Set(wkhtmltopdf.OrientationPortrait)
+		}
+	} else {
+		width, height, err := setup.Dimensions()
+		if err != nil {
+			return err
+		}
+		pdfg.PageWidth.Set(uint(math.Round(width)))
+		pdfg.PageHeight.Set(uint(math.Round(height)))
+	}
+	pdfg.OutlineDepth.Set(w.OutlineDepth)
+	pdfg.Grayscale.Set(w.Grayscale)
+
+	if w.CoverFile != "" {
+		cover, err := fileURL(w.CoverFile)
+		if err != nil {
+			return err
+		}
+		pdfg.Cover.Input = cover
+		pdfg.Cover.EnableLocalFileAccess.Set(true)
+		pdfg.TOC.Include = true
+		pdfg.TOC.TocHeaderText.Set("Table of Contents")
+		if w.TOCDepth > 0 {
+			style, err := writeTOCStyle(w.TOCDepth)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(style)
+			pdfg.TOC.XslStyleSheet.Set(style)
+		}
+	}
+
+	// Create page from combined HTML, by URL so the path reaches
+	// wkhtmltopdf intact whatever the code page of Windows
+	inputURL, err := fileURL(input)
+	if err != nil {
+		return err
+	}
+	page := wkhtmltopdf.NewPage(inputURL)
+	page.EnableLocalFileAccess.Set(true)
+	page.LoadErrorHandling.Set("ignore")
+	//page.EnableJavascript.Set(false)
+	page.LoadMediaErrorHandling.Set("ignore")
+	if w.Zoom > 0 {
+		page.Zoom.Set(w.Zoom)
+	}
+	// wkhtmltopdf fills in [page], [toPage] and [section] itself
+	header, footer := parts(w.Running.Header), parts(w.Running.Footer)
+	set := func(opt interface{ Set(string) }, part string) {
+		if part != "" {
+			opt.Set(w.Running.expand(part, "[page]", "[toPage]", "[section]", plain))
+		}
+	}
+	set(&page.HeaderLeft, header[0])
+	set(&page.HeaderCenter, header[1])
+	set(&page.HeaderRight, header[2])
+	set(&page.FooterLeft, footer[0])
+	set(&page.FooterCenter, footer[1])
+	set(&page.FooterRight, footer[2])
+	if w.Running.PageOffset > 0 {
+		page.PageOffset.Set(uint(w.Running.PageOffset))
+	}
+
+	pdfg.AddPage(page)
+
+	ctx, cancel := withTimeout(context.Background(), w.Timeout)
+	defer cancel()
+	return w.run(ctx, pdfg, input, output)
+}
+
+// run runs wkhtmltopdf as pdfg is set up, writing the PDF to output, and
+// stops it when ctx is done or it uses more than w.MemoryLimit
+func (w *Wkhtmltopdf) run(ctx context.Context, pdfg *wkhtmltopdf.PDFGenerator, input, output string) error {
+	ctx, kill := context.WithCancel(ctx)
+	defer kill()
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var stderr bytes.Buffer
+	// NewPDFGenerator found the executable
+	cmd := exec.CommandContext(ctx, wkhtmltopdf.GetPath(), pdfg.Args()...)
+	cmd.Stdout, cmd.Stderr = f, &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start wkhtmltopdf: %w", err)
+	}
+	watch := watchMemory(cmd.Process.Pid, w.MemoryLimit, kill)
+	err = cmd.Wait()
+	used := watch.end()
+	if err == nil {
+		slog.Info("Writing PDF", "file", output)
+		return f.Close()
+	}
+	f.Close()
+	os.Remove(output)
+	switch {
+	case timedOut(ctx):
+		return fmt.Errorf("wkhtmltopdf timed out after %s rendering %s", w.Timeout, input)
+	case used > 0:
+		return fmt.Errorf("wkhtmltopdf used %d MB of memory, over the limit of %d MB, rendering %s: %w", used>>20, w.MemoryLimit>>20, input, ErrKilled)
+	case signaled(err):
+		return fmt.Errorf("wkhtmltopdf ended with %s rendering %s, most likely for running out of memory: %w", cmd.ProcessState, input, ErrKilled)
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%s\n%w", msg, err)
+	}
+	return err
+}
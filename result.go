@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"i2pdoc2pdf/renderer"
+)
+
+// Exit codes, so scripts can tell what went wrong
+const (
+	exitFailure = 1 // Anything else, such as invalid flags
+	exitUsage   = 2 // Unknown command
+	exitFetch   = 3 // Cloning or updating the docs failed
+	exitProcess = 4 // Processing the pages failed
+	exitRender  = 5 // Rendering or writing the outputs failed
+	exitPartial = 6 // The outputs were written, but some pages failed and were left out
+)
+
+// exitError is an error ending the run with code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// failed makes err end the run with code, unless it already has a code
+func failed(code int, err error) error {
+	var e *exitError
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the code the run ends with after err
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
+
+// runResult is the summary --json prints when the run ends
+type runResult struct {
+	Command  string   `json:"command"`
+	Status   string   `json:"status"` // "ok", "partial" or "failed"
+	ExitCode int      `json:"exit_code"`
+	Error    string   `json:"error,omitempty"`
+	Output   string   `json:"output,omitempty"`  // The PDF, or the HTML with --format html
+	Outputs  []string `json:"outputs,omitempty"` // Every document written
+	Pages    int      `json:"pages,omitempty"`   // Of the PDF
+	Warnings []string `json:"warnings"`
+	Duration float64  `json:"duration_seconds"`
+}
+
+// printResult prints the result of command, which ended with err after
+// running since start, to stdout as JSON if --json. Everything else the run
+// prints goes to stderr then.
+func (o *options) printResult(command string, start time.Time, err error) {
+	if !o.jsonResult {
+		return
+	}
+	result := runResult{
+		Command:  command,
+		Status:   "ok",
+		ExitCode: exitCode(err),
+		Warnings: o.warnings.list(),
+		Duration: time.Since(start).Seconds(),
+	}
+	switch result.ExitCode {
+	case 0:
+	case exitPartial:
+		result.Status = "partial"
+	default:
+		result.Status = "failed"
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	for _, t := range o.targetBuilds {
+		if t.built {
+			result.Outputs = append(result.Outputs, t.distributed()...)
+		}
+	}
+	if o.built && (err == nil || result.ExitCode == exitPartial) {
+		result.Outputs = o.distributed()
+		switch o.format {
+		case "html":
+			result.Output = o.htmlOutput
+		case "epub":
+			result.Output = o.epubFile()
+		default:
+			result.Output = o.outputFile
+			result.Pages, _ = renderer.PageCount(o.outputFile, o.userPassword)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// buildIndex is builds.json, the list of the builds kept with --keep-builds
+type buildIndex struct {
+	Builds []buildRecord `json:"builds"` // Newest first
+}
+
+// buildRecord is a build listed in builds.json
+type buildRecord struct {
+	Built    time.Time `json:"built"`
+	Date     string    `json:"date"`
+	Revision string    `json:"revision,omitempty"`
+	Files    []string  `json:"files"` // Relative to the directory of builds.json
+}
+
+// buildIndexFile returns where the builds kept with --keep-builds are listed
+func (o *options) buildIndexFile() string {
+	return filepath.Join(filepath.Dir(o.outputFile), "builds.json")
+}
+
+// published returns the files written by the build: its outputs and bundle,
+// the torrent and checksums and the signatures of all of them
+func (o *options) published() []string {
+	files := o.distributed()
+	if o.torrent {
+		files = append(files, o.torrentFile())
+	}
+	if o.checksums || o.sign != "" {
+		files = append(files, o.checksumFile())
+	}
+	for _, file := range files {
+		for _, sig := range []string{file + ".asc", file + ".sig"} {
+			if fileExists(sig) {
+				files = append(files, sig)
+			}
+		}
+	}
+	return files
+}
+
+// recordBuild adds the build to builds.json and, beyond the last
+// --keep-builds builds, deletes the files of older ones. A file written
+// again, as happens unless --output names {date} or the like, belongs to the
+// newest build only.
+func (o *options) recordBuild(stats buildStats) error {
+	if o.keepBuilds <= 0 {
+		return nil
+	}
+	indexFile := o.buildIndexFile()
+	dir := filepath.Dir(indexFile)
+	index, err := readBuildIndex(indexFile)
+	if err != nil {
+		return err
+	}
+
+	build := buildRecord{Built: time.Now().UTC().Truncate(time.Second), Date: stats.Date, Revision: stats.Revision}
+	for _, file := range o.published() {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || !filepath.IsLocal(rel) {
+			// Files elsewhere, such as --page-pdfs, are not rotated
+			continue
+		}
+		build.Files = append(build.Files, filepath.ToSlash(rel))
+	}
+	builds := []buildRecord{build}
+	for _, b := range index.Builds {
+		b.Files = slices.DeleteFunc(b.Files, func(f string) bool {
+			return slices.Contains(build.Files, f)
+		})
+		if len(b.Files) > 0 {
+			builds = append(builds, b)
+		}
+	}
+
+	if len(builds) > o.keepBuilds {
+		for _, b := range builds[o.keepBuilds:] {
+			for _, f := range b.Files {
+				if err := os.Remove(filepath.Join(dir, filepath.FromSlash(f))); err != nil && !os.IsNotExist(err) {
+					slog.Warn("Cannot delete an old build", "file", f, "err", err)
+				}
+			}
+			slog.Info("Deleted an old build", "built", b.Built, "files", len(b.Files))
+		}
+		builds = builds[:o.keepBuilds]
+	}
+	index.Builds = builds
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Replaced atomically, serve reads it alongside
+	err = writeFile(indexFile, func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error writing the build index: %w", err)
+	}
+	slog.Debug("Recorded the build", "file", indexFile, "builds", len(builds))
+	return nil
+}
+
+// readBuildIndex reads builds.json, empty if there is none yet
+func readBuildIndex(file string) (buildIndex, error) {
+	var index buildIndex
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return index, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return index, fmt.Errorf("invalid build index %s: %w", file, err)
+	}
+	return index, nil
+}
@@ -0,0 +1,282 @@
+// Package sam accepts streams on an I2P destination through the SAMv3 bridge
+// of a local I2P router, so the documentation can be served inside I2P.
+package sam
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAddress is where routers listen for SAM clients by default
+const DefaultAddress = "127.0.0.1:7656"
+
+// signatureType is Ed25519, the signature type routers recommend
+const signatureType = "7"
+
+// i2pBase64 is the base64 alphabet of I2P, with - and ~ for + and /
+var i2pBase64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-~")
+
+// Session is a SAM stream session, which keeps its destination published in
+// the network for as long as it is open
+type Session struct {
+	bridge string
+	id     string
+	ctrl   net.Conn // Control connection, the session ends when it closes
+
+	// Destination is the public destination of the session, I2P base64
+	Destination string
+}
+
+// LoadKeys returns the private keys of a destination kept in file, generating
+// them with the bridge at bridge and writing them to file when it doesn't
+// exist yet, so the destination stays the same from run to run
+func LoadKeys(bridge, file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	c, r, err := hello(bridge)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	reply, err := command(c, r, "DEST GENERATE SIGNATURE_TYPE="+signatureType)
+	if err != nil {
+		return "", err
+	}
+	keys := reply["PRIV"]
+	if keys == "" {
+		return "", fmt.Errorf("SAM bridge returned no keys")
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, []byte(keys+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return keys, nil
+}
+
+// NewSession creates a stream session called id for the destination of keys
+// through the bridge at bridge. Creating its tunnels can take a minute.
+func NewSession(bridge, id, keys string) (*Session, error) {
+	c, r, err := hello(bridge)
+	if err != nil {
+		return nil, err
+	}
+	_, err = command(c, r, fmt.Sprintf("SESSION CREATE STYLE=STREAM ID=%s DESTINATION=%s SIGNATURE_TYPE=%s", id, keys, signatureType))
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("cannot create SAM session: %w", err)
+	}
+	dest, err := publicDestination(keys)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &Session{bridge: bridge, id: id, ctrl: c, Destination: dest}, nil
+}
+
+// Address returns the .b32.i2p address of the session's destination
+func (s *Session) Address() string {
+	return Base32Address(s.Destination)
+}
+
+// Close ends the session, taking the destination off the network
+func (s *Session) Close() error {
+	return s.ctrl.Close()
+}
+
+// Listen returns a listener accepting the streams peers open to the session
+func (s *Session) Listen() net.Listener {
+	return &listener{session: s}
+}
+
+// Base32Address returns the .b32.i2p address of dest, a destination in I2P
+// base64, or "" if it isn't one
+func Base32Address(dest string) string {
+	data, err := i2pBase64.DecodeString(dest)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(sum[:])) + ".b32.i2p"
+}
+
+// publicDestination returns the destination of keys, which are the
+// destination followed by its private keys: 256 bytes of encryption key, 128
+// of signing key and a certificate whose length is in its bytes 1 and 2
+func publicDestination(keys string) (string, error) {
+	data, err := i2pBase64.DecodeString(keys)
+	if err != nil || len(data) < 387 {
+		return "", fmt.Errorf("invalid destination keys")
+	}
+	size := 387 + int(data[385])<<8 + int(data[386])
+	if len(data) < size {
+		return "", fmt.Errorf("invalid destination keys")
+	}
+	return i2pBase64.EncodeToString(data[:size]), nil
+}
+
+// hello connects to the bridge and agrees on the protocol version
+func hello(bridge string) (net.Conn, *bufio.Reader, error) {
+	c, err := net.DialTimeout("tcp", bridge, 10*time.Second)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot reach the SAM bridge (is the router's SAM application enabled?): %w", err)
+	}
+	r := bufio.NewReader(c)
+	if _, err := command(c, r, "HELLO VERSION MIN=3.1 MAX=3.3"); err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return c, r, nil
+}
+
+// command sends line to the bridge and returns the fields of its reply,
+// failing unless the reply has no RESULT or RESULT=OK
+func command(c net.Conn, r *bufio.Reader, line string) (map[string]string, error) {
+	if _, err := fmt.Fprintf(c, "%s\n", line); err != nil {
+		return nil, err
+	}
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("SAM bridge closed the connection: %w", err)
+	}
+	fields := parseReply(reply)
+	if result, ok := fields["RESULT"]; ok && result != "OK" {
+		if msg := fields["MESSAGE"]; msg != "" {
+			return nil, fmt.Errorf("SAM bridge: %s: %s", result, msg)
+		}
+		return nil, fmt.Errorf("SAM bridge: %s", result)
+	}
+	return fields, nil
+}
+
+// parseReply returns the KEY=VALUE fields of a reply line, whose values may
+// be quoted
+func parseReply(line string) map[string]string {
+	fields := map[string]string{}
+	var token strings.Builder
+	quoted := false
+	flush := func() {
+		if key, value, ok := strings.Cut(token.String(), "="); ok {
+			fields[key] = value
+		}
+		token.Reset()
+	}
+	for _, r := range strings.TrimSpace(line) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			flush()
+		default:
+			token.WriteRune(r)
+		}
+	}
+	flush()
+	return fields
+}
+
+// listener accepts the streams of a session, one STREAM ACCEPT at a time
+type listener struct {
+	session *Session
+
+	mu      sync.Mutex
+	pending net.Conn // Connection waiting for the next peer, closed by Close
+	closed  bool
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, r, err := hello(l.session.bridge)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		c.Close()
+		return nil, net.ErrClosed
+	}
+	l.pending = c
+	l.mu.Unlock()
+
+	if _, err := command(c, r, "STREAM ACCEPT ID="+l.session.id+" SILENT=false"); err != nil {
+		c.Close()
+		return nil, l.err(err)
+	}
+	// The bridge sends the peer's destination once one connects
+	peer, err := r.ReadString('\n')
+	if err != nil {
+		c.Close()
+		return nil, l.err(err)
+	}
+	l.mu.Lock()
+	l.pending = nil
+	l.mu.Unlock()
+	dest, _, _ := strings.Cut(strings.TrimSpace(peer), " ")
+	return &conn{Conn: c, r: r, local: Addr(l.session.Destination), remote: Addr(dest)}, nil
+}
+
+// err returns net.ErrClosed for errors caused by closing the listener
+func (l *listener) err(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return net.ErrClosed
+	}
+	return err
+}
+
+func (l *listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.pending != nil {
+		return l.pending.Close()
+	}
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return Addr(l.session.Destination)
+}
+
+// conn is a stream with a peer. Data the bridge sent along with the peer's
+// destination is already in r.
+type conn struct {
+	net.Conn
+	r             *bufio.Reader
+	local, remote Addr
+}
+
+func (c *conn) Read(p []byte) (int, error) { return c.r.Read(p) }
+func (c *conn) LocalAddr() net.Addr        { return c.local }
+func (c *conn) RemoteAddr() net.Addr       { return c.remote }
+
+// Addr is an I2P destination in base64
+type Addr string
+
+func (a Addr) Network() string { return "i2p" }
+
+// String returns the .b32.i2p address of the destination
+func (a Addr) String() string {
+	if b32 := Base32Address(string(a)); b32 != "" {
+		return b32
+	}
+	return string(a)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"gopkg.in/yaml.v3"
+
+	"i2pdoc2pdf/htmlproc"
+)
+
+// Choices of the page settings the selection cycles through
+var (
+	selectPageSizes    = []string{"A4", "Letter", "Legal", "A5", "A3", "A6", "B5"}
+	selectOrientations = []string{"portrait", "landscape"}
+	selectTOCStyles    = []string{"pages", "links", "none"}
+)
+
+// selectItem is a section or page of the docs tree shown by runSelect
+type selectItem struct {
+	node     *htmlproc.Node
+	depth    int
+	parent   int // Index of the parent item, -1 at the top
+	checked  bool
+	expanded bool
+}
+
+// selectModel is the terminal UI of runSelect
+type selectModel struct {
+	items  []selectItem
+	cursor int
+	top    int      // First item shown
+	height int      // Lines of the terminal
+	sizes  []string // selectPageSizes, after any other --page-size
+	size   int      // Indexes into the page setting choices
+	orient int
+	toc    int
+	save   bool
+}
+
+// runSelect shows the docs tree in --input in a terminal UI, where sections
+// and pages can be checked or unchecked and the page settings chosen, and
+// writes the selection to --profile as a config file for --config. The
+// current --include, --exclude and page settings are the starting point.
+func runSelect(o *options) error {
+	pages, err := htmlproc.FindPages(o.inputDir, ".html", ".rst")
+	if err != nil {
+		return fmt.Errorf("error finding pages: %w", err)
+	}
+	if len(pages) == 0 {
+		return fmt.Errorf("no pages found in %s, run fetch first", o.inputDir)
+	}
+	files := make([]string, len(pages))
+	for i, page := range pages {
+		files[i] = page.File
+	}
+	tree := htmlproc.BuildTree(o.inputDir, files)
+	filter, err := htmlproc.NewPathFilter(splitList(o.include), splitList(o.exclude))
+	if err != nil {
+		return err
+	}
+
+	m := &selectModel{
+		sizes:  selectPageSizes,
+		orient: max(slices.Index(selectOrientations, o.orientation), 0),
+		toc:    max(slices.Index(selectTOCStyles, o.tocStyle), 0),
+	}
+	if !slices.Contains(m.sizes, o.pageSize) {
+		m.sizes = append([]string{o.pageSize}, m.sizes...)
+	}
+	m.size = slices.Index(m.sizes, o.pageSize)
+	var add func(n *htmlproc.Node, depth, parent int) bool
+	add = func(n *htmlproc.Node, depth, parent int) bool {
+		i := len(m.items)
+		m.items = append(m.items, selectItem{node: n, depth: depth, parent: parent, expanded: depth == 0})
+		checked := n.File != "" && filter.Match(n.Path, strings.Trim(o.sitePath, "/"))
+		for _, c := range n.Children {
+			if add(c, depth+1, i) {
+				checked = true
+			}
+		}
+		m.items[i].checked = checked
+		return checked
+	}
+	for _, c := range tree.Children {
+		add(c, 0, -1)
+	}
+	if len(m.items) == 0 {
+		return fmt.Errorf("no sections to select in %s", o.inputDir)
+	}
+
+	final, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	if err != nil {
+		return fmt.Errorf("error running the terminal UI: %w", err)
+	}
+	if m = final.(*selectModel); !m.save {
+		slog.Info("Selection not saved")
+		return nil
+	}
+	return m.writeProfile(o.profile)
+}
+
+func (m *selectModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *selectModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		visible := m.visible()
+		pos := max(slices.Index(visible, m.cursor), 0)
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		case "s", "ctrl+s":
+			m.save = true
+			return m, tea.Quit
+		case "up", "k":
+			m.cursor = visible[max(pos-1, 0)]
+		case "down", "j":
+			m.cursor = visible[min(pos+1, len(visible)-1)]
+		case "home", "g":
+			m.cursor = visible[0]
+		case "end", "G":
+			m.cursor = visible[len(visible)-1]
+		case "right", "l", "enter":
+			m.items[m.cursor].expanded = true
+		case "left", "h":
+			if m.items[m.cursor].expanded && len(m.items[m.cursor].node.Children) > 0 {
+				m.items[m.cursor].expanded = false
+			} else if parent := m.items[m.cursor].parent; parent >= 0 {
+				m.cursor = parent
+			}
+		case " ", "x":
+			m.toggle(m.cursor)
+		case "a":
+			for i := range m.items {
+				m.items[i].checked = true
+			}
+		case "n":
+			for i := range m.items {
+				m.items[i].checked = false
+			}
+		case "p":
+			m.size = (m.size + 1) % len(m.sizes)
+		case "o":
+			m.orient = (m.orient + 1) % len(selectOrientations)
+		case "t":
+			m.toc = (m.toc + 1) % len(selectTOCStyles)
+		}
+	}
+	return m, nil
+}
+
+// toggle checks or unchecks item i with everything in it. Checking an item
+// checks the sections it is in too, as a section can't be left out without
+// its pages.
+func (m *selectModel) toggle(i int) {
+	checked := !m.items[i].checked
+	for j := i; j < len(m.items) && (j == i || m.items[j].depth > m.items[i].depth); j++ {
+		m.items[j].checked = checked
+	}
+	if checked {
+		for p := m.items[i].parent; p >= 0; p = m.items[p].parent {
+			m.items[p].checked = true
+		}
+	}
+}
+
+// visible returns the items whose sections are expanded
+func (m *selectModel) visible() []int {
+	var items []int
+	for i, item := range m.items {
+		shown := true
+		for p := item.parent; p >= 0; p = m.items[p].parent {
+			shown = shown && m.items[p].expanded
+		}
+		if shown {
+			items = append(items, i)
+		}
+	}
+	return items
+}
+
+func (m *selectModel) View() string {
+	var sb strings.Builder
+	sb.WriteString("Select the sections and pages to include\n\n")
+	visible := m.visible()
+	lines := len(visible)
+	if m.height > 0 {
+		lines = max(m.height-7, 1)
+	}
+	pos := max(slices.Index(visible, m.cursor), 0)
+	if pos < m.top {
+		m.top = pos
+	} else if pos >= m.top+lines {
+		m.top = pos - lines + 1
+	}
+	for _, i := range visible[m.top:min(m.top+lines, len(visible))] {
+		item := m.items[i]
+		cursor, box, fold := "  ", "[ ]", "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		if item.checked {
+			box = "[x]"
+		}
+		if len(item.node.Children) > 0 {
+			fold = "▸ "
+			if item.expanded {
+				fold = "▾ "
+			}
+		}
+		fmt.Fprintf(&sb, "%s%s%s %s%s\n", cursor, strings.Repeat("  ", item.depth), box, fold, item.node.Name)
+	}
+	fmt.Fprintf(&sb, "\nPage size: %s   Orientation: %s   TOC: %s\n",
+		m.sizes[m.size], selectOrientations[m.orient], selectTOCStyles[m.toc])
+	sb.WriteString("space toggle · ←/→ fold · a/n all/none · p size · o orientation · t TOC · s save · q quit\n")
+	return sb.String()
+}
+
+// excluded returns the patterns leaving out the unchecked items, a section
+// standing for everything in it
+func (m *selectModel) excluded() []string {
+	var patterns []string
+	for i := 0; i < len(m.items); i++ {
+		if m.items[i].checked {
+			continue
+		}
+		patterns = append(patterns, m.items[i].node.Path)
+		depth := m.items[i].depth
+		for i+1 < len(m.items) && m.items[i+1].depth > depth {
+			i++
+		}
+	}
+	return patterns
+}
+
+// writeProfile writes the selection to the config file at path, keeping the
+// other settings of an existing file. Its comments are lost.
+func (m *selectModel) writeProfile(path string) error {
+	settings := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := yaml.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(settings, "include")
+	delete(settings, "exclude")
+	if exclude := m.excluded(); len(exclude) > 0 {
+		settings["exclude"] = exclude
+	}
+	settings["page-size"] = m.sizes[m.size]
+	settings["orientation"] = selectOrientations[m.orient]
+	settings["toc"] = selectTOCStyles[m.toc]
+
+	var sb strings.Builder
+	enc := yaml.NewEncoder(&sb)
+	enc.SetIndent(2)
+	if err := enc.Encode(settings); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("error writing --profile: %w", err)
+	}
+	slog.Info("Saved selection", "file", path, "excluded", len(m.excluded()))
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// docServer serves the outputs of the latest build
+type docServer struct {
+	o *options
+
+	mu       sync.Mutex        // Guards the fields below, builds run alongside requests
+	files    map[string]string // URL path → output file
+	latest   string            // URL path of the PDF, or of the HTML with --format html
+	builds   []servedBuild     // Builds kept with --keep-builds, newest first
+	archived map[string]string // URL path → file of the builds and builds.json
+	built    time.Time
+	err      error
+	building bool
+}
+
+// servedFile is an output listed on the index page
+type servedFile struct {
+	URL      string
+	Name     string
+	Size     string
+	Modified string
+}
+
+// servedBuild is a build kept with --keep-builds listed on the index page
+type servedBuild struct {
+	Built    string
+	Revision string
+	Files    []servedFile
+}
+
+var serveIndex = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>I2P documentation</title>
+<style>body{font-family:sans-serif;max-width:50em;margin:2em auto;padding:0 1em}td{padding:.2em 1em .2em 0}.error{color:#b00}</style>
+</head><body>
+<h1>I2P documentation</h1>
+{{if .Latest}}<p><a href="{{.Latest}}">Latest documentation</a></p>{{end}}
+<p>{{if .Building}}Building now. {{end}}{{if .Built.IsZero}}Not built yet.{{else}}Last built {{.Built.Format "2006-01-02 15:04 MST"}}.{{end}}{{if .Every}} Rebuilt every {{.Every}} if the docs changed.{{end}}</p>
+{{if .Error}}<p class="error">The last build failed: {{.Error}}</p>{{end}}
+{{with .Documents}}<h2>Documents</h2><table>{{range .}}<tr><td><a href="{{.URL}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{.Modified}}</td></tr>{{end}}</table>{{end}}
+{{with .Pages}}<h2>Pages</h2><table>{{range .}}<tr><td><a href="{{.URL}}">{{.Name}}</a></td><td>{{.Size}}</td></tr>{{end}}</table>{{end}}
+{{with .Builds}}<h2>Builds</h2><p>Also listed in <a href="/builds.json">builds.json</a>.</p><table>{{range .}}<tr><td>{{.Built}}</td><td>{{.Revision}}</td><td>{{range .Files}}<a href="{{.URL}}">{{.Name}}</a> ({{.Size}})<br>{{end}}</td></tr>{{end}}</table>{{end}}
+</body></html>
+`))
+
+// runServe serves the outputs of the build over HTTP on --listen with an
+// index page linking them, until interrupted. It builds the docs as all does
+// when it starts, which only renders what changed, then every
+// --rebuild-every as update does. Outputs are replaced
+// atomically, so requests during a rebuild get the previous version.
+func runServe(o *options) error {
+	l, err := net.Listen("tcp", o.listen)
+	if err != nil {
+		return err
+	}
+	return serveDocs(o, l, "http://"+o.listen+"/")
+}
+
+// serveDocs serves the documentation as runServe does on l, whose address
+// is url
+func serveDocs(o *options, l net.Listener, url string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	o.watch = false
+
+	s := &docServer{o: o}
+	s.collect()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveHTTP)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(l)
+	}()
+	slog.Info("Serving documentation", "url", url)
+
+	go s.schedule(ctx)
+	select {
+	case err := <-errc:
+		return fmt.Errorf("error serving: %w", err)
+	case <-ctx.Done():
+	}
+	slog.Info("Stopping server")
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// schedule builds now, then every --rebuild-every
+func (s *docServer) schedule(ctx context.Context) {
+	s.rebuild(true)
+	if s.o.rebuildEvery <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.o.rebuildEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.rebuild(false)
+		}
+	}
+}
+
+// rebuild updates the docs and rebuilds them if they changed. With all, or
+// for crawled docs, which have no commits to compare, it always builds them.
+func (s *docServer) rebuild(all bool) {
+	s.mu.Lock()
+	s.building = true
+	s.mu.Unlock()
+
+	var err error
+	if !all && s.o.source == "git" {
+		err = runUpdate(s.o)
+	} else {
+		err = runAll(s.o)
+	}
+	if err != nil {
+		slog.Error("Rebuild failed", "err", err)
+	}
+
+	s.mu.Lock()
+	s.building, s.err = false, err
+	s.mu.Unlock()
+	s.collect()
+}
+
+// collect looks up the outputs of the latest build
+func (s *docServer) collect() {
+	files := map[string]string{}
+	latest := ""
+	for _, file := range s.o.outputs() {
+		if file == "" || !fileExists(file) {
+			continue
+		}
+		url := "/" + filepath.Base(file)
+		if s.o.pagePDFs != "" {
+			if rel, err := filepath.Rel(s.o.pagePDFs, file); err == nil && filepath.IsLocal(rel) {
+				url = path.Join("/pages", filepath.ToSlash(rel))
+			}
+		}
+		files[url] = file
+		if latest == "" {
+			latest = url
+		}
+	}
+
+	archived := map[string]string{}
+	builds := s.collectBuilds(archived)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files, s.latest, s.builds, s.archived = files, latest, builds, archived
+	if info, err := os.Stat(files[latest]); err == nil {
+		s.built = info.ModTime()
+	}
+}
+
+// collectBuilds looks up the builds kept with --keep-builds, adding their
+// files and builds.json to files by URL path
+func (s *docServer) collectBuilds(files map[string]string) []servedBuild {
+	if s.o.keepBuilds <= 0 {
+		return nil
+	}
+	indexFile := s.o.buildIndexFile()
+	index, err := readBuildIndex(indexFile)
+	if err != nil {
+		slog.Warn("Cannot list the builds", "err", err)
+		return nil
+	}
+	files["/builds.json"] = indexFile
+	var builds []servedBuild
+	for _, b := range index.Builds {
+		build := servedBuild{Built: b.Built.Local().Format("2006-01-02 15:04"), Revision: b.Revision}
+		for _, f := range b.Files {
+			file := filepath.Join(filepath.Dir(indexFile), filepath.FromSlash(f))
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			url := "/" + f
+			files[url] = file
+			build.Files = append(build.Files, servedFile{URL: url, Name: f, Size: formatSize(info.Size())})
+		}
+		builds = append(builds, build)
+	}
+	return builds
+}
+
+// serveHTTP serves the index page, the outputs and /latest, which redirects
+// to the current PDF
+func (s *docServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	file, ok := s.files[r.URL.Path]
+	if !ok {
+		file, ok = s.archived[r.URL.Path]
+	}
+	latest := s.latest
+	s.mu.Unlock()
+	switch {
+	case ok:
+		http.ServeFile(w, r, file)
+	case r.URL.Path == "/latest" && latest != "":
+		http.Redirect(w, r, latest, http.StatusFound)
+	case r.URL.Path == "/":
+		s.serveIndex(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveIndex writes the index page listing the outputs
+func (s *docServer) serveIndex(w http.ResponseWriter) {
+	s.mu.Lock()
+	data := struct {
+		Latest           string
+		Built            time.Time
+		Building         bool
+		Every, Error     string
+		Documents, Pages []servedFile
+		Builds           []servedBuild
+	}{Latest: s.latest, Built: s.built, Building: s.building, Builds: s.builds}
+	if s.err != nil {
+		data.Error = s.err.Error()
+	}
+	if s.o.rebuildEvery > 0 {
+		data.Every = s.o.rebuildEvery.String()
+	}
+	urls := make([]string, 0, len(s.files))
+	for url := range s.files {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		f := servedFile{URL: url, Name: url[1:]}
+		if info, err := os.Stat(s.files[url]); err == nil {
+			f.Size = formatSize(info.Size())
+			f.Modified = info.ModTime().Format("2006-01-02 15:04")
+		}
+		if rel, ok := strings.CutPrefix(url, "/pages/"); ok {
+			f.Name = rel
+			data.Pages = append(data.Pages, f)
+		} else {
+			data.Documents = append(data.Documents, f)
+		}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := serveIndex.Execute(w, data); err != nil {
+		slog.Warn("Cannot write index page", "err", err)
+	}
+}
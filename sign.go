@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"i2pdoc2pdf/fetcher"
+	"i2pdoc2pdf/htmlproc"
+)
+
+// finishBuild writes the statistics, the latest link, the torrent, the
+// bundle and the checksums of a successful build, signs its outputs and
+// records it with --keep-builds
+func (o *options) finishBuild(stats buildStats, tree *htmlproc.Node) error {
+	o.built = true
+	if err := o.writeStats(stats); err != nil {
+		return err
+	}
+	if err := o.updateLatest(); err != nil {
+		return err
+	}
+	if o.torrent {
+		if err := o.writeTorrent(); err != nil {
+			return err
+		}
+	}
+	if o.bundle != "" {
+		if err := o.writeBundle(stats, tree); err != nil {
+			return err
+		}
+	}
+	if err := o.signOutputs(); err != nil {
+		return err
+	}
+	return o.recordBuild(stats)
+}
+
+// signOutputs writes the checksums of the outputs with --checksums or
+// --sign, and signs them with --sign
+func (o *options) signOutputs() error {
+	if !o.checksums && o.sign == "" {
+		return nil
+	}
+	manifest, err := o.writeChecksums()
+	if err != nil {
+		return fmt.Errorf("error writing checksums: %w", err)
+	}
+	if o.sign == "" {
+		return nil
+	}
+	for _, file := range append(o.distributed(), manifest) {
+		if err := signFile(file, o.sign); err != nil {
+			return fmt.Errorf("error signing %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// outputs returns the documents the build writes
+func (o *options) outputs() []string {
+	var files []string
+	if o.format == "epub" {
+		return []string{o.epubFile()}
+	}
+	if o.makesPDF() {
+		files = append(files, o.outputFile)
+		files = append(files, o.volumeFiles...)
+		files = append(files, o.pageFiles...)
+	}
+	if o.format == "html" || o.format == "both" {
+		files = append(files, o.htmlOutput)
+	}
+	return files
+}
+
+// makesPDF reports whether the build renders a PDF, rather than only the
+// standalone HTML or an EPUB
+func (o *options) makesPDF() bool {
+	return o.format == "pdf" || o.format == "both"
+}
+
+// epubFile returns where the EPUB of --format epub is written: --output,
+// with the extension .epub
+func (o *options) epubFile() string {
+	return strings.TrimSuffix(o.outputFile, filepath.Ext(o.outputFile)) + ".epub"
+}
+
+// distributed returns the files published from the build: its outputs and
+// the --bundle of them
+func (o *options) distributed() []string {
+	files := o.outputs()
+	if o.bundle != "" {
+		files = append(files, o.bundleFile())
+	}
+	return files
+}
+
+// checksumFile returns where the checksums of the outputs are written
+func (o *options) checksumFile() string {
+	return strings.TrimSuffix(o.outputFile, filepath.Ext(o.outputFile)) + ".sha256"
+}
+
+// writeChecksums writes the SHA-256 sums of the outputs next to --output, in
+// the format of sha256sum so that "sha256sum -c" verifies them, and returns
+// the file written
+func (o *options) writeChecksums() (string, error) {
+	manifest := o.checksumFile()
+	var sb strings.Builder
+	for _, file := range o.distributed() {
+		sum, err := sha256File(file)
+		if err != nil {
+			return "", err
+		}
+		// Relative to the manifest, so it can be checked wherever the files are copied
+		name, err := filepath.Rel(filepath.Dir(manifest), file)
+		if err != nil {
+			name = file
+		}
+		fmt.Fprintf(&sb, "%s  %s\n", sum, filepath.ToSlash(name))
+	}
+	if err := os.WriteFile(manifest, []byte(sb.String()), 0644); err != nil {
+		return "", err
+	}
+	slog.Info("Wrote checksums", "file", manifest)
+	return manifest, nil
+}
+
+// sha256File returns the hex SHA-256 sum of a file
+func sha256File(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// signFile writes a detached signature of file next to it. key is
+// "ssh:<private key file>" to sign with ssh-keygen, giving file.sig, or a GPG
+// key ID ("default" for gpg's default key), giving the ASCII-armored file.asc.
+func signFile(file, key string) error {
+	if keyFile, ok := strings.CutPrefix(key, "ssh:"); ok {
+		// ssh-keygen refuses to overwrite an earlier signature
+		os.Remove(file + ".sig")
+		if err := fetcher.ExecuteCommand("", "ssh-keygen", "-Y", "sign", "-q", "-f", keyFile, "-n", "file", file); err != nil {
+			return err
+		}
+		slog.Info("Signed", "file", file+".sig")
+		return nil
+	}
+	args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", file + ".asc"}
+	if key != "default" {
+		args = append(args, "--local-user", key)
+	}
+	if err := fetcher.ExecuteCommand("", "gpg", append(args, file)...); err != nil {
+		return err
+	}
+	slog.Info("Signed", "file", file+".asc")
+	return nil
+}
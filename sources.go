@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"i2pdoc2pdf/fetcher"
+	"i2pdoc2pdf/htmlproc"
+)
+
+// sourceConfig is another documentation source of a multi-source build, an
+// entry of the sources list of the config file. Its pages become a part of
+// the book after the i2p.www docs.
+type sourceConfig struct {
+	Name     string `yaml:"name"`      // Short name, e.g. "i2pd"
+	Title    string `yaml:"title"`     // Heading of the part, Name if empty
+	Repo     string `yaml:"repo"`      // Git URL of the repository holding the docs
+	Branch   string `yaml:"branch"`    // Branch to pull, "master" if empty
+	Path     string `yaml:"path"`      // Slash-separated path of the docs in the repository, "" for all of it
+	CloneDir string `yaml:"clone-dir"` // Where the repository is cloned
+	Input    string `yaml:"input"`     // Directory the docs are copied to, or taken from without a repo
+	Format   string `yaml:"format"`    // Page format: html, rst or markdown
+	SitePath string `yaml:"site-path"` // URL path of the docs on their website
+	SiteURL  string `yaml:"site-url"`  // Base URL of their website
+}
+
+// sourceName matches the names of sources, which end up in file names and
+// anchors
+var sourceName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// mainPart is the name of the part holding the i2p.www docs
+const mainPart = "i2p"
+
+// loadSources reads the sources list of a YAML config file
+func loadSources(file string) ([]sourceConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Sources []sourceConfig `yaml:"sources"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	names := map[string]bool{}
+	for i := range config.Sources {
+		s := &config.Sources[i]
+		if !sourceName.MatchString(s.Name) {
+			return nil, fmt.Errorf("%s: source %d needs a name of letters, digits, - and _", file, i+1)
+		}
+		if names[s.Name] || s.Name == mainPart {
+			return nil, fmt.Errorf("%s: source name %q is taken", file, s.Name)
+		}
+		names[s.Name] = true
+		if s.Repo == "" && s.Input == "" {
+			return nil, fmt.Errorf("%s: source %q needs a repo or an input", file, s.Name)
+		}
+		switch s.Format {
+		case "":
+			s.Format = "html"
+		case "html", "rst", "markdown":
+		default:
+			return nil, fmt.Errorf("%s: unknown format %q of source %q, expected html, rst or markdown", file, s.Format, s.Name)
+		}
+		if s.Branch == "" {
+			s.Branch = "master"
+		}
+	}
+	return config.Sources, nil
+}
+
+// sourceInput returns where the pages of s are read from: its input, or else a
+// directory named after it next to --input
+func (o *options) sourceInput(s sourceConfig) string {
+	if s.Input != "" {
+		return s.Input
+	}
+	return filepath.Clean(o.inputDir) + "-" + s.Name
+}
+
+// fetchSources clones or updates the repositories of the other sources and
+// copies their docs. update pulls the latest commit into existing clones.
+func (o *options) fetchSources(update bool) error {
+	for _, s := range o.sources {
+		if s.Repo == "" {
+			continue
+		}
+		cloneDir := s.CloneDir
+		if cloneDir == "" {
+			cloneDir = filepath.Join(filepath.Dir(filepath.Clean(o.repo.CloneDir)), s.Name+"-source")
+		}
+		repo := fetcher.RepositoryInfo{
+			URL:      s.Repo,
+			Branch:   s.Branch,
+			CloneDir: cloneDir,
+			Depth:    o.repo.Depth,
+			Proxy:    o.repo.Proxy,
+			Timeout:  o.repo.Timeout,
+			Retries:  o.repo.Retries,
+			Output:   o.repo.Output,
+		}
+		sparse := o.sparse && s.Path != ""
+		if sparse {
+			repo.SparsePaths = []string{s.Path}
+		}
+		slog.Info("Fetching source", "source", s.Name, "repo", s.Repo)
+		source := &fetcher.GitSource{
+			Update:   update,
+			Repo:     repo,
+			Sparse:   sparse,
+			DocsPath: path.Clean("/" + s.Path)[1:],
+			DestDir:  o.sourceInput(s),
+			Copy:     o.copyOpts,
+		}
+		if _, err := source.Fetch(); err != nil {
+			return fmt.Errorf("failed to fetch source %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// joinSources builds the pages of the other sources with the settings of
+// pipeline and makes a book of tree and them, each source a part of its
+// own. Their images are copied below the assets directory of pipeline.
+func (o *options) joinSources(tree *htmlproc.Node, pipeline *htmlproc.Pipeline) (*htmlproc.Node, []*htmlproc.AssetResolver, error) {
+	parts := []htmlproc.Part{{Name: mainPart, Title: o.partTitle, Tree: tree}}
+	var assets []*htmlproc.AssetResolver
+	for _, s := range o.sources {
+		slog.Info("Processing source", "source", s.Name)
+		title := s.Title
+		if title == "" {
+			title = s.Name
+		}
+		input := o.sourceInput(s)
+		p := &htmlproc.Pipeline{
+			InputDir:    input,
+			SitePath:    s.SitePath,
+			SiteURL:     s.SiteURL,
+			Format:      s.Format,
+			ID:          "part-" + s.Name,
+			Boilerplate: pipeline.Boilerplate,
+			Sanitize:    pipeline.Sanitize,
+			Fit:         pipeline.Fit,
+			RST:         pipeline.RST,
+			Math:        pipeline.Math,
+			Diagrams:    pipeline.Diagrams,
+			PrintLinks:  pipeline.PrintLinks,
+			Cache:       pipeline.Cache,
+			Jobs:        pipeline.Jobs,
+			Assets: &htmlproc.AssetResolver{
+				BaseDir: input,
+				Dir:     path.Join(pipeline.Assets.Dir, s.Name),
+				SVG:     pipeline.Assets.SVG,
+				Images:  pipeline.Assets.Images,
+			},
+		}
+		p.MinWords, p.SkipRedirects = pipeline.MinWords, pipeline.SkipRedirects
+		p.FailOnError = pipeline.FailOnError
+		sourceTree, err := p.Build()
+		for _, e := range p.Errors() {
+			e.Page = path.Join(s.Name, e.Page)
+			o.pageErrors = append(o.pageErrors, e)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("source %s: %w", s.Name, err)
+		}
+		if o.sourceNotes {
+			links := htmlproc.SourceLinks{RepoPath: s.Path}
+			if s.SiteURL != "" {
+				links.BaseURL = strings.TrimSuffix(s.SiteURL, "/") + path.Join("/", s.SitePath)
+			}
+			htmlproc.NoteSources(sourceTree, input, links)
+		}
+		parts = append(parts, htmlproc.Part{Name: s.Name, Title: title, Tree: sourceTree})
+		assets = append(assets, p.Assets)
+	}
+	return htmlproc.JoinParts(parts), assets, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"i2pdoc2pdf/htmlproc"
+	"i2pdoc2pdf/renderer"
+)
+
+// buildStats is the summary --stats writes after each build
+type buildStats struct {
+	Date     string `json:"date"`
+	Revision string `json:"revision,omitempty"`
+	htmlproc.Stats
+	PDF     *pdfStats  `json:"pdf,omitempty"`     // Nil for --format html
+	Volumes []pdfStats `json:"volumes,omitempty"` // With --split-by, PDF is the master index
+}
+
+// pdfStats describes the rendered PDF
+type pdfStats struct {
+	File  string `json:"file"`
+	Pages int    `json:"pages"`
+	Bytes int64  `json:"bytes"`
+}
+
+// writeStats writes the statistics of the build to --stats as JSON, after
+// adding those of the PDF if one was made
+func (o *options) writeStats(stats buildStats) error {
+	if o.statsFile == "" {
+		return nil
+	}
+	if o.makesPDF() {
+		pdf, err := o.pdfStats(o.outputFile)
+		if err != nil {
+			return err
+		}
+		stats.PDF = &pdf
+		for _, file := range o.volumeFiles {
+			volume, err := o.pdfStats(file)
+			if err != nil {
+				return err
+			}
+			stats.Volumes = append(stats.Volumes, volume)
+		}
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(o.statsFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing --stats: %w", err)
+	}
+	slog.Info("Wrote build statistics", "file", o.statsFile)
+	return nil
+}
+
+// pdfStats returns the statistics of a PDF written by the build
+func (o *options) pdfStats(file string) (pdfStats, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return pdfStats{}, fmt.Errorf("error reading PDF for --stats: %w", err)
+	}
+	pages, err := renderer.PageCount(file, o.userPassword)
+	if err != nil {
+		return pdfStats{}, fmt.Errorf("error reading PDF for --stats: %w", err)
+	}
+	return pdfStats{File: file, Pages: pages, Bytes: info.Size()}, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadTargets reads the targets of a YAML config file: named sets of flag
+// values, each building another edition of the docs with --targets, e.g.
+//
+//	targets:
+//	  a4: {page-size: A4, output: i2p-docs-a4.pdf}
+//	  letter: {page-size: Letter, output: i2p-docs-letter.pdf}
+//	  de: {lang: de, output: i2p-docs-de.pdf}
+func loadTargets(file string) (map[string]map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Targets map[string]map[string]interface{} `yaml:"targets"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	targets := map[string]map[string]string{}
+	for name, raw := range config.Targets {
+		if !sourceName.MatchString(name) || name == "all" {
+			return nil, fmt.Errorf("%s: target %q needs a name of letters, digits, - and _", file, name)
+		}
+		values, err := flagValues(file, raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range []string{"config", "targets", "watch"} {
+			if _, ok := values[key]; ok {
+				return nil, fmt.Errorf("%s: target %q cannot set %s", file, name, key)
+			}
+		}
+		targets[name] = values
+	}
+	return targets, nil
+}
+
+// targetsTranslate reports whether a target of the config file sets --lang,
+// so the translations must be fetched
+func (o *options) targetsTranslate() bool {
+	for _, values := range o.targetConfigs {
+		if values["lang"] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// targetNames returns the targets --targets picks, in the order given
+func (o *options) targetNames() ([]string, error) {
+	if len(o.targetConfigs) == 0 {
+		return nil, fmt.Errorf("--targets needs a --config file listing targets")
+	}
+	names := splitList(o.targets)
+	if len(names) == 1 && names[0] == "all" {
+		names = nil
+		for name := range o.targetConfigs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if _, ok := o.targetConfigs[name]; !ok {
+			var known []string
+			for name := range o.targetConfigs {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown target %q, expected %s or all", name, strings.Join(known, ", "))
+		}
+	}
+	return slices.Compact(names), nil
+}
+
+// targetOptions returns the options of the target called name: those of the
+// command line and config file, overridden by the settings of the target
+func (o *options) targetOptions(name string) (*options, error) {
+	t := &options{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	t.commonFlags(fs)
+	t.fetchFlags(fs)
+	t.buildFlags(fs)
+
+	values := o.targetConfigs[name]
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	args := slices.Clone(o.args)
+	for _, key := range keys {
+		if fs.Lookup(key) == nil {
+			return nil, fmt.Errorf("target %s: unknown setting %q", name, key)
+		}
+		args = append(args, "-"+key+"="+values[key])
+	}
+	if err := t.parse(fs, args); err != nil {
+		return nil, fmt.Errorf("target %s: %w", name, err)
+	}
+	t.targets, t.warnings, t.stdout = "", o.warnings, o.stdout
+	// The intermediate files of targets must not clash
+	if t.workDir != "" {
+		t.workDir = filepath.Join(t.workDir, name)
+	}
+	return t, nil
+}
+
+// runTargets builds the targets picked with --targets from the docs fetched
+// once. Their pages are processed one target at a time, so that targets
+// processing them alike share the page cache, and they render concurrently.
+// Every target is built even if another fails.
+func runTargets(o *options) error {
+	if o.watch {
+		return fmt.Errorf("--watch cannot be combined with --targets")
+	}
+	names, err := o.targetNames()
+	if err != nil {
+		return err
+	}
+	var processing sync.Mutex
+	outputs := map[string]string{}
+	for _, name := range names {
+		t, err := o.targetOptions(name)
+		if err != nil {
+			return err
+		}
+		output, _ := filepath.Abs(t.outputFile)
+		if other, ok := outputs[output]; ok {
+			return fmt.Errorf("targets %s and %s both write %s, give them another output", other, name, t.outputFile)
+		}
+		outputs[output] = name
+		t.processing = &processing
+		o.targetBuilds = append(o.targetBuilds, t)
+	}
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, t := range o.targetBuilds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slog.Info("Building target", "target", names[i], "output", t.outputFile)
+			if err := t.reportPageErrors(buildOnce(t)); err != nil {
+				errs[i] = fmt.Errorf("target %s: %w", names[i], err)
+				return
+			}
+			slog.Info("Built target", "target", names[i])
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultTrackers are open trackers inside I2P, as I2PSnark knows them
+const defaultTrackers = "http://tracker2.postman.i2p/announce.php,http://opentracker.dg2.i2p/a"
+
+// torrentFile returns where the torrent of the outputs is written
+func (o *options) torrentFile() string {
+	return strings.TrimSuffix(o.outputFile, filepath.Ext(o.outputFile)) + ".torrent"
+}
+
+// writeTorrent writes a torrent of the outputs of the build, announced to
+// --trackers and with --web-seeds, for I2PSnark and other clients. A single
+// output makes a single-file torrent; otherwise the files are placed in a
+// directory named after --output, below which they keep their paths
+// relative to the directory of --output; see torrentPath for the others.
+func (o *options) writeTorrent() error {
+	files := o.outputs()
+	if len(files) == 0 {
+		return nil
+	}
+	base := filepath.Dir(o.outputFile)
+	name := filepath.Base(files[0])
+	if len(files) > 1 {
+		name = strings.TrimSuffix(filepath.Base(o.outputFile), filepath.Ext(o.outputFile))
+	}
+
+	var total int64
+	var entries []any
+	seen := map[string]string{} // Path in the torrent → file
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		rel := o.torrentPath(base, file)
+		if seen[rel] != "" {
+			return fmt.Errorf("%s and %s would both be %s in the torrent", seen[rel], file, rel)
+		}
+		seen[rel] = file
+		var path []any
+		for _, part := range strings.Split(rel, "/") {
+			path = append(path, part)
+		}
+		entries = append(entries, map[string]any{"length": info.Size(), "path": path})
+	}
+	// Keep to around 1500 pieces, like most clients
+	pieceLength := int64(256 << 10)
+	for total/pieceLength > 1500 && pieceLength < 4<<20 {
+		pieceLength *= 2
+	}
+	pieces, err := pieceHashes(files, pieceLength)
+	if err != nil {
+		return err
+	}
+
+	info := map[string]any{"name": name, "piece length": pieceLength, "pieces": pieces}
+	if len(files) == 1 {
+		info["length"] = total
+	} else {
+		info["files"] = entries
+	}
+	torrent := map[string]any{
+		"info":          info,
+		"created by":    "i2pdoc2pdf " + version,
+		"creation date": o.buildDate().Unix(),
+	}
+	trackers := splitList(o.trackers)
+	if len(trackers) > 0 {
+		torrent["announce"] = trackers[0]
+		var tiers []any
+		for _, t := range trackers {
+			tiers = append(tiers, []any{t})
+		}
+		torrent["announce-list"] = tiers
+	}
+	if seeds := splitList(o.webSeeds); len(seeds) > 0 {
+		var urls []any
+		for _, s := range seeds {
+			urls = append(urls, s)
+		}
+		torrent["url-list"] = urls
+	}
+
+	var buf bytes.Buffer
+	bencode(&buf, torrent)
+	err = writeFile(o.torrentFile(), func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error writing torrent: %w", err)
+	}
+	var infoBuf bytes.Buffer
+	bencode(&infoBuf, info)
+	hash := sha1.Sum(infoBuf.Bytes())
+	slog.Info("Wrote torrent", "file", o.torrentFile(), "infohash", hex.EncodeToString(hash[:]), "files", len(files))
+	return nil
+}
+
+// torrentPath returns the slash-separated path of file in a multi-file
+// torrent: relative to base where it is below it. Page PDFs elsewhere keep
+// their tree below "pages", and other files keep only their name.
+func (o *options) torrentPath(base, file string) string {
+	if rel, err := filepath.Rel(base, file); err == nil && filepath.IsLocal(rel) {
+		return filepath.ToSlash(rel)
+	}
+	if o.pagePDFs != "" {
+		if rel, err := filepath.Rel(o.pagePDFs, file); err == nil && filepath.IsLocal(rel) {
+			return "pages/" + filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(file)
+}
+
+// pieceHashes returns the SHA-1 hashes of the pieces of files, read one after
+// the other as the torrent lays them out
+func pieceHashes(files []string, pieceLength int64) (string, error) {
+	var pieces bytes.Buffer
+	piece := sha1.New()
+	size := int64(0)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		for {
+			n, err := io.CopyN(piece, f, pieceLength-size)
+			size += n
+			if size == pieceLength {
+				pieces.Write(piece.Sum(nil))
+				piece.Reset()
+				size = 0
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return "", err
+			}
+		}
+		f.Close()
+	}
+	if size > 0 {
+		pieces.Write(piece.Sum(nil))
+	}
+	return pieces.String(), nil
+}
+
+// bencode writes v, a string, integer, list or dictionary, bencoded
+func bencode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case []any:
+		buf.WriteByte('l')
+		for _, item := range v {
+			bencode(buf, item)
+		}
+		buf.WriteByte('e')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, key := range keys {
+			bencode(buf, key)
+			bencode(buf, v[key])
+		}
+		buf.WriteByte('e')
+	default:
+		panic(fmt.Sprintf("cannot bencode %T", v))
+	}
+}
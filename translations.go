@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+
+	"i2pdoc2pdf/htmlproc"
+)
+
+// buildTranslations builds the pages of pipeline again with the catalogs of
+// each of --with-langs, for a combined edition where every page is followed
+// by its translations. The trees are in the order of --with-langs.
+func (o *options) buildTranslations(pipeline *htmlproc.Pipeline) ([]*htmlproc.Node, error) {
+	var trees []*htmlproc.Node
+	for _, lang := range splitList(o.withLangs) {
+		cat, err := htmlproc.LoadCatalogs(o.translationsDir, lang)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load translations: %w", err)
+		}
+		slog.Info("Processing translation", "lang", lang, "messages", len(cat))
+		p := *pipeline
+		p.Catalog = cat
+		p.ID = lang + "-doc"
+		p.Progress = nil
+		tree, err := p.Build()
+		for _, e := range p.Errors() {
+			e.Page = path.Join(lang, e.Page)
+			o.pageErrors = append(o.pageErrors, e)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("translation %s: %w", lang, err)
+		}
+		trees = append(trees, tree)
+	}
+	return trees, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"i2pdoc2pdf/htmlproc"
+	"i2pdoc2pdf/renderer"
+)
+
+// volumeFile returns where the PDF of a volume is written, next to --output
+func (o *options) volumeFile(v htmlproc.Volume) string {
+	return strings.TrimSuffix(o.outputFile, filepath.Ext(o.outputFile)) + "-" + v.Name + ".pdf"
+}
+
+// volumeHTML returns where the HTML of a volume is written, next to the
+// combined HTML file so they share its images
+func volumeHTML(combined, name string) string {
+	return strings.TrimSuffix(combined, filepath.Ext(combined)) + "-volume-" + name + ".html"
+}
+
+// splitVolumes splits tree into volumes as --split-by asks and records
+// their files
+func (o *options) splitVolumes(tree *htmlproc.Node) []htmlproc.Volume {
+	if o.splitBy == "none" {
+		return nil
+	}
+	volumes := htmlproc.SplitVolumes(tree)
+	o.volumeFiles = make([]string, len(volumes))
+	for i, v := range volumes {
+		o.volumeFiles[i] = o.volumeFile(v)
+	}
+	return volumes
+}
+
+// renderVolumes renders each top-level section of tree into a PDF of its
+// own, with its own title page and TOC, and a master index linking them to
+// --output. With --continuous-numbering each volume numbers its pages on
+// from the previous one.
+func (o *options) renderVolumes(tree *htmlproc.Node, combined string, docOpts htmlproc.DocumentOptions, setup renderer.PageSetup, running renderer.Running) error {
+	volumes := o.splitVolumes(tree)
+	if len(volumes) == 0 {
+		return fmt.Errorf("no top-level sections to split into volumes")
+	}
+	links := make([]string, len(volumes)) // Volume files relative to each other
+	for i := range volumes {
+		links[i] = filepath.Base(o.volumeFiles[i])
+	}
+	if err := htmlproc.LinkVolumes(volumes, func(i int) string { return links[i] }); err != nil {
+		return fmt.Errorf("error linking volumes: %w", err)
+	}
+
+	offset := 0
+	for i, v := range volumes {
+		slog.Info("Rendering volume", "volume", v.Title, "file", o.volumeFiles[i])
+		opts := docOpts
+		opts.Subtitle = fmt.Sprintf("Volume %d: %s", i+1, v.Title)
+		opts.TOC = o.tocStyle
+		opts.Cover = o.tocStyle != "pages" || o.splitRender
+		opts.Figures = volumeFigures(v, docOpts.Figures)
+		input := volumeHTML(combined, v.Name)
+		err := writeFile(input, func(w io.Writer) error {
+			return htmlproc.WriteDocument(w, v.Tree, opts)
+		})
+		if err != nil {
+			return fmt.Errorf("error writing volume: %w", err)
+		}
+		if !o.keepFiles() {
+			defer os.Remove(input)
+		}
+		cover := ""
+		if !opts.Cover {
+			cover = coverFile(input)
+			if err := os.WriteFile(cover, []byte(htmlproc.BuildCover(opts)), 0644); err != nil {
+				return fmt.Errorf("error writing cover page: %w", err)
+			}
+			if !o.keepFiles() {
+				defer os.Remove(cover)
+			}
+		}
+
+		volumeRunning := running
+		if o.continuousPages {
+			volumeRunning.PageOffset = offset
+		}
+		err = replaceFile(o.volumeFiles[i], func(pdf string) error {
+			if err := o.renderOne(v.Tree, input, cover, pdf, opts, setup, volumeRunning); err != nil {
+				return fmt.Errorf("error creating volume %s: %w", v.Title, err)
+			}
+			if o.continuousPages {
+				pages, err := renderer.PageCount(pdf, "")
+				if err != nil {
+					return err
+				}
+				offset += pages
+			}
+			meta := o.metadata()
+			meta.Title += ": " + v.Title
+			return o.finishPDF(pdf, meta)
+		})
+		if err != nil {
+			return err
+		}
+		if err := o.writeBooklet(o.volumeFiles[i]); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Rendering master index", "file", o.outputFile)
+	index := volumeHTML(combined, "index")
+	if err := os.WriteFile(index, []byte(htmlproc.BuildVolumeIndex(tree, volumes, links, docOpts)), 0644); err != nil {
+		return fmt.Errorf("error writing master index: %w", err)
+	}
+	if !o.keepFiles() {
+		defer os.Remove(index)
+	}
+	r, err := renderer.New(o.engine, renderer.Options{
+		OutlineDepth: o.outlineDepth,
+		ChromePath:   o.chromePath,
+		Timeout:      o.renderTimeout,
+		MemoryLimit:  o.memoryLimit(),
+		Page:         setup,
+		Grayscale:    o.grayscale,
+		Zoom:         o.zoom,
+		FontSize:     o.fontSize,
+		Running:      running,
+	})
+	if err != nil {
+		return err
+	}
+	return replaceFile(o.outputFile, func(pdf string) error {
+		if err := r.Render(index, pdf); err != nil {
+			return fmt.Errorf("error creating master index: %w", err)
+		}
+		return o.finishPDF(pdf, o.metadata())
+	})
+}
+
+// volumeFigures returns the figures that are in volume v
+func volumeFigures(v htmlproc.Volume, figures []htmlproc.Figure) []htmlproc.Figure {
+	var in []htmlproc.Figure
+	for _, f := range figures {
+		found := false
+		v.Tree.Walk(func(n *htmlproc.Node) {
+			found = found || strings.Contains(n.Content, `id="`+f.ID+`"`)
+		})
+		if found {
+			in = append(in, f)
+		}
+	}
+	return in
+}
+
+// engineTOCDepth returns the depth of the table of contents wkhtmltopdf
+// generates for tree, whose headings are a level deeper under the docs index
+// page
+func (o *options) engineTOCDepth(tree *htmlproc.Node) uint {
+	if o.tocDepth > 0 && tree.File != "" {
+		return o.tocDepth + 1
+	}
+	return o.tocDepth
+}
+
+// renderOne renders the document of tree, written to input, into output
+// with the engine, the way a whole document is rendered. Should the engine
+// be killed for running out of memory, the chapters are rendered one at a
+// time instead, as with --split-render.
+func (o *options) renderOne(tree *htmlproc.Node, input, cover, output string, opts htmlproc.DocumentOptions, setup renderer.PageSetup, running renderer.Running) error {
+	engineOpts := renderer.Options{
+		CoverFile:    cover,
+		TOCDepth:     o.engineTOCDepth(tree),
+		OutlineDepth: o.outlineDepth,
+		ChromePath:   o.chromePath,
+		Timeout:      o.renderTimeout,
+		MemoryLimit:  o.memoryLimit(),
+		Page:         setup,
+		Grayscale:    o.grayscale,
+		Zoom:         o.zoom,
+		FontSize:     o.fontSize,
+		Running:      running,
+	}
+	if o.splitRender {
+		// The header and footer are stamped on the merged chapters instead
+		engineOpts.Running = renderer.Running{}
+	}
+	r, err := renderer.New(o.engine, engineOpts)
+	if err != nil {
+		return err
+	}
+	switch {
+	case o.splitRender:
+		err = o.renderChapters(r, tree, input, output, opts, setup, running, o.jobs)
+	case o.pageRefs:
+		err = o.renderWithPageRefs(r, tree, input, output)
+	default:
+		err = r.Render(input, output)
+	}
+	if errors.Is(err, renderer.ErrKilled) && !o.splitRender {
+		slog.Warn("The engine was killed rendering the whole document, rendering it chapter by chapter instead (links between chapters are lost)", "err", err)
+		engineOpts.CoverFile, engineOpts.Running = "", renderer.Running{}
+		if r, err = renderer.New(o.engine, engineOpts); err != nil {
+			return err
+		}
+		err = o.renderChapters(r, tree, input, output, opts, setup, running, 1)
+	}
+	if err != nil {
+		return err
+	}
+	return o.embedSources(output, tree)
+}
+
+// memoryLimit returns the --render-memory in bytes, 0 for no limit
+func (o *options) memoryLimit() int64 {
+	limit, _ := parseSize(o.renderMemory)
+	return limit
+}
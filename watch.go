@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchBuild builds once, then again whenever files in --input or the
+// navigation template change, until interrupted. Changes are batched until
+// nothing changed for --watch-delay, so saving several files rebuilds once;
+// the page cache limits each rebuild to the pages that changed.
+func watchBuild(o *options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot watch for changes: %w", err)
+	}
+	defer watcher.Close()
+	if err := watchTree(watcher, o.inputDir); err != nil {
+		return err
+	}
+	navFile := o.navFile
+	if navFile == "" {
+		navFile = filepath.Join(o.repo.CloneDir, "i2p2www", "pages", "global", "nav.html")
+	}
+	if _, err := os.Stat(navFile); err == nil {
+		if err := watcher.Add(filepath.Dir(navFile)); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", navFile, err)
+		}
+	}
+
+	rebuild := func() {
+		start := time.Now()
+		if err := buildOnce(o); err != nil {
+			slog.Error("Build failed", "err", err)
+			return
+		}
+		slog.Info("Built, watching for changes", "took", time.Since(start).Round(time.Millisecond))
+	}
+	rebuild()
+
+	debounce := time.NewTimer(0)
+	<-debounce.C
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped watching")
+			return nil
+		case err := <-watcher.Errors:
+			slog.Warn("Watching for changes", "err", err)
+		case event := <-watcher.Events:
+			if ignoredChange(event.Name) {
+				continue
+			}
+			slog.Debug("Changed", "file", event.Name, "op", event.Op.String())
+			// New directories need watching too, fsnotify isn't recursive
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						slog.Warn("Cannot watch new directory", "dir", event.Name, "err", err)
+					}
+				}
+			}
+			debounce.Reset(o.watchDelay)
+		case <-debounce.C:
+			rebuild()
+		}
+	}
+}
+
+// watchTree adds root and every directory below it to watcher
+func watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// ignoredChange reports whether a changed file is an editor's temporary or
+// backup file rather than a page or image
+func ignoredChange(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".swp") || strings.HasSuffix(name, ".tmp")
+}